@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"go-processor/internal/api"
 	"go-processor/internal/config"
 	"go-processor/internal/database"
+	ingestgrpc "go-processor/internal/grpc"
+	"go-processor/internal/health"
 	"go-processor/internal/kafka"
 	"go-processor/internal/metrics"
 	"go-processor/internal/processors"
+	"go-processor/internal/sse"
+	"go-processor/internal/tracing"
 	"go-processor/internal/websocket"
 )
 
@@ -22,11 +32,30 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Cancelled on SIGINT/SIGTERM to stop the processing loops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger, err := newLogger(cfg.LogFormat)
+	if err != nil {
+		log.Fatalf("failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger)
 
 	log.Printf("Configuration loaded: Kafka=%s, Database=%s", cfg.KafkaBrokers, cfg.DatabaseURL)
 
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(ctx, cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+
 	// Initialize database connection
-	db, err := database.NewTimescaleDB(cfg.DatabaseURL)
+	db, err := database.NewTimescaleDB(cfg.DatabaseURL, cfg.MigrationsDir)
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
@@ -37,60 +66,287 @@ func main() {
 		log.Fatalf("database health check failed: %v", err)
 	}
 
+	// Fail writes fast while the database is down
+	if cfg.DBFailureThreshold > 0 {
+		db.UseCircuitBreaker(database.NewCircuitBreaker(cfg.DBFailureThreshold, cfg.DBCircuitOpenDuration))
+	}
+
 	log.Println("Database connection established")
 
+	// Export the number of devices seen in the last 5 minutes
+	go db.RecordActiveDevices(ctx, 5*time.Minute, time.Minute)
+
+	// Drop old data automatically
+	for table, days := range map[string]int{
+		"metric_aggregates": cfg.RetentionDaysAggregates,
+		"alerts":            cfg.RetentionDaysAlerts,
+	} {
+		if err := db.SetRetentionPolicy(table, days); err != nil {
+			log.Printf("Failed to set retention policy: %v", err)
+		}
+	}
+
+	// Re-aggregate old aggregates into coarser buckets every night
+	if cfg.DownsampleAfterDays > 0 {
+		go downsampleNightly(ctx, db, cfg.DownsampleAfterDays, time.Duration(cfg.DownsampleResolutionMinutes)*time.Minute)
+	}
+
+	// Create missing topics before any reader or writer uses them
+	var topics []kafka.TopicSpec
+	topicNames := []string{cfg.KafkaTopic, cfg.AggregatesTopic, cfg.AlertsTopic, cfg.DLQTopic, cfg.CommandsTopic, cfg.FleetAggregatesTopic}
+	topicNames = append(topicNames, cfg.AdditionalAggregateTopics...)
+	topicNames = append(topicNames, cfg.AdditionalAlertTopics...)
+	for _, name := range topicNames {
+		if name == "" {
+			continue
+		}
+		topics = append(topics, kafka.TopicSpec{
+			Name:              name,
+			Partitions:        cfg.KafkaPartitions,
+			ReplicationFactor: cfg.KafkaReplicationFactor,
+		})
+	}
+	if err := kafka.EnsureTopics(cfg.Brokers, topics); err != nil {
+		log.Fatalf("failed to create Kafka topics: %v", err)
+	}
+
+	kafkaHealth := kafka.NewHealthChecker(cfg.Brokers, cfg.KafkaTopic)
+
+	// Components reported by /health
+	healthRegistry := health.NewRegistry()
+	healthRegistry.Register("database", db)
+	healthRegistry.Register(metrics.ProcessorAggregator, health.NewProcessorChecker(metrics.ProcessorAggregator))
+	healthRegistry.Register(metrics.ProcessorAnomalyDetector, health.NewProcessorChecker(metrics.ProcessorAnomalyDetector))
+
+	producerOpts, err := kafka.ProducerOptionsFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to configure Kafka producer: %v", err)
+	}
+
+	// Commands sent by WebSocket clients go to the commands topic
+	commandProducer := kafka.NewCommandProducer(cfg.Brokers, cfg.CommandsTopic, producerOpts)
+	defer commandProducer.Close()
+
 	// Initialize WebSocket server
-	wsServer := websocket.NewServer(cfg.WebSocketPort)
+	wsServer := websocket.NewServer(cfg.WebSocketPort, websocket.ServerOptions{
+		JWTSecret:        cfg.JWTSecret,
+		Compression:      cfg.CompressionEnabled,
+		PingInterval:     cfg.PingInterval,
+		PongTimeout:      cfg.PongTimeout,
+		Health:           healthRegistry,
+		ReplayBufferSize: cfg.ReplayBufferSize,
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		Commands:         commandProducer,
+	})
 	go wsServer.Run()
 
 	log.Printf("WebSocket server started on %s", cfg.WebSocketPort)
 
+	// API keys protect the REST API and the SSE streams
+	var apiKeys *api.APIKeys
+	if cfg.APIKeysFile != "" {
+		apiKeys, err = api.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			log.Fatalf("failed to load API keys: %v", err)
+		}
+	}
+
+	// Initialize SSE server, fed by the same broadcasts as WebSocket clients
+	sseServer := sse.NewSSEServer(cfg.SSEPort, cfg.JWTSecret, apiKeys)
+	wsServer.AddSubscriber(sseServer.Hub().Broadcast())
+	go sseServer.Run()
+
+	log.Printf("SSE server started on %s", cfg.SSEPort)
+
 	// Start Prometheus metrics server
 	go metrics.Serve(cfg.MetricsPort)
 
 	log.Printf("Metrics server started on %s", cfg.MetricsPort)
 
-	// Create Kafka consumer for raw events
-	consumer, err := kafka.NewConsumer(cfg)
+	// Serve API reads through the Redis cache when configured
+	var store api.Store = db
+	if cfg.RedisURL != "" {
+		cachingDB, err := database.NewCachingTimescaleDB(db, cfg.RedisURL)
+		if err != nil {
+			log.Fatalf("failed to connect to Redis: %v", err)
+		}
+		defer cachingDB.CloseCache()
+		store = cachingDB
+
+		log.Println("Redis aggregate cache enabled")
+	}
+
+	// Start REST API server
+	apiServer := api.NewServer(cfg.APIPort, store, api.ServerOptions{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		RateLimit:      cfg.APIRateLimit,
+		RateBurst:      cfg.APIRateBurst,
+		APIKeys:        apiKeys,
+		DeviceStream:   http.HandlerFunc(sseServer.HandleDeviceStream),
+	})
+	go apiServer.Run()
+
+	log.Printf("API server started on %s", cfg.APIPort)
+
+	// Start gRPC ingestion server, publishing to the raw events topic
+	ingestProducer := kafka.NewProducer(cfg.Brokers, cfg.KafkaTopic, producerOpts)
+	defer ingestProducer.Close()
+
+	grpcServer := ingestgrpc.NewServer(cfg.GRPCPort, ingestProducer)
+	go grpcServer.Run()
+
+	log.Printf("gRPC server started on %s", cfg.GRPCPort)
+
+	if cfg.SourceType == kafka.SourceTypeKafka {
+		// Fail fast rather than log read errors until the broker appears
+		if err := kafkaHealth.HealthCheck(ctx, 30*time.Second); err != nil {
+			log.Fatalf("Kafka health check failed: %v", err)
+		}
+	}
+
+	// Alert on devices that stop reporting
+	offlineDetector := processors.NewOfflineDetector(cfg, db, wsServer, logger.With(slog.String("processor", "offline")))
+	offlineDetector.Start(ctx)
+
+	// Alert on devices that miss their expected reporting intervals
+	gapDetector := processors.NewGapDetector(cfg, db, wsServer, logger.With(slog.String("processor", "gap")))
+	gapDetector.Start(ctx)
+
+	// Alert on batteries projected to run out within two days
+	batteryAnalyzer := processors.NewBatteryTrendAnalyzer(db, wsServer, logger.With(slog.String("processor", "battery_trend")))
+	batteryAnalyzer.Start(ctx)
+
+	// Create Kafka consumer for minute aggregates feeding the rollups
+	rollupReader := kafka.NewReader(cfg.Brokers, cfg.RollupGroupID, cfg.AggregatesTopic)
+	defer rollupReader.Close()
+
+	// And for the same aggregates feeding the fleet aggregates
+	fleetReader := kafka.NewReader(cfg.Brokers, cfg.FleetGroupID, cfg.AggregatesTopic)
+	defer fleetReader.Close()
+
+	// Register the raw telemetry processors
+	registry := processors.NewProcessorRegistry(logger)
+
+	aggregator, err := processors.NewAggregator(cfg, db, logger.With(slog.String("processor", "aggregator")))
 	if err != nil {
-		log.Fatalf("failed to create Kafka consumer: %v", err)
+		log.Printf("Failed to create aggregator: %v", err)
+	} else {
+		aggregator.GapDetector = gapDetector
+		aggregator.ShadowSync = processors.NewShadowSync(db, wsServer)
+
+		// Stream sub-minute aggregates to dashboards that ask for them
+		realtimeAggregator := websocket.NewRealtimeAggregator(wsServer)
+		realtimeAggregator.Start(ctx)
+		defer realtimeAggregator.Stop()
+		aggregator.Observers = append(aggregator.Observers, realtimeAggregator)
+
+		// MQTT messages have no offsets to deduplicate by
+		if cfg.SourceType == kafka.SourceTypeKafka && cfg.DedupWindow > 0 {
+			dedup := kafka.NewDeduplicator(cfg.DedupWindow)
+			dedup.Start(ctx)
+			defer dedup.Stop()
+			aggregator.Deduplicator = dedup
+		}
+
+		registry.RegisterProcessorLoop(aggregator, func(ctx context.Context, source kafka.MessageSource) {
+			processors.StartAggregationLoop(ctx, source, cfg, aggregator, wsServer, cfg.AggregationWorkers)
+
+			// Drain in-flight windows before Stop closes the producer
+			aggregator.Flush()
+		})
 	}
-	defer consumer.Close()
 
-	log.Println("Kafka consumer created")
+	detector, err := processors.NewDetector(cfg, db, logger.With(slog.String("processor", "anomaly")))
+	if err != nil {
+		log.Printf("Failed to create anomaly detector: %v", err)
+	} else {
+		log.Printf("Using %s anomaly detector", cfg.DetectorType)
+
+		// Apply changes to the config file without a restart
+		if cfg.ConfigFile != "" {
+			configWatcher, err := config.NewConfigWatcher(cfg.ConfigFile, cfg)
+			if err != nil {
+				log.Fatalf("failed to watch config file: %v", err)
+			}
+			configWatcher.Start(ctx)
+			defer configWatcher.Stop()
+
+			go func() {
+				for {
+					select {
+					case updated := <-configWatcher.Updates():
+						detector.UpdateConfig(updated)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		registry.RegisterProcessorLoop(detector, func(ctx context.Context, source kafka.MessageSource) {
+			processors.StartAnomalyDetectionLoop(ctx, source, cfg, detector, db, wsServer)
+		})
+	}
+
+	// Each processor reads the raw events, from Kafka or MQTT, through its own
+	// source
+	var aggregatorSource kafka.MessageSource
+	err = registry.Start(ctx, func(processor string) (kafka.MessageSource, error) {
+		source, err := kafka.NewMessageSource(cfg, processor)
+		if processor == metrics.ProcessorAggregator {
+			aggregatorSource = source
+		}
+		return source, err
+	})
+	if err != nil {
+		log.Fatalf("failed to create message source: %v", err)
+	}
+
+	log.Printf("%s message sources created", cfg.SourceType)
+
+	if cfg.SourceType == kafka.SourceTypeKafka {
+		// Monitor the aggregator's consumer lag on the raw events topic
+		lagMonitor := kafka.NewLagMonitor(cfg.Brokers, kafka.ProcessorGroupID(cfg, metrics.ProcessorAggregator), cfg.KafkaTopic)
+		lagMonitor.Start(ctx)
+		defer lagMonitor.Stop()
+
+		kafkaHealth.LagMonitor = lagMonitor
+		kafkaHealth.Source, _ = aggregatorSource.(*kafka.ReaderSource)
+	}
+	healthRegistry.Register("kafka", kafkaHealth)
 
-	// Start processing loops
-	aggregatorDone := make(chan bool)
-	anomalyDone := make(chan bool)
+	rollupDone := make(chan struct{})
 
-	// Start aggregation processor
+	// Start hourly/daily rollup processor
 	go func() {
-		defer func() { aggregatorDone <- true }()
-		log.Println("Starting aggregation processor...")
+		defer close(rollupDone)
+		log.Println("Starting rollup processor...")
 
-		aggregator, err := processors.NewAggregator(cfg, db)
+		rollup, err := processors.NewRollupProcessor(cfg, db, logger.With(slog.String("processor", "rollup")))
 		if err != nil {
-			log.Printf("Failed to create aggregator: %v", err)
+			log.Printf("Failed to create rollup processor: %v", err)
 			return
 		}
-		defer aggregator.Stop()
+		defer rollup.Stop()
 
-		processors.StartAggregationLoop(consumer, cfg, aggregator, wsServer)
+		processors.StartRollupLoop(ctx, rollupReader, cfg, rollup)
 	}()
 
-	// Start anomaly detection processor
+	fleetDone := make(chan struct{})
+
+	// Combine device aggregates into fleet-wide aggregates
 	go func() {
-		defer func() { anomalyDone <- true }()
-		log.Println("Starting anomaly detection processor...")
+		defer close(fleetDone)
 
-		detector, err := processors.NewAnomalyDetector(cfg, db)
+		fleet, err := processors.NewFleetAggregator(cfg, logger.With(slog.String("processor", "fleet")))
 		if err != nil {
-			log.Printf("Failed to create anomaly detector: %v", err)
+			log.Printf("Failed to create fleet aggregator: %v", err)
 			return
 		}
-		defer detector.Stop()
+		fleet.Start(ctx)
+		defer fleet.Stop()
 
-		processors.StartAnomalyDetectionLoop(consumer, cfg, detector, wsServer)
+		processors.StartFleetAggregationLoop(ctx, fleetReader, fleet)
 	}()
 
 	log.Println("All processors started successfully")
@@ -103,16 +359,82 @@ func main() {
 	sig := <-sigs
 	log.Printf("Received signal %s, initiating graceful shutdown...", sig)
 
+	// Stop accepting new telemetry
+	grpcCtx, grpcCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := grpcServer.Stop(grpcCtx); err != nil {
+		log.Printf("gRPC server shutdown error: %v", err)
+	}
+	grpcCancel()
+
+	// Stop the processing loops
+	cancel()
+
+	// Wait for processors to finish before tearing down their dependencies
+	log.Println("Waiting for processors to finish...")
+	registry.Stop()
+	<-rollupDone
+	<-fleetDone
+	offlineDetector.Stop()
+	gapDetector.Stop()
+	batteryAnalyzer.Stop()
+
+	// Stop API and SSE servers
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := apiServer.Stop(shutdownCtx); err != nil {
+		log.Printf("API server shutdown error: %v", err)
+	}
+	if err := sseServer.Stop(shutdownCtx); err != nil {
+		log.Printf("SSE server shutdown error: %v", err)
+	}
+	shutdownCancel()
+
 	// Stop WebSocket server
 	wsServer.Stop()
 
 	// Close database connection
 	db.Close()
 
-	// Wait for processors to finish
-	log.Println("Waiting for processors to finish...")
-	<-aggregatorDone
-	<-anomalyDone
+	// Flush pending spans
+	tracingCtx, tracingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Printf("Tracing shutdown error: %v", err)
+	}
+	tracingCancel()
 
 	log.Println("Go Processor Service stopped gracefully")
 }
+
+// downsampleNightly downsamples the aggregates older than afterDays at
+// startup and then every 24 hours, until ctx is cancelled. Everything older
+// is covered each time, so a missed night is caught up on the next one.
+func downsampleNightly(ctx context.Context, db *database.TimescaleDB, afterDays int, resolution time.Duration) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		// Ending on a bucket boundary keeps a bucket from being split between runs
+		to := time.Now().AddDate(0, 0, -afterDays).Truncate(resolution)
+		if err := db.Downsample("metric_aggregates", time.Unix(0, 0), to, resolution); err != nil {
+			log.Printf("Failed to downsample aggregates: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newLogger builds the service logger for LOG_FORMAT, which is either "json"
+// or "text".
+func newLogger(format string) (*slog.Logger, error) {
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, nil)), nil
+	case "text", "":
+		return slog.New(slog.NewTextHandler(os.Stdout, nil)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
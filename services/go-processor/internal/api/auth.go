@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	// ErrMissingAPIKey is returned when a request carries no API key.
+	ErrMissingAPIKey = errors.New("missing API key")
+
+	// ErrInvalidAPIKey is returned for API keys that are not configured.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// APIKeyRecord describes the holder of an API key.
+type APIKeyRecord struct {
+	Name        string    `json:"name"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// APIKeys holds the API keys accepted by the REST API.
+type APIKeys struct {
+	keys map[string]APIKeyRecord
+}
+
+func NewAPIKeys(keys map[string]APIKeyRecord) *APIKeys {
+	return &APIKeys{keys: keys}
+}
+
+// LoadAPIKeys reads a JSON file mapping each API key to its record:
+//
+//	{"3f9c...": {"name": "dashboard", "permissions": ["read"], "created_at": "2024-01-01T00:00:00Z"}}
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys map[string]APIKeyRecord
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+	for key, record := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("API keys file contains an empty key")
+		}
+		if record.Name == "" {
+			return nil, fmt.Errorf("API key record without a name")
+		}
+	}
+	return NewAPIKeys(keys), nil
+}
+
+// ValidateAPIKey returns the record of key, or ErrInvalidAPIKey. Keys are
+// compared in constant time so response times don't reveal them.
+func (k *APIKeys) ValidateAPIKey(key string) (*APIKeyRecord, error) {
+	if key == "" {
+		return nil, ErrMissingAPIKey
+	}
+
+	var match *APIKeyRecord
+	for candidate, record := range k.keys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			match = &record
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return match, nil
+}
+
+// APIKeyFromRequest returns the key of the X-API-Key header, falling back to
+// the api_key query parameter.
+func APIKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("api_key")
+}
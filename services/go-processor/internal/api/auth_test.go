@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-keys.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"dashboard-key": {"name": "dashboard", "permissions": ["read"], "created_at": "2024-01-01T00:00:00Z"}
+	}`), 0o600))
+
+	keys, err := LoadAPIKeys(path)
+	assert.NoError(t, err)
+
+	record, err := keys.ValidateAPIKey("dashboard-key")
+	assert.NoError(t, err)
+	assert.Equal(t, &APIKeyRecord{
+		Name:        "dashboard",
+		Permissions: []string{"read"},
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, record)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"nameless-key": {}}`), 0o600))
+	_, err = LoadAPIKeys(path)
+	assert.Error(t, err)
+
+	_, err = LoadAPIKeys(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	keys := NewAPIKeys(map[string]APIKeyRecord{"dashboard-key": {Name: "dashboard"}})
+
+	_, err := keys.ValidateAPIKey("")
+	assert.ErrorIs(t, err, ErrMissingAPIKey)
+
+	_, err = keys.ValidateAPIKey("dashboard-ke")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	record, err := keys.ValidateAPIKey("dashboard-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "dashboard", record.Name)
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := NewAPIKeys(map[string]APIKeyRecord{"dashboard-key": {Name: "dashboard"}})
+	var logs bytes.Buffer
+	handler := APIKeyAuth(keys, slog.New(slog.NewTextHandler(&logs, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		target   string
+		header   string
+		wantCode int
+		wantBody string
+	}{
+		{"missing key", "/api/v1/devices", "", http.StatusUnauthorized, "missing API key"},
+		{"invalid key", "/api/v1/devices", "wrong-key", http.StatusUnauthorized, "invalid API key"},
+		{"valid key", "/api/v1/devices", "dashboard-key", http.StatusOK, ""},
+		{"valid key in query", "/api/v1/devices?api_key=dashboard-key", "", http.StatusOK, ""},
+		{"invalid key in query", "/api/v1/devices?api_key=wrong-key", "", http.StatusUnauthorized, "invalid API key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+
+	// Attempts are logged to the given logger
+	assert.Contains(t, logs.String(), "API authentication failed")
+	assert.Contains(t, logs.String(), "key_name=dashboard")
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/graphql-go/graphql"
+)
+
+// graphQLRequest is a GraphQL query, sent as the JSON body of a POST or as
+// the query, variables and operationName parameters of a GET.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+var metricAggregateType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "MetricAggregate",
+	Fields: graphql.Fields{
+		"deviceId":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"metricName":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"function":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"value":       &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"sampleCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"timestamp":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"windowStart": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"windowEnd":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+	},
+})
+
+var alertType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Alert",
+	Fields: graphql.Fields{
+		"id":             &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"deviceId":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"timestamp":      &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"metricName":     &graphql.Field{Type: graphql.String},
+		"metricValue":    &graphql.Field{Type: graphql.Float},
+		"alertType":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"severity":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"zScore":         &graphql.Field{Type: graphql.Float},
+		"threshold":      &graphql.Field{Type: graphql.Float},
+		"status":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"message":        &graphql.Field{Type: graphql.String},
+		"acknowledgedAt": &graphql.Field{Type: graphql.DateTime},
+		"acknowledgedBy": &graphql.Field{Type: graphql.String},
+		"resolvedAt":     &graphql.Field{Type: graphql.DateTime},
+		"resolvedBy":     &graphql.Field{Type: graphql.String},
+		"notes":          &graphql.Field{Type: graphql.String},
+	},
+})
+
+// newGraphQLSchema builds the schema documented in schema.graphql, resolved
+// against store.
+func newGraphQLSchema(store Store) (graphql.Schema, error) {
+	deviceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Device",
+		Fields: graphql.Fields{
+			"deviceId":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"deviceName":      &graphql.Field{Type: graphql.String},
+			"deviceType":      &graphql.Field{Type: graphql.String},
+			"location":        &graphql.Field{Type: graphql.String},
+			"status":          &graphql.Field{Type: graphql.String},
+			"firmwareVersion": &graphql.Field{Type: graphql.String},
+			"lastSeen":        &graphql.Field{Type: graphql.DateTime},
+			"createdAt":       &graphql.Field{Type: graphql.DateTime},
+			"updatedAt":       &graphql.Field{Type: graphql.DateTime},
+			"aggregates": &graphql.Field{
+				Type: graphql.NewList(metricAggregateType),
+				Args: graphql.FieldConfigArgument{
+					"metric": &graphql.ArgumentConfig{Type: graphql.String},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultAggregateLimit},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, err := graphQLLimit(p.Args["limit"])
+					if err != nil {
+						return nil, err
+					}
+					metric, _ := p.Args["metric"].(string)
+					deviceID := p.Source.(map[string]interface{})["deviceId"].(string)
+
+					aggregates, _, err := store.GetAggregatesPage(deviceID, metric, time.Time{}, limit)
+					if err != nil {
+						return nil, fmt.Errorf("failed to query aggregates: %w", err)
+					}
+					objects := make([]map[string]interface{}, len(aggregates))
+					for i, aggregate := range aggregates {
+						objects[i] = aggregateObject(aggregate)
+					}
+					return objects, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"device": &graphql.Field{
+				Type: deviceType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					device, err := store.GetDevice(p.Args["id"].(string))
+					if errors.Is(err, database.ErrDeviceNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, fmt.Errorf("failed to get device: %w", err)
+					}
+					return deviceObject(device), nil
+				},
+			},
+			"alerts": &graphql.Field{
+				Type: graphql.NewList(alertType),
+				Args: graphql.FieldConfigArgument{
+					"deviceId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"status":   &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: defaultAlertStatus},
+					"limit":    &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultAlertLimit},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, err := graphQLLimit(p.Args["limit"])
+					if err != nil {
+						return nil, err
+					}
+
+					alerts, _, err := store.GetAlertsPage(p.Args["deviceId"].(string), p.Args["status"].(string), time.Time{}, limit)
+					if err != nil {
+						return nil, fmt.Errorf("failed to query alerts: %w", err)
+					}
+					objects := make([]map[string]interface{}, len(alerts))
+					for i, alert := range alerts {
+						objects[i] = alertObject(alert)
+					}
+					return objects, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// GraphQLHandler executes GraphQL queries against schema and writes the
+// result, including any query errors, as JSON.
+func GraphQLHandler(schema graphql.Schema) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request graphQLRequest
+		if r.Method == http.MethodGet {
+			query := r.URL.Query()
+			request.Query = query.Get("query")
+			request.OperationName = query.Get("operationName")
+			if variables := query.Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+					writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid variables: %v", err))
+					return
+				}
+			}
+		} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid GraphQL request: %v", err))
+			return
+		}
+		if request.Query == "" {
+			writeError(w, http.StatusBadRequest, "query is required")
+			return
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  request.Query,
+			VariableValues: request.Variables,
+			OperationName:  request.OperationName,
+			Context:        r.Context(),
+		})
+		writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// graphQLLimit validates a limit argument as limitParam does.
+func graphQLLimit(arg interface{}) (int, error) {
+	limit, _ := arg.(int)
+	if limit <= 0 {
+		return 0, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	return min(limit, maxLimit), nil
+}
+
+func deviceObject(device *database.DeviceRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"deviceId":        device.DeviceID,
+		"deviceName":      device.DeviceName,
+		"deviceType":      device.DeviceType,
+		"location":        device.Location,
+		"status":          device.Status,
+		"firmwareVersion": device.FirmwareVersion,
+		"lastSeen":        optionalTime(device.LastSeen),
+		"createdAt":       device.CreatedAt,
+		"updatedAt":       device.UpdatedAt,
+	}
+}
+
+func aggregateObject(aggregate database.AggregateRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"deviceId":    aggregate.DeviceID,
+		"metricName":  aggregate.MetricName,
+		"function":    aggregate.Function,
+		"value":       aggregate.MetricValue,
+		"sampleCount": aggregate.SampleCount,
+		"timestamp":   aggregate.Timestamp,
+		"windowStart": aggregate.WindowStart,
+		"windowEnd":   aggregate.WindowEnd,
+	}
+}
+
+func alertObject(alert database.AlertRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             alert.ID,
+		"deviceId":       alert.DeviceID,
+		"timestamp":      alert.Timestamp,
+		"metricName":     alert.MetricName,
+		"metricValue":    alert.MetricValue,
+		"alertType":      alert.AlertType,
+		"severity":       alert.Severity,
+		"zScore":         alert.ZScore,
+		"threshold":      alert.Threshold,
+		"status":         alert.Status,
+		"message":        alert.Message,
+		"acknowledgedAt": optionalTime(alert.AcknowledgedAt),
+		"acknowledgedBy": alert.AcknowledgedBy,
+		"resolvedAt":     optionalTime(alert.ResolvedAt),
+		"resolvedBy":     alert.ResolvedBy,
+		"notes":          alert.Notes,
+	}
+}
+
+// optionalTime returns nil for a nil t, so it resolves to null.
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// postGraphQL sends query with variables to a test server backed by store and
+// returns the status code and body of the response.
+func postGraphQL(t *testing.T, store Store, query string, variables map[string]interface{}) (int, string) {
+	t.Helper()
+	server := httptest.NewServer(NewServer(":0", store, ServerOptions{}).Routes())
+	defer server.Close()
+
+	body, err := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	assert.NoError(t, err)
+	resp, err := http.Post(server.URL+"/api/graphql", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+func TestGraphQL_Device(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeStore{
+		devices: map[string]*database.DeviceRecord{
+			"sensor-1": {DeviceID: "sensor-1", DeviceName: "Boiler room", Status: "active", CreatedAt: ts, UpdatedAt: ts},
+		},
+		aggregates: []database.AggregateRecord{{
+			DeviceID:    "sensor-1",
+			Timestamp:   ts,
+			WindowStart: ts.Add(-time.Minute),
+			WindowEnd:   ts,
+			MetricName:  "temperature",
+			MetricValue: 21.5,
+			SampleCount: 60,
+			Function:    "mean",
+		}},
+	}
+
+	status, body := postGraphQL(t, store, `
+		query($id: String!) {
+			device(id: $id) {
+				deviceId
+				deviceName
+				lastSeen
+				aggregates(metric: "temperature", limit: 5) { metricName function value sampleCount windowEnd }
+			}
+		}`, map[string]interface{}{"id": "sensor-1"})
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"data": {"device": {
+		"deviceId": "sensor-1",
+		"deviceName": "Boiler room",
+		"lastSeen": null,
+		"aggregates": [{"metricName": "temperature", "function": "mean", "value": 21.5, "sampleCount": 60, "windowEnd": "2024-01-01T12:00:00Z"}]
+	}}}`, body)
+	assert.Equal(t, "temperature", store.metric)
+	assert.Equal(t, 5, store.limit)
+}
+
+func TestGraphQL_DeviceNotFound(t *testing.T) {
+	status, body := postGraphQL(t, &fakeStore{}, `{ device(id: "missing") { deviceId } }`, nil)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"data": {"device": null}}`, body)
+}
+
+func TestGraphQL_Alerts(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeStore{alerts: []database.AlertRecord{{
+		ID:          7,
+		DeviceID:    "sensor-1",
+		Timestamp:   ts,
+		MetricName:  "temperature",
+		MetricValue: 80,
+		AlertType:   "anomaly",
+		Severity:    "high",
+		Status:      "acknowledged",
+	}}}
+
+	status, body := postGraphQL(t, store, `{
+		alerts(deviceId: "sensor-1", status: "acknowledged", limit: 5000) { id severity timestamp acknowledgedAt }
+	}`, nil)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"data": {"alerts": [
+		{"id": 7, "severity": "high", "timestamp": "2024-01-01T12:00:00Z", "acknowledgedAt": null}
+	]}}`, body)
+	assert.Equal(t, "sensor-1", store.deviceID)
+	assert.Equal(t, "acknowledged", store.status)
+	assert.Equal(t, maxLimit, store.limit)
+}
+
+func TestGraphQL_AlertsDefaults(t *testing.T) {
+	store := &fakeStore{}
+
+	rec := serve(store, "/api/graphql?query="+url.QueryEscape(`{ alerts(deviceId: "sensor-1") { id } }`))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data": {"alerts": []}}`, rec.Body.String())
+	assert.Equal(t, defaultAlertStatus, store.status)
+	assert.Equal(t, defaultAlertLimit, store.limit)
+}
+
+func TestGraphQL_Errors(t *testing.T) {
+	status, body := postGraphQL(t, &fakeStore{err: errors.New("connection refused")},
+		`{ alerts(deviceId: "sensor-1") { id } }`, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "failed to query alerts")
+
+	status, body = postGraphQL(t, &fakeStore{}, `{ device { deviceId } }`, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"errors"`)
+
+	rec := serveRequest(&fakeStore{}, http.MethodPost, "/api/graphql", "not json")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(&fakeStore{}, "/api/graphql")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
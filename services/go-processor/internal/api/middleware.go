@@ -0,0 +1,317 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-processor/internal/metrics"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	corsAllowedMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, X-API-Key"
+)
+
+// CORSMiddleware lets browsers on allowedOrigins call the wrapped handler
+// from another origin. "*" allows every origin. Preflight requests are
+// answered directly: 204 for allowed origins and 403 for the rest. Requests
+// from other origins are served without CORS headers, so browsers hide the
+// response from them.
+func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			allowed := OriginAllowed(allowedOrigins, origin)
+			if allowed {
+				if containsWildcard(allowedOrigins) {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				if allowed {
+					w.WriteHeader(http.StatusNoContent)
+				} else {
+					w.WriteHeader(http.StatusForbidden)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OriginAllowed reports whether origin, e.g. "https://dashboard.example.com",
+// is one of allowedOrigins or they contain "*". Origins are compared without
+// regard to case or a trailing slash.
+func OriginAllowed(allowedOrigins []string, origin string) bool {
+	origin = normalizeOrigin(origin)
+	for _, allowed := range allowedOrigins {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || normalizeOrigin(allowed) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// SameOrigin reports whether the Origin header of r matches its Host, as for
+// a page served by the same server.
+func SameOrigin(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func containsWildcard(allowedOrigins []string) bool {
+	for _, allowed := range allowedOrigins {
+		if strings.TrimSpace(allowed) == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
+
+// LoggingMiddleware logs the method, path, status code, response size and
+// latency of every request, and observes the latency in
+// api_request_duration_seconds.
+func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			latency := time.Since(start)
+
+			metrics.APIRequestDuration.WithLabelValues(r.Method, routePath(r)).Observe(latency.Seconds())
+			logger.Info("API request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", recorder.Status()),
+				slog.Int("size", recorder.size),
+				slog.Duration("latency", latency))
+		})
+	}
+}
+
+// statusRecorder remembers the status code and number of body bytes written
+// through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Flush lets streaming handlers, such as the device event stream, flush
+// through the recorder.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Status returns the status code of the response, 200 if the handler wrote
+// none.
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// routePath returns the path pattern of the route that served r, e.g.
+// "/api/v1/devices/{device_id}", so device IDs don't become metric labels.
+// Requests that matched no route, or were rejected before routing, are
+// reported as "unmatched".
+func routePath(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	// Patterns may start with a method, as in "GET /api/v1/devices"
+	if _, path, found := strings.Cut(r.Pattern, " "); found {
+		return path
+	}
+	return r.Pattern
+}
+
+// APIKeyAuth rejects requests without a valid API key in the X-API-Key
+// header or api_key query parameter with 401 Unauthorized, logging
+// authentication attempts to logger.
+func APIKeyAuth(keys *APIKeys, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			record, err := keys.ValidateAPIKey(APIKeyFromRequest(r))
+			if err != nil {
+				logger.Warn("API authentication failed",
+					slog.String("remote_addr", r.RemoteAddr), slog.Any("error", err))
+				writeError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			logger.Info("Authenticated API request",
+				slog.String("key_name", record.Name),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Clients that have not made a request for rateLimiterIdleTimeout lose their
+// limiter, which is checked for every rateLimiterCleanupInterval.
+const (
+	rateLimiterIdleTimeout     = 10 * time.Minute
+	rateLimiterCleanupInterval = time.Minute
+)
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter throttles requests per client IP with a token bucket of Burst
+// requests refilled at Limit requests per second. Requests over the limit get
+// 429 Too Many Requests with a Retry-After header.
+type RateLimiter struct {
+	Limit rate.Limit
+	Burst int
+
+	clients map[string]*clientLimiter
+	mutex   sync.Mutex
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewRateLimiter returns a RateLimiter whose idle clients are evicted in the
+// background until Stop is called.
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		Limit:   rate.Limit(requestsPerSecond),
+		Burst:   burst,
+		clients: make(map[string]*clientLimiter),
+		stop:    make(chan struct{}),
+	}
+	go rl.cleanupLoop()
+	return rl
+}
+
+// Middleware rate limits the requests to next.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		reservation := rl.limiter(clientIP(r), now).ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+			reservation.CancelAt(now)
+			metrics.RateLimitExceeded.Inc()
+
+			retryAfter := 1
+			if reservation.OK() {
+				retryAfter = max(1, int(math.Ceil(delay.Seconds())))
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stop ends the eviction of idle clients.
+func (rl *RateLimiter) Stop() {
+	rl.once.Do(func() { close(rl.stop) })
+}
+
+// limiter returns the limiter of the client at ip, creating it if needed.
+func (rl *RateLimiter) limiter(ip string, now time.Time) *rate.Limiter {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	client, ok := rl.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(rl.Limit, rl.Burst)}
+		rl.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
+
+func (rl *RateLimiter) cleanupLoop() {
+	ticker := time.NewTicker(rateLimiterCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			rl.evictIdle(now.Add(-rateLimiterIdleTimeout))
+		case <-rl.stop:
+			return
+		}
+	}
+}
+
+// evictIdle drops the limiters of clients last seen before cutoff.
+func (rl *RateLimiter) evictIdle(cutoff time.Time) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	for ip, client := range rl.clients {
+		if client.lastSeen.Before(cutoff) {
+			delete(rl.clients, ip)
+		}
+	}
+}
+
+// clientIP returns the IP address of the client that sent r. Forwarding
+// headers are ignored, as clients can set them to anything.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-processor/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveCORS(allowedOrigins []string, method, origin string) *httptest.ResponseRecorder {
+	handler := CORSMiddleware(allowedOrigins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(method, "/api/v1/devices", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSMiddleware_AllowedOrigin(t *testing.T) {
+	allowed := []string{"https://dashboard.example.com", "http://localhost:3000"}
+
+	rec := serveCORS(allowed, http.MethodGet, "http://localhost:3000")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "http://localhost:3000", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type, X-API-Key", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+
+	rec = serveCORS(allowed, http.MethodOptions, "https://dashboard.example.com")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://dashboard.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_DisallowedOrigin(t *testing.T) {
+	allowed := []string{"https://dashboard.example.com"}
+
+	rec := serveCORS(allowed, http.MethodGet, "https://evil.example.com")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Methods"))
+
+	rec = serveCORS(allowed, http.MethodOptions, "https://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// Nothing is allowed when no origins are configured
+	rec = serveCORS(nil, http.MethodGet, "https://dashboard.example.com")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_Wildcard(t *testing.T) {
+	rec := serveCORS([]string{"*"}, http.MethodGet, "https://anywhere.example.com")
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_SameOriginRequestsUntouched(t *testing.T) {
+	rec := serveCORS([]string{"*"}, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{" https://Dashboard.example.com/ "}
+	assert.True(t, OriginAllowed(allowed, "https://dashboard.example.com"))
+	assert.False(t, OriginAllowed(allowed, "http://dashboard.example.com"))
+	assert.False(t, OriginAllowed(allowed, "https://dashboard.example.com:8443"))
+}
+
+func sendFrom(handler http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/devices", nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimiter_RejectsRequestsOverTheBurst(t *testing.T) {
+	limiter := NewRateLimiter(0.5, 3)
+	defer limiter.Stop()
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	exceededBefore := testutil.ToFloat64(metrics.RateLimitExceeded)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, sendFrom(handler, "203.0.113.7:40000").Code)
+	}
+
+	// Another port of the same client shares its limit
+	rec := sendFrom(handler, "203.0.113.7:40001")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, exceededBefore+1, testutil.ToFloat64(metrics.RateLimitExceeded))
+
+	// Other clients are unaffected
+	assert.Equal(t, http.StatusOK, sendFrom(handler, "198.51.100.1:40000").Code)
+}
+
+func TestRateLimiter_EvictsIdleClients(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	defer limiter.Stop()
+
+	now := time.Now()
+	limiter.limiter("203.0.113.7", now.Add(-time.Hour))
+	limiter.limiter("198.51.100.1", now)
+
+	limiter.evictIdle(now.Add(-rateLimiterIdleTimeout))
+
+	assert.NotContains(t, limiter.clients, "203.0.113.7")
+	assert.Contains(t, limiter.clients, "198.51.100.1")
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/devices/{device_id}", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "device not found")
+	})
+	handler := LoggingMiddleware(logger)(mux)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/devices/sensor-1", nil))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "API request", entry["msg"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/api/v1/devices/sensor-1", entry["path"])
+	assert.Equal(t, float64(http.StatusNotFound), entry["status"])
+	assert.Equal(t, float64(rec.Body.Len()), entry["size"])
+	assert.Contains(t, entry, "latency")
+
+	// The histogram is labeled by route, not by device
+	assert.True(t, metrics.APIRequestDuration.DeleteLabelValues("GET", "/api/v1/devices/{device_id}"))
+}
+
+func TestLoggingMiddleware_DefaultStatus(t *testing.T) {
+	var logs bytes.Buffer
+	handler := LoggingMiddleware(slog.New(slog.NewJSONHandler(&logs, nil)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Equal(t, float64(2), entry["size"])
+	assert.True(t, metrics.APIRequestDuration.DeleteLabelValues("GET", "unmatched"))
+}
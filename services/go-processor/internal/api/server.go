@@ -0,0 +1,723 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-processor/internal/database"
+)
+
+const (
+	defaultAggregateHours = 24
+	defaultAggregateLimit = 100
+	defaultAlertStatus    = "open"
+	defaultAlertLimit     = 50
+	defaultDeviceLimit    = 100
+	defaultSummaryRange   = 24 * time.Hour
+	defaultExportRange    = 24 * time.Hour
+	defaultAnomalyHours   = 24
+	defaultAnomalyTop     = 10
+	defaultFleetHours     = 1
+	maxLimit              = 1000
+)
+
+// Store is the subset of TimescaleDB used by the API.
+type Store interface {
+	GetAggregatesPage(deviceID, metricName string, before time.Time, limit int) ([]database.AggregateRecord, time.Time, error)
+	GetAlertsPage(deviceID, status string, before time.Time, limit int) ([]database.AlertRecord, time.Time, error)
+	GetAuditLog(alertID int) ([]database.AlertAuditEntry, error)
+
+	RegisterDevice(device database.DeviceRecord) error
+	UpdateDeviceMetadata(deviceID string, metadata map[string]interface{}) error
+	GetDevice(deviceID string) (*database.DeviceRecord, error)
+	ListDevices(status string, limit, offset int) ([]database.DeviceRecord, error)
+	GetDevicesByBoundingBox(minLat, maxLat, minLon, maxLon float64) ([]database.DeviceRecord, error)
+	DeleteDevice(deviceID string) error
+
+	GetDeviceShadow(deviceID string) (*database.DeviceShadow, error)
+	UpdateDesiredState(deviceID string, desired map[string]interface{}) error
+
+	GetDeviceSummary(deviceID string, metricNames []string, from, to time.Time) (map[string]database.MetricSummary, error)
+	GetTopAnomalousMetrics(deviceID string, hours int, topN int) ([]database.MetricAnomalyCount, error)
+	GetFleetSummary(hours int) (map[string]database.FleetMetricSummary, error)
+
+	ExportAggregatesCSV(w io.Writer, deviceID string, from, to time.Time) error
+	ExportAlertsCSV(w io.Writer, deviceID string, from, to time.Time) error
+}
+
+// pageResponse is the envelope of paginated endpoints. NextCursor is passed
+// back as the before parameter to fetch the next page and is null on the last
+// page.
+type pageResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor *string     `json:"next_cursor"`
+}
+
+// shadowResponse is a device shadow with the desired values the device has
+// not reported yet.
+type shadowResponse struct {
+	*database.DeviceShadow
+	Delta map[string]interface{} `json:"delta"`
+}
+
+// listResponse is the envelope of offset-paginated endpoints.
+type listResponse struct {
+	Data interface{} `json:"data"`
+}
+
+func newPageResponse(data interface{}, nextCursor time.Time) pageResponse {
+	response := pageResponse{Data: data}
+	if !nextCursor.IsZero() {
+		cursor := nextCursor.UTC().Format(time.RFC3339Nano)
+		response.NextCursor = &cursor
+	}
+	return response
+}
+
+// ServerOptions configures the middleware of a Server.
+type ServerOptions struct {
+	// AllowedOrigins may call the API from another origin; see
+	// CORSMiddleware.
+	AllowedOrigins []string
+
+	// RateLimit is how many requests per second each client IP may make, in
+	// bursts of up to RateBurst. Zero disables rate limiting.
+	RateLimit float64
+	RateBurst int
+
+	// APIKeys are required on every request. Nil disables authentication.
+	APIKeys *APIKeys
+
+	// DeviceStream, when set, serves GET /api/v1/devices/{device_id}/stream,
+	// e.g. the SSE server's HandleDeviceStream.
+	DeviceStream http.Handler
+}
+
+// Server exposes stored aggregates and alerts over a read-only REST API.
+type Server struct {
+	store        Store
+	server       *http.Server
+	limiter      *RateLimiter
+	deviceStream http.Handler
+}
+
+func NewServer(addr string, store Store, opts ServerOptions) *Server {
+	s := &Server{store: store, deviceStream: opts.DeviceStream}
+
+	handler := s.Routes()
+	if opts.APIKeys != nil {
+		handler = APIKeyAuth(opts.APIKeys, slog.Default())(handler)
+	} else {
+		slog.Warn("API_KEYS_FILE is not set; REST API clients are not authenticated")
+	}
+	// Throttle before authenticating, so keys can't be guessed quickly
+	if opts.RateLimit > 0 {
+		s.limiter = NewRateLimiter(opts.RateLimit, opts.RateBurst)
+		handler = s.limiter.Middleware(handler)
+	}
+	// CORS headers go on rejected requests too, so browsers can read the 429
+	handler = CORSMiddleware(opts.AllowedOrigins)(handler)
+	handler = LoggingMiddleware(slog.Default())(handler)
+
+	s.server = &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	return s
+}
+
+// Routes returns the router serving the API endpoints.
+func (s *Server) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/devices", s.handleRegisterDevice)
+	mux.HandleFunc("GET /api/v1/devices", s.handleListDevices)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}", s.handleGetDevice)
+	mux.HandleFunc("PUT /api/v1/devices/{device_id}", s.handleUpdateDevice)
+	mux.HandleFunc("DELETE /api/v1/devices/{device_id}", s.handleDeleteDevice)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/shadow", s.handleGetShadow)
+	mux.HandleFunc("PUT /api/v1/devices/{device_id}/shadow", s.handleUpdateShadow)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/aggregates", s.handleAggregates)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/alerts", s.handleAlerts)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/summary", s.handleSummary)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/anomaly-summary", s.handleAnomalySummary)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/export/aggregates", s.handleExportAggregates)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/export/alerts", s.handleExportAlerts)
+	mux.HandleFunc("GET /api/v1/alerts/{id}/audit", s.handleAlertAudit)
+	mux.HandleFunc("GET /api/v1/fleet/summary", s.handleFleetSummary)
+	if s.deviceStream != nil {
+		mux.Handle("GET /api/v1/devices/{device_id}/stream", s.deviceStream)
+	}
+
+	schema, err := newGraphQLSchema(s.store)
+	if err != nil {
+		// The schema is fixed, so this only fails on a bug in its definition
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	graphQL := GraphQLHandler(schema)
+	mux.Handle("GET /api/graphql", graphQL)
+	mux.Handle("POST /api/graphql", graphQL)
+	return mux
+}
+
+func (s *Server) Run() {
+	slog.Info("API server starting", slog.String("addr", s.server.Addr))
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("API server error", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	if s.limiter != nil {
+		s.limiter.Stop()
+	}
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) handleAggregates(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+	query := r.URL.Query()
+
+	hours, err := intParam(query.Get("hours"), defaultAggregateHours)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid hours: %v", err))
+		return
+	}
+	limit, err := limitParam(query.Get("limit"), defaultAggregateLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %v", err))
+		return
+	}
+	before, err := timeParam(query.Get("before"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid before: %v", err))
+		return
+	}
+
+	aggregates, nextCursor, err := s.store.GetAggregatesPage(deviceID, query.Get("metric"), before, limit)
+	if err != nil {
+		slog.Error("Failed to query aggregates", slog.String("device_id", deviceID), slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to query aggregates")
+		return
+	}
+
+	// Stop paging once the results leave the requested window
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	for i, aggregate := range aggregates {
+		if aggregate.Timestamp.Before(since) {
+			aggregates = aggregates[:i]
+			nextCursor = time.Time{}
+			break
+		}
+	}
+
+	if aggregates == nil {
+		aggregates = []database.AggregateRecord{}
+	}
+	writeJSON(w, http.StatusOK, newPageResponse(aggregates, nextCursor))
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	if status == "" {
+		status = defaultAlertStatus
+	}
+	limit, err := limitParam(query.Get("limit"), defaultAlertLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %v", err))
+		return
+	}
+
+	before, err := timeParam(query.Get("before"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid before: %v", err))
+		return
+	}
+
+	alerts, nextCursor, err := s.store.GetAlertsPage(deviceID, status, before, limit)
+	if err != nil {
+		slog.Error("Failed to query alerts", slog.String("device_id", deviceID), slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to query alerts")
+		return
+	}
+
+	if alerts == nil {
+		alerts = []database.AlertRecord{}
+	}
+	writeJSON(w, http.StatusOK, newPageResponse(alerts, nextCursor))
+}
+
+// handleAlertAudit returns the status changes of an alert, oldest first.
+func (s *Server) handleAlertAudit(w http.ResponseWriter, r *http.Request) {
+	id, err := intParam(r.PathValue("id"), 0)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, "invalid alert id")
+		return
+	}
+
+	entries, err := s.store.GetAuditLog(id)
+	if err != nil {
+		slog.Error("Failed to query alert audit log", slog.Int("alert_id", id), slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to query audit log")
+		return
+	}
+
+	if entries == nil {
+		entries = []database.AlertAuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, listResponse{Data: entries})
+}
+
+// handleSummary returns per-metric statistics for a device over [from, to),
+// which defaults to the last 24 hours.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+	query := r.URL.Query()
+
+	from, to, err := rangeParams(query, defaultSummaryRange)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var metricNames []string
+	for _, name := range strings.Split(query.Get("metrics"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			metricNames = append(metricNames, name)
+		}
+	}
+
+	summary, err := s.store.GetDeviceSummary(deviceID, metricNames, from, to)
+	if err != nil {
+		slog.Error("Failed to query device summary", slog.String("device_id", deviceID), slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to query device summary")
+		return
+	}
+
+	if summary == nil {
+		summary = map[string]database.MetricSummary{}
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (s *Server) handleExportAggregates(w http.ResponseWriter, r *http.Request) {
+	s.handleExport(w, r, "aggregates", s.store.ExportAggregatesCSV)
+}
+
+func (s *Server) handleExportAlerts(w http.ResponseWriter, r *http.Request) {
+	s.handleExport(w, r, "alerts", s.store.ExportAlertsCSV)
+}
+
+// handleExport streams a device's records in the requested range as a CSV
+// download.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request, kind string, export func(io.Writer, string, time.Time, time.Time) error) {
+	deviceID := r.PathValue("device_id")
+	query := r.URL.Query()
+
+	if format := query.Get("format"); format != "" && format != "csv" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q, expected csv", format))
+		return
+	}
+	from, to, err := rangeParams(query, defaultExportRange)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	download := &csvDownload{w: w, filename: fmt.Sprintf("device-%s-%s.csv", deviceID, kind)}
+	if err := export(download, deviceID, from, to); err != nil {
+		slog.Error("Failed to export "+kind, slog.String("device_id", deviceID), slog.Any("error", err))
+		// Once rows are sent the status can't change, and the download is
+		// left truncated
+		if !download.started {
+			writeError(w, http.StatusInternalServerError, "failed to export "+kind)
+		}
+	}
+}
+
+// csvDownload sends the CSV download headers with the first write, so errors
+// before any row is written can still be reported as JSON.
+type csvDownload struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (d *csvDownload) Write(p []byte) (int, error) {
+	if !d.started {
+		d.started = true
+		d.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		d.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", d.filename))
+		d.w.WriteHeader(http.StatusOK)
+	}
+	return d.w.Write(p)
+}
+
+func (s *Server) handleAnomalySummary(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+	query := r.URL.Query()
+
+	hours, err := intParam(query.Get("hours"), defaultAnomalyHours)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid hours: %v", err))
+		return
+	}
+	top, err := limitParam(query.Get("top"), defaultAnomalyTop)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid top: %v", err))
+		return
+	}
+
+	counts, err := s.store.GetTopAnomalousMetrics(deviceID, hours, top)
+	if err != nil {
+		slog.Error("Failed to query anomaly summary", slog.String("device_id", deviceID), slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to query anomaly summary")
+		return
+	}
+
+	if counts == nil {
+		counts = []database.MetricAnomalyCount{}
+	}
+	writeJSON(w, http.StatusOK, counts)
+}
+
+func (s *Server) handleFleetSummary(w http.ResponseWriter, r *http.Request) {
+	hours, err := intParam(r.URL.Query().Get("hours"), defaultFleetHours)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid hours: %v", err))
+		return
+	}
+
+	summary, err := s.store.GetFleetSummary(hours)
+	if err != nil {
+		slog.Error("Failed to query fleet summary", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to query fleet summary")
+		return
+	}
+
+	if summary == nil {
+		summary = map[string]database.FleetMetricSummary{}
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (s *Server) handleRegisterDevice(w http.ResponseWriter, r *http.Request) {
+	var device database.DeviceRecord
+	if err := json.NewDecoder(r.Body).Decode(&device); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid device: %v", err))
+		return
+	}
+	if device.DeviceID == "" {
+		writeError(w, http.StatusBadRequest, "device_id is required")
+		return
+	}
+
+	if err := s.store.RegisterDevice(device); err != nil {
+		slog.Error("Failed to register device", slog.String("device_id", device.DeviceID), slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to register device")
+		return
+	}
+
+	s.writeDevice(w, http.StatusCreated, device.DeviceID)
+}
+
+// handleListDevices lists devices by status, or with a bbox parameter, every
+// device located within the bounding box.
+func (s *Server) handleListDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if bbox := query.Get("bbox"); bbox != "" {
+		s.handleDevicesByBoundingBox(w, bbox)
+		return
+	}
+
+	limit, err := limitParam(query.Get("limit"), defaultDeviceLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %v", err))
+		return
+	}
+	offset, err := offsetParam(query.Get("offset"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid offset: %v", err))
+		return
+	}
+
+	devices, err := s.store.ListDevices(query.Get("status"), limit, offset)
+	if err != nil {
+		slog.Error("Failed to list devices", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to list devices")
+		return
+	}
+
+	if devices == nil {
+		devices = []database.DeviceRecord{}
+	}
+	writeJSON(w, http.StatusOK, listResponse{Data: devices})
+}
+
+func (s *Server) handleDevicesByBoundingBox(w http.ResponseWriter, bbox string) {
+	minLat, maxLat, minLon, maxLon, err := bboxParam(bbox)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid bbox: %v", err))
+		return
+	}
+
+	devices, err := s.store.GetDevicesByBoundingBox(minLat, maxLat, minLon, maxLon)
+	if err != nil {
+		slog.Error("Failed to list devices by bounding box", slog.String("bbox", bbox), slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "failed to list devices")
+		return
+	}
+
+	if devices == nil {
+		devices = []database.DeviceRecord{}
+	}
+	writeJSON(w, http.StatusOK, listResponse{Data: devices})
+}
+
+func (s *Server) handleGetDevice(w http.ResponseWriter, r *http.Request) {
+	s.writeDevice(w, http.StatusOK, r.PathValue("device_id"))
+}
+
+// handleUpdateDevice updates the fields present in the body. Metadata, when
+// given, replaces the stored metadata.
+func (s *Server) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+
+	var device database.DeviceRecord
+	if err := json.NewDecoder(r.Body).Decode(&device); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid device: %v", err))
+		return
+	}
+	if device.DeviceID != "" && device.DeviceID != deviceID {
+		writeError(w, http.StatusBadRequest, "device_id does not match the URL")
+		return
+	}
+	device.DeviceID = deviceID
+
+	// PUT only updates known devices; registration goes through POST
+	if _, err := s.store.GetDevice(deviceID); err != nil {
+		s.writeDeviceError(w, deviceID, err)
+		return
+	}
+
+	metadata := device.Metadata
+	device.Metadata = nil
+	if err := s.store.RegisterDevice(device); err != nil {
+		s.writeDeviceError(w, deviceID, err)
+		return
+	}
+	if metadata != nil {
+		if err := s.store.UpdateDeviceMetadata(deviceID, metadata); err != nil {
+			s.writeDeviceError(w, deviceID, err)
+			return
+		}
+	}
+
+	s.writeDevice(w, http.StatusOK, deviceID)
+}
+
+func (s *Server) handleDeleteDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+	if err := s.store.DeleteDevice(deviceID); err != nil {
+		s.writeDeviceError(w, deviceID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetShadow(w http.ResponseWriter, r *http.Request) {
+	s.writeShadow(w, r.PathValue("device_id"))
+}
+
+// handleUpdateShadow replaces the desired state of a registered device with
+// the desired object of the body.
+func (s *Server) handleUpdateShadow(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("device_id")
+
+	var body struct {
+		Desired map[string]interface{} `json:"desired"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid shadow: %v", err))
+		return
+	}
+	if body.Desired == nil {
+		writeError(w, http.StatusBadRequest, "desired is required")
+		return
+	}
+
+	if _, err := s.store.GetDevice(deviceID); err != nil {
+		s.writeDeviceError(w, deviceID, err)
+		return
+	}
+	if err := s.store.UpdateDesiredState(deviceID, body.Desired); err != nil {
+		s.writeDeviceError(w, deviceID, err)
+		return
+	}
+
+	s.writeShadow(w, deviceID)
+}
+
+// writeShadow responds with the stored shadow of a device and its delta.
+func (s *Server) writeShadow(w http.ResponseWriter, deviceID string) {
+	shadow, err := s.store.GetDeviceShadow(deviceID)
+	if errors.Is(err, database.ErrShadowNotFound) {
+		writeError(w, http.StatusNotFound, "shadow not found")
+		return
+	}
+	if err != nil {
+		s.writeDeviceError(w, deviceID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, shadowResponse{DeviceShadow: shadow, Delta: shadow.Delta()})
+}
+
+// writeDevice responds with the stored state of a device.
+func (s *Server) writeDevice(w http.ResponseWriter, status int, deviceID string) {
+	device, err := s.store.GetDevice(deviceID)
+	if err != nil {
+		s.writeDeviceError(w, deviceID, err)
+		return
+	}
+	writeJSON(w, status, device)
+}
+
+func (s *Server) writeDeviceError(w http.ResponseWriter, deviceID string, err error) {
+	if errors.Is(err, database.ErrDeviceNotFound) {
+		writeError(w, http.StatusNotFound, "device not found")
+		return
+	}
+	slog.Error("Device request failed", slog.String("device_id", deviceID), slog.Any("error", err))
+	writeError(w, http.StatusInternalServerError, "device request failed")
+}
+
+// intParam parses a positive integer query parameter, falling back to def
+// when it is absent.
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("must be positive, got %d", n)
+	}
+	return n, nil
+}
+
+func limitParam(value string, def int) (int, error) {
+	limit, err := intParam(value, def)
+	if err != nil {
+		return 0, err
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit, nil
+}
+
+// offsetParam parses an optional non-negative offset, defaulting to zero.
+func offsetParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("must not be negative, got %d", offset)
+	}
+	return offset, nil
+}
+
+// bboxParam parses a "lat1,lon1,lat2,lon2" bounding box given by any two
+// opposite corners.
+func bboxParam(value string) (minLat, maxLat, minLon, maxLon float64, err error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return 0, 0, 0, 0, fmt.Errorf("expected lat1,lon1,lat2,lon2, got %q", value)
+	}
+
+	var coords [4]float64
+	for i, part := range parts {
+		coords[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+	}
+	for _, lat := range []float64{coords[0], coords[2]} {
+		if lat < -90 || lat > 90 {
+			return 0, 0, 0, 0, fmt.Errorf("latitude %v out of range", lat)
+		}
+	}
+	for _, lon := range []float64{coords[1], coords[3]} {
+		if lon < -180 || lon > 180 {
+			return 0, 0, 0, 0, fmt.Errorf("longitude %v out of range", lon)
+		}
+	}
+
+	minLat, maxLat = min(coords[0], coords[2]), max(coords[0], coords[2])
+	minLon, maxLon = min(coords[1], coords[3]), max(coords[1], coords[3])
+	return minLat, maxLat, minLon, maxLon, nil
+}
+
+// timeParam parses an optional RFC 3339 cursor. An absent cursor is the zero
+// time, which requests the first page.
+// rangeParams parses the from and to parameters. to defaults to now and from
+// to defaultRange before to.
+func rangeParams(query url.Values, defaultRange time.Duration) (from, to time.Time, err error) {
+	to, err = timeParam(query.Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %v", err)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from, err = timeParam(query.Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %v", err)
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultRange)
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+func timeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("Failed to encode API response", slog.Any("error", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,687 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	deviceID string
+	metric   string
+	status   string
+	before   time.Time
+	limit    int
+	err      error
+
+	aggregates []database.AggregateRecord
+	alerts     []database.AlertRecord
+	nextCursor time.Time
+
+	devices map[string]*database.DeviceRecord
+	offset  int
+	bbox    [4]float64
+
+	alertID int
+	audit   []database.AlertAuditEntry
+
+	summary     map[string]database.MetricSummary
+	metricNames []string
+	from, to    time.Time
+
+	anomalyCounts []database.MetricAnomalyCount
+	hours         int
+
+	fleetSummary map[string]database.FleetMetricSummary
+
+	shadows map[string]*database.DeviceShadow
+
+	// csv is written by the exports before they return err
+	csv      string
+	exported string
+}
+
+func (f *fakeStore) GetAggregatesPage(deviceID, metricName string, before time.Time, limit int) ([]database.AggregateRecord, time.Time, error) {
+	f.deviceID, f.metric, f.before, f.limit = deviceID, metricName, before, limit
+	return f.aggregates, f.nextCursor, f.err
+}
+
+func (f *fakeStore) GetAlertsPage(deviceID, status string, before time.Time, limit int) ([]database.AlertRecord, time.Time, error) {
+	f.deviceID, f.status, f.before, f.limit = deviceID, status, before, limit
+	return f.alerts, f.nextCursor, f.err
+}
+
+func (f *fakeStore) GetAuditLog(alertID int) ([]database.AlertAuditEntry, error) {
+	f.alertID = alertID
+	return f.audit, f.err
+}
+
+// RegisterDevice mirrors the upsert semantics of TimescaleDB.RegisterDevice.
+func (f *fakeStore) RegisterDevice(device database.DeviceRecord) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.devices == nil {
+		f.devices = make(map[string]*database.DeviceRecord)
+	}
+	stored, ok := f.devices[device.DeviceID]
+	if !ok {
+		stored = &database.DeviceRecord{DeviceID: device.DeviceID, Status: "active"}
+		f.devices[device.DeviceID] = stored
+	}
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&stored.DeviceName, device.DeviceName},
+		{&stored.DeviceType, device.DeviceType},
+		{&stored.Location, device.Location},
+		{&stored.Status, device.Status},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if device.Metadata != nil {
+		stored.Metadata = device.Metadata
+	}
+	if device.ExpectedInterval > 0 {
+		stored.ExpectedInterval = device.ExpectedInterval
+	}
+	if device.GeoLocation != nil {
+		stored.GeoLocation = device.GeoLocation
+	}
+	return nil
+}
+
+func (f *fakeStore) UpdateDeviceMetadata(deviceID string, metadata map[string]interface{}) error {
+	if _, err := f.GetDevice(deviceID); err != nil {
+		return err
+	}
+	f.devices[deviceID].Metadata = metadata
+	return nil
+}
+
+func (f *fakeStore) GetDevice(deviceID string) (*database.DeviceRecord, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	device, ok := f.devices[deviceID]
+	if !ok {
+		return nil, fmt.Errorf("device %s: %w", deviceID, database.ErrDeviceNotFound)
+	}
+	copied := *device
+	return &copied, nil
+}
+
+func (f *fakeStore) ListDevices(status string, limit, offset int) ([]database.DeviceRecord, error) {
+	f.status, f.limit, f.offset = status, limit, offset
+	var devices []database.DeviceRecord
+	for _, device := range f.devices {
+		if status == "" || device.Status == status {
+			devices = append(devices, *device)
+		}
+	}
+	return devices, f.err
+}
+
+func (f *fakeStore) GetDevicesByBoundingBox(minLat, maxLat, minLon, maxLon float64) ([]database.DeviceRecord, error) {
+	f.bbox = [4]float64{minLat, maxLat, minLon, maxLon}
+	var devices []database.DeviceRecord
+	for _, device := range f.devices {
+		location := device.GeoLocation
+		if location != nil && location.Latitude >= minLat && location.Latitude <= maxLat &&
+			location.Longitude >= minLon && location.Longitude <= maxLon {
+			devices = append(devices, *device)
+		}
+	}
+	return devices, f.err
+}
+
+func (f *fakeStore) DeleteDevice(deviceID string) error {
+	if _, err := f.GetDevice(deviceID); err != nil {
+		return err
+	}
+	delete(f.devices, deviceID)
+	return nil
+}
+
+func (f *fakeStore) GetDeviceSummary(deviceID string, metricNames []string, from, to time.Time) (map[string]database.MetricSummary, error) {
+	f.deviceID, f.metricNames, f.from, f.to = deviceID, metricNames, from, to
+	return f.summary, f.err
+}
+
+func (f *fakeStore) GetDeviceShadow(deviceID string) (*database.DeviceShadow, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	shadow, ok := f.shadows[deviceID]
+	if !ok {
+		return nil, fmt.Errorf("device %s: %w", deviceID, database.ErrShadowNotFound)
+	}
+	copied := *shadow
+	return &copied, nil
+}
+
+// UpdateDesiredState mirrors TimescaleDB.UpdateDesiredState.
+func (f *fakeStore) UpdateDesiredState(deviceID string, desired map[string]interface{}) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.shadows == nil {
+		f.shadows = make(map[string]*database.DeviceShadow)
+	}
+	shadow, ok := f.shadows[deviceID]
+	if !ok {
+		shadow = &database.DeviceShadow{DeviceID: deviceID, Reported: map[string]interface{}{}}
+		f.shadows[deviceID] = shadow
+	}
+	shadow.Desired = desired
+	shadow.Version++
+	return nil
+}
+
+func (f *fakeStore) GetTopAnomalousMetrics(deviceID string, hours int, topN int) ([]database.MetricAnomalyCount, error) {
+	f.deviceID, f.hours, f.limit = deviceID, hours, topN
+	return f.anomalyCounts, f.err
+}
+
+func (f *fakeStore) GetFleetSummary(hours int) (map[string]database.FleetMetricSummary, error) {
+	f.hours = hours
+	return f.fleetSummary, f.err
+}
+
+func (f *fakeStore) ExportAggregatesCSV(w io.Writer, deviceID string, from, to time.Time) error {
+	return f.export("aggregates", w, deviceID, from, to)
+}
+
+func (f *fakeStore) ExportAlertsCSV(w io.Writer, deviceID string, from, to time.Time) error {
+	return f.export("alerts", w, deviceID, from, to)
+}
+
+func (f *fakeStore) export(kind string, w io.Writer, deviceID string, from, to time.Time) error {
+	f.exported, f.deviceID, f.from, f.to = kind, deviceID, from, to
+	if f.csv != "" {
+		if _, err := io.WriteString(w, f.csv); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+type aggregatesPage struct {
+	Data       []database.AggregateRecord `json:"data"`
+	NextCursor *string                    `json:"next_cursor"`
+}
+
+type alertsPage struct {
+	Data       []database.AlertRecord `json:"data"`
+	NextCursor *string                `json:"next_cursor"`
+}
+
+func serve(store Store, target string) *httptest.ResponseRecorder {
+	return serveRequest(store, http.MethodGet, target, "")
+}
+
+func serveRequest(store Store, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	NewServer(":0", store, ServerOptions{}).Routes().ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestHandleAggregates(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	store := &fakeStore{
+		aggregates: []database.AggregateRecord{{DeviceID: "device-1", Timestamp: now, MetricName: "temperature", MetricValue: 21.5}},
+		nextCursor: now,
+	}
+
+	rec := serve(store, "/api/v1/devices/device-1/aggregates?metric=temperature&limit=10&before=2024-01-01T12:00:00Z")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "device-1", store.deviceID)
+	assert.Equal(t, "temperature", store.metric)
+	assert.Equal(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), store.before)
+	assert.Equal(t, 10, store.limit)
+
+	var body aggregatesPage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Data, 1)
+	assert.Equal(t, 21.5, body.Data[0].MetricValue)
+	if assert.NotNil(t, body.NextCursor) {
+		assert.Equal(t, now.Format(time.RFC3339Nano), *body.NextCursor)
+	}
+}
+
+func TestHandleAggregates_Defaults(t *testing.T) {
+	store := &fakeStore{}
+
+	rec := serve(store, "/api/v1/devices/device-1/aggregates")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, store.before.IsZero())
+	assert.Equal(t, defaultAggregateLimit, store.limit)
+	assert.JSONEq(t, `{"data": [], "next_cursor": null}`, rec.Body.String())
+}
+
+func TestHandleAggregates_StopsAtHoursWindow(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{
+		aggregates: []database.AggregateRecord{
+			{DeviceID: "device-1", Timestamp: now.Add(-time.Hour)},
+			{DeviceID: "device-1", Timestamp: now.Add(-3 * time.Hour)},
+		},
+		nextCursor: now.Add(-3 * time.Hour),
+	}
+
+	rec := serve(store, "/api/v1/devices/device-1/aggregates?hours=2")
+
+	var body aggregatesPage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Data, 1)
+	assert.Nil(t, body.NextCursor)
+}
+
+func TestHandleAggregates_InvalidParams(t *testing.T) {
+	for _, target := range []string{
+		"/api/v1/devices/device-1/aggregates?hours=abc",
+		"/api/v1/devices/device-1/aggregates?hours=-1",
+		"/api/v1/devices/device-1/aggregates?limit=0",
+		"/api/v1/devices/device-1/aggregates?before=yesterday",
+	} {
+		rec := serve(&fakeStore{}, target)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func TestHandleAlerts(t *testing.T) {
+	store := &fakeStore{
+		alerts: []database.AlertRecord{{ID: 7, DeviceID: "device-1", Status: "acknowledged"}},
+	}
+
+	rec := serve(store, "/api/v1/devices/device-1/alerts?status=acknowledged&limit=5000")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "acknowledged", store.status)
+	assert.Equal(t, maxLimit, store.limit)
+
+	var body alertsPage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, store.alerts, body.Data)
+	assert.Nil(t, body.NextCursor)
+}
+
+func TestHandleAlerts_StoreError(t *testing.T) {
+	store := &fakeStore{err: errors.New("connection refused")}
+
+	rec := serve(store, "/api/v1/devices/device-1/alerts")
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, defaultAlertStatus, store.status)
+	assert.Equal(t, defaultAlertLimit, store.limit)
+}
+
+func TestRoutes_MethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/device-1/alerts", nil)
+	NewServer(":0", &fakeStore{}, ServerOptions{}).Routes().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestRoutes_DeviceStream(t *testing.T) {
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: " + r.PathValue("device_id") + "\n\n"))
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	})
+	server := NewServer(":0", &fakeStore{}, ServerOptions{DeviceStream: stream})
+
+	// Served through the middleware, which must let the stream flush
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/devices/device-1/stream", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "data: device-1\n\n", rec.Body.String())
+	assert.True(t, rec.Flushed)
+
+	// Without a stream the route is not served
+	rec = serve(&fakeStore{}, "/api/v1/devices/device-1/stream")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDevices_CRUD(t *testing.T) {
+	store := &fakeStore{}
+
+	rec := serveRequest(store, http.MethodPost, "/api/v1/devices",
+		`{"device_id":"device-1","device_name":"Boiler","metadata":{"firmware":"1.2.0"}}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var device database.DeviceRecord
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &device))
+	assert.Equal(t, "Boiler", device.DeviceName)
+	assert.Equal(t, "active", device.Status)
+	assert.Equal(t, "1.2.0", device.Metadata["firmware"])
+
+	rec = serveRequest(store, http.MethodPut, "/api/v1/devices/device-1",
+		`{"location":"Basement","metadata":{"firmware":"1.3.0"}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &device))
+	assert.Equal(t, "Boiler", device.DeviceName)
+	assert.Equal(t, "Basement", device.Location)
+	assert.Equal(t, map[string]interface{}{"firmware": "1.3.0"}, device.Metadata)
+
+	rec = serve(store, "/api/v1/devices/device-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serveRequest(store, http.MethodDelete, "/api/v1/devices/device-1", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve(store, "/api/v1/devices/device-1")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDevices_List(t *testing.T) {
+	store := &fakeStore{devices: map[string]*database.DeviceRecord{
+		"device-1": {DeviceID: "device-1", Status: "active"},
+		"device-2": {DeviceID: "device-2", Status: "inactive"},
+	}}
+
+	rec := serve(store, "/api/v1/devices?status=active&limit=10&offset=20")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "active", store.status)
+	assert.Equal(t, 10, store.limit)
+	assert.Equal(t, 20, store.offset)
+
+	var list struct {
+		Data []database.DeviceRecord `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, "device-1", list.Data[0].DeviceID)
+
+	rec = serve(store, "/api/v1/devices?offset=-1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestDevices_ListByBoundingBox(t *testing.T) {
+	store := &fakeStore{devices: map[string]*database.DeviceRecord{
+		"device-1": {DeviceID: "device-1", GeoLocation: &database.DeviceLocation{Latitude: 52.52, Longitude: 13.40}},
+		"device-2": {DeviceID: "device-2", GeoLocation: &database.DeviceLocation{Latitude: 48.85, Longitude: 2.35}},
+		"device-3": {DeviceID: "device-3"},
+	}}
+
+	// Corners may be given in any order
+	rec := serve(store, "/api/v1/devices?bbox=53,14,52,13")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, [4]float64{52, 53, 13, 14}, store.bbox)
+
+	var list struct {
+		Data []database.DeviceRecord `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, "device-1", list.Data[0].DeviceID)
+
+	for _, bbox := range []string{"52,13,53", "52,13,53,east", "91,13,53,14", "52,13,53,181"} {
+		rec = serve(store, "/api/v1/devices?bbox="+bbox)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, bbox)
+	}
+}
+
+func TestDevices_InvalidRequests(t *testing.T) {
+	store := &fakeStore{}
+
+	rec := serveRequest(store, http.MethodPost, "/api/v1/devices", `{"device_name":"Boiler"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serveRequest(store, http.MethodPost, "/api/v1/devices", `not json`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// PUT does not create devices
+	rec = serveRequest(store, http.MethodPut, "/api/v1/devices/device-9", `{"location":"Roof"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serveRequest(store, http.MethodDelete, "/api/v1/devices/device-9", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleAlertAudit(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeStore{audit: []database.AlertAuditEntry{
+		{ID: 1, AlertID: 7, Action: database.AuditActionAcknowledge, Actor: "alice", Timestamp: at, OldStatus: "open", NewStatus: "acknowledged"},
+		{ID: 2, AlertID: 7, Action: database.AuditActionResolve, Actor: "bob", Timestamp: at.Add(time.Hour), OldStatus: "acknowledged", NewStatus: "resolved", Notes: "Replaced the sensor"},
+	}}
+
+	rec := serve(store, "/api/v1/alerts/7/audit")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 7, store.alertID)
+
+	var list struct {
+		Data []database.AlertAuditEntry `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Equal(t, store.audit, list.Data)
+
+	rec = serve(&fakeStore{}, "/api/v1/alerts/8/audit")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data": []}`, rec.Body.String())
+
+	for _, target := range []string{"/api/v1/alerts/abc/audit", "/api/v1/alerts/-1/audit"} {
+		rec = serve(&fakeStore{}, target)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func TestHandleSummary(t *testing.T) {
+	store := &fakeStore{summary: map[string]database.MetricSummary{
+		"temperature": {Min: 18, Max: 24, Avg: 21, Latest: 22, SampleCount: 120},
+	}}
+
+	rec := serve(store, "/api/v1/devices/device-1/summary?from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z&metrics=temperature,%20humidity,")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "device-1", store.deviceID)
+	assert.Equal(t, []string{"temperature", "humidity"}, store.metricNames)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), store.from)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), store.to)
+	assert.JSONEq(t, `{"temperature": {"min": 18, "max": 24, "avg": 21, "latest": 22, "sample_count": 120}}`, rec.Body.String())
+}
+
+func TestHandleSummary_Defaults(t *testing.T) {
+	store := &fakeStore{}
+
+	rec := serve(store, "/api/v1/devices/device-1/summary")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, store.metricNames)
+	assert.Equal(t, defaultSummaryRange, store.to.Sub(store.from))
+	assert.WithinDuration(t, time.Now(), store.to, time.Minute)
+	assert.JSONEq(t, `{}`, rec.Body.String())
+}
+
+func TestHandleSummary_InvalidRange(t *testing.T) {
+	for _, target := range []string{
+		"/api/v1/devices/device-1/summary?from=yesterday",
+		"/api/v1/devices/device-1/summary?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z",
+	} {
+		rec := serve(&fakeStore{}, target)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	store := &fakeStore{csv: "device_id,timestamp\ndevice-1,2024-01-01T12:00:00Z\n"}
+
+	rec := serve(store, "/api/v1/devices/device-1/export/aggregates?from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z&format=csv")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="device-device-1-aggregates.csv"`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, store.csv, rec.Body.String())
+	assert.Equal(t, "aggregates", store.exported)
+	assert.Equal(t, "device-1", store.deviceID)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), store.from)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), store.to)
+
+	// The format and range default to csv and the last day
+	rec = serve(store, "/api/v1/devices/device-1/export/alerts")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `attachment; filename="device-device-1-alerts.csv"`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "alerts", store.exported)
+	assert.Equal(t, defaultExportRange, store.to.Sub(store.from))
+}
+
+func TestHandleExport_InvalidParams(t *testing.T) {
+	for _, target := range []string{
+		"/api/v1/devices/device-1/export/aggregates?format=json",
+		"/api/v1/devices/device-1/export/alerts?from=yesterday",
+		"/api/v1/devices/device-1/export/alerts?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z",
+	} {
+		store := &fakeStore{}
+		rec := serve(store, target)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		assert.Empty(t, store.exported, target)
+	}
+}
+
+func TestHandleExport_StoreError(t *testing.T) {
+	rec := serve(&fakeStore{err: errors.New("connection refused")}, "/api/v1/devices/device-1/export/aggregates")
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Disposition"))
+	assert.JSONEq(t, `{"error": "failed to export aggregates"}`, rec.Body.String())
+
+	// An error after rows were sent leaves the download truncated
+	rec = serve(&fakeStore{csv: "device_id\n", err: errors.New("connection reset")}, "/api/v1/devices/device-1/export/aggregates")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "device_id\n", rec.Body.String())
+}
+
+func TestHandleAnomalySummary(t *testing.T) {
+	store := &fakeStore{anomalyCounts: []database.MetricAnomalyCount{
+		{Metric: "temperature", Count: 42},
+		{Metric: "humidity", Count: 7},
+	}}
+
+	rec := serve(store, "/api/v1/devices/device-1/anomaly-summary?hours=6&top=2")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "device-1", store.deviceID)
+	assert.Equal(t, 6, store.hours)
+	assert.Equal(t, 2, store.limit)
+	assert.JSONEq(t, `[{"metric": "temperature", "count": 42}, {"metric": "humidity", "count": 7}]`, rec.Body.String())
+}
+
+func TestHandleAnomalySummary_Defaults(t *testing.T) {
+	store := &fakeStore{}
+
+	rec := serve(store, "/api/v1/devices/device-1/anomaly-summary")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, defaultAnomalyHours, store.hours)
+	assert.Equal(t, defaultAnomalyTop, store.limit)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+
+	for _, target := range []string{
+		"/api/v1/devices/device-1/anomaly-summary?hours=0",
+		"/api/v1/devices/device-1/anomaly-summary?top=ten",
+	} {
+		rec := serve(&fakeStore{}, target)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func TestHandleFleetSummary(t *testing.T) {
+	store := &fakeStore{fleetSummary: map[string]database.FleetMetricSummary{
+		"temperature": {Min: 12, Max: 35, Avg: 22.5, SampleCount: 12000, DeviceCount: 40},
+	}}
+
+	rec := serve(store, "/api/v1/fleet/summary?hours=6")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 6, store.hours)
+	assert.JSONEq(t, `{"temperature": {"min": 12, "max": 35, "avg": 22.5, "sample_count": 12000, "device_count": 40}}`, rec.Body.String())
+}
+
+func TestHandleFleetSummary_Defaults(t *testing.T) {
+	store := &fakeStore{}
+
+	rec := serve(store, "/api/v1/fleet/summary")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, defaultFleetHours, store.hours)
+	assert.JSONEq(t, `{}`, rec.Body.String())
+
+	rec = serve(&fakeStore{}, "/api/v1/fleet/summary?hours=-1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(&fakeStore{err: errors.New("connection refused")}, "/api/v1/fleet/summary")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestHandleGetShadow(t *testing.T) {
+	store := &fakeStore{shadows: map[string]*database.DeviceShadow{
+		"device-1": {
+			DeviceID:  "device-1",
+			Desired:   map[string]interface{}{"interval": 30.0},
+			Reported:  map[string]interface{}{"interval": 60.0, "temperature": 21.5},
+			Version:   3,
+			UpdatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}}
+
+	rec := serve(store, "/api/v1/devices/device-1/shadow")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"device_id": "device-1",
+		"desired": {"interval": 30},
+		"reported": {"interval": 60, "temperature": 21.5},
+		"version": 3,
+		"updated_at": "2024-01-01T00:00:00Z",
+		"delta": {"interval": 30}
+	}`, rec.Body.String())
+
+	rec = serve(store, "/api/v1/devices/device-2/shadow")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleUpdateShadow(t *testing.T) {
+	store := &fakeStore{devices: map[string]*database.DeviceRecord{"device-1": {DeviceID: "device-1"}}}
+
+	rec := serveRequest(store, http.MethodPut, "/api/v1/devices/device-1/shadow", `{"desired": {"interval": 30}}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var shadow shadowResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &shadow))
+	assert.Equal(t, map[string]interface{}{"interval": 30.0}, shadow.Desired)
+	assert.Equal(t, map[string]interface{}{"interval": 30.0}, shadow.Delta)
+	assert.Equal(t, 1, shadow.Version)
+}
+
+func TestHandleUpdateShadow_Invalid(t *testing.T) {
+	store := &fakeStore{devices: map[string]*database.DeviceRecord{"device-1": {DeviceID: "device-1"}}}
+
+	for _, body := range []string{`not json`, `{"reported": {"interval": 30}}`} {
+		rec := serveRequest(store, http.MethodPut, "/api/v1/devices/device-1/shadow", body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	rec := serveRequest(store, http.MethodPut, "/api/v1/devices/device-2/shadow", `{"desired": {}}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, store.shadows)
+}
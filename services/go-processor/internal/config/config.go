@@ -1,21 +1,209 @@
 package config
 
 import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	KafkaBrokers string `envconfig:"KAFKA_BROKERS" default:"localhost:9092"`
+	// KafkaBrokers is a comma-separated list of broker addresses, e.g.
+	// "kafka-1:9092,kafka-2:9092". Load splits it into Brokers.
+	KafkaBrokers string   `envconfig:"KAFKA_BROKERS" default:"localhost:9092"`
+	Brokers      []string `ignored:"true"`
+
 	KafkaGroupID string `envconfig:"KAFKA_GROUP_ID" default:"go-processor"`
 	KafkaTopic   string `envconfig:"KAFKA_TOPIC" default:"raw.events"`
 
+	KafkaCompression string `envconfig:"KAFKA_COMPRESSION" default:"none"`
+
+	// Topics the processor reads or writes are created at startup with these
+	// settings if they don't exist.
+	KafkaPartitions        int `envconfig:"KAFKA_PARTITIONS" default:"3"`
+	KafkaReplicationFactor int `envconfig:"KAFKA_REPLICATION_FACTOR" default:"1"`
+
+	// KafkaAutoCommit commits offsets as raw events are read. When false they
+	// are committed only once processed, so failed messages are redelivered.
+	// KafkaCommitInterval batches commits; zero commits synchronously.
+	KafkaAutoCommit     bool          `envconfig:"KAFKA_AUTO_COMMIT" default:"true"`
+	KafkaCommitInterval time.Duration `envconfig:"KAFKA_COMMIT_INTERVAL" default:"0s"`
+
+	// DedupWindow is how long consumed offsets are remembered to skip
+	// messages redelivered after a rebalance. Zero disables deduplication.
+	DedupWindow time.Duration `envconfig:"DEDUP_WINDOW" default:"5m"`
+
+	// SourceType selects where raw telemetry is read from: "kafka" or "mqtt".
+	SourceType       string `envconfig:"SOURCE_TYPE" default:"kafka"`
+	MQTTBrokerURL    string `envconfig:"MQTT_BROKER_URL"`
+	MQTTTopicPattern string `envconfig:"MQTT_TOPIC_PATTERN" default:"devices/+/telemetry"`
+	MQTTClientID     string `envconfig:"MQTT_CLIENT_ID" default:"go-processor"`
+
+	// MessageFormat is the encoding of raw telemetry: "protobuf" or "avro".
+	// Avro messages carry a Schema Registry schema ID.
+	MessageFormat     string `envconfig:"MESSAGE_FORMAT" default:"protobuf"`
+	SchemaRegistryURL string `envconfig:"SCHEMA_REGISTRY_URL"`
+
 	AggregatesTopic string `envconfig:"AGGREGATES_TOPIC" default:"aggregates.minute"`
 	AlertsTopic     string `envconfig:"ALERTS_TOPIC" default:"alerts"`
+	RollupGroupID   string `envconfig:"ROLLUP_GROUP_ID" default:"go-processor-rollup"`
+	DLQTopic        string `envconfig:"DLQ_TOPIC" default:"raw.events.dlq"`
+
+	// FleetAggregatesTopic receives the fleet-wide aggregates combined from
+	// the minute aggregates of every device, read with FleetGroupID.
+	FleetAggregatesTopic string `envconfig:"FLEET_AGGREGATES_TOPIC" default:"fleet.aggregates"`
+	FleetGroupID         string `envconfig:"FLEET_GROUP_ID" default:"go-processor-fleet"`
+
+	// CommandsTopic receives the device commands sent by WebSocket clients.
+	CommandsTopic string `envconfig:"COMMANDS_TOPIC" default:"commands"`
+
+	// Aggregates and alerts are also published to these topics, e.g.
+	// "aggregates.archive,aggregates.analytics".
+	AdditionalAggregateTopics []string `envconfig:"ADDITIONAL_AGGREGATE_TOPICS"`
+	AdditionalAlertTopics     []string `envconfig:"ADDITIONAL_ALERT_TOPICS"`
+
+	AggregationFunctions     []string `envconfig:"AGGREGATION_FUNCTIONS" default:"mean,min,max,p95,p99"`
+	AggregationWorkers       int      `envconfig:"AGGREGATION_WORKERS" default:"4"`
+	AggregationWindowSeconds int      `envconfig:"AGGREGATION_WINDOW_SECONDS" default:"60"`
+	OrderedByDevice          bool     `envconfig:"ORDERED_BY_DEVICE" default:"true"`
+	BulkInsertThreshold      int      `envconfig:"BULK_INSERT_THRESHOLD" default:"100"`
+
+	// MaxDeviceChannels, when positive, processes each device's aggregation
+	// messages on a goroutine of its own instead of AggregationWorkers
+	// shared workers, stopping the least recently used device's goroutine
+	// past this many devices.
+	MaxDeviceChannels int `envconfig:"MAX_DEVICE_CHANNELS" default:"0"`
+
+	// AggregationGracePeriod is how long a due window keeps accepting late
+	// messages before it is written out.
+	AggregationGracePeriod time.Duration `envconfig:"AGGREGATION_GRACE_PERIOD" default:"0s"`
+
+	// AggregationAlignToClock starts windows on clock boundaries, e.g. every
+	// 5 minutes past the hour. When false, each device's windows start at
+	// its first message, and fleet aggregates combine device windows that
+	// only partly overlap.
+	AggregationAlignToClock bool `envconfig:"AGGREGATION_ALIGN_TO_CLOCK" default:"true"`
+
+	DetectorType string  `envconfig:"DETECTOR_TYPE" default:"zscore"`
+	EWMAAlpha    float64 `envconfig:"EWMA_ALPHA" default:"0.2"`
+	EWMABeta     float64 `envconfig:"EWMA_BETA" default:"0.2"`
+
+	// AlertThreshold is the default anomaly threshold, in standard deviations
+	// for the zscore detector.
+	AlertThreshold float64 `envconfig:"ALERT_THRESHOLD" default:"3.0"`
+
+	ThresholdConfigPath string        `envconfig:"THRESHOLD_CONFIG_PATH"`
+	RulesConfigPath     string        `envconfig:"RULES_CONFIG_PATH"`
+	AnomalyCooldown     time.Duration `envconfig:"ANOMALY_COOLDOWN" default:"5m"`
+
+	// An anomaly is re-emitted with high severity once its device metric has
+	// had EscalationThreshold anomalies within EscalationWindow. A zero
+	// threshold disables escalation.
+	EscalationWindow    time.Duration `envconfig:"ESCALATION_WINDOW" default:"10m"`
+	EscalationThreshold int           `envconfig:"ESCALATION_THRESHOLD" default:"5"`
+
+	// MaxRateOfChange limits how fast each metric may change, in units per
+	// second, e.g. "temperature:10,humidity:5".
+	MaxRateOfChange map[string]float64 `envconfig:"MAX_RATE_OF_CHANGE"`
+
+	FlatlineWindowSize int     `envconfig:"FLATLINE_WINDOW_SIZE" default:"20"`
+	FlatlineTolerance  float64 `envconfig:"FLATLINE_TOLERANCE" default:"0.001"`
+
+	// MultivariateMetrics lists the metrics scored together by Mahalanobis
+	// distance, e.g. "temperature,humidity". Fewer than two disables it.
+	MultivariateMetrics      []string `envconfig:"MULTIVARIATE_METRICS"`
+	MultivariateWindowSize   int      `envconfig:"MULTIVARIATE_WINDOW_SIZE" default:"100"`
+	MultivariateSignificance float64  `envconfig:"MULTIVARIATE_SIGNIFICANCE" default:"0.001"`
 
-	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	// CUSUM change-point detection, in standard deviations of the baseline
+	// maintained by the zscore detector. A zero threshold disables it.
+	CUSUMAllowance float64 `envconfig:"CUSUM_ALLOWANCE" default:"0.5"`
+	CUSUMThreshold float64 `envconfig:"CUSUM_THRESHOLD" default:"5.0"`
+
+	IQRBufferSize int     `envconfig:"IQR_BUFFER_SIZE" default:"100"`
+	IQRMultiplier float64 `envconfig:"IQR_MULTIPLIER" default:"1.5"`
+
+	OfflineCheckInterval time.Duration `envconfig:"OFFLINE_CHECK_INTERVAL" default:"5m"`
+	OfflineThreshold     time.Duration `envconfig:"OFFLINE_THRESHOLD" default:"10m"`
+
+	// ReportingInterval is the expected interval between messages of devices
+	// without their own expected_interval. A data gap is raised after
+	// GapThresholdMultiplier intervals without data.
+	ReportingInterval      time.Duration `envconfig:"REPORTING_INTERVAL" default:"30s"`
+	GapThresholdMultiplier float64       `envconfig:"GAP_THRESHOLD_MULTIPLIER" default:"10"`
+
+	StatsSnapshotPath   string `envconfig:"STATS_SNAPSHOT_PATH"`
+	WarmupLookbackHours int    `envconfig:"WARMUP_LOOKBACK_HOURS" default:"0"`
+
+	// WALPath is where the aggregator logs in-flight windows so they are
+	// replayed after a restart. Empty disables the WAL.
+	WALPath string `envconfig:"WAL_PATH"`
+
+	DatabaseURL   string `envconfig:"DATABASE_URL" required:"true"`
+	MigrationsDir string `envconfig:"MIGRATIONS_DIR" default:"migrations"`
+
+	// Aggregate and alert inserts are rejected for DBCircuitOpenDuration
+	// after DBFailureThreshold consecutive failures. Zero disables this.
+	DBFailureThreshold    int           `envconfig:"DB_FAILURE_THRESHOLD" default:"5"`
+	DBCircuitOpenDuration time.Duration `envconfig:"DB_CIRCUIT_OPEN_DURATION" default:"30s"`
+
+	// Data older than these many days is dropped by TimescaleDB. Zero keeps
+	// data indefinitely.
+	RetentionDaysAggregates int `envconfig:"RETENTION_DAYS_AGGREGATES" default:"90"`
+	RetentionDaysAlerts     int `envconfig:"RETENTION_DAYS_ALERTS" default:"365"`
+
+	// Aggregates older than DownsampleAfterDays are re-aggregated nightly
+	// into DownsampleResolutionMinutes buckets. Zero days disables it. The
+	// API reads only metric_aggregates, so downsampled aggregates drop out of
+	// its results.
+	DownsampleAfterDays         int `envconfig:"DOWNSAMPLE_AFTER_DAYS" default:"0"`
+	DownsampleResolutionMinutes int `envconfig:"DOWNSAMPLE_RESOLUTION_MINUTES" default:"60"`
+
+	// RedisURL enables caching of recent aggregate reads, e.g.
+	// "redis://localhost:6379/0". Empty disables the cache.
+	RedisURL string `envconfig:"REDIS_URL"`
+
+	// ConfigFile is a JSON file of reloadable settings overlaid on the
+	// environment and watched for changes. Empty disables it.
+	ConfigFile string `envconfig:"CONFIG_FILE"`
+
+	LogFormat string `envconfig:"LOG_FORMAT" default:"text"`
+
+	OTLPEndpoint string `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 
 	MetricsPort   string `envconfig:"METRICS_PORT" default:":9090"`
 	WebSocketPort string `envconfig:"WEBSOCKET_PORT" default:":8080"`
+	APIPort       string `envconfig:"API_PORT" default:":8082"`
+	SSEPort       string `envconfig:"SSE_PORT" default:":8083"`
+	GRPCPort      string `envconfig:"GRPC_PORT" default:":50051"`
+
+	JWTSecret          string `envconfig:"WS_JWT_SECRET"`
+	CompressionEnabled bool   `envconfig:"WS_COMPRESSION" default:"true"`
+
+	// ReplayBufferSize is how many recent broadcasts are replayed to newly
+	// subscribed WebSocket clients. Zero disables replay.
+	ReplayBufferSize int `envconfig:"WS_REPLAY_BUFFER_SIZE" default:"100"`
+
+	PingInterval time.Duration `envconfig:"WS_PING_INTERVAL" default:"30s"`
+	PongTimeout  time.Duration `envconfig:"WS_PONG_TIMEOUT" default:"10s"`
+
+	// CORSAllowedOrigins lists the browser origins allowed to call the REST
+	// API and connect to the WebSocket server, e.g.
+	// "https://dashboard.example.com". "*" allows every origin.
+	CORSAllowedOrigins []string `envconfig:"CORS_ALLOWED_ORIGINS"`
+
+	// APIRateLimit is how many REST API requests per second each client IP
+	// may make, in bursts of up to APIRateBurst. Zero disables the limit.
+	APIRateLimit float64 `envconfig:"API_RATE_LIMIT" default:"10"`
+	APIRateBurst int     `envconfig:"API_RATE_BURST" default:"20"`
+
+	// APIKeysFile is a JSON file of the API keys accepted by the REST API.
+	// Empty disables API authentication.
+	APIKeysFile string `envconfig:"API_KEYS_FILE"`
 }
 
 func Load() (*Config, error) {
@@ -24,5 +212,164 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.Brokers = ParseBrokers(cfg.KafkaBrokers)
+	if cfg.ConfigFile != "" {
+		if err := cfg.applyFile(cfg.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
 	return &cfg, nil
 }
+
+// ParseBrokers splits a comma-separated list of broker addresses, dropping
+// blank entries.
+func ParseBrokers(s string) []string {
+	var brokers []string
+	for _, broker := range strings.Split(s, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
+
+// ValidationError lists every invalid setting found by Validate.
+type ValidationError struct {
+	Failures []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Failures, "; ")
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Failures = append(e.Failures, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the settings that would otherwise only fail once a
+// connection is attempted. It returns a *ValidationError listing all failures.
+func (c *Config) Validate() error {
+	verr := &ValidationError{}
+
+	validateBrokers(verr, c.KafkaBrokers)
+	validateDSN(verr, c.DatabaseURL)
+
+	if c.KafkaPartitions < 1 {
+		verr.add("KAFKA_PARTITIONS must be at least 1, got %d", c.KafkaPartitions)
+	}
+	if c.KafkaReplicationFactor < 1 {
+		verr.add("KAFKA_REPLICATION_FACTOR must be at least 1, got %d", c.KafkaReplicationFactor)
+	}
+	if c.DownsampleAfterDays < 0 {
+		verr.add("DOWNSAMPLE_AFTER_DAYS must not be negative, got %d", c.DownsampleAfterDays)
+	}
+	if c.DownsampleAfterDays > 0 && c.DownsampleResolutionMinutes < 1 {
+		verr.add("DOWNSAMPLE_RESOLUTION_MINUTES must be at least 1, got %d", c.DownsampleResolutionMinutes)
+	}
+	if c.MaxDeviceChannels < 0 {
+		verr.add("MAX_DEVICE_CHANNELS must not be negative, got %d", c.MaxDeviceChannels)
+	}
+
+	ports := []struct{ name, value string }{
+		{"METRICS_PORT", c.MetricsPort},
+		{"WEBSOCKET_PORT", c.WebSocketPort},
+		{"API_PORT", c.APIPort},
+		{"SSE_PORT", c.SSEPort},
+		{"GRPC_PORT", c.GRPCPort},
+	}
+	for _, port := range ports {
+		validatePort(verr, port.name, port.value)
+	}
+
+	topics := []struct{ name, value string }{
+		{"KAFKA_TOPIC", c.KafkaTopic},
+		{"AGGREGATES_TOPIC", c.AggregatesTopic},
+		{"ALERTS_TOPIC", c.AlertsTopic},
+		{"COMMANDS_TOPIC", c.CommandsTopic},
+		{"FLEET_AGGREGATES_TOPIC", c.FleetAggregatesTopic},
+	}
+	for _, topic := range topics {
+		if strings.TrimSpace(topic.value) == "" {
+			verr.add("%s must not be empty", topic.name)
+		}
+	}
+
+	additionalTopics := []struct {
+		name   string
+		values []string
+	}{
+		{"ADDITIONAL_AGGREGATE_TOPICS", c.AdditionalAggregateTopics},
+		{"ADDITIONAL_ALERT_TOPICS", c.AdditionalAlertTopics},
+	}
+	for _, topics := range additionalTopics {
+		for _, topic := range topics.values {
+			if strings.TrimSpace(topic) == "" {
+				verr.add("%s must not contain empty topics", topics.name)
+				break
+			}
+		}
+	}
+
+	if len(verr.Failures) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func validateBrokers(verr *ValidationError, brokers string) {
+	if strings.TrimSpace(brokers) == "" {
+		verr.add("KAFKA_BROKERS must not be empty")
+		return
+	}
+	for _, broker := range strings.Split(brokers, ",") {
+		broker = strings.TrimSpace(broker)
+		host, port, err := net.SplitHostPort(broker)
+		if err != nil || host == "" || !validPortNumber(port) {
+			verr.add("KAFKA_BROKERS entry %q is not a host:port address", broker)
+		}
+	}
+}
+
+// validateDSN accepts the URL ("postgres://user@host/db") and keyword/value
+// ("host=localhost dbname=iot") connection string formats.
+func validateDSN(verr *ValidationError, dsn string) {
+	dsn = strings.TrimSpace(dsn)
+	if dsn == "" {
+		verr.add("DATABASE_URL must not be empty")
+		return
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			verr.add("DATABASE_URL is not a valid URL: %v", err)
+		} else if u.Host == "" {
+			verr.add("DATABASE_URL has no host")
+		}
+		return
+	}
+	if strings.Contains(dsn, "://") {
+		verr.add("DATABASE_URL must use the postgres:// or postgresql:// scheme")
+		return
+	}
+
+	for _, field := range strings.Fields(dsn) {
+		key, _, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			verr.add("DATABASE_URL is neither a postgres:// URL nor key=value pairs")
+			return
+		}
+	}
+}
+
+func validatePort(verr *ValidationError, name, value string) {
+	port, ok := strings.CutPrefix(value, ":")
+	if !ok || !validPortNumber(port) {
+		verr.add("%s must be \":<port>\" with a port between 1 and 65535, got %q", name, value)
+	}
+}
+
+func validPortNumber(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadableConfig holds the settings a config file may change at runtime.
+// Unset fields keep their environment value.
+type reloadableConfig struct {
+	AlertThreshold  *float64 `json:"alert_threshold"`
+	AnomalyCooldown *string  `json:"anomaly_cooldown"` // e.g. "5m"
+}
+
+// applyFile overlays the reloadable settings in the JSON file at path, such as
+//
+//	{"alert_threshold": 2.5, "anomaly_cooldown": "10m"}
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file reloadableConfig
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if file.AlertThreshold != nil {
+		if *file.AlertThreshold <= 0 {
+			return fmt.Errorf("config file %s: alert_threshold must be positive", path)
+		}
+		c.AlertThreshold = *file.AlertThreshold
+	}
+	if file.AnomalyCooldown != nil {
+		cooldown, err := time.ParseDuration(*file.AnomalyCooldown)
+		if err != nil {
+			return fmt.Errorf("config file %s: invalid anomaly_cooldown: %w", path, err)
+		}
+		c.AnomalyCooldown = cooldown
+	}
+	return nil
+}
+
+// ConfigWatcher re-reads a config file when it changes and publishes the
+// resulting configuration. Only the reloadable settings differ from the base
+// configuration.
+type ConfigWatcher struct {
+	path    string
+	base    Config
+	watcher *fsnotify.Watcher
+	updates chan Config
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewConfigWatcher watches path, overlaying it on base on every change.
+func NewConfigWatcher(path string, base *Config) (*ConfigWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config file watcher: %w", err)
+	}
+
+	// Watch the directory, as many editors replace the file rather than
+	// write to it
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch config file %s: %w", path, err)
+	}
+
+	return &ConfigWatcher{
+		path:    filepath.Clean(path),
+		base:    *base,
+		watcher: watcher,
+		updates: make(chan Config, 1),
+	}, nil
+}
+
+// Updates delivers the configuration after each successful reload. Only the
+// latest configuration is kept if the receiver falls behind.
+func (w *ConfigWatcher) Updates() <-chan Config {
+	return w.updates
+}
+
+// Start launches the goroutine watching the file. It runs until ctx is
+// cancelled or Stop is called.
+func (w *ConfigWatcher) Start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		for {
+			select {
+			case event, ok := <-w.watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != w.path || !event.Has(fsnotify.Write|fsnotify.Create) {
+					continue
+				}
+				w.reload()
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Config file watcher error", slog.String("path", w.path), slog.Any("error", err))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	slog.Info("Watching config file", slog.String("path", w.path))
+}
+
+func (w *ConfigWatcher) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+	w.watcher.Close()
+}
+
+func (w *ConfigWatcher) reload() {
+	cfg := w.base
+	if err := cfg.applyFile(w.path); err != nil {
+		// A partially written file fails to parse; the final write reloads it
+		slog.Warn("Failed to reload config file", slog.String("path", w.path), slog.Any("error", err))
+		return
+	}
+
+	// Replace an update the receiver has not picked up yet
+	select {
+	case <-w.updates:
+	default:
+	}
+	w.updates <- cfg
+	slog.Info("Config file reloaded", slog.String("path", w.path))
+}
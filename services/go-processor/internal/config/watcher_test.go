@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_OverlaysConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"alert_threshold": 2.5, "anomaly_cooldown": "10m"}`), 0o644))
+
+	t.Setenv("DATABASE_URL", "postgres://localhost/iot")
+	t.Setenv("ALERT_THRESHOLD", "4")
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, cfg.AlertThreshold)
+	assert.Equal(t, 10*time.Minute, cfg.AnomalyCooldown)
+}
+
+func TestApplyFile_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "config.json")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	cfg := Config{AlertThreshold: 3}
+	assert.Error(t, cfg.applyFile(write(`{"alert_threshold": `)))
+	assert.ErrorContains(t, cfg.applyFile(write(`{"alert_threshold": -1}`)), "alert_threshold")
+	assert.ErrorContains(t, cfg.applyFile(write(`{"anomaly_cooldown": "soon"}`)), "anomaly_cooldown")
+	assert.Error(t, cfg.applyFile(filepath.Join(dir, "missing.json")))
+	assert.Equal(t, 3.0, cfg.AlertThreshold)
+}
+
+func TestConfigWatcher_PublishesChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"alert_threshold": 3}`), 0o644))
+
+	base := &Config{AlertThreshold: 3, KafkaTopic: "raw.events"}
+	watcher, err := NewConfigWatcher(path, base)
+	assert.NoError(t, err)
+	watcher.Start(context.Background())
+	defer watcher.Stop()
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"alert_threshold": 2}`), 0o644))
+
+	select {
+	case cfg := <-watcher.Updates():
+		assert.Equal(t, 2.0, cfg.AlertThreshold)
+		assert.Equal(t, "raw.events", cfg.KafkaTopic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no config update after writing the file")
+	}
+}
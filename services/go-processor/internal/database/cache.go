@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// aggregateCacheTTL bounds how stale a cached aggregate read can be.
+	// Aggregates are written once per minute window.
+	aggregateCacheTTL = 60 * time.Second
+
+	redisTimeout = time.Second
+)
+
+// CachingTimescaleDB serves recent aggregate reads from Redis, falling back
+// to TimescaleDB on a miss. Every other method goes straight to the embedded
+// TimescaleDB. Redis errors are logged and treated as misses, so an
+// unavailable cache never fails a read.
+type CachingTimescaleDB struct {
+	*TimescaleDB
+	redis *redis.Client
+
+	// timeout bounds each Redis call; see redisTimeout.
+	timeout time.Duration
+}
+
+func NewCachingTimescaleDB(db *TimescaleDB, redisURL string) (*CachingTimescaleDB, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping Redis: %w", err)
+	}
+
+	return &CachingTimescaleDB{TimescaleDB: db, redis: client, timeout: redisTimeout}, nil
+}
+
+func (c *CachingTimescaleDB) GetRecentAggregates(deviceID string, hours int, limit int) ([]AggregateRecord, error) {
+	key := fmt.Sprintf("agg:%s:%d:%d", deviceID, hours, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	cached, err := c.redis.Get(ctx, key).Bytes()
+	cancel()
+	if err == nil {
+		var aggregates []AggregateRecord
+		if err := json.Unmarshal(cached, &aggregates); err == nil {
+			return aggregates, nil
+		}
+		slog.Warn("Discarding undecodable cached aggregates", slog.String("key", key))
+	} else if !errors.Is(err, redis.Nil) {
+		slog.Warn("Failed to read aggregates from cache", slog.String("key", key), slog.Any("error", err))
+	}
+
+	aggregates, err := c.TimescaleDB.GetRecentAggregates(deviceID, hours, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(aggregates)
+	if err != nil {
+		return aggregates, nil
+	}
+
+	// A fresh timeout, so reads slower than it, which gain most from the
+	// cache, are still cached
+	ctx, cancel = context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if err := c.redis.Set(ctx, key, data, aggregateCacheTTL).Err(); err != nil {
+		slog.Warn("Failed to cache aggregates", slog.String("key", key), slog.Any("error", err))
+	}
+
+	return aggregates, nil
+}
+
+// CloseCache closes the Redis client. The embedded TimescaleDB is closed
+// separately.
+func (c *CachingTimescaleDB) CloseCache() error {
+	return c.redis.Close()
+}
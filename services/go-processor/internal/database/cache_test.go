@@ -0,0 +1,85 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachingTimescaleDB_GetRecentAggregates(t *testing.T) {
+	windowStart := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	drv := &recordingDriver{
+		columns: []string{"device_id", "timestamp", "window_start", "window_end",
+			"metric_name", "metric_value", "sample_count", "aggregation_function"},
+		rows: [][]driver.Value{
+			{"device-1", windowStart, windowStart, windowStart.Add(time.Minute), "temperature", 21.5, int64(60), "mean"},
+		},
+	}
+	sql.Register("recording-cached-aggregates", drv)
+
+	db, err := sql.Open("recording-cached-aggregates", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mr := miniredis.RunT(t)
+	cache, err := NewCachingTimescaleDB(&TimescaleDB{db: db}, "redis://"+mr.Addr())
+	assert.NoError(t, err)
+	defer cache.CloseCache()
+
+	// Miss: read from the database and cached for a minute
+	first, err := cache.GetRecentAggregates("device-1", 24, 100)
+	assert.NoError(t, err)
+	assert.Len(t, first, 1)
+	assert.Equal(t, recentAggregatesQuery, drv.query)
+	assert.True(t, mr.Exists("agg:device-1:24:100"))
+	assert.Equal(t, aggregateCacheTTL, mr.TTL("agg:device-1:24:100"))
+
+	// Hit: the database is not queried
+	drv.query = ""
+	second, err := cache.GetRecentAggregates("device-1", 24, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Empty(t, drv.query)
+
+	// Expired: read from the database again
+	mr.FastForward(aggregateCacheTTL)
+	_, err = cache.GetRecentAggregates("device-1", 24, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, recentAggregatesQuery, drv.query)
+
+	// Redis down: reads still succeed
+	mr.Close()
+	drv.query = ""
+	third, err := cache.GetRecentAggregates("device-1", 24, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, first, third)
+	assert.Equal(t, recentAggregatesQuery, drv.query)
+}
+
+func TestCachingTimescaleDB_CachesSlowReads(t *testing.T) {
+	drv := &recordingDriver{
+		columns: []string{"device_id", "timestamp", "window_start", "window_end",
+			"metric_name", "metric_value", "sample_count", "aggregation_function"},
+		delay: 50 * time.Millisecond,
+	}
+	sql.Register("recording-cached-slow-aggregates", drv)
+
+	db, err := sql.Open("recording-cached-slow-aggregates", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mr := miniredis.RunT(t)
+	cache, err := NewCachingTimescaleDB(&TimescaleDB{db: db}, "redis://"+mr.Addr())
+	assert.NoError(t, err)
+	defer cache.CloseCache()
+
+	// The query outlasts the Redis timeout, which must not stop caching
+	cache.timeout = 20 * time.Millisecond
+	_, err = cache.GetRecentAggregates("device-1", 24, 100)
+	assert.NoError(t, err)
+	assert.True(t, mr.Exists("agg:device-1:24:100"))
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-processor/internal/metrics"
+)
+
+// ErrCircuitOpen is returned for database writes rejected by an open circuit
+// breaker.
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker. The values are exported as
+// the circuit state gauge.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker stops calling the database after FailureThreshold
+// consecutive failures. While open, calls fail immediately with
+// ErrCircuitOpen; after OpenDuration a single probe call is let through, and
+// its success closes the circuit again.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	now func() time.Time
+
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	mutex    sync.Mutex
+}
+
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	metrics.DBCircuitState.Set(float64(CircuitClosed))
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenDuration:     openDuration,
+		now:              time.Now,
+	}
+}
+
+// State returns the current state, moving an open circuit whose duration has
+// elapsed to half-open.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == CircuitOpen && cb.now().Sub(cb.openedAt) >= cb.OpenDuration {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// Execute runs fn unless the circuit is open. A nil breaker always runs fn.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	if cb == nil {
+		return fn()
+	}
+	if err := cb.allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	cb.record(err)
+	return err
+}
+
+func (cb *CircuitBreaker) allow() error {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.OpenDuration {
+			return ErrCircuitOpen
+		}
+		// This call is the probe; others are rejected until it completes
+		cb.setState(CircuitHalfOpen)
+		return nil
+	case CircuitHalfOpen:
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+func (cb *CircuitBreaker) record(err error) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if err == nil {
+		cb.failures = 0
+		if cb.state != CircuitClosed {
+			slog.Info("Database circuit breaker closed")
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.FailureThreshold {
+		cb.trip(err)
+	}
+}
+
+func (cb *CircuitBreaker) trip(err error) {
+	cb.openedAt = cb.now()
+	cb.setState(CircuitOpen)
+	metrics.DBCircuitTrips.Inc()
+	slog.Warn("Database circuit breaker opened",
+		slog.Int("consecutive_failures", cb.failures),
+		slog.Duration("open_duration", cb.OpenDuration),
+		slog.Any("error", err))
+}
+
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	cb.state = state
+	metrics.DBCircuitState.Set(float64(state))
+}
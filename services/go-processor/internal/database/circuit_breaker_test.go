@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBreaker(now *time.Time) *CircuitBreaker {
+	cb := NewCircuitBreaker(3, 30*time.Second)
+	cb.now = func() time.Time { return *now }
+	return cb
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cb := newTestBreaker(&now)
+	dbErr := errors.New("connection refused")
+
+	calls := 0
+	failing := func() error { calls++; return dbErr }
+
+	assert.ErrorIs(t, cb.Execute(failing), dbErr)
+	assert.ErrorIs(t, cb.Execute(failing), dbErr)
+	assert.NoError(t, cb.Execute(func() error { return nil }))
+
+	// The success reset the count, so three more failures are needed
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, cb.Execute(failing), dbErr)
+	}
+	assert.Equal(t, CircuitOpen, cb.State())
+	assert.Equal(t, 5, calls)
+
+	assert.ErrorIs(t, cb.Execute(failing), ErrCircuitOpen)
+	assert.Equal(t, 5, calls)
+}
+
+func TestCircuitBreaker_ProbeClosesCircuit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cb := newTestBreaker(&now)
+	for i := 0; i < 3; i++ {
+		cb.Execute(func() error { return errors.New("timeout") })
+	}
+
+	now = now.Add(29 * time.Second)
+	assert.ErrorIs(t, cb.Execute(func() error { return nil }), ErrCircuitOpen)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+
+	// Only one probe is let through at a time
+	probed := false
+	assert.NoError(t, cb.Execute(func() error {
+		probed = true
+		assert.ErrorIs(t, cb.Execute(func() error { return nil }), ErrCircuitOpen)
+		return nil
+	}))
+	assert.True(t, probed)
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestCircuitBreaker_FailedProbeReopens(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cb := newTestBreaker(&now)
+	for i := 0; i < 3; i++ {
+		cb.Execute(func() error { return errors.New("timeout") })
+	}
+
+	now = now.Add(30 * time.Second)
+	assert.Error(t, cb.Execute(func() error { return errors.New("still down") }))
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	// The open duration restarts from the failed probe
+	now = now.Add(29 * time.Second)
+	assert.ErrorIs(t, cb.Execute(func() error { return nil }), ErrCircuitOpen)
+	now = now.Add(time.Second)
+	assert.NoError(t, cb.Execute(func() error { return nil }))
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestTimescaleDB_InsertsUseCircuitBreaker(t *testing.T) {
+	// A closed pool fails every call without a server
+	conn, err := sql.Open("postgres", "postgres://localhost/iot")
+	assert.NoError(t, err)
+	conn.Close()
+
+	now := time.Unix(1700000000, 0)
+	tsdb := &TimescaleDB{db: conn}
+	tsdb.UseCircuitBreaker(newTestBreaker(&now))
+
+	aggregates := []AggregateRecord{{DeviceID: "device-1", MetricName: "temperature"}}
+	assert.ErrorContains(t, tsdb.InsertAggregates(aggregates), "database is closed")
+	assert.ErrorContains(t, tsdb.InsertAggregatesBulk(aggregates), "database is closed")
+	assert.ErrorContains(t, tsdb.InsertAlert(AlertRecord{DeviceID: "device-1"}), "database is closed")
+
+	assert.ErrorIs(t, tsdb.InsertAlert(AlertRecord{DeviceID: "device-1"}), ErrCircuitOpen)
+	assert.ErrorIs(t, tsdb.InsertAggregates(aggregates), ErrCircuitOpen)
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var aggregatesCSVHeader = []string{
+	"device_id", "timestamp", "window_start", "window_end", "metric_name",
+	"aggregation_function", "metric_value", "sample_count",
+}
+
+var alertsCSVHeader = []string{
+	"id", "device_id", "timestamp", "metric_name", "metric_value", "alert_type",
+	"severity", "z_score", "threshold", "status", "message",
+	"acknowledged_at", "acknowledged_by", "resolved_at", "resolved_by", "notes",
+}
+
+const exportAggregatesQuery = `
+	SELECT device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count, aggregation_function
+	FROM metric_aggregates
+	WHERE device_id = $1 AND timestamp >= $2 AND timestamp < $3
+	ORDER BY timestamp, metric_name, aggregation_function
+`
+
+const exportAlertsQuery = `
+	SELECT ` + alertColumns + `
+	FROM alerts
+	WHERE device_id = $1 AND timestamp >= $2 AND timestamp < $3
+	ORDER BY timestamp, id
+`
+
+// ExportAggregatesCSV writes a device's aggregates in [from, to) to w as CSV,
+// oldest first, one row at a time as they are read.
+func (tsdb *TimescaleDB) ExportAggregatesCSV(w io.Writer, deviceID string, from, to time.Time) error {
+	rows, err := tsdb.db.Query(exportAggregatesQuery, deviceID, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to query aggregates: %w", err)
+	}
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(aggregatesCSVHeader); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	for rows.Next() {
+		var agg AggregateRecord
+		err := rows.Scan(
+			&agg.DeviceID,
+			&agg.Timestamp,
+			&agg.WindowStart,
+			&agg.WindowEnd,
+			&agg.MetricName,
+			&agg.MetricValue,
+			&agg.SampleCount,
+			&agg.Function,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan aggregate: %w", err)
+		}
+
+		err = writer.Write([]string{
+			agg.DeviceID,
+			csvTime(agg.Timestamp),
+			csvTime(agg.WindowStart),
+			csvTime(agg.WindowEnd),
+			agg.MetricName,
+			aggregationFunction(agg.Function),
+			csvFloat(agg.MetricValue),
+			strconv.Itoa(agg.SampleCount),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read aggregates: %w", err)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportAlertsCSV writes a device's alerts raised in [from, to) to w as CSV,
+// oldest first, one row at a time as they are read.
+func (tsdb *TimescaleDB) ExportAlertsCSV(w io.Writer, deviceID string, from, to time.Time) error {
+	rows, err := tsdb.db.Query(exportAlertsQuery, deviceID, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(alertsCSVHeader); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan alert: %w", err)
+		}
+
+		err = writer.Write([]string{
+			strconv.Itoa(alert.ID),
+			alert.DeviceID,
+			csvTime(alert.Timestamp),
+			alert.MetricName,
+			csvFloat(alert.MetricValue),
+			alert.AlertType,
+			alert.Severity,
+			csvFloat(alert.ZScore),
+			csvFloat(alert.Threshold),
+			alert.Status,
+			alert.Message,
+			csvOptionalTime(alert.AcknowledgedAt),
+			alert.AcknowledgedBy,
+			csvOptionalTime(alert.ResolvedAt),
+			alert.ResolvedBy,
+			alert.Notes,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read alerts: %w", err)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// csvOptionalTime leaves the field empty when t is nil.
+func csvOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return csvTime(*t)
+}
+
+func csvFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
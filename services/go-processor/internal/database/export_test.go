@@ -0,0 +1,96 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportAggregatesCSV(t *testing.T) {
+	windowStart := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	drv := &recordingDriver{
+		columns: []string{"device_id", "timestamp", "window_start", "window_end",
+			"metric_name", "metric_value", "sample_count", "aggregation_function"},
+		rows: [][]driver.Value{
+			{"device-1", windowStart, windowStart, windowStart.Add(time.Minute), "temperature", 21.5, int64(60), "mean"},
+			{"device-1", windowStart, windowStart, windowStart.Add(time.Minute), "temperature", 23.25, int64(60), "max"},
+			{"device-1", windowStart.Add(time.Minute), windowStart.Add(time.Minute), windowStart.Add(2 * time.Minute), "room, north", 0.1, int64(3), ""},
+		},
+	}
+	sql.Register("recording-export-aggregates", drv)
+
+	db, err := sql.Open("recording-export-aggregates", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+	from := windowStart.Add(-time.Hour)
+	to := windowStart.Add(time.Hour)
+
+	var buf bytes.Buffer
+	assert.NoError(t, tsdb.ExportAggregatesCSV(&buf, "device-1", from, to))
+
+	assert.Equal(t, "device_id,timestamp,window_start,window_end,metric_name,aggregation_function,metric_value,sample_count\n"+
+		"device-1,2024-01-01T12:00:00Z,2024-01-01T12:00:00Z,2024-01-01T12:01:00Z,temperature,mean,21.5,60\n"+
+		"device-1,2024-01-01T12:00:00Z,2024-01-01T12:00:00Z,2024-01-01T12:01:00Z,temperature,max,23.25,60\n"+
+		"device-1,2024-01-01T12:01:00Z,2024-01-01T12:01:00Z,2024-01-01T12:02:00Z,\"room, north\",mean,0.1,3\n",
+		buf.String())
+	assert.Equal(t, exportAggregatesQuery, drv.query)
+	assert.Equal(t, []driver.Value{"device-1", from, to}, drv.args)
+}
+
+func TestExportAlertsCSV(t *testing.T) {
+	raised := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	acknowledged := raised.Add(5 * time.Minute)
+	drv := &recordingDriver{
+		columns: []string{"id", "device_id", "timestamp", "metric_name", "metric_value",
+			"alert_type", "severity", "z_score", "threshold", "status", "message",
+			"acknowledged_at", "resolved_at", "acknowledged_by", "resolved_by", "notes"},
+		rows: [][]driver.Value{
+			{int64(7), "device-1", raised, "temperature", 95.5, "anomaly", "high", 4.2, 3.0, "acknowledged",
+				"Temperature anomaly detected", acknowledged, nil, "alice", "", ""},
+			{int64(8), "device-1", raised.Add(time.Minute), "humidity", 10.0, "threshold", "low", 0.0, 20.0, "open",
+				"", nil, nil, "", "", ""},
+		},
+	}
+	sql.Register("recording-export-alerts", drv)
+
+	db, err := sql.Open("recording-export-alerts", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+	from := raised.Add(-time.Hour)
+	to := raised.Add(time.Hour)
+
+	var buf bytes.Buffer
+	assert.NoError(t, tsdb.ExportAlertsCSV(&buf, "device-1", from, to))
+
+	assert.Equal(t, "id,device_id,timestamp,metric_name,metric_value,alert_type,severity,z_score,threshold,status,message,"+
+		"acknowledged_at,acknowledged_by,resolved_at,resolved_by,notes\n"+
+		"7,device-1,2024-01-01T12:00:00Z,temperature,95.5,anomaly,high,4.2,3,acknowledged,Temperature anomaly detected,"+
+		"2024-01-01T12:05:00Z,alice,,,\n"+
+		"8,device-1,2024-01-01T12:01:00Z,humidity,10,threshold,low,0,20,open,,,,,,\n",
+		buf.String())
+	assert.Equal(t, exportAlertsQuery, drv.query)
+	assert.Equal(t, []driver.Value{"device-1", from, to}, drv.args)
+}
+
+func TestExportAggregatesCSV_NoRows(t *testing.T) {
+	drv := &recordingDriver{columns: []string{"device_id", "timestamp", "window_start", "window_end",
+		"metric_name", "metric_value", "sample_count", "aggregation_function"}}
+	sql.Register("recording-export-empty", drv)
+
+	db, err := sql.Open("recording-export-empty", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	tsdb := &TimescaleDB{db: db}
+	assert.NoError(t, tsdb.ExportAggregatesCSV(&buf, "device-1", time.Now().Add(-time.Hour), time.Now()))
+	assert.Equal(t, "device_id,timestamp,window_start,window_end,metric_name,aggregation_function,metric_value,sample_count\n", buf.String())
+}
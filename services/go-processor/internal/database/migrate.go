@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// Migrate applies the pending migrations in migrationsDir. Applied
+// migrations are recorded in the schema_migrations table and skipped, so it
+// is safe to run on every start.
+func Migrate(db *sql.DB, migrationsDir string) error {
+	ctx := context.Background()
+
+	// A dedicated connection lets the driver be closed without closing db
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration connection: %w", err)
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	m, err := migrate.NewWithDatabaseInstance("file://"+migrationsDir, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		return fmt.Errorf("failed to load migrations from %s: %w", migrationsDir, err)
+	}
+	defer m.Close()
+
+	return applyMigrations(m)
+}
+
+func applyMigrations(m *migrate.Migrate) error {
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	version, _, err := m.Version()
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	slog.Info("Database schema up to date", slog.Uint64("version", uint64(version)))
+	return nil
+}
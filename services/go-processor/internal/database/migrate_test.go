@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMigrationsDir = "../../migrations"
+
+func TestApplyMigrations_Idempotent(t *testing.T) {
+	driver, err := stub.WithInstance(nil, &stub.Config{})
+	assert.NoError(t, err)
+	m, err := migrate.NewWithDatabaseInstance("file://"+testMigrationsDir, "stub", driver)
+	assert.NoError(t, err)
+
+	assert.NoError(t, applyMigrations(m))
+	assert.Len(t, driver.(*stub.Stub).MigrationSequence, 7)
+
+	// A second run finds nothing to apply
+	assert.NoError(t, applyMigrations(m))
+	assert.Len(t, driver.(*stub.Stub).MigrationSequence, 7)
+
+	version, dirty, err := m.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), version)
+	assert.False(t, dirty)
+}
+
+// TestMigrate_Postgres runs the migrations against a real TimescaleDB
+// instance and is skipped unless TEST_DATABASE_URL points at one.
+func TestMigrate_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.NoError(t, Migrate(db, testMigrationsDir))
+	assert.NoError(t, Migrate(db, testMigrationsDir))
+
+	// The connection pool survives the migration driver being closed
+	assert.NoError(t, db.Ping())
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrShadowNotFound is returned for devices without a shadow.
+var ErrShadowNotFound = errors.New("device shadow not found")
+
+// DeviceShadow is the desired state of a device, set through the API, and
+// the state it last reported. Version counts the updates of either.
+type DeviceShadow struct {
+	DeviceID  string                 `json:"device_id"`
+	Desired   map[string]interface{} `json:"desired"`
+	Reported  map[string]interface{} `json:"reported"`
+	Version   int                    `json:"version"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// Delta returns the desired values the device has not reported yet, keyed
+// like Desired. It is empty once the device is in its desired state.
+func (s *DeviceShadow) Delta() map[string]interface{} {
+	delta := make(map[string]interface{})
+	for key, desired := range s.Desired {
+		if reported, ok := s.Reported[key]; !ok || !reflect.DeepEqual(desired, reported) {
+			delta[key] = desired
+		}
+	}
+	return delta
+}
+
+func (tsdb *TimescaleDB) GetDeviceShadow(deviceID string) (*DeviceShadow, error) {
+	query := `
+		SELECT device_id, desired, reported, version, updated_at
+		FROM device_shadows
+		WHERE device_id = $1
+	`
+
+	var shadow DeviceShadow
+	var desired, reported []byte
+	err := tsdb.db.QueryRow(query, deviceID).Scan(&shadow.DeviceID, &desired, &reported, &shadow.Version, &shadow.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("device %s: %w", deviceID, ErrShadowNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device shadow: %w", err)
+	}
+
+	if err := json.Unmarshal(desired, &shadow.Desired); err != nil {
+		return nil, fmt.Errorf("failed to decode desired state: %w", err)
+	}
+	if err := json.Unmarshal(reported, &shadow.Reported); err != nil {
+		return nil, fmt.Errorf("failed to decode reported state: %w", err)
+	}
+	return &shadow, nil
+}
+
+// UpdateDesiredState replaces the desired state of a device, creating its
+// shadow if needed.
+func (tsdb *TimescaleDB) UpdateDesiredState(deviceID string, desired map[string]interface{}) error {
+	query := `
+		INSERT INTO device_shadows (device_id, desired, version, updated_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (device_id)
+		DO UPDATE SET
+			desired = EXCLUDED.desired,
+			version = device_shadows.version + 1,
+			updated_at = NOW()
+	`
+
+	if err := tsdb.upsertShadowState(query, deviceID, desired); err != nil {
+		return fmt.Errorf("failed to update desired state: %w", err)
+	}
+	return nil
+}
+
+// UpdateReportedState merges reported into the reported state of a device,
+// creating its shadow if needed. Keys absent from reported keep their last
+// reported value.
+func (tsdb *TimescaleDB) UpdateReportedState(deviceID string, reported map[string]interface{}) error {
+	query := `
+		INSERT INTO device_shadows (device_id, reported, version, updated_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (device_id)
+		DO UPDATE SET
+			reported = device_shadows.reported || EXCLUDED.reported,
+			version = device_shadows.version + 1,
+			updated_at = NOW()
+	`
+
+	if err := tsdb.upsertShadowState(query, deviceID, reported); err != nil {
+		return fmt.Errorf("failed to update reported state: %w", err)
+	}
+	return nil
+}
+
+// upsertShadowState runs query with the device ID and state as JSONB. A nil
+// state is stored as an empty object.
+func (tsdb *TimescaleDB) upsertShadowState(query, deviceID string, state map[string]interface{}) error {
+	if state == nil {
+		state = map[string]interface{}{}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	_, err = tsdb.db.Exec(query, deviceID, string(data))
+	return err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceShadow_Delta(t *testing.T) {
+	shadow := DeviceShadow{
+		Desired:  map[string]interface{}{"interval": 30.0, "mode": "eco", "led": true},
+		Reported: map[string]interface{}{"interval": 60.0, "mode": "eco", "temperature": 21.5},
+	}
+
+	assert.Equal(t, map[string]interface{}{"interval": 30.0, "led": true}, shadow.Delta())
+
+	shadow.Reported["interval"] = 30.0
+	shadow.Reported["led"] = true
+	assert.Empty(t, shadow.Delta())
+}
+
+func TestGetDeviceShadow_DecodesRow(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	drv := &recordingDriver{
+		columns: []string{"device_id", "desired", "reported", "version", "updated_at"},
+		rows: [][]driver.Value{
+			{"device-1", []byte(`{"interval": 30}`), []byte(`{"temperature": 21.5}`), int64(4), updatedAt},
+		},
+	}
+	sql.Register("recording-device-shadow", drv)
+
+	db, err := sql.Open("recording-device-shadow", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	shadow, err := (&TimescaleDB{db: db}).GetDeviceShadow("device-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &DeviceShadow{
+		DeviceID:  "device-1",
+		Desired:   map[string]interface{}{"interval": 30.0},
+		Reported:  map[string]interface{}{"temperature": 21.5},
+		Version:   4,
+		UpdatedAt: updatedAt,
+	}, shadow)
+	assert.Equal(t, []driver.Value{"device-1"}, drv.args)
+}
+
+func TestGetDeviceShadow_NotFound(t *testing.T) {
+	drv := &recordingDriver{columns: []string{"device_id"}}
+	sql.Register("recording-missing-shadow", drv)
+
+	db, err := sql.Open("recording-missing-shadow", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = (&TimescaleDB{db: db}).GetDeviceShadow("device-404")
+	assert.ErrorIs(t, err, ErrShadowNotFound)
+}
+
+func TestUpdateShadowState_BindsJSON(t *testing.T) {
+	drv := &recordingDriver{}
+	sql.Register("recording-shadow-updates", drv)
+
+	db, err := sql.Open("recording-shadow-updates", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+	assert.NoError(t, tsdb.UpdateDesiredState("device-1", map[string]interface{}{"interval": 30}))
+	assert.NoError(t, tsdb.UpdateReportedState("device-1", nil))
+
+	assert.Equal(t, [][]driver.Value{
+		{"device-1", `{"interval":30}`},
+		{"device-1", `{}`},
+	}, drv.execs)
+}
+
+// TestDeviceShadow_Postgres runs against a real TimescaleDB instance and is
+// skipped unless TEST_DATABASE_URL points at one.
+func TestDeviceShadow_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer func() {
+		tsdb.db.Exec("DELETE FROM device_shadows WHERE device_id = 'shadow-device'")
+		tsdb.Close()
+	}()
+
+	_, err = tsdb.GetDeviceShadow("shadow-device")
+	assert.ErrorIs(t, err, ErrShadowNotFound)
+
+	assert.NoError(t, tsdb.UpdateReportedState("shadow-device", map[string]interface{}{"temperature": 21.5, "interval": 60}))
+	assert.NoError(t, tsdb.UpdateReportedState("shadow-device", map[string]interface{}{"humidity": 40}))
+	assert.NoError(t, tsdb.UpdateDesiredState("shadow-device", map[string]interface{}{"interval": 30}))
+
+	shadow, err := tsdb.GetDeviceShadow("shadow-device")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"interval": 30.0}, shadow.Desired)
+	assert.Equal(t, map[string]interface{}{"temperature": 21.5, "interval": 60.0, "humidity": 40.0}, shadow.Reported)
+	assert.Equal(t, 3, shadow.Version)
+	assert.Equal(t, map[string]interface{}{"interval": 30.0}, shadow.Delta())
+}
@@ -1,16 +1,30 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"go-processor/internal/health"
+	"go-processor/internal/metrics"
+
+	"github.com/lib/pq"
 )
 
 type TimescaleDB struct {
 	db *sql.DB
+
+	// breaker guards aggregate and alert inserts. Nil disables it.
+	breaker *CircuitBreaker
+
+	// lastWrite is when an aggregate or alert insert last succeeded, in Unix
+	// nanoseconds.
+	lastWrite atomic.Int64
 }
 
 type AggregateRecord struct {
@@ -21,6 +35,43 @@ type AggregateRecord struct {
 	MetricName  string    `json:"metric_name"`
 	MetricValue float64   `json:"metric_value"`
 	SampleCount int       `json:"sample_count"`
+	Function    string    `json:"function"`
+}
+
+// RollupRecord is an hourly or daily summary of per-minute mean aggregates.
+type RollupRecord struct {
+	DeviceID    string    `json:"device_id"`
+	BucketStart time.Time `json:"bucket_start"`
+	BucketEnd   time.Time `json:"bucket_end"`
+	MetricName  string    `json:"metric_name"`
+	MeanValue   float64   `json:"mean_value"`
+	MinValue    float64   `json:"min_value"`
+	MaxValue    float64   `json:"max_value"`
+	SampleCount int       `json:"sample_count"`
+}
+
+// MetricSummary summarises one metric of a device over a time range.
+type MetricSummary struct {
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Avg         float64 `json:"avg"`
+	Latest      float64 `json:"latest"`
+	SampleCount int     `json:"sample_count"`
+}
+
+// FleetMetricSummary summarizes a metric across every device reporting it.
+type FleetMetricSummary struct {
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Avg         float64 `json:"avg"`
+	SampleCount int     `json:"sample_count"`
+	DeviceCount int     `json:"device_count"`
+}
+
+// MetricAnomalyCount is the number of anomaly alerts raised for one metric.
+type MetricAnomalyCount struct {
+	Metric string `json:"metric"`
+	Count  int    `json:"count"`
 }
 
 type AlertRecord struct {
@@ -35,9 +86,83 @@ type AlertRecord struct {
 	Threshold   float64   `json:"threshold"`
 	Status      string    `json:"status"`
 	Message     string    `json:"message"`
+
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	ResolvedBy     string     `json:"resolved_by,omitempty"`
+	Notes          string     `json:"notes,omitempty"`
+}
+
+// Actions recorded in the alert audit log.
+const (
+	AuditActionAcknowledge = "acknowledge"
+	AuditActionResolve     = "resolve"
+)
+
+// AlertAuditEntry is a row of the alert_audit_log table, recording one
+// change to the status of an alert.
+type AlertAuditEntry struct {
+	ID        int       `json:"id"`
+	AlertID   int       `json:"alert_id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	OldStatus string    `json:"old_status,omitempty"`
+	NewStatus string    `json:"new_status,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+// DeviceRecord is a row of the devices table.
+type DeviceRecord struct {
+	DeviceID   string                 `json:"device_id"`
+	DeviceName string                 `json:"device_name"`
+	DeviceType string                 `json:"device_type"`
+	Location   string                 `json:"location"`
+	LastSeen   *time.Time             `json:"last_seen,omitempty"`
+	Status     string                 `json:"status"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+
+	// ExpectedInterval is how often the device normally reports. Zero means
+	// the configured default applies.
+	ExpectedInterval time.Duration `json:"expected_interval_ns,omitempty"`
+
+	// GeoLocation is where the device is installed. Location remains the
+	// free-text description.
+	GeoLocation *DeviceLocation `json:"geo_location,omitempty"`
+
+	// FirmwareVersion is the firmware the device last reported running.
+	FirmwareVersion string `json:"firmware_version,omitempty"`
 }
 
-func NewTimescaleDB(connectionString string) (*TimescaleDB, error) {
+// DeviceReport is what a device reports about itself alongside its
+// telemetry. Zero fields leave the stored values unchanged.
+type DeviceReport struct {
+	Location        *DeviceLocation
+	FirmwareVersion string
+	DeviceType      string
+}
+
+// DeviceLocation is the physical position of a device, stored as JSONB in
+// the geo_location column of the devices table.
+type DeviceLocation struct {
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	BuildingID string  `json:"building_id,omitempty"`
+	Floor      string  `json:"floor,omitempty"`
+}
+
+// ErrAlertNotFound is returned when no alert exists with the requested ID.
+var ErrAlertNotFound = errors.New("alert not found")
+
+// ErrDeviceNotFound is returned when no device exists with the requested ID.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// NewTimescaleDB connects to the database and applies the pending schema
+// migrations in migrationsDir.
+func NewTimescaleDB(connectionString, migrationsDir string) (*TimescaleDB, error) {
 	db, err := sql.Open("postgres", connectionString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
@@ -48,118 +173,21 @@ func NewTimescaleDB(connectionString string) (*TimescaleDB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	tsdb := &TimescaleDB{db: db}
-
-	// Initialize database schema
-	if err := tsdb.initSchema(); err != nil {
-		return nil, fmt.Errorf("failed to initialize database schema: %w", err)
+	if err := Migrate(db, migrationsDir); err != nil {
+		return nil, fmt.Errorf("failed to migrate database schema: %w", err)
 	}
 
-	log.Println("Successfully connected to TimescaleDB")
-	return tsdb, nil
-}
-
-func (tsdb *TimescaleDB) initSchema() error {
-	// Create aggregates table
-	aggregatesSchema := `
-		CREATE TABLE IF NOT EXISTS metric_aggregates (
-			device_id TEXT NOT NULL,
-			timestamp TIMESTAMPTZ NOT NULL,
-			window_start TIMESTAMPTZ NOT NULL,
-			window_end TIMESTAMPTZ NOT NULL,
-			metric_name TEXT NOT NULL,
-			metric_value DOUBLE PRECISION NOT NULL,
-			sample_count INTEGER NOT NULL,
-			created_at TIMESTAMPTZ DEFAULT NOW()
-		);
-
-		-- Convert to hypertable if not already done
-		SELECT create_hypertable('metric_aggregates', 'timestamp', if_not_exists => TRUE);
-
-		-- Create indexes for better query performance
-		CREATE INDEX IF NOT EXISTS idx_metric_aggregates_device_time
-		ON metric_aggregates (device_id, timestamp DESC);
-
-		CREATE INDEX IF NOT EXISTS idx_metric_aggregates_metric_time
-		ON metric_aggregates (metric_name, timestamp DESC);
-	`
-
-	if _, err := tsdb.db.Exec(aggregatesSchema); err != nil {
-		return fmt.Errorf("failed to create aggregates schema: %w", err)
-	}
-
-	// Create alerts table
-	alertsSchema := `
-		CREATE TABLE IF NOT EXISTS alerts (
-			id SERIAL PRIMARY KEY,
-			device_id TEXT NOT NULL,
-			timestamp TIMESTAMPTZ NOT NULL,
-			metric_name TEXT NOT NULL,
-			metric_value DOUBLE PRECISION NOT NULL,
-			alert_type TEXT NOT NULL,
-			severity TEXT NOT NULL,
-			z_score DOUBLE PRECISION,
-			threshold DOUBLE PRECISION,
-			status TEXT DEFAULT 'open',
-			message TEXT,
-			created_at TIMESTAMPTZ DEFAULT NOW(),
-			acknowledged_at TIMESTAMPTZ,
-			resolved_at TIMESTAMPTZ
-		);
-
-		-- Convert to hypertable
-		SELECT create_hypertable('alerts', 'timestamp', if_not_exists => TRUE);
-
-		-- Create indexes
-		CREATE INDEX IF NOT EXISTS idx_alerts_device_time
-		ON alerts (device_id, timestamp DESC);
-
-		CREATE INDEX IF NOT EXISTS idx_alerts_status_time
-		ON alerts (status, timestamp DESC);
-
-		CREATE INDEX IF NOT EXISTS idx_alerts_severity_time
-		ON alerts (severity, timestamp DESC);
-	`
-
-	if _, err := tsdb.db.Exec(alertsSchema); err != nil {
-		return fmt.Errorf("failed to create alerts schema: %w", err)
-	}
-
-	// Create devices table for metadata
-	devicesSchema := `
-		CREATE TABLE IF NOT EXISTS devices (
-			device_id TEXT PRIMARY KEY,
-			device_name TEXT,
-			device_type TEXT,
-			location TEXT,
-			last_seen TIMESTAMPTZ,
-			status TEXT DEFAULT 'active',
-			metadata JSONB,
-			created_at TIMESTAMPTZ DEFAULT NOW(),
-			updated_at TIMESTAMPTZ DEFAULT NOW()
-		);
-
-		-- Create indexes
-		CREATE INDEX IF NOT EXISTS idx_devices_last_seen
-		ON devices (last_seen DESC);
-
-		CREATE INDEX IF NOT EXISTS idx_devices_status
-		ON devices (status);
-	`
-
-	if _, err := tsdb.db.Exec(devicesSchema); err != nil {
-		return fmt.Errorf("failed to create devices schema: %w", err)
-	}
+	tsdb := &TimescaleDB{db: db}
 
-	log.Println("Database schema initialized successfully")
-	return nil
+	slog.Info("Successfully connected to TimescaleDB")
+	return tsdb, nil
 }
 
 func (tsdb *TimescaleDB) InsertAggregate(aggregate AggregateRecord) error {
 	query := `
 		INSERT INTO metric_aggregates
-		(device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		(device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count, aggregation_function)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
 	_, err := tsdb.db.Exec(query,
@@ -170,6 +198,7 @@ func (tsdb *TimescaleDB) InsertAggregate(aggregate AggregateRecord) error {
 		aggregate.MetricName,
 		aggregate.MetricValue,
 		aggregate.SampleCount,
+		aggregationFunction(aggregate.Function),
 	)
 
 	if err != nil {
@@ -179,10 +208,22 @@ func (tsdb *TimescaleDB) InsertAggregate(aggregate AggregateRecord) error {
 	return nil
 }
 
+// UseCircuitBreaker routes aggregate and alert inserts through cb.
+func (tsdb *TimescaleDB) UseCircuitBreaker(cb *CircuitBreaker) {
+	tsdb.breaker = cb
+}
+
 func (tsdb *TimescaleDB) InsertAggregates(aggregates []AggregateRecord) error {
 	if len(aggregates) == 0 {
 		return nil
 	}
+	return tsdb.write(func() error {
+		return tsdb.insertAggregates(aggregates)
+	})
+}
+
+func (tsdb *TimescaleDB) insertAggregates(aggregates []AggregateRecord) error {
+	defer observeWrite(time.Now())
 
 	tx, err := tsdb.db.Begin()
 	if err != nil {
@@ -192,8 +233,8 @@ func (tsdb *TimescaleDB) InsertAggregates(aggregates []AggregateRecord) error {
 
 	stmt, err := tx.Prepare(`
 		INSERT INTO metric_aggregates
-		(device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		(device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count, aggregation_function)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
@@ -209,6 +250,7 @@ func (tsdb *TimescaleDB) InsertAggregates(aggregates []AggregateRecord) error {
 			aggregate.MetricName,
 			aggregate.MetricValue,
 			aggregate.SampleCount,
+			aggregationFunction(aggregate.Function),
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert aggregate: %w", err)
@@ -222,7 +264,131 @@ func (tsdb *TimescaleDB) InsertAggregates(aggregates []AggregateRecord) error {
 	return nil
 }
 
+// InsertAggregatesBulk streams aggregates into metric_aggregates using the
+// PostgreSQL COPY protocol, which is much faster than InsertAggregates for
+// large batches.
+func (tsdb *TimescaleDB) InsertAggregatesBulk(aggregates []AggregateRecord) error {
+	if len(aggregates) == 0 {
+		return nil
+	}
+	return tsdb.write(func() error {
+		return tsdb.insertAggregatesBulk(aggregates)
+	})
+}
+
+func (tsdb *TimescaleDB) insertAggregatesBulk(aggregates []AggregateRecord) error {
+	defer observeWrite(time.Now())
+
+	tx, err := tsdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyIn("metric_aggregates",
+		"device_id", "timestamp", "window_start", "window_end",
+		"metric_name", "metric_value", "sample_count", "aggregation_function",
+	))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, aggregate := range aggregates {
+		_, err := stmt.Exec(
+			aggregate.DeviceID,
+			aggregate.Timestamp,
+			aggregate.WindowStart,
+			aggregate.WindowEnd,
+			aggregate.MetricName,
+			aggregate.MetricValue,
+			aggregate.SampleCount,
+			aggregationFunction(aggregate.Function),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to copy aggregate: %w", err)
+		}
+	}
+
+	// An Exec without arguments flushes the buffered rows to the server
+	if _, err := stmt.Exec(); err != nil {
+		return fmt.Errorf("failed to flush copy: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (tsdb *TimescaleDB) InsertHourlyAggregate(record RollupRecord) error {
+	return tsdb.insertRollup("metric_aggregates_hourly", record)
+}
+
+func (tsdb *TimescaleDB) InsertDailyAggregate(record RollupRecord) error {
+	return tsdb.insertRollup("metric_aggregates_daily", record)
+}
+
+func (tsdb *TimescaleDB) insertRollup(table string, record RollupRecord) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s
+		(device_id, bucket_start, bucket_end, metric_name, mean_value, min_value, max_value, sample_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, table)
+
+	_, err := tsdb.db.Exec(query,
+		record.DeviceID,
+		record.BucketStart,
+		record.BucketEnd,
+		record.MetricName,
+		record.MeanValue,
+		record.MinValue,
+		record.MaxValue,
+		record.SampleCount,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to insert rollup into %s: %w", table, err)
+	}
+
+	return nil
+}
+
+// write runs insert through the circuit breaker and records when it last
+// succeeded.
+func (tsdb *TimescaleDB) write(insert func() error) error {
+	if err := tsdb.breaker.Execute(insert); err != nil {
+		return err
+	}
+	tsdb.lastWrite.Store(time.Now().UnixNano())
+	return nil
+}
+
+// observeWrite records the latency of a database write that began at start.
+// It is meant to be deferred with time.Now() as its argument.
+func observeWrite(start time.Time) {
+	metrics.DatabaseWriteLatency.Observe(metrics.Milliseconds(start))
+}
+
+// aggregationFunction defaults records without an explicit function to "mean",
+// which is what the aggregator produced before functions were configurable.
+func aggregationFunction(function string) string {
+	if function == "" {
+		return "mean"
+	}
+	return function
+}
+
 func (tsdb *TimescaleDB) InsertAlert(alert AlertRecord) error {
+	return tsdb.write(func() error {
+		return tsdb.insertAlert(alert)
+	})
+}
+
+func (tsdb *TimescaleDB) insertAlert(alert AlertRecord) error {
+	defer observeWrite(time.Now())
+
 	query := `
 		INSERT INTO alerts
 		(device_id, timestamp, metric_name, metric_value, alert_type, severity, z_score, threshold, status, message)
@@ -248,19 +414,31 @@ func (tsdb *TimescaleDB) InsertAlert(alert AlertRecord) error {
 		return fmt.Errorf("failed to insert alert: %w", err)
 	}
 
-	log.Printf("Inserted alert with ID %d for device %s", id, alert.DeviceID)
+	slog.Info("Inserted alert", slog.Int("alert_id", id), slog.String("device_id", alert.DeviceID))
 	return nil
 }
 
-func (tsdb *TimescaleDB) UpdateDeviceLastSeen(deviceID string) error {
+// UpdateDeviceLastSeen marks a device as seen now and upserts the location,
+// firmware version and device type it reported.
+func (tsdb *TimescaleDB) UpdateDeviceLastSeen(deviceID string, report DeviceReport) error {
+	geoLocation, err := locationParam(report.Location)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO devices (device_id, last_seen, updated_at)
-		VALUES ($1, NOW(), NOW())
+		INSERT INTO devices (device_id, last_seen, geo_location, firmware_version, device_type, updated_at)
+		VALUES ($1, NOW(), $2, NULLIF($3, ''), NULLIF($4, ''), NOW())
 		ON CONFLICT (device_id)
-		DO UPDATE SET last_seen = NOW(), updated_at = NOW()
+		DO UPDATE SET
+			last_seen = NOW(),
+			geo_location = COALESCE($2, devices.geo_location),
+			firmware_version = COALESCE(NULLIF($3, ''), devices.firmware_version),
+			device_type = COALESCE(NULLIF($4, ''), devices.device_type),
+			updated_at = NOW()
 	`
 
-	_, err := tsdb.db.Exec(query, deviceID)
+	_, err = tsdb.db.Exec(query, deviceID, geoLocation, report.FirmwareVersion, report.DeviceType)
 	if err != nil {
 		return fmt.Errorf("failed to update device last seen: %w", err)
 	}
@@ -268,16 +446,288 @@ func (tsdb *TimescaleDB) UpdateDeviceLastSeen(deviceID string) error {
 	return nil
 }
 
-func (tsdb *TimescaleDB) GetRecentAggregates(deviceID string, hours int, limit int) ([]AggregateRecord, error) {
+// RegisterDevice inserts a device, or updates an existing one. Empty fields,
+// a nil Metadata or GeoLocation and a zero ExpectedInterval leave the stored
+// values unchanged, and a new device without a status is active.
+func (tsdb *TimescaleDB) RegisterDevice(device DeviceRecord) error {
+	metadata, err := metadataParam(device.Metadata)
+	if err != nil {
+		return err
+	}
+	geoLocation, err := locationParam(device.GeoLocation)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO devices (device_id, device_name, device_type, location, status, metadata, expected_interval_ms, geo_location, firmware_version, created_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), COALESCE(NULLIF($5, ''), 'active'), $6, NULLIF($7, 0), $8, NULLIF($9, ''), NOW(), NOW())
+		ON CONFLICT (device_id)
+		DO UPDATE SET
+			device_name = COALESCE(NULLIF($2, ''), devices.device_name),
+			device_type = COALESCE(NULLIF($3, ''), devices.device_type),
+			location = COALESCE(NULLIF($4, ''), devices.location),
+			status = COALESCE(NULLIF($5, ''), devices.status),
+			metadata = COALESCE($6, devices.metadata),
+			expected_interval_ms = COALESCE(NULLIF($7, 0), devices.expected_interval_ms),
+			geo_location = COALESCE($8, devices.geo_location),
+			firmware_version = COALESCE(NULLIF($9, ''), devices.firmware_version),
+			updated_at = NOW()
+	`
+
+	_, err = tsdb.db.Exec(query,
+		device.DeviceID,
+		device.DeviceName,
+		device.DeviceType,
+		device.Location,
+		device.Status,
+		metadata,
+		device.ExpectedInterval.Milliseconds(),
+		geoLocation,
+		device.FirmwareVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register device: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateDeviceMetadata replaces the metadata of an existing device.
+func (tsdb *TimescaleDB) UpdateDeviceMetadata(deviceID string, metadata map[string]interface{}) error {
+	value, err := metadataParam(metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE devices
+		SET metadata = $2, updated_at = NOW()
+		WHERE device_id = $1
+	`
+
+	result, err := tsdb.db.Exec(query, deviceID, value)
+	if err != nil {
+		return fmt.Errorf("failed to update device metadata: %w", err)
+	}
+
+	return checkDeviceAffected(result, deviceID)
+}
+
+func (tsdb *TimescaleDB) GetDevice(deviceID string) (*DeviceRecord, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE device_id = $1
+	`
+
+	device, err := scanDevice(tsdb.db.QueryRow(query, deviceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("device %s: %w", deviceID, ErrDeviceNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device: %w", err)
+	}
+
+	return device, nil
+}
+
+// ListDevices returns devices ordered by ID. An empty status matches every
+// status.
+func (tsdb *TimescaleDB) ListDevices(status string, limit, offset int) ([]DeviceRecord, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY device_id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := tsdb.db.Query(query, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []DeviceRecord
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, *device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// GetDevicesByBoundingBox returns the devices whose geo location lies within
+// the given latitude and longitude ranges, ordered by ID.
+func (tsdb *TimescaleDB) GetDevicesByBoundingBox(minLat, maxLat, minLon, maxLon float64) ([]DeviceRecord, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE jsonb_path_exists(
+			geo_location,
+			'$ ? (@.latitude >= $min_lat && @.latitude <= $max_lat && @.longitude >= $min_lon && @.longitude <= $max_lon)',
+			jsonb_build_object('min_lat', $1::float8, 'max_lat', $2::float8, 'min_lon', $3::float8, 'max_lon', $4::float8)
+		)
+		ORDER BY device_id
+	`
+
+	rows, err := tsdb.db.Query(query, minLat, maxLat, minLon, maxLon)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices by bounding box: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []DeviceRecord
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, *device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// ListDevicesByFirmware returns the devices that last reported the given
+// firmware version.
+func (tsdb *TimescaleDB) ListDevicesByFirmware(version string) ([]DeviceRecord, error) {
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE firmware_version = $1
+		ORDER BY device_id
+	`
+
+	rows, err := tsdb.db.Query(query, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices by firmware: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []DeviceRecord
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, *device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// CountRecentDevices returns how many devices were seen within window.
+func (tsdb *TimescaleDB) CountRecentDevices(window time.Duration) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT device_id)
+		FROM devices
+		WHERE last_seen >= NOW() - $1 * INTERVAL '1 second'
+	`
+
+	var count int
+	if err := tsdb.db.QueryRow(query, window.Seconds()).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recent devices: %w", err)
+	}
+
+	return count, nil
+}
+
+// RecordActiveDevices sets the active devices gauge to the number of devices
+// seen within window, every interval until ctx is cancelled.
+func (tsdb *TimescaleDB) RecordActiveDevices(ctx context.Context, window, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if count, err := tsdb.CountRecentDevices(window); err != nil {
+			slog.Warn("Failed to count active devices", slog.Any("error", err))
+		} else {
+			metrics.ActiveDevices.Set(float64(count))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetDevicesOfflineSince returns the devices that have not been seen for
+// longer than threshold.
+func (tsdb *TimescaleDB) GetDevicesOfflineSince(threshold time.Duration) ([]DeviceRecord, error) {
 	query := `
-		SELECT device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE last_seen < NOW() - $1 * INTERVAL '1 second'
+		ORDER BY last_seen
+	`
+
+	rows, err := tsdb.db.Query(query, threshold.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query offline devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []DeviceRecord
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, *device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+func (tsdb *TimescaleDB) DeleteDevice(deviceID string) error {
+	result, err := tsdb.db.Exec(`DELETE FROM devices WHERE device_id = $1`, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+
+	return checkDeviceAffected(result, deviceID)
+}
+
+func checkDeviceAffected(result sql.Result, deviceID string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check device update: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("device %s: %w", deviceID, ErrDeviceNotFound)
+	}
+	return nil
+}
+
+const recentAggregatesQuery = `
+		SELECT device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count, aggregation_function
 		FROM metric_aggregates
-		WHERE device_id = $1 AND timestamp >= NOW() - INTERVAL '%d hours'
+		WHERE device_id = $1 AND timestamp >= NOW() - ($2 * INTERVAL '1 hour')
 		ORDER BY timestamp DESC
-		LIMIT $2
+		LIMIT $3
 	`
 
-	rows, err := tsdb.db.Query(fmt.Sprintf(query, hours), deviceID, limit)
+func (tsdb *TimescaleDB) GetRecentAggregates(deviceID string, hours int, limit int) ([]AggregateRecord, error) {
+	rows, err := tsdb.db.Query(recentAggregatesQuery, deviceID, hours, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query aggregates: %w", err)
 	}
@@ -294,6 +744,7 @@ func (tsdb *TimescaleDB) GetRecentAggregates(deviceID string, hours int, limit i
 			&agg.MetricName,
 			&agg.MetricValue,
 			&agg.SampleCount,
+			&agg.Function,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan aggregate: %w", err)
@@ -301,50 +752,769 @@ func (tsdb *TimescaleDB) GetRecentAggregates(deviceID string, hours int, limit i
 		aggregates = append(aggregates, agg)
 	}
 
-	return aggregates, nil
+	return aggregates, rows.Err()
 }
 
-func (tsdb *TimescaleDB) GetActiveAlerts(deviceID string, limit int) ([]AlertRecord, error) {
+// GetAggregatesForAPI returns a device's aggregates from the last hours,
+// newest first. An empty metricName matches every metric.
+func (tsdb *TimescaleDB) GetAggregatesForAPI(deviceID, metricName string, hours, limit int) ([]AggregateRecord, error) {
 	query := `
-		SELECT id, device_id, timestamp, metric_name, metric_value, alert_type,
-		       severity, z_score, threshold, status, message
-		FROM alerts
-		WHERE device_id = $1 AND status = 'open'
+		SELECT device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count, aggregation_function
+		FROM metric_aggregates
+		WHERE device_id = $1
+		  AND ($2 = '' OR metric_name = $2)
+		  AND timestamp >= NOW() - $3 * INTERVAL '1 hour'
 		ORDER BY timestamp DESC
-		LIMIT $2
+		LIMIT $4
 	`
 
-	rows, err := tsdb.db.Query(query, deviceID, limit)
+	rows, err := tsdb.db.Query(query, deviceID, metricName, hours, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query alerts: %w", err)
+		return nil, fmt.Errorf("failed to query aggregates: %w", err)
 	}
 	defer rows.Close()
 
-	var alerts []AlertRecord
+	var aggregates []AggregateRecord
 	for rows.Next() {
-		var alert AlertRecord
+		var agg AggregateRecord
 		err := rows.Scan(
-			&alert.ID,
-			&alert.DeviceID,
-			&alert.Timestamp,
-			&alert.MetricName,
-			&alert.MetricValue,
-			&alert.AlertType,
-			&alert.Severity,
-			&alert.ZScore,
-			&alert.Threshold,
-			&alert.Status,
-			&alert.Message,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan alert: %w", err)
-		}
-		alerts = append(alerts, alert)
-	}
+			&agg.DeviceID,
+			&agg.Timestamp,
+			&agg.WindowStart,
+			&agg.WindowEnd,
+			&agg.MetricName,
+			&agg.MetricValue,
+			&agg.SampleCount,
+			&agg.Function,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate: %w", err)
+		}
+		aggregates = append(aggregates, agg)
+	}
+
+	return aggregates, rows.Err()
+}
+
+// GetAggregatesPage returns up to limit of a device's aggregates older than
+// before, newest first. An empty metricName matches every metric and a zero
+// before starts from the newest aggregate. nextCursor is passed as before to
+// fetch the following page and is zero when there are no more aggregates.
+func (tsdb *TimescaleDB) GetAggregatesPage(deviceID, metricName string, before time.Time, limit int) ([]AggregateRecord, time.Time, error) {
+	query := `
+		SELECT device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count, aggregation_function
+		FROM metric_aggregates
+		WHERE device_id = $1
+		  AND ($2 = '' OR metric_name = $2)
+		  AND ($3::timestamptz IS NULL OR timestamp < $3)
+		ORDER BY timestamp DESC
+		LIMIT $4
+	`
+
+	// Fetch one extra row to learn whether another page follows
+	rows, err := tsdb.db.Query(query, deviceID, metricName, cursorParam(before), limit+1)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to query aggregates: %w", err)
+	}
+	defer rows.Close()
+
+	var aggregates []AggregateRecord
+	for rows.Next() {
+		var agg AggregateRecord
+		err := rows.Scan(
+			&agg.DeviceID,
+			&agg.Timestamp,
+			&agg.WindowStart,
+			&agg.WindowEnd,
+			&agg.MetricName,
+			&agg.MetricValue,
+			&agg.SampleCount,
+			&agg.Function,
+		)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to scan aggregate: %w", err)
+		}
+		aggregates = append(aggregates, agg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read aggregates: %w", err)
+	}
+
+	aggregates, nextCursor := splitPage(aggregates, limit, func(a AggregateRecord) time.Time { return a.Timestamp })
+	return aggregates, nextCursor, nil
+}
+
+// GetAggregatesForWarmup returns the mean aggregates of every device recorded
+// in the last lookbackHours, oldest first.
+func (tsdb *TimescaleDB) GetAggregatesForWarmup(lookbackHours int) ([]AggregateRecord, error) {
+	query := `
+		SELECT device_id, timestamp, window_start, window_end, metric_name, metric_value, sample_count, aggregation_function
+		FROM metric_aggregates
+		WHERE timestamp >= NOW() - $1 * INTERVAL '1 hour' AND aggregation_function = 'mean'
+		ORDER BY timestamp ASC
+	`
+
+	rows, err := tsdb.db.Query(query, lookbackHours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query warmup aggregates: %w", err)
+	}
+	defer rows.Close()
+
+	var aggregates []AggregateRecord
+	for rows.Next() {
+		var agg AggregateRecord
+		err := rows.Scan(
+			&agg.DeviceID,
+			&agg.Timestamp,
+			&agg.WindowStart,
+			&agg.WindowEnd,
+			&agg.MetricName,
+			&agg.MetricValue,
+			&agg.SampleCount,
+			&agg.Function,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate: %w", err)
+		}
+		aggregates = append(aggregates, agg)
+	}
+
+	return aggregates, rows.Err()
+}
+
+// deviceSummaryQuery summarises every metric in one pass. Min and max come
+// from the min and max aggregates when those functions are computed, and from
+// the window means otherwise; the average is weighted by sample count.
+const deviceSummaryQuery = `
+		SELECT metric_name,
+		       COALESCE(MIN(metric_value) FILTER (WHERE aggregation_function = 'min'),
+		                MIN(metric_value) FILTER (WHERE aggregation_function = 'mean')),
+		       COALESCE(MAX(metric_value) FILTER (WHERE aggregation_function = 'max'),
+		                MAX(metric_value) FILTER (WHERE aggregation_function = 'mean')),
+		       SUM(metric_value * sample_count) FILTER (WHERE aggregation_function = 'mean')
+		           / SUM(sample_count) FILTER (WHERE aggregation_function = 'mean'),
+		       last(metric_value, timestamp) FILTER (WHERE aggregation_function = 'mean'),
+		       SUM(sample_count) FILTER (WHERE aggregation_function = 'mean')
+		FROM metric_aggregates
+		WHERE device_id = $1 AND timestamp >= $2 AND timestamp < $3
+		  AND aggregation_function IN ('mean', 'min', 'max')
+		  AND ($4::text[] IS NULL OR metric_name = ANY($4))
+		GROUP BY metric_name
+		HAVING SUM(sample_count) FILTER (WHERE aggregation_function = 'mean') > 0
+	`
+
+// GetDeviceSummary returns the min, max, average and latest value of a
+// device's metrics in [from, to), keyed by metric name. An empty metricNames
+// summarises every metric.
+func (tsdb *TimescaleDB) GetDeviceSummary(deviceID string, metricNames []string, from, to time.Time) (map[string]MetricSummary, error) {
+	var names interface{}
+	if len(metricNames) > 0 {
+		names = pq.Array(metricNames)
+	}
+
+	rows, err := tsdb.db.Query(deviceSummaryQuery, deviceID, from, to, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device summary: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]MetricSummary)
+	for rows.Next() {
+		var metricName string
+		var summary MetricSummary
+		if err := rows.Scan(
+			&metricName,
+			&summary.Min,
+			&summary.Max,
+			&summary.Avg,
+			&summary.Latest,
+			&summary.SampleCount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan device summary: %w", err)
+		}
+		summaries[metricName] = summary
+	}
+
+	return summaries, rows.Err()
+}
+
+// fleetSummaryQuery summarises every metric across devices like
+// deviceSummaryQuery, counting the devices with mean aggregates.
+const fleetSummaryQuery = `
+		SELECT metric_name,
+		       COALESCE(MIN(metric_value) FILTER (WHERE aggregation_function = 'min'),
+		                MIN(metric_value) FILTER (WHERE aggregation_function = 'mean')),
+		       COALESCE(MAX(metric_value) FILTER (WHERE aggregation_function = 'max'),
+		                MAX(metric_value) FILTER (WHERE aggregation_function = 'mean')),
+		       SUM(metric_value * sample_count) FILTER (WHERE aggregation_function = 'mean')
+		           / SUM(sample_count) FILTER (WHERE aggregation_function = 'mean'),
+		       SUM(sample_count) FILTER (WHERE aggregation_function = 'mean'),
+		       COUNT(DISTINCT device_id) FILTER (WHERE aggregation_function = 'mean')
+		FROM metric_aggregates
+		WHERE timestamp >= NOW() - $1 * INTERVAL '1 hour'
+		  AND aggregation_function IN ('mean', 'min', 'max')
+		GROUP BY metric_name
+		HAVING SUM(sample_count) FILTER (WHERE aggregation_function = 'mean') > 0
+	`
+
+// GetFleetSummary returns the min, max and average of every metric across
+// all devices in the last hours, with the number of devices reporting it,
+// keyed by metric name.
+func (tsdb *TimescaleDB) GetFleetSummary(hours int) (map[string]FleetMetricSummary, error) {
+	rows, err := tsdb.db.Query(fleetSummaryQuery, hours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fleet summary: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]FleetMetricSummary)
+	for rows.Next() {
+		var metricName string
+		var summary FleetMetricSummary
+		if err := rows.Scan(
+			&metricName,
+			&summary.Min,
+			&summary.Max,
+			&summary.Avg,
+			&summary.SampleCount,
+			&summary.DeviceCount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan fleet summary: %w", err)
+		}
+		summaries[metricName] = summary
+	}
+
+	return summaries, rows.Err()
+}
+
+const topAnomalousMetricsQuery = `
+		SELECT metric_name, COUNT(*) AS count
+		FROM alerts
+		WHERE alert_type = 'anomaly' AND device_id = $1
+		  AND timestamp >= NOW() - $2 * INTERVAL '1 hour'
+		GROUP BY metric_name
+		ORDER BY count DESC, metric_name
+		LIMIT $3
+	`
+
+// GetTopAnomalousMetrics returns the topN metrics of a device with the most
+// anomaly alerts in the last hours, most anomalous first.
+func (tsdb *TimescaleDB) GetTopAnomalousMetrics(deviceID string, hours int, topN int) ([]MetricAnomalyCount, error) {
+	rows, err := tsdb.db.Query(topAnomalousMetricsQuery, deviceID, hours, topN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomaly counts: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []MetricAnomalyCount
+	for rows.Next() {
+		var count MetricAnomalyCount
+		if err := rows.Scan(&count.Metric, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+func (tsdb *TimescaleDB) GetActiveAlerts(deviceID string, limit int) ([]AlertRecord, error) {
+	query := `
+		SELECT ` + alertColumns + `
+		FROM alerts
+		WHERE device_id = $1 AND status IN ('open', 'acknowledged')
+		ORDER BY timestamp DESC
+		LIMIT $2
+	`
+
+	rows, err := tsdb.db.Query(query, deviceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []AlertRecord
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		alerts = append(alerts, *alert)
+	}
 
 	return alerts, nil
 }
 
+// GetAlertsPage returns up to limit of a device's alerts older than before,
+// newest first. An empty status matches every status and a zero before
+// starts from the newest alert. nextCursor is passed as before to fetch the
+// following page and is zero when there are no more alerts.
+func (tsdb *TimescaleDB) GetAlertsPage(deviceID, status string, before time.Time, limit int) ([]AlertRecord, time.Time, error) {
+	query := `
+		SELECT ` + alertColumns + `
+		FROM alerts
+		WHERE device_id = $1
+		  AND ($2 = '' OR status = $2)
+		  AND ($3::timestamptz IS NULL OR timestamp < $3)
+		ORDER BY timestamp DESC
+		LIMIT $4
+	`
+
+	// Fetch one extra row to learn whether another page follows
+	rows, err := tsdb.db.Query(query, deviceID, status, cursorParam(before), limit+1)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []AlertRecord
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		alerts = append(alerts, *alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read alerts: %w", err)
+	}
+
+	alerts, nextCursor := splitPage(alerts, limit, func(a AlertRecord) time.Time { return a.Timestamp })
+	return alerts, nextCursor, nil
+}
+
+func (tsdb *TimescaleDB) GetAlertByID(id int) (*AlertRecord, error) {
+	query := `
+		SELECT ` + alertColumns + `
+		FROM alerts
+		WHERE id = $1
+	`
+
+	alert, err := scanAlert(tsdb.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("alert %d: %w", id, ErrAlertNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert: %w", err)
+	}
+
+	return alert, nil
+}
+
+// AcknowledgeAlert moves an open alert to the acknowledged state and records
+// the change in the audit log.
+func (tsdb *TimescaleDB) AcknowledgeAlert(id int, acknowledgedBy string) error {
+	query := `
+		WITH previous AS (
+			SELECT id, status FROM alerts
+			WHERE id = $1 AND status = 'open'
+			FOR UPDATE
+		)
+		UPDATE alerts
+		SET status = 'acknowledged', acknowledged_at = NOW(), acknowledged_by = $2
+		FROM previous
+		WHERE alerts.id = previous.id
+		RETURNING previous.status
+	`
+
+	return tsdb.transitionAlert(AlertAuditEntry{
+		AlertID:   id,
+		Action:    AuditActionAcknowledge,
+		Actor:     acknowledgedBy,
+		NewStatus: "acknowledged",
+	}, query, id, acknowledgedBy)
+}
+
+// ResolveAlert closes an open or acknowledged alert and records the change
+// in the audit log.
+func (tsdb *TimescaleDB) ResolveAlert(id int, resolvedBy string, notes string) error {
+	query := `
+		WITH previous AS (
+			SELECT id, status FROM alerts
+			WHERE id = $1 AND status IN ('open', 'acknowledged')
+			FOR UPDATE
+		)
+		UPDATE alerts
+		SET status = 'resolved', resolved_at = NOW(), resolved_by = $2, notes = $3
+		FROM previous
+		WHERE alerts.id = previous.id
+		RETURNING previous.status
+	`
+
+	return tsdb.transitionAlert(AlertAuditEntry{
+		AlertID:   id,
+		Action:    AuditActionResolve,
+		Actor:     resolvedBy,
+		NewStatus: "resolved",
+		Notes:     notes,
+	}, query, id, resolvedBy, notes)
+}
+
+// transitionAlert runs query, an UPDATE of entry.AlertID returning the
+// alert's previous status, and appends entry to the audit log in the same
+// transaction. An UPDATE that matches no rows becomes a descriptive error:
+// either the alert does not exist or its current status does not allow the
+// transition.
+func (tsdb *TimescaleDB) transitionAlert(entry AlertAuditEntry, query string, args ...interface{}) error {
+	tx, err := tsdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(query, args...).Scan(&entry.OldStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		alert, err := tsdb.GetAlertByID(entry.AlertID)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("alert %d cannot be %s from status %q", entry.AlertID, entry.NewStatus, alert.Status)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s alert: %w", entry.Action, err)
+	}
+
+	if err := appendAuditLog(tx, entry); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AppendAuditLog records a change to an alert. A zero Timestamp is stored as
+// the current time.
+func (tsdb *TimescaleDB) AppendAuditLog(entry AlertAuditEntry) error {
+	return appendAuditLog(tsdb.db, entry)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func appendAuditLog(db execer, entry AlertAuditEntry) error {
+	var timestamp interface{}
+	if !entry.Timestamp.IsZero() {
+		timestamp = entry.Timestamp
+	}
+
+	query := `
+		INSERT INTO alert_audit_log (alert_id, action, actor, timestamp, old_status, new_status, notes)
+		VALUES ($1, $2, NULLIF($3, ''), COALESCE($4, NOW()), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''))
+	`
+
+	_, err := db.Exec(query,
+		entry.AlertID,
+		entry.Action,
+		entry.Actor,
+		timestamp,
+		entry.OldStatus,
+		entry.NewStatus,
+		entry.Notes,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to append audit log: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuditLog returns the recorded changes to an alert, oldest first.
+func (tsdb *TimescaleDB) GetAuditLog(alertID int) ([]AlertAuditEntry, error) {
+	query := `
+		SELECT id, alert_id, action, COALESCE(actor, ''), timestamp,
+		       COALESCE(old_status, ''), COALESCE(new_status, ''), COALESCE(notes, '')
+		FROM alert_audit_log
+		WHERE alert_id = $1
+		ORDER BY timestamp, id
+	`
+
+	rows, err := tsdb.db.Query(query, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AlertAuditEntry
+	for rows.Next() {
+		var entry AlertAuditEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.AlertID,
+			&entry.Action,
+			&entry.Actor,
+			&entry.Timestamp,
+			&entry.OldStatus,
+			&entry.NewStatus,
+			&entry.Notes,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit log entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return entries, nil
+}
+
+const alertColumns = `id, device_id, timestamp, metric_name, metric_value, alert_type,
+		       severity, z_score, threshold, status, message,
+		       acknowledged_at, resolved_at, COALESCE(acknowledged_by, ''),
+		       COALESCE(resolved_by, ''), COALESCE(notes, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlert(row rowScanner) (*AlertRecord, error) {
+	var alert AlertRecord
+	err := row.Scan(
+		&alert.ID,
+		&alert.DeviceID,
+		&alert.Timestamp,
+		&alert.MetricName,
+		&alert.MetricValue,
+		&alert.AlertType,
+		&alert.Severity,
+		&alert.ZScore,
+		&alert.Threshold,
+		&alert.Status,
+		&alert.Message,
+		&alert.AcknowledgedAt,
+		&alert.ResolvedAt,
+		&alert.AcknowledgedBy,
+		&alert.ResolvedBy,
+		&alert.Notes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+const deviceColumns = `device_id, COALESCE(device_name, ''), COALESCE(device_type, ''),
+		       COALESCE(location, ''), last_seen, COALESCE(status, ''), metadata,
+		       created_at, updated_at, COALESCE(expected_interval_ms, 0), geo_location,
+		       COALESCE(firmware_version, '')`
+
+func scanDevice(row rowScanner) (*DeviceRecord, error) {
+	var device DeviceRecord
+	var metadata []byte
+	var expectedIntervalMs int64
+	var geoLocation []byte
+	err := row.Scan(
+		&device.DeviceID,
+		&device.DeviceName,
+		&device.DeviceType,
+		&device.Location,
+		&device.LastSeen,
+		&device.Status,
+		&metadata,
+		&device.CreatedAt,
+		&device.UpdatedAt,
+		&expectedIntervalMs,
+		&geoLocation,
+		&device.FirmwareVersion,
+	)
+	if err != nil {
+		return nil, err
+	}
+	device.ExpectedInterval = time.Duration(expectedIntervalMs) * time.Millisecond
+	if metadata != nil {
+		if err := json.Unmarshal(metadata, &device.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode device metadata: %w", err)
+		}
+	}
+	if geoLocation != nil {
+		if err := json.Unmarshal(geoLocation, &device.GeoLocation); err != nil {
+			return nil, fmt.Errorf("failed to decode device location: %w", err)
+		}
+	}
+	return &device, nil
+}
+
+// metadataParam encodes device metadata for a JSONB column, binding nil as
+// NULL.
+func metadataParam(metadata map[string]interface{}) (interface{}, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode device metadata: %w", err)
+	}
+	return string(data), nil
+}
+
+// locationParam encodes a device location for a JSONB column, binding nil as
+// NULL.
+func locationParam(location *DeviceLocation) (interface{}, error) {
+	if location == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode device location: %w", err)
+	}
+	return string(data), nil
+}
+
+// cursorParam binds a zero cursor as NULL so that the first page is unbounded.
+func cursorParam(before time.Time) interface{} {
+	if before.IsZero() {
+		return nil
+	}
+	return before
+}
+
+// splitPage trims records, fetched with one row of lookahead, to a page of at
+// most limit and returns the cursor for the next page. Rows at the page
+// boundary that share a timestamp with the lookahead row are deferred to the
+// next page, since the cursor query only returns strictly older rows.
+func splitPage[T any](records []T, limit int, timestamp func(T) time.Time) ([]T, time.Time) {
+	if len(records) <= limit {
+		return records, time.Time{}
+	}
+
+	next := timestamp(records[limit])
+	page := records[:limit]
+
+	end := len(page)
+	for end > 0 && timestamp(page[end-1]).Equal(next) {
+		end--
+	}
+	if end == 0 {
+		// The whole page shares one timestamp; there is no cursor that splits
+		// it, so return it as is and resume after that timestamp.
+		return page, next
+	}
+
+	page = page[:end]
+	return page, timestamp(page[end-1])
+}
+
+// SetRetentionPolicy has TimescaleDB drop the chunks of a hypertable once
+// they are older than retentionDays. An existing policy is replaced, so a
+// changed retention takes effect on the next start; zero or less removes it.
+func (tsdb *TimescaleDB) SetRetentionPolicy(tableName string, retentionDays int) error {
+	if _, err := tsdb.db.Exec(`SELECT remove_retention_policy($1::regclass, if_exists => TRUE)`, tableName); err != nil {
+		return fmt.Errorf("failed to remove retention policy on %s: %w", tableName, err)
+	}
+	if retentionDays <= 0 {
+		return nil
+	}
+
+	query := `SELECT add_retention_policy($1::regclass, make_interval(days => $2), if_not_exists => TRUE)`
+	if _, err := tsdb.db.Exec(query, tableName, retentionDays); err != nil {
+		return fmt.Errorf("failed to add retention policy on %s: %w", tableName, err)
+	}
+
+	slog.Info("Retention policy set",
+		slog.String("table", tableName), slog.Int("retention_days", retentionDays))
+	return nil
+}
+
+// DropOldChunks drops the chunks of a hypertable holding only data older than
+// before, and returns how many were dropped.
+func (tsdb *TimescaleDB) DropOldChunks(tableName string, before time.Time) (int, error) {
+	rows, err := tsdb.db.Query(`SELECT drop_chunks($1::regclass, older_than => $2)`, tableName, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to drop chunks of %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	dropped := 0
+	for rows.Next() {
+		dropped++
+	}
+	if err := rows.Err(); err != nil {
+		return dropped, fmt.Errorf("failed to drop chunks of %s: %w", tableName, err)
+	}
+	return dropped, nil
+}
+
+// downsampledTables maps the tables Downsample accepts to the tables their
+// downsampled rows are written to.
+var downsampledTables = map[string]string{
+	"metric_aggregates": "metric_aggregates_downsampled",
+}
+
+// downsampleQuery re-aggregates the rows of %[1]s in [$2, $3) into buckets
+// of $1 seconds, written to %[2]s. Means are weighted by sample count, min,
+// max and sum combine exactly, and percentiles keep the highest window's
+// value as an upper bound.
+const downsampleQuery = `
+	INSERT INTO %[2]s (device_id, timestamp, window_start, window_end, metric_name,
+		metric_value, sample_count, aggregation_function)
+	SELECT device_id, bucket, bucket, bucket + make_interval(secs => $1), metric_name,
+		CASE aggregation_function
+			WHEN 'min' THEN MIN(metric_value)
+			WHEN 'max' THEN MAX(metric_value)
+			WHEN 'sum' THEN SUM(metric_value)
+			WHEN 'p95' THEN MAX(metric_value)
+			WHEN 'p99' THEN MAX(metric_value)
+			ELSE COALESCE(SUM(metric_value * sample_count) / NULLIF(SUM(sample_count), 0), AVG(metric_value))
+		END,
+		SUM(sample_count), aggregation_function
+	FROM (
+		SELECT *, time_bucket(make_interval(secs => $1), timestamp) AS bucket
+		FROM %[1]s
+		WHERE timestamp >= $2 AND timestamp < $3
+	) AS source
+	GROUP BY device_id, metric_name, aggregation_function, bucket`
+
+// Downsample replaces the rows of table in [from, to) with rows aggregated
+// into targetResolution buckets in the table's _downsampled counterpart.
+// from and to should be multiples of targetResolution, so a bucket isn't
+// split between two calls.
+func (tsdb *TimescaleDB) Downsample(table string, from, to time.Time, targetResolution time.Duration) error {
+	target, ok := downsampledTables[table]
+	if !ok {
+		return fmt.Errorf("table %s cannot be downsampled", table)
+	}
+	if targetResolution < time.Second {
+		return fmt.Errorf("downsample resolution must be at least 1s, got %v", targetResolution)
+	}
+
+	tx, err := tsdb.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The table names come from downsampledTables, never from the caller
+	result, err := tx.Exec(fmt.Sprintf(downsampleQuery, table, target), targetResolution.Seconds(), from, to)
+	if err != nil {
+		return fmt.Errorf("failed to downsample %s: %w", table, err)
+	}
+	inserted, _ := result.RowsAffected()
+
+	result, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE timestamp >= $1 AND timestamp < $2`, table), from, to)
+	if err != nil {
+		return fmt.Errorf("failed to delete downsampled rows of %s: %w", table, err)
+	}
+	deleted, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	slog.Info("Downsampled aggregates",
+		slog.String("table", table),
+		slog.Time("from", from),
+		slog.Time("to", to),
+		slog.Duration("resolution", targetResolution),
+		slog.Int64("rows_deleted", deleted),
+		slog.Int64("rows_inserted", inserted))
+	return nil
+}
+
 func (tsdb *TimescaleDB) Close() error {
 	if tsdb.db != nil {
 		return tsdb.db.Close()
@@ -355,3 +1525,24 @@ func (tsdb *TimescaleDB) Close() error {
 func (tsdb *TimescaleDB) HealthCheck() error {
 	return tsdb.db.Ping()
 }
+
+// Check pings the database and reports the ping latency and when aggregates
+// or alerts were last written.
+func (tsdb *TimescaleDB) Check(ctx context.Context) health.HealthStatus {
+	start := time.Now()
+	err := tsdb.db.PingContext(ctx)
+	details := map[string]interface{}{
+		"ping_latency_ms": metrics.Milliseconds(start),
+	}
+	if lastWrite := tsdb.lastWrite.Load(); lastWrite != 0 {
+		details["last_write"] = time.Unix(0, lastWrite).UTC()
+	}
+	if tsdb.breaker != nil {
+		details["circuit_breaker"] = tsdb.breaker.State().String()
+	}
+
+	if err != nil {
+		return health.Unhealthy(fmt.Errorf("failed to ping database: %w", err), details)
+	}
+	return health.HealthStatus{Status: health.StatusHealthy, Details: details}
+}
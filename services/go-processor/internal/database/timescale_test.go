@@ -0,0 +1,760 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingDriver is a minimal database/sql driver that records the last
+// query and its arguments and answers it with canned rows. Statements run
+// with Exec are recorded in execs.
+type recordingDriver struct {
+	mu      sync.Mutex
+	query   string
+	args    []driver.Value
+	columns []string
+	rows    [][]driver.Value
+	execs   [][]driver.Value
+
+	// delay slows down every query
+	delay time.Duration
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{d: d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{d: c.d, query: query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return recordingTx{}, nil }
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.execs = append(s.d.execs, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	time.Sleep(s.d.delay)
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.query = s.query
+	s.d.args = args
+	return &recordingRows{columns: s.d.columns, rows: s.d.rows}, nil
+}
+
+type recordingRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string { return r.columns }
+func (r *recordingRows) Close() error      { return nil }
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestGetRecentAggregates_Parameterized(t *testing.T) {
+	windowStart := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	drv := &recordingDriver{
+		columns: []string{"device_id", "timestamp", "window_start", "window_end",
+			"metric_name", "metric_value", "sample_count", "aggregation_function"},
+		rows: [][]driver.Value{
+			{"device-1", windowStart, windowStart, windowStart.Add(time.Minute), "temperature", 21.5, int64(60), "mean"},
+		},
+	}
+	sql.Register("recording-recent-aggregates", drv)
+
+	db, err := sql.Open("recording-recent-aggregates", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+	aggregates, err := tsdb.GetRecentAggregates("device-1", 24, 100)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []AggregateRecord{{
+		DeviceID:    "device-1",
+		Timestamp:   windowStart,
+		WindowStart: windowStart,
+		WindowEnd:   windowStart.Add(time.Minute),
+		MetricName:  "temperature",
+		MetricValue: 21.5,
+		SampleCount: 60,
+		Function:    "mean",
+	}}, aggregates)
+
+	// The SQL sent to the server is the untouched template, with every
+	// caller-supplied value bound as a parameter.
+	assert.Equal(t, recentAggregatesQuery, drv.query)
+	assert.NotContains(t, drv.query, "%")
+	assert.Equal(t, []driver.Value{"device-1", int64(24), int64(100)}, drv.args)
+	for _, placeholder := range []string{"$1", "$2", "$3"} {
+		assert.Contains(t, drv.query, placeholder)
+	}
+}
+
+func TestSplitPage(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes ...int) []time.Time {
+		times := make([]time.Time, len(minutes))
+		for i, m := range minutes {
+			times[i] = base.Add(time.Duration(m) * time.Minute)
+		}
+		return times
+	}
+	identity := func(ts time.Time) time.Time { return ts }
+
+	// Last page: nothing beyond the limit, so no cursor
+	page, cursor := splitPage(at(5, 4, 3), 3, identity)
+	assert.Equal(t, at(5, 4, 3), page)
+	assert.True(t, cursor.IsZero())
+
+	// Lookahead row present: cursor is the last returned timestamp
+	page, cursor = splitPage(at(5, 4, 3, 2), 3, identity)
+	assert.Equal(t, at(5, 4, 3), page)
+	assert.Equal(t, base.Add(3*time.Minute), cursor)
+
+	// Rows tied with the lookahead row move to the next page
+	page, cursor = splitPage(at(5, 4, 3, 3), 3, identity)
+	assert.Equal(t, at(5, 4), page)
+	assert.Equal(t, base.Add(4*time.Minute), cursor)
+
+	// A page of one timestamp cannot be split
+	page, cursor = splitPage(at(3, 3, 3, 3), 3, identity)
+	assert.Equal(t, at(3, 3, 3), page)
+	assert.Equal(t, base.Add(3*time.Minute), cursor)
+}
+
+func TestGetDevice_DecodesMetadata(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	drv := &recordingDriver{
+		columns: []string{"device_id", "device_name", "device_type", "location",
+			"last_seen", "status", "metadata", "created_at", "updated_at", "expected_interval_ms", "geo_location",
+			"firmware_version"},
+		rows: [][]driver.Value{
+			{"device-1", "Boiler", "thermometer", "", nil, "active", []byte(`{"firmware":"1.2.0","floor":3}`), created, created, int64(30000), nil, ""},
+		},
+	}
+	sql.Register("recording-get-device", drv)
+
+	db, err := sql.Open("recording-get-device", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+	device, err := tsdb.GetDevice("device-1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, &DeviceRecord{
+		DeviceID:   "device-1",
+		DeviceName: "Boiler",
+		DeviceType: "thermometer",
+		Status:     "active",
+		Metadata:   map[string]interface{}{"firmware": "1.2.0", "floor": 3.0},
+		CreatedAt:  created,
+		UpdatedAt:  created,
+
+		ExpectedInterval: 30 * time.Second,
+	}, device)
+	assert.Equal(t, []driver.Value{"device-1"}, drv.args)
+}
+
+func TestGetDevicesByBoundingBox_DecodesLocation(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	drv := &recordingDriver{
+		columns: []string{"device_id", "device_name", "device_type", "location",
+			"last_seen", "status", "metadata", "created_at", "updated_at", "expected_interval_ms", "geo_location",
+			"firmware_version"},
+		rows: [][]driver.Value{
+			{"device-1", "", "", "", nil, "active", nil, created, created, int64(0),
+				[]byte(`{"latitude":52.52,"longitude":13.405,"building_id":"hq","floor":"2"}`), ""},
+		},
+	}
+	sql.Register("recording-bbox", drv)
+
+	db, err := sql.Open("recording-bbox", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	devices, err := (&TimescaleDB{db: db}).GetDevicesByBoundingBox(52, 53, 13, 14)
+	assert.NoError(t, err)
+
+	assert.Len(t, devices, 1)
+	assert.Equal(t, &DeviceLocation{Latitude: 52.52, Longitude: 13.405, BuildingID: "hq", Floor: "2"}, devices[0].GeoLocation)
+	assert.Equal(t, []driver.Value{52.0, 53.0, 13.0, 14.0}, drv.args)
+	assert.Contains(t, drv.query, "jsonb_path_exists")
+}
+
+func TestListDevicesByFirmware(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	drv := &recordingDriver{
+		columns: []string{"device_id", "device_name", "device_type", "location",
+			"last_seen", "status", "metadata", "created_at", "updated_at", "expected_interval_ms", "geo_location",
+			"firmware_version"},
+		rows: [][]driver.Value{
+			{"device-1", "", "sensor", "", nil, "active", nil, created, created, int64(0), nil, "2.0.0-beta"},
+		},
+	}
+	sql.Register("recording-firmware", drv)
+
+	db, err := sql.Open("recording-firmware", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	devices, err := (&TimescaleDB{db: db}).ListDevicesByFirmware("2.0.0-beta")
+	assert.NoError(t, err)
+
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "2.0.0-beta", devices[0].FirmwareVersion)
+	assert.Equal(t, "sensor", devices[0].DeviceType)
+	assert.Equal(t, []driver.Value{"2.0.0-beta"}, drv.args)
+}
+
+func TestUpdateDeviceLastSeen_BindsReport(t *testing.T) {
+	drv := &recordingDriver{}
+	sql.Register("recording-last-seen", drv)
+
+	db, err := sql.Open("recording-last-seen", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+	assert.NoError(t, tsdb.UpdateDeviceLastSeen("device-1", DeviceReport{FirmwareVersion: "1.1.0", DeviceType: "sensor"}))
+	assert.NoError(t, tsdb.UpdateDeviceLastSeen("device-1", DeviceReport{}))
+
+	assert.Equal(t, [][]driver.Value{
+		{"device-1", nil, "1.1.0", "sensor"},
+		{"device-1", nil, "", ""},
+	}, drv.execs)
+}
+
+func TestAlertTransitions_AppendAuditLog(t *testing.T) {
+	drv := &recordingDriver{columns: []string{"status"}}
+	sql.Register("recording-alert-audit", drv)
+
+	db, err := sql.Open("recording-alert-audit", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+
+	drv.rows = [][]driver.Value{{"open"}}
+	assert.NoError(t, tsdb.AcknowledgeAlert(7, "alice"))
+
+	drv.rows = [][]driver.Value{{"acknowledged"}}
+	assert.NoError(t, tsdb.ResolveAlert(7, "bob", "Replaced the sensor"))
+
+	assert.Equal(t, [][]driver.Value{
+		{int64(7), "acknowledge", "alice", nil, "open", "acknowledged", ""},
+		{int64(7), "resolve", "bob", nil, "acknowledged", "resolved", "Replaced the sensor"},
+	}, drv.execs)
+}
+
+// TestAlertAuditLog_Postgres runs against a real TimescaleDB instance and is
+// skipped unless TEST_DATABASE_URL points at one.
+func TestAlertAuditLog_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer tsdb.Close()
+
+	assert.NoError(t, tsdb.InsertAlert(AlertRecord{
+		DeviceID:    "audit-device",
+		Timestamp:   time.Now(),
+		MetricName:  "temperature",
+		MetricValue: 80,
+		AlertType:   "anomaly",
+		Severity:    "high",
+		Status:      "open",
+	}))
+	var id int
+	err = tsdb.db.QueryRow(`SELECT MAX(id) FROM alerts WHERE device_id = 'audit-device'`).Scan(&id)
+	assert.NoError(t, err)
+
+	assert.NoError(t, tsdb.AcknowledgeAlert(id, "alice"))
+	assert.NoError(t, tsdb.ResolveAlert(id, "bob", "Replaced the sensor"))
+	// A resolved alert cannot be acknowledged, and the failure is not logged
+	assert.Error(t, tsdb.AcknowledgeAlert(id, "carol"))
+
+	entries, err := tsdb.GetAuditLog(id)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, AuditActionAcknowledge, entries[0].Action)
+		assert.Equal(t, "alice", entries[0].Actor)
+		assert.Equal(t, "open", entries[0].OldStatus)
+		assert.Equal(t, "acknowledged", entries[0].NewStatus)
+
+		assert.Equal(t, AuditActionResolve, entries[1].Action)
+		assert.Equal(t, "bob", entries[1].Actor)
+		assert.Equal(t, "acknowledged", entries[1].OldStatus)
+		assert.Equal(t, "resolved", entries[1].NewStatus)
+		assert.Equal(t, "Replaced the sensor", entries[1].Notes)
+	}
+}
+
+func TestCountRecentDevices(t *testing.T) {
+	drv := &recordingDriver{
+		columns: []string{"count"},
+		rows:    [][]driver.Value{{int64(42)}},
+	}
+	sql.Register("recording-recent-devices", drv)
+
+	db, err := sql.Open("recording-recent-devices", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	count, err := (&TimescaleDB{db: db}).CountRecentDevices(5 * time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, count)
+	assert.Equal(t, []driver.Value{300.0}, drv.args)
+}
+
+// TestCountRecentDevices_Postgres runs against a real TimescaleDB instance
+// and is skipped unless TEST_DATABASE_URL points at one.
+func TestCountRecentDevices_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer tsdb.Close()
+
+	before, err := tsdb.CountRecentDevices(5 * time.Minute)
+	assert.NoError(t, err)
+
+	assert.NoError(t, tsdb.UpdateDeviceLastSeen("active-device-1", DeviceReport{}))
+	assert.NoError(t, tsdb.UpdateDeviceLastSeen("active-device-2", DeviceReport{}))
+	_, err = tsdb.db.Exec(`
+		INSERT INTO devices (device_id, last_seen) VALUES ('stale-device', NOW() - INTERVAL '1 hour')
+		ON CONFLICT (device_id) DO UPDATE SET last_seen = EXCLUDED.last_seen
+	`)
+	assert.NoError(t, err)
+
+	count, err := tsdb.CountRecentDevices(5 * time.Minute)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, count, 2)
+	assert.LessOrEqual(t, count, before+2)
+}
+
+func TestGetDevice_NotFound(t *testing.T) {
+	drv := &recordingDriver{columns: []string{"device_id"}}
+	sql.Register("recording-missing-device", drv)
+
+	db, err := sql.Open("recording-missing-device", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = (&TimescaleDB{db: db}).GetDevice("device-404")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
+
+func TestDropOldChunks_CountsDroppedChunks(t *testing.T) {
+	drv := &recordingDriver{
+		columns: []string{"drop_chunks"},
+		rows: [][]driver.Value{
+			{"_timescaledb_internal._hyper_1_1_chunk"},
+			{"_timescaledb_internal._hyper_1_2_chunk"},
+		},
+	}
+	sql.Register("recording-drop-chunks", drv)
+
+	db, err := sql.Open("recording-drop-chunks", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dropped, err := (&TimescaleDB{db: db}).DropOldChunks("metric_aggregates", before)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dropped)
+	assert.Equal(t, []driver.Value{"metric_aggregates", before}, drv.args)
+}
+
+// TestDropOldChunks_Postgres runs against a real TimescaleDB instance and is
+// skipped unless TEST_DATABASE_URL points at one.
+func TestDropOldChunks_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer tsdb.Close()
+
+	old := time.Now().AddDate(-2, 0, 0).Truncate(time.Minute)
+	assert.NoError(t, tsdb.InsertAggregate(AggregateRecord{
+		DeviceID:    "retention-device",
+		Timestamp:   old,
+		WindowStart: old,
+		WindowEnd:   old.Add(time.Minute),
+		MetricName:  "temperature",
+		MetricValue: 21.5,
+		SampleCount: 1,
+		Function:    "mean",
+	}))
+
+	dropped, err := tsdb.DropOldChunks("metric_aggregates", old.AddDate(0, 1, 0))
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, dropped, 1)
+
+	var remaining int
+	err = tsdb.db.QueryRow(`SELECT COUNT(*) FROM metric_aggregates WHERE device_id = 'retention-device'`).Scan(&remaining)
+	assert.NoError(t, err)
+	assert.Zero(t, remaining)
+}
+
+func TestGetDeviceSummary_DecodesRows(t *testing.T) {
+	drv := &recordingDriver{
+		columns: []string{"metric_name", "min", "max", "avg", "latest", "sample_count"},
+		rows: [][]driver.Value{
+			{"temperature", 18.0, 24.0, 21.0, 22.0, int64(120)},
+			{"humidity", 40.0, 55.0, 47.5, 50.0, int64(60)},
+		},
+	}
+	sql.Register("recording-device-summary", drv)
+
+	db, err := sql.Open("recording-device-summary", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	summary, err := (&TimescaleDB{db: db}).GetDeviceSummary("device-1", []string{"temperature", "humidity"}, from, to)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]MetricSummary{
+		"temperature": {Min: 18, Max: 24, Avg: 21, Latest: 22, SampleCount: 120},
+		"humidity":    {Min: 40, Max: 55, Avg: 47.5, Latest: 50, SampleCount: 60},
+	}, summary)
+	assert.Equal(t, deviceSummaryQuery, drv.query)
+	assert.Equal(t, []driver.Value{"device-1", from, to, "{\"temperature\",\"humidity\"}"}, drv.args)
+}
+
+// TestGetDeviceSummary_Postgres runs against a real TimescaleDB instance and
+// is skipped unless TEST_DATABASE_URL points at one.
+func TestGetDeviceSummary_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer func() {
+		tsdb.db.Exec("DELETE FROM metric_aggregates WHERE device_id = 'summary-device'")
+		tsdb.Close()
+	}()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	windows := []struct {
+		mean, min, max float64
+		samples        int
+	}{
+		{mean: 20, min: 18, max: 22, samples: 10},
+		{mean: 26, min: 25, max: 30, samples: 30},
+	}
+	var records []AggregateRecord
+	for i, w := range windows {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		for function, value := range map[string]float64{"mean": w.mean, "min": w.min, "max": w.max} {
+			records = append(records, AggregateRecord{
+				DeviceID:    "summary-device",
+				Timestamp:   ts,
+				WindowStart: ts,
+				WindowEnd:   ts.Add(time.Minute),
+				MetricName:  "temperature",
+				MetricValue: value,
+				SampleCount: w.samples,
+				Function:    function,
+			})
+		}
+	}
+	assert.NoError(t, tsdb.InsertAggregates(records))
+
+	summary, err := tsdb.GetDeviceSummary("summary-device", nil, start, start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]MetricSummary{
+		"temperature": {Min: 18, Max: 30, Avg: 24.5, Latest: 26, SampleCount: 40},
+	}, summary)
+}
+
+func TestGetFleetSummary_DecodesRows(t *testing.T) {
+	drv := &recordingDriver{
+		columns: []string{"metric_name", "min", "max", "avg", "sample_count", "device_count"},
+		rows: [][]driver.Value{
+			{"temperature", 12.0, 35.0, 22.5, int64(12000), int64(40)},
+			{"humidity", 30.0, 70.0, 51.0, int64(6000), int64(20)},
+		},
+	}
+	sql.Register("recording-fleet-summary", drv)
+
+	db, err := sql.Open("recording-fleet-summary", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	summary, err := (&TimescaleDB{db: db}).GetFleetSummary(1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]FleetMetricSummary{
+		"temperature": {Min: 12, Max: 35, Avg: 22.5, SampleCount: 12000, DeviceCount: 40},
+		"humidity":    {Min: 30, Max: 70, Avg: 51, SampleCount: 6000, DeviceCount: 20},
+	}, summary)
+	assert.Equal(t, fleetSummaryQuery, drv.query)
+	assert.Equal(t, []driver.Value{int64(1)}, drv.args)
+}
+
+// TestGetFleetSummary_Postgres runs against a real TimescaleDB instance and
+// is skipped unless TEST_DATABASE_URL points at one.
+func TestGetFleetSummary_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer func() {
+		tsdb.db.Exec("DELETE FROM metric_aggregates WHERE metric_name = 'fleet_test_metric'")
+		tsdb.Close()
+	}()
+
+	ts := time.Now().Add(-10 * time.Minute).Truncate(time.Minute)
+	var records []AggregateRecord
+	for _, device := range []struct {
+		id                   string
+		mean, min, max       float64
+		samples, minutesBack int
+	}{
+		{id: "fleet-device-1", mean: 20, min: 18, max: 22, samples: 10},
+		{id: "fleet-device-2", mean: 30, min: 25, max: 40, samples: 30},
+		// Outside the last hour
+		{id: "fleet-device-3", mean: 90, min: 90, max: 90, samples: 10, minutesBack: 120},
+	} {
+		windowStart := ts.Add(-time.Duration(device.minutesBack) * time.Minute)
+		for function, value := range map[string]float64{"mean": device.mean, "min": device.min, "max": device.max} {
+			records = append(records, AggregateRecord{
+				DeviceID:    device.id,
+				Timestamp:   windowStart,
+				WindowStart: windowStart,
+				WindowEnd:   windowStart.Add(time.Minute),
+				MetricName:  "fleet_test_metric",
+				MetricValue: value,
+				SampleCount: device.samples,
+				Function:    function,
+			})
+		}
+	}
+	assert.NoError(t, tsdb.InsertAggregates(records))
+
+	summary, err := tsdb.GetFleetSummary(1)
+	assert.NoError(t, err)
+	assert.Equal(t, FleetMetricSummary{Min: 18, Max: 40, Avg: 27.5, SampleCount: 40, DeviceCount: 2}, summary["fleet_test_metric"])
+}
+
+func TestGetTopAnomalousMetrics_DecodesRows(t *testing.T) {
+	drv := &recordingDriver{
+		columns: []string{"metric_name", "count"},
+		rows: [][]driver.Value{
+			{"temperature", int64(42)},
+			{"humidity", int64(7)},
+		},
+	}
+	sql.Register("recording-anomaly-counts", drv)
+
+	db, err := sql.Open("recording-anomaly-counts", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	counts, err := (&TimescaleDB{db: db}).GetTopAnomalousMetrics("device-1", 24, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []MetricAnomalyCount{
+		{Metric: "temperature", Count: 42},
+		{Metric: "humidity", Count: 7},
+	}, counts)
+	assert.Equal(t, topAnomalousMetricsQuery, drv.query)
+	assert.Equal(t, []driver.Value{"device-1", int64(24), int64(10)}, drv.args)
+}
+
+// TestGetTopAnomalousMetrics_Postgres runs against a real TimescaleDB
+// instance and is skipped unless TEST_DATABASE_URL points at one.
+func TestGetTopAnomalousMetrics_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer func() {
+		tsdb.db.Exec("DELETE FROM alerts WHERE device_id = 'anomalous-device'")
+		tsdb.Close()
+	}()
+
+	now := time.Now()
+	alert := func(metric, alertType string, age time.Duration) AlertRecord {
+		return AlertRecord{
+			DeviceID:    "anomalous-device",
+			Timestamp:   now.Add(-age),
+			MetricName:  metric,
+			MetricValue: 1,
+			AlertType:   alertType,
+			Severity:    "medium",
+			Status:      "open",
+		}
+	}
+	alerts := []AlertRecord{
+		alert("temperature", "anomaly", time.Minute),
+		alert("temperature", "anomaly", time.Hour),
+		alert("temperature", "anomaly", 2*time.Hour),
+		alert("humidity", "anomaly", time.Minute),
+		alert("humidity", "anomaly", time.Hour),
+		alert("pressure", "anomaly", time.Minute),
+		// Only anomalies within the window count
+		alert("pressure", "threshold", time.Minute),
+		alert("pressure", "threshold", time.Minute),
+		alert("pressure", "anomaly", 48*time.Hour),
+		alert("pressure", "anomaly", 48*time.Hour),
+	}
+	for _, a := range alerts {
+		assert.NoError(t, tsdb.InsertAlert(a))
+	}
+
+	counts, err := tsdb.GetTopAnomalousMetrics("anomalous-device", 24, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []MetricAnomalyCount{
+		{Metric: "temperature", Count: 3},
+		{Metric: "humidity", Count: 2},
+	}, counts)
+}
+
+func TestDownsample_Parameterized(t *testing.T) {
+	drv := &recordingDriver{}
+	sql.Register("recording-downsample", drv)
+
+	db, err := sql.Open("recording-downsample", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tsdb := &TimescaleDB{db: db}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	assert.NoError(t, tsdb.Downsample("metric_aggregates", from, to, time.Hour))
+	assert.Equal(t, [][]driver.Value{
+		{3600.0, from, to},
+		{from, to},
+	}, drv.execs)
+
+	// Table names can't be bound, so only known tables are accepted
+	assert.ErrorContains(t, tsdb.Downsample("alerts; DROP TABLE alerts", from, to, time.Hour), "cannot be downsampled")
+	assert.ErrorContains(t, tsdb.Downsample("metric_aggregates", from, to, 0), "resolution")
+	assert.Len(t, drv.execs, 2)
+}
+
+// TestDownsample_Postgres runs against a real TimescaleDB instance and is
+// skipped unless TEST_DATABASE_URL points at one.
+func TestDownsample_Postgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	tsdb, err := NewTimescaleDB(url, testMigrationsDir)
+	assert.NoError(t, err)
+	defer func() {
+		tsdb.db.Exec("DELETE FROM metric_aggregates WHERE device_id = 'downsample-device'")
+		tsdb.db.Exec("DELETE FROM metric_aggregates_downsampled WHERE device_id = 'downsample-device'")
+		tsdb.Close()
+	}()
+
+	count := func(table string) int {
+		var n int
+		assert.NoError(t, tsdb.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE device_id = 'downsample-device'").Scan(&n))
+		return n
+	}
+
+	// Two hours of per-minute means and maxima, and one row outside the range
+	from := time.Now().AddDate(0, 0, -10).Truncate(time.Hour)
+	var aggregates []AggregateRecord
+	for i := 0; i < 120; i++ {
+		windowStart := from.Add(time.Duration(i) * time.Minute)
+		for _, function := range []string{"mean", "max"} {
+			aggregates = append(aggregates, AggregateRecord{
+				DeviceID:    "downsample-device",
+				Timestamp:   windowStart,
+				WindowStart: windowStart,
+				WindowEnd:   windowStart.Add(time.Minute),
+				MetricName:  "temperature",
+				MetricValue: float64(i),
+				SampleCount: 10,
+				Function:    function,
+			})
+		}
+	}
+	kept := from.Add(2 * time.Hour)
+	aggregates = append(aggregates, AggregateRecord{
+		DeviceID:    "downsample-device",
+		Timestamp:   kept,
+		WindowStart: kept,
+		WindowEnd:   kept.Add(time.Minute),
+		MetricName:  "temperature",
+		MetricValue: 1,
+		SampleCount: 10,
+		Function:    "mean",
+	})
+	assert.NoError(t, tsdb.InsertAggregates(aggregates))
+	assert.Equal(t, 241, count("metric_aggregates"))
+	assert.Equal(t, 0, count("metric_aggregates_downsampled"))
+
+	assert.NoError(t, tsdb.Downsample("metric_aggregates", from, kept, time.Hour))
+
+	assert.Equal(t, 1, count("metric_aggregates"))
+	// One row per hour and function
+	assert.Equal(t, 4, count("metric_aggregates_downsampled"))
+
+	var mean, maximum float64
+	var samples int
+	assert.NoError(t, tsdb.db.QueryRow(`
+		SELECT metric_value, sample_count FROM metric_aggregates_downsampled
+		WHERE device_id = 'downsample-device' AND aggregation_function = 'mean' AND timestamp = $1`, from).Scan(&mean, &samples))
+	assert.NoError(t, tsdb.db.QueryRow(`
+		SELECT metric_value FROM metric_aggregates_downsampled
+		WHERE device_id = 'downsample-device' AND aggregation_function = 'max' AND timestamp = $1`, from).Scan(&maximum))
+	assert.InDelta(t, 29.5, mean, 1e-9)
+	assert.Equal(t, 600, samples)
+	assert.Equal(t, 59.0, maximum)
+}
@@ -0,0 +1,135 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+
+	pb "go-processor/internal/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Publisher is the subset of kafka.Producer used to forward ingested
+// telemetry.
+type Publisher interface {
+	SendMessage(key, value []byte) error
+}
+
+// Server implements the TelemetryIngestion service, publishing every valid
+// message to the raw events topic so it flows through the same processors as
+// telemetry from the HTTP ingestion path.
+type Server struct {
+	pb.UnimplementedTelemetryIngestionServer
+
+	addr     string
+	producer Publisher
+	server   *grpc.Server
+}
+
+func NewServer(addr string, producer Publisher) *Server {
+	s := &Server{
+		addr:     addr,
+		producer: producer,
+		server:   grpc.NewServer(),
+	}
+	pb.RegisterTelemetryIngestionServer(s.server, s)
+	return s
+}
+
+func (s *Server) Run() {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		slog.Error("gRPC server error", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	slog.Info("gRPC server starting", slog.String("addr", s.addr))
+	if err := s.server.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		slog.Error("gRPC server error", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+// Stop waits for open streams to finish, closing them forcibly once ctx is
+// done.
+func (s *Server) Stop(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// Ingest acknowledges each received message in order. Invalid messages are
+// rejected in their ack and the stream continues; a failed Kafka write ends
+// the stream with codes.Unavailable so the client can reconnect and resend.
+func (s *Server) Ingest(stream pb.TelemetryIngestion_IngestServer) error {
+	for {
+		telemetry, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &pb.IngestAck{DeviceId: telemetry.DeviceId, Ts: telemetry.Ts}
+		if err := validate(telemetry); err != nil {
+			ack.Error = err.Error()
+		} else if err := s.publish(telemetry); err != nil {
+			slog.Error("Failed to publish ingested telemetry",
+				slog.String("device_id", telemetry.DeviceId),
+				slog.Any("error", err))
+			return status.Errorf(codes.Unavailable, "failed to publish telemetry: %v", err)
+		} else {
+			ack.Accepted = true
+		}
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) publish(telemetry *pb.Telemetry) error {
+	data, err := proto.Marshal(telemetry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telemetry: %w", err)
+	}
+	return s.producer.SendMessage([]byte(telemetry.DeviceId), data)
+}
+
+func validate(telemetry *pb.Telemetry) error {
+	if telemetry.DeviceId == "" {
+		return errors.New("device_id is required")
+	}
+	if telemetry.Ts <= 0 {
+		return errors.New("ts must be a positive epoch millisecond timestamp")
+	}
+	if len(telemetry.Metrics) == 0 {
+		return errors.New("at least one metric is required")
+	}
+	for name, value := range telemetry.Metrics {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("metric %q is not a finite number", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"testing"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages map[string][]byte
+	err      error
+}
+
+func (p *fakePublisher) SendMessage(key, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	if p.messages == nil {
+		p.messages = make(map[string][]byte)
+	}
+	p.messages[string(key)] = value
+	return nil
+}
+
+func newTestClient(t *testing.T, publisher Publisher) pb.TelemetryIngestionClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := NewServer("bufconn", publisher)
+	go server.server.Serve(lis)
+	t.Cleanup(server.server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewTelemetryIngestionClient(conn)
+}
+
+func TestIngest_PublishesValidTelemetry(t *testing.T) {
+	publisher := &fakePublisher{}
+	client := newTestClient(t, publisher)
+
+	stream, err := client.Ingest(context.Background())
+	assert.NoError(t, err)
+
+	valid := &pb.Telemetry{DeviceId: "device-001", Ts: 1699123456789, Metrics: map[string]float64{"temperature": 21.5}}
+	invalid := &pb.Telemetry{DeviceId: "device-002", Ts: 1699123456789}
+
+	assert.NoError(t, stream.Send(valid))
+	assert.NoError(t, stream.Send(invalid))
+	assert.NoError(t, stream.CloseSend())
+
+	ack, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.True(t, ack.Accepted)
+	assert.Equal(t, "device-001", ack.DeviceId)
+
+	ack, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.False(t, ack.Accepted)
+	assert.Equal(t, "device-002", ack.DeviceId)
+	assert.NotEmpty(t, ack.Error)
+
+	var published pb.Telemetry
+	assert.NoError(t, proto.Unmarshal(publisher.messages["device-001"], &published))
+	assert.Equal(t, 21.5, published.Metrics["temperature"])
+	assert.NotContains(t, publisher.messages, "device-002")
+}
+
+func TestIngest_PublishFailureEndsStream(t *testing.T) {
+	client := newTestClient(t, &fakePublisher{err: errors.New("broker unavailable")})
+
+	stream, err := client.Ingest(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&pb.Telemetry{DeviceId: "device-001", Ts: 1, Metrics: map[string]float64{"temperature": 1}}))
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestValidate(t *testing.T) {
+	metrics := map[string]float64{"temperature": 20}
+
+	assert.NoError(t, validate(&pb.Telemetry{DeviceId: "d", Ts: 1, Metrics: metrics}))
+	assert.Error(t, validate(&pb.Telemetry{Ts: 1, Metrics: metrics}))
+	assert.Error(t, validate(&pb.Telemetry{DeviceId: "d", Metrics: metrics}))
+	assert.Error(t, validate(&pb.Telemetry{DeviceId: "d", Ts: 1}))
+	assert.Error(t, validate(&pb.Telemetry{DeviceId: "d", Ts: 1, Metrics: map[string]float64{"temperature": math.NaN()}}))
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"sync"
+)
+
+// Component statuses reported by a HealthChecker.
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+)
+
+// HealthStatus is the state of one component, with component-specific
+// details such as latencies and timestamps.
+type HealthStatus struct {
+	Status  string                 `json:"status"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Healthy reports whether the component is working.
+func (s HealthStatus) Healthy() bool {
+	return s.Status == StatusHealthy
+}
+
+// Unhealthy returns an unhealthy status describing err.
+func Unhealthy(err error, details map[string]interface{}) HealthStatus {
+	return HealthStatus{Status: StatusUnhealthy, Error: err.Error(), Details: details}
+}
+
+// HealthChecker reports the health of a dependency or processor. Check
+// should return by the context's deadline.
+type HealthChecker interface {
+	Check(ctx context.Context) HealthStatus
+}
+
+// CheckerFunc adapts a function to a HealthChecker.
+type CheckerFunc func(ctx context.Context) HealthStatus
+
+func (f CheckerFunc) Check(ctx context.Context) HealthStatus {
+	return f(ctx)
+}
+
+// Report is the combined health of every registered component. Status is
+// unhealthy if any component is.
+type Report struct {
+	Status     string                  `json:"status"`
+	Components map[string]HealthStatus `json:"components"`
+}
+
+// Healthy reports whether every component is healthy.
+func (r Report) Healthy() bool {
+	return r.Status == StatusHealthy
+}
+
+// Registry holds the named checkers that make up the service's health.
+type Registry struct {
+	mu       sync.RWMutex
+	checkers map[string]HealthChecker
+}
+
+func NewRegistry() *Registry {
+	return &Registry{checkers: make(map[string]HealthChecker)}
+}
+
+// Register adds checker under name, replacing any checker of that name.
+func (r *Registry) Register(name string, checker HealthChecker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers[name] = checker
+}
+
+// Check runs every checker concurrently and combines their statuses.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checkers := make(map[string]HealthChecker, len(r.checkers))
+	for name, checker := range r.checkers {
+		checkers[name] = checker
+	}
+	r.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	report := Report{Status: StatusHealthy, Components: make(map[string]HealthStatus, len(checkers))}
+	for name, checker := range checkers {
+		wg.Add(1)
+		go func(name string, checker HealthChecker) {
+			defer wg.Done()
+			status := checker.Check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = status
+			if !status.Healthy() {
+				report.Status = StatusUnhealthy
+			}
+		}(name, checker)
+	}
+	wg.Wait()
+
+	return report
+}
@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-processor/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func staticChecker(status HealthStatus) HealthChecker {
+	return CheckerFunc(func(context.Context) HealthStatus { return status })
+}
+
+func TestRegistry_CombinesComponentStatuses(t *testing.T) {
+	registry := NewRegistry()
+	assert.Equal(t, Report{Status: StatusHealthy, Components: map[string]HealthStatus{}}, registry.Check(context.Background()))
+
+	healthy := HealthStatus{Status: StatusHealthy}
+	registry.Register("database", staticChecker(healthy))
+	registry.Register("kafka", staticChecker(healthy))
+	report := registry.Check(context.Background())
+	assert.True(t, report.Healthy())
+	assert.Len(t, report.Components, 2)
+
+	unhealthy := Unhealthy(errors.New("connection refused"), nil)
+	registry.Register("kafka", staticChecker(unhealthy))
+	report = registry.Check(context.Background())
+	assert.False(t, report.Healthy())
+	assert.Equal(t, StatusUnhealthy, report.Status)
+	assert.Equal(t, unhealthy, report.Components["kafka"])
+	assert.Equal(t, healthy, report.Components["database"])
+}
+
+func TestProcessorChecker(t *testing.T) {
+	const processor = "health_test_processor"
+	checker := NewProcessorChecker(processor)
+
+	// An idle processor is healthy
+	status := checker.Check(context.Background())
+	assert.True(t, status.Healthy())
+	assert.Equal(t, int64(0), status.Details["messages_processed"])
+
+	for i := 0; i < 3; i++ {
+		metrics.ObserveProcessing(processor, time.Now(), nil)
+	}
+	metrics.ObserveProcessing(processor, time.Now(), errors.New("decode failed"))
+	status = checker.Check(context.Background())
+	assert.True(t, status.Healthy())
+	assert.Equal(t, int64(4), status.Details["messages_processed"])
+	assert.Equal(t, 0.25, status.Details["error_rate"])
+
+	for i := 0; i < 4; i++ {
+		metrics.ObserveProcessing(processor, time.Now(), errors.New("database unavailable"))
+	}
+	status = checker.Check(context.Background())
+	assert.False(t, status.Healthy())
+	assert.Equal(t, "5 of 8 messages failed", status.Error)
+}
@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"go-processor/internal/metrics"
+)
+
+// defaultMaxErrorRate is the share of failed messages above which a
+// processor is unhealthy.
+const defaultMaxErrorRate = 0.5
+
+// ProcessorChecker reports how many messages a processor handled within
+// metrics.ActivityWindow and how many failed. A processor that received no
+// messages is healthy, as the source may simply be idle.
+type ProcessorChecker struct {
+	processor    string
+	MaxErrorRate float64
+}
+
+// NewProcessorChecker checks the processor named by its metrics label, such
+// as metrics.ProcessorAggregator.
+func NewProcessorChecker(processor string) *ProcessorChecker {
+	return &ProcessorChecker{processor: processor, MaxErrorRate: defaultMaxErrorRate}
+}
+
+func (c *ProcessorChecker) Check(context.Context) HealthStatus {
+	processed, failed := metrics.RecentActivity(c.processor)
+
+	var errorRate float64
+	if processed > 0 {
+		errorRate = float64(failed) / float64(processed)
+	}
+	details := map[string]interface{}{
+		"window_seconds":     metrics.ActivityWindow.Seconds(),
+		"messages_processed": processed,
+		"error_rate":         errorRate,
+	}
+
+	if errorRate > c.MaxErrorRate {
+		return Unhealthy(fmt.Errorf("%d of %d messages failed", failed, processed), details)
+	}
+	return HealthStatus{Status: StatusHealthy, Details: details}
+}
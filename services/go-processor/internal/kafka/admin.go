@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// adminTimeout bounds the metadata and topic creation requests of
+// EnsureTopics.
+const adminTimeout = 30 * time.Second
+
+// TopicSpec describes a topic to create if it does not exist.
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+}
+
+// topicAdmin is the subset of the Kafka admin API used by EnsureTopics.
+type topicAdmin interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error)
+}
+
+// EnsureTopics creates the topics that don't exist yet. Existing topics are
+// left as they are, whatever their partitions and replication factor.
+func EnsureTopics(brokers []string, topics []TopicSpec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+
+	client := &kafka.Client{
+		Addr:    kafka.TCP(brokers...),
+		Timeout: adminTimeout,
+	}
+	return ensureTopics(ctx, client, topics)
+}
+
+func ensureTopics(ctx context.Context, admin topicAdmin, topics []TopicSpec) error {
+	// Listing all topics rather than the wanted ones keeps brokers with
+	// auto.create.topics.enable from creating them with default settings
+	metadata, err := admin.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+	existing := make(map[string]bool, len(metadata.Topics))
+	for _, topic := range metadata.Topics {
+		if topic.Error == nil {
+			existing[topic.Name] = true
+		}
+	}
+
+	var missing []kafka.TopicConfig
+	for _, topic := range topics {
+		if existing[topic.Name] {
+			continue
+		}
+		existing[topic.Name] = true
+		missing = append(missing, kafka.TopicConfig{
+			Topic:             topic.Name,
+			NumPartitions:     topic.Partitions,
+			ReplicationFactor: topic.ReplicationFactor,
+		})
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	resp, err := admin.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: missing})
+	if err != nil {
+		return fmt.Errorf("failed to create topics: %w", err)
+	}
+
+	var errs []error
+	for _, topic := range missing {
+		err := resp.Errors[topic.Topic]
+		// Another processor instance may have created it in the meantime
+		if errors.Is(err, kafka.TopicAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to create topic %s: %w", topic.Topic, err))
+			continue
+		}
+		slog.Info("Created Kafka topic",
+			slog.String("topic", topic.Topic),
+			slog.Int("partitions", topic.NumPartitions),
+			slog.Int("replication_factor", topic.ReplicationFactor))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTopicAdmin struct {
+	topics  []kafka.Topic
+	errors  map[string]error
+	created []kafka.TopicConfig
+}
+
+func (a *fakeTopicAdmin) Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	return &kafka.MetadataResponse{Topics: a.topics}, nil
+}
+
+func (a *fakeTopicAdmin) CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error) {
+	a.created = append(a.created, req.Topics...)
+	return &kafka.CreateTopicsResponse{Errors: a.errors}, nil
+}
+
+func TestEnsureTopics_CreatesMissingTopics(t *testing.T) {
+	admin := &fakeTopicAdmin{topics: []kafka.Topic{{Name: "raw.events"}}}
+
+	err := ensureTopics(context.Background(), admin, []TopicSpec{
+		{Name: "raw.events", Partitions: 3, ReplicationFactor: 1},
+		{Name: "aggregates.minute", Partitions: 3, ReplicationFactor: 1},
+		{Name: "alerts", Partitions: 1, ReplicationFactor: 3},
+		{Name: "alerts", Partitions: 1, ReplicationFactor: 3},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []kafka.TopicConfig{
+		{Topic: "aggregates.minute", NumPartitions: 3, ReplicationFactor: 1},
+		{Topic: "alerts", NumPartitions: 1, ReplicationFactor: 3},
+	}, admin.created)
+}
+
+func TestEnsureTopics_AllExist(t *testing.T) {
+	admin := &fakeTopicAdmin{topics: []kafka.Topic{{Name: "raw.events"}, {Name: "alerts"}}}
+
+	err := ensureTopics(context.Background(), admin, []TopicSpec{
+		{Name: "raw.events", Partitions: 3, ReplicationFactor: 1},
+		{Name: "alerts", Partitions: 3, ReplicationFactor: 1},
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, admin.created)
+}
+
+func TestEnsureTopics_CreationErrors(t *testing.T) {
+	admin := &fakeTopicAdmin{errors: map[string]error{
+		"raw.events": kafka.TopicAlreadyExists,
+		"alerts":     kafka.InvalidReplicationFactor,
+	}}
+
+	err := ensureTopics(context.Background(), admin, []TopicSpec{
+		{Name: "raw.events", Partitions: 3, ReplicationFactor: 1},
+		{Name: "alerts", Partitions: 3, ReplicationFactor: 5},
+	})
+
+	assert.ErrorContains(t, err, "failed to create topic alerts")
+	assert.True(t, errors.Is(err, kafka.InvalidReplicationFactor))
+	assert.NotContains(t, err.Error(), "raw.events")
+}
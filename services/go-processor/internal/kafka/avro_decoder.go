@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Confluent wire format: a zero magic byte and a big-endian schema ID precede
+// the Avro payload.
+const (
+	avroMagicByte    = 0
+	avroHeaderLength = 5
+)
+
+const schemaRegistryTimeout = 10 * time.Second
+
+// AvroDecoder decodes Avro telemetry in the Schema Registry wire format.
+// Schemas are fetched from the registry on first use and cached by ID.
+//
+// The record is expected to have the Telemetry fields: a string device_id, a
+// long ts in epoch ms (or a timestamp-millis), a map of numeric metrics and
+// optional raw bytes.
+type AvroDecoder struct {
+	SchemaRegistryURL string
+
+	client *http.Client
+	codecs map[uint32]*goavro.Codec
+	mutex  sync.RWMutex
+}
+
+func NewAvroDecoder(schemaRegistryURL string) *AvroDecoder {
+	return &AvroDecoder{
+		SchemaRegistryURL: strings.TrimRight(schemaRegistryURL, "/"),
+		client:            &http.Client{Timeout: schemaRegistryTimeout},
+		codecs:            make(map[uint32]*goavro.Codec),
+	}
+}
+
+func (d *AvroDecoder) DecodeMessage(data []byte) (*pb.Telemetry, error) {
+	if len(data) < avroHeaderLength || data[0] != avroMagicByte {
+		return nil, fmt.Errorf("message is not in the schema registry wire format")
+	}
+	schemaID := binary.BigEndian.Uint32(data[1:avroHeaderLength])
+
+	codec, err := d.codec(schemaID)
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := codec.NativeFromBinary(data[avroHeaderLength:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode avro payload with schema %d: %w", schemaID, err)
+	}
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema %d does not describe a record", schemaID)
+	}
+	return telemetryFromRecord(record)
+}
+
+func (d *AvroDecoder) codec(schemaID uint32) (*goavro.Codec, error) {
+	d.mutex.RLock()
+	codec, ok := d.codecs[schemaID]
+	d.mutex.RUnlock()
+	if ok {
+		return codec, nil
+	}
+
+	schema, err := d.fetchSchema(schemaID)
+	if err != nil {
+		return nil, err
+	}
+	codec, err = goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %d: %w", schemaID, err)
+	}
+
+	d.mutex.Lock()
+	d.codecs[schemaID] = codec
+	d.mutex.Unlock()
+	return codec, nil
+}
+
+func (d *AvroDecoder) fetchSchema(schemaID uint32) (string, error) {
+	resp, err := d.client.Get(fmt.Sprintf("%s/schemas/ids/%d", d.SchemaRegistryURL, schemaID))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch schema %d: %w", schemaID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch schema %d: schema registry returned %s", schemaID, resp.Status)
+	}
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode schema %d: %w", schemaID, err)
+	}
+	return body.Schema, nil
+}
+
+// telemetryFromRecord maps a decoded Avro record onto a Telemetry message.
+func telemetryFromRecord(record map[string]interface{}) (*pb.Telemetry, error) {
+	var telemetry pb.Telemetry
+
+	deviceID, ok := unwrapUnion(record["device_id"]).(string)
+	if !ok || deviceID == "" {
+		return nil, fmt.Errorf("avro record has no device_id")
+	}
+	telemetry.DeviceId = deviceID
+
+	switch ts := unwrapUnion(record["ts"]).(type) {
+	case int64:
+		telemetry.Ts = ts
+	case int32:
+		telemetry.Ts = int64(ts)
+	case time.Time:
+		telemetry.Ts = ts.UnixMilli()
+	case nil:
+	default:
+		return nil, fmt.Errorf("avro field ts has unsupported type %T", ts)
+	}
+
+	if fields, ok := unwrapUnion(record["metrics"]).(map[string]interface{}); ok {
+		telemetry.Metrics = make(map[string]float64, len(fields))
+		for name, field := range fields {
+			value, ok := avroNumber(unwrapUnion(field))
+			if !ok {
+				return nil, fmt.Errorf("avro metric %s has unsupported type %T", name, field)
+			}
+			telemetry.Metrics[name] = value
+		}
+	}
+
+	if raw, ok := unwrapUnion(record["raw"]).([]byte); ok {
+		telemetry.Raw = raw
+	}
+
+	return &telemetry, nil
+}
+
+// unwrapUnion returns the value of a non-null union branch, which goavro
+// decodes as a single-entry map keyed by the branch type.
+func unwrapUnion(value interface{}) interface{} {
+	union, ok := value.(map[string]interface{})
+	if !ok || len(union) != 1 {
+		return value
+	}
+	for branch, v := range union {
+		switch branch {
+		case "string", "long", "int", "double", "float", "bytes", "map", "long.timestamp-millis":
+			return v
+		}
+	}
+	return value
+}
+
+func avroNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go-processor/internal/config"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTelemetrySchema = `{
+	"type": "record",
+	"name": "Telemetry",
+	"fields": [
+		{"name": "device_id", "type": "string"},
+		{"name": "ts", "type": "long"},
+		{"name": "metrics", "type": {"type": "map", "values": "double"}},
+		{"name": "raw", "type": ["null", "bytes"], "default": null}
+	]
+}`
+
+// newTestSchemaRegistry serves testTelemetrySchema as schema 42 and counts
+// the lookups.
+func newTestSchemaRegistry(t *testing.T, lookups *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(lookups, 1)
+		if r.URL.Path != "/schemas/ids/42" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		json.NewEncoder(w).Encode(map[string]string{"schema": testTelemetrySchema})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func encodeAvro(t *testing.T, schemaID uint32, record map[string]interface{}) []byte {
+	codec, err := goavro.NewCodec(testTelemetrySchema)
+	assert.NoError(t, err)
+
+	header := make([]byte, avroHeaderLength)
+	binary.BigEndian.PutUint32(header[1:], schemaID)
+	data, err := codec.BinaryFromNative(header, record)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestAvroDecoder_MapsFields(t *testing.T) {
+	var lookups int32
+	registry := newTestSchemaRegistry(t, &lookups)
+	decoder := NewAvroDecoder(registry.URL + "/")
+
+	data := encodeAvro(t, 42, map[string]interface{}{
+		"device_id": "device-1",
+		"ts":        int64(1700000000123),
+		"metrics":   map[string]interface{}{"temperature": 21.5, "humidity": 40.0},
+		"raw":       goavro.Union("bytes", []byte{0x01, 0x02}),
+	})
+
+	telemetry, err := decoder.DecodeMessage(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "device-1", telemetry.DeviceId)
+	assert.Equal(t, int64(1700000000123), telemetry.Ts)
+	assert.Equal(t, map[string]float64{"temperature": 21.5, "humidity": 40.0}, telemetry.Metrics)
+	assert.Equal(t, []byte{0x01, 0x02}, telemetry.Raw)
+
+	// The schema is fetched once and cached
+	_, err = decoder.DecodeMessage(data)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+}
+
+func TestAvroDecoder_NullRaw(t *testing.T) {
+	var lookups int32
+	decoder := NewAvroDecoder(newTestSchemaRegistry(t, &lookups).URL)
+
+	telemetry, err := decoder.DecodeMessage(encodeAvro(t, 42, map[string]interface{}{
+		"device_id": "device-1",
+		"ts":        int64(1),
+		"metrics":   map[string]interface{}{},
+		"raw":       goavro.Union("null", nil),
+	}))
+	assert.NoError(t, err)
+	assert.Nil(t, telemetry.Raw)
+}
+
+func TestAvroDecoder_Errors(t *testing.T) {
+	var lookups int32
+	decoder := NewAvroDecoder(newTestSchemaRegistry(t, &lookups).URL)
+
+	_, err := decoder.DecodeMessage([]byte{0x01, 0, 0, 0, 42})
+	assert.ErrorContains(t, err, "wire format")
+
+	_, err = decoder.DecodeMessage([]byte{0x00, 0x00})
+	assert.ErrorContains(t, err, "wire format")
+
+	_, err = decoder.DecodeMessage(encodeAvro(t, 7, map[string]interface{}{
+		"device_id": "device-1",
+		"ts":        int64(1),
+		"metrics":   map[string]interface{}{},
+		"raw":       goavro.Union("null", nil),
+	}))
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestNewMessageDecoder(t *testing.T) {
+	decoder, err := NewMessageDecoder(&config.Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, ProtobufDecoder{}, decoder)
+
+	_, err = NewMessageDecoder(&config.Config{MessageFormat: MessageFormatAvro})
+	assert.ErrorContains(t, err, "SCHEMA_REGISTRY_URL")
+
+	_, err = NewMessageDecoder(&config.Config{MessageFormat: "json"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DeviceCommand asks a device to do something, such as reboot or change its
+// reporting interval. It is published as JSON keyed by DeviceID, so the
+// commands of a device stay in order.
+type DeviceCommand struct {
+	CommandID  string                 `json:"command_id"`
+	DeviceID   string                 `json:"device_id"`
+	Command    string                 `json:"command"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// Validate checks that the command names a device and what to do.
+func (c DeviceCommand) Validate() error {
+	if c.DeviceID == "" {
+		return errors.New("device_id is required")
+	}
+	if c.Command == "" {
+		return errors.New("command is required")
+	}
+	return nil
+}
+
+// CommandProducer publishes device commands to the commands topic.
+type CommandProducer struct {
+	producer *Producer
+}
+
+func NewCommandProducer(brokers []string, topic string, opts ProducerOptions) *CommandProducer {
+	return &CommandProducer{producer: NewProducer(brokers, topic, opts)}
+}
+
+// SendCommand publishes command once it is valid.
+func (p *CommandProducer) SendCommand(command DeviceCommand) error {
+	if err := command.Validate(); err != nil {
+		return fmt.Errorf("invalid command: %w", err)
+	}
+
+	data, err := json.Marshal(command)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+	if err := p.producer.SendMessage([]byte(command.DeviceID), data); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+	return nil
+}
+
+func (p *CommandProducer) Close() error {
+	return p.producer.Close()
+}
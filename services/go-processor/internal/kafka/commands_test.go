@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandProducer_SendCommand(t *testing.T) {
+	writer := &recordingWriter{}
+	producer := &CommandProducer{producer: &Producer{writer: writer}}
+
+	command := DeviceCommand{
+		CommandID:  "cmd-1",
+		DeviceID:   "device-1",
+		Command:    "set_interval",
+		Parameters: map[string]interface{}{"seconds": 30.0},
+	}
+	assert.NoError(t, producer.SendCommand(command))
+
+	if assert.Len(t, writer.messages, 1) {
+		assert.Equal(t, []byte("device-1"), writer.messages[0].Key)
+		var sent DeviceCommand
+		assert.NoError(t, json.Unmarshal(writer.messages[0].Value, &sent))
+		assert.Equal(t, command, sent)
+	}
+}
+
+func TestCommandProducer_RejectsInvalidCommands(t *testing.T) {
+	writer := &recordingWriter{}
+	producer := &CommandProducer{producer: &Producer{writer: writer}}
+
+	assert.Error(t, producer.SendCommand(DeviceCommand{Command: "reboot"}))
+	assert.Error(t, producer.SendCommand(DeviceCommand{DeviceID: "device-1"}))
+	assert.Empty(t, writer.messages)
+}
@@ -1,13 +1,14 @@
 package kafka
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/segmentio/kafka-go"
 )
 
 func NewReader(brokers []string, groupID, topic string) *kafka.Reader {
-	log.Printf("Connecting Kafka reader: brokers=%v topic=%s group=%s", brokers, topic, groupID)
+	slog.Info("Connecting Kafka reader",
+		slog.Any("brokers", brokers), slog.String("topic", topic), slog.String("group", groupID))
 	return kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  brokers,
 		GroupID:  groupID,
@@ -18,7 +19,7 @@ func NewReader(brokers []string, groupID, topic string) *kafka.Reader {
 }
 
 func NewWriter(brokers []string, topic string) *kafka.Writer {
-	log.Printf("Connecting Kafka writer: brokers=%v topic=%s", brokers, topic)
+	slog.Info("Connecting Kafka writer", slog.Any("brokers", brokers), slog.String("topic", topic))
 	return &kafka.Writer{
 		Addr:     kafka.TCP(brokers...),
 		Topic:    topic,
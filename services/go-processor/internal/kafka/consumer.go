@@ -1,22 +1,33 @@
 package kafka
 
 import (
-	"log"
+	"log/slog"
 
 	"go-processor/internal/config"
 
 	"github.com/segmentio/kafka-go"
 )
 
-func NewConsumer(cfg *config.Config) (*kafka.Reader, error) {
+// ProcessorGroupID returns the consumer group through which processor reads
+// the raw events topic. Each processor has its own group, so every processor
+// receives every message and commits only its own progress.
+func ProcessorGroupID(cfg *config.Config, processor string) string {
+	return cfg.KafkaGroupID + "-" + processor
+}
+
+func NewConsumer(cfg *config.Config, groupID string) (*kafka.Reader, error) {
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  []string{cfg.KafkaBrokers},
-		GroupID:  cfg.KafkaGroupID,
+		Brokers:  cfg.Brokers,
+		GroupID:  groupID,
 		Topic:    cfg.KafkaTopic,
 		MinBytes: 10e3,
 		MaxBytes: 10e6,
+
+		CommitInterval: cfg.KafkaCommitInterval,
 	})
-	log.Printf("Kafka consumer connected to %s (topic=%s, group=%s)",
-		cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroupID)
+	slog.Info("Kafka consumer connected",
+		slog.Any("brokers", cfg.Brokers),
+		slog.String("topic", cfg.KafkaTopic),
+		slog.String("group", groupID))
 	return reader, nil
 }
@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"fmt"
+
+	"go-processor/internal/config"
+	pb "go-processor/internal/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	MessageFormatProtobuf = "protobuf"
+	MessageFormatAvro     = "avro"
+)
+
+// MessageDecoder converts a raw telemetry payload into a Telemetry message.
+type MessageDecoder interface {
+	DecodeMessage(data []byte) (*pb.Telemetry, error)
+}
+
+// ProtobufDecoder decodes protobuf-encoded Telemetry messages.
+type ProtobufDecoder struct{}
+
+func (ProtobufDecoder) DecodeMessage(data []byte) (*pb.Telemetry, error) {
+	var telemetry pb.Telemetry
+	if err := proto.Unmarshal(data, &telemetry); err != nil {
+		return nil, err
+	}
+	return &telemetry, nil
+}
+
+// NewMessageDecoder creates the decoder selected by cfg.MessageFormat.
+func NewMessageDecoder(cfg *config.Config) (MessageDecoder, error) {
+	switch cfg.MessageFormat {
+	case MessageFormatProtobuf, "":
+		return ProtobufDecoder{}, nil
+	case MessageFormatAvro:
+		if cfg.SchemaRegistryURL == "" {
+			return nil, fmt.Errorf("SCHEMA_REGISTRY_URL is required for message format %q", MessageFormatAvro)
+		}
+		return NewAvroDecoder(cfg.SchemaRegistryURL), nil
+	default:
+		return nil, fmt.Errorf("unknown message format %q", cfg.MessageFormat)
+	}
+}
@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type messagePosition struct {
+	partition int
+	offset    int64
+}
+
+// Deduplicator remembers the partition offsets seen within a window so that
+// messages redelivered after a consumer group rebalance can be skipped.
+type Deduplicator struct {
+	window time.Duration
+	now    func() time.Time
+
+	seen  map[messagePosition]time.Time
+	mutex sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		window: window,
+		now:    time.Now,
+		seen:   make(map[messagePosition]time.Time),
+	}
+}
+
+// IsDuplicate reports whether the message at partition and offset was seen
+// within the window, recording it if not.
+func (d *Deduplicator) IsDuplicate(partition int, offset int64) bool {
+	pos := messagePosition{partition: partition, offset: offset}
+	now := d.now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if seenAt, ok := d.seen[pos]; ok && now.Sub(seenAt) < d.window {
+		return true
+	}
+	d.seen[pos] = now
+	return false
+}
+
+// Start launches the goroutine expiring entries older than the window. It
+// runs until ctx is cancelled or Stop is called.
+func (d *Deduplicator) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.window / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.expire()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (d *Deduplicator) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+}
+
+func (d *Deduplicator) expire() {
+	cutoff := d.now().Add(-d.window)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for pos, seenAt := range d.seen {
+		if !seenAt.After(cutoff) {
+			delete(d.seen, pos)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplicator_IsDuplicate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := NewDeduplicator(5 * time.Minute)
+	d.now = func() time.Time { return now }
+
+	assert.False(t, d.IsDuplicate(0, 10))
+	assert.True(t, d.IsDuplicate(0, 10))
+
+	// Same offset on another partition, and the next offset, are new
+	assert.False(t, d.IsDuplicate(1, 10))
+	assert.False(t, d.IsDuplicate(0, 11))
+
+	// Once the window has passed the offset counts as new again
+	now = now.Add(5 * time.Minute)
+	assert.False(t, d.IsDuplicate(0, 10))
+	assert.True(t, d.IsDuplicate(0, 10))
+}
+
+func TestDeduplicator_Expire(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := NewDeduplicator(time.Minute)
+	d.now = func() time.Time { return now }
+
+	d.IsDuplicate(0, 1)
+	now = now.Add(30 * time.Second)
+	d.IsDuplicate(0, 2)
+
+	now = now.Add(30 * time.Second)
+	d.expire()
+	assert.Len(t, d.seen, 1)
+	assert.Contains(t, d.seen, messagePosition{partition: 0, offset: 2})
+}
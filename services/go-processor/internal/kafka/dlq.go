@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-processor/internal/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DLQEnvelope wraps a message that could not be processed together with the
+// reason, so it can be inspected and replayed later.
+type DLQEnvelope struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Error     string `json:"error"`
+	FailedAt  int64  `json:"failed_at"`
+}
+
+// SendToDLQ publishes the original message bytes and the processing error to
+// the dead-letter topic.
+func (p *Producer) SendToDLQ(msg kafka.Message, err error) error {
+	envelope := DLQEnvelope{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		FailedAt:  time.Now().UnixMilli(),
+	}
+	if err != nil {
+		envelope.Error = err.Error()
+	}
+
+	data, marshalErr := json.Marshal(envelope)
+	if marshalErr != nil {
+		return fmt.Errorf("failed to marshal DLQ envelope: %w", marshalErr)
+	}
+
+	if sendErr := p.SendMessage(msg.Key, data); sendErr != nil {
+		return fmt.Errorf("failed to send message to DLQ: %w", sendErr)
+	}
+
+	metrics.DLQMessages.Inc()
+	return nil
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// FanOutProducer writes every message to several topics through one Producer
+// per topic. Writes to the topics run concurrently; a send fails with the
+// error of the first producer that failed, in the order the producers were
+// given, once all writes have finished.
+type FanOutProducer struct {
+	producers []*Producer
+}
+
+func NewFanOutProducer(producers ...*Producer) *FanOutProducer {
+	return &FanOutProducer{producers: producers}
+}
+
+func (f *FanOutProducer) SendMessage(key, value []byte) error {
+	return f.SendMessageWithHeaders(key, value, nil)
+}
+
+// SendMessageWithHeaders sends a message carrying the given Kafka headers to
+// every topic.
+func (f *FanOutProducer) SendMessageWithHeaders(key, value []byte, headers []kafka.Header) error {
+	return f.fanOut(func(p *Producer) error {
+		return p.SendMessageWithHeaders(key, value, headers)
+	})
+}
+
+// SendMessageWithRetry sends a message to every topic, retrying each write as
+// Producer.SendMessageWithRetry does.
+func (f *FanOutProducer) SendMessageWithRetry(ctx context.Context, key, value []byte, maxRetries int, baseDelay time.Duration, headers ...kafka.Header) error {
+	return f.fanOut(func(p *Producer) error {
+		return p.SendMessageWithRetry(ctx, key, value, maxRetries, baseDelay, headers...)
+	})
+}
+
+// Close closes every producer and returns the first error.
+func (f *FanOutProducer) Close() error {
+	var firstErr error
+	for _, p := range f.producers {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (f *FanOutProducer) fanOut(send func(p *Producer) error) error {
+	errs := make([]error, len(f.producers))
+
+	var wg sync.WaitGroup
+	for i, p := range f.producers {
+		wg.Add(1)
+		go func(i int, p *Producer) {
+			defer wg.Done()
+			errs[i] = send(p)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOutProducer_SendsToAllTopics(t *testing.T) {
+	writers := []*recordingWriter{{}, {}, {}}
+	fanOut := NewFanOutProducer(&Producer{writer: writers[0]}, &Producer{writer: writers[1]}, &Producer{writer: writers[2]})
+	headers := []kafka.Header{{Key: "device-id", Value: []byte("device-1")}}
+
+	assert.NoError(t, fanOut.SendMessage([]byte("key"), []byte("value")))
+	assert.NoError(t, fanOut.SendMessageWithRetry(context.Background(), []byte("key"), []byte("retried"), 1, time.Millisecond, headers...))
+
+	for _, writer := range writers {
+		assert.Len(t, writer.messages, 2)
+		assert.Equal(t, []byte("value"), writer.messages[0].Value)
+		assert.Equal(t, []byte("retried"), writer.messages[1].Value)
+		assert.Equal(t, headers, writer.messages[1].Headers)
+	}
+}
+
+func TestFanOutProducer_ReturnsFirstError(t *testing.T) {
+	healthy := &recordingWriter{}
+	first := &flakyWriter{failures: 10}
+	fanOut := NewFanOutProducer(&Producer{writer: healthy}, &Producer{writer: first}, &Producer{writer: &flakyWriter{failures: 10}})
+
+	err := fanOut.SendMessageWithRetry(context.Background(), nil, []byte("value"), 1, time.Millisecond)
+
+	assert.EqualError(t, err, "broker unavailable")
+	assert.Equal(t, 2, first.calls)
+	// The healthy topic still gets the message
+	assert.Len(t, healthy.messages, 1)
+}
+
+type closeErrorWriter struct {
+	recordingWriter
+	err error
+}
+
+func (w *closeErrorWriter) Close() error { return w.err }
+
+func TestFanOutProducer_ClosesAllProducers(t *testing.T) {
+	closeErr := errors.New("close failed")
+	fanOut := NewFanOutProducer(&Producer{writer: &closeErrorWriter{err: closeErr}}, &Producer{writer: &closeErrorWriter{}})
+
+	assert.ErrorIs(t, fanOut.Close(), closeErr)
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"github.com/segmentio/kafka-go"
+)
+
+// HeaderCarrier adapts Kafka message headers to the OpenTelemetry
+// propagation.TextMapCarrier interface so trace context can be carried
+// alongside a message.
+type HeaderCarrier struct {
+	headers *[]kafka.Header
+}
+
+func NewHeaderCarrier(headers *[]kafka.Header) HeaderCarrier {
+	return HeaderCarrier{headers: headers}
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, header := range *c.headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	for i, header := range *c.headers {
+		if header.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, header := range *c.headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
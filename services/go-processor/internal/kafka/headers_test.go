@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHeaderCarrier_PropagatesTraceContext(t *testing.T) {
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01, 0x02, 0x03},
+		SpanID:     trace.SpanID{0x04, 0x05, 0x06},
+		TraceFlags: trace.FlagsSampled,
+	})
+	propagator := propagation.TraceContext{}
+
+	var headers []kafka.Header
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), spanCtx), NewHeaderCarrier(&headers))
+	assert.Equal(t, []string{"traceparent"}, NewHeaderCarrier(&headers).Keys())
+
+	extracted := trace.SpanContextFromContext(propagator.Extract(context.Background(), NewHeaderCarrier(&headers)))
+	assert.Equal(t, spanCtx.TraceID(), extracted.TraceID())
+	assert.Equal(t, spanCtx.SpanID(), extracted.SpanID())
+	assert.True(t, extracted.IsRemote())
+}
+
+func TestHeaderCarrier_SetReplacesExistingKey(t *testing.T) {
+	headers := []kafka.Header{{Key: "traceparent", Value: []byte("old")}}
+	carrier := NewHeaderCarrier(&headers)
+
+	carrier.Set("traceparent", "new")
+
+	assert.Len(t, headers, 1)
+	assert.Equal(t, "new", carrier.Get("traceparent"))
+	assert.Equal(t, "", carrier.Get("missing"))
+}
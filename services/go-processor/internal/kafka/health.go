@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-processor/internal/health"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// HealthChecker verifies that a topic's metadata can be fetched from the
+// brokers.
+type HealthChecker struct {
+	brokers []string
+	topic   string
+	dialer  *kafka.Dialer
+
+	// LagMonitor and Source, when set, add the consumer lag and the time of
+	// the last message read to Check.
+	LagMonitor *LagMonitor
+	Source     *ReaderSource
+}
+
+func NewHealthChecker(brokers []string, topic string) *HealthChecker {
+	return &HealthChecker{
+		brokers: brokers,
+		topic:   topic,
+		dialer:  &kafka.Dialer{},
+	}
+}
+
+// HealthCheck fetches the topic's partitions from the first broker that
+// answers within timeout. It fails if no broker answers or the topic has no
+// partitions.
+func (h *HealthChecker) HealthCheck(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var errs []error
+	for _, broker := range h.brokers {
+		err := h.checkBroker(ctx, broker)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+	}
+	return fmt.Errorf("kafka unreachable: %w", errors.Join(errs...))
+}
+
+func (h *HealthChecker) checkBroker(ctx context.Context, broker string) error {
+	conn, err := h.dialer.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The connection does not watch ctx once established
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	partitions, err := conn.ReadPartitions(h.topic)
+	if err != nil {
+		return fmt.Errorf("failed to fetch metadata for topic %s: %w", h.topic, err)
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s has no partitions", h.topic)
+	}
+	return nil
+}
+
+// checkTimeout bounds the broker probe of Check when ctx has no earlier
+// deadline.
+const checkTimeout = 3 * time.Second
+
+// Check probes the brokers and reports the consumer lag and when a message
+// was last read.
+func (h *HealthChecker) Check(ctx context.Context) health.HealthStatus {
+	details := map[string]interface{}{"topic": h.topic}
+	if h.LagMonitor != nil {
+		if lag, ok := h.LagMonitor.TotalLag(); ok {
+			details["consumer_lag"] = lag
+		}
+	}
+	if h.Source != nil {
+		if lastMessage := h.Source.LastMessageTime(); !lastMessage.IsZero() {
+			details["last_message"] = lastMessage.UTC()
+		}
+	}
+
+	if err := h.HealthCheck(ctx, checkTimeout); err != nil {
+		return health.Unhealthy(err, details)
+	}
+	return health.HealthStatus{Status: health.StatusHealthy, Details: details}
+}
@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheck_SilentBrokerTimesOut(t *testing.T) {
+	// Accepts connections but never answers a request
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	checker := NewHealthChecker([]string{listener.Addr().String()}, "raw.events")
+
+	start := time.Now()
+	err = checker.HealthCheck(context.Background(), 100*time.Millisecond)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestHealthCheck_ClosedPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	checker := NewHealthChecker([]string{addr}, "raw.events")
+
+	err = checker.HealthCheck(context.Background(), time.Second)
+	assert.ErrorContains(t, err, addr)
+}
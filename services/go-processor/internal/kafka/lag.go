@@ -0,0 +1,159 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-processor/internal/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// LagMonitor periodically compares the committed offsets of a consumer group
+// with the partition high watermarks and exports the difference as the
+// consumer lag gauge.
+type LagMonitor struct {
+	client   *kafka.Client
+	groupID  string
+	topic    string
+	interval time.Duration
+
+	// totalLag is the lag summed over partitions at the last collection, or
+	// -1 before the first.
+	totalLag atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewLagMonitor(brokers []string, groupID, topic string) *LagMonitor {
+	lm := &LagMonitor{
+		client: &kafka.Client{
+			Addr:    kafka.TCP(brokers...),
+			Timeout: 5 * time.Second,
+		},
+		groupID:  groupID,
+		topic:    topic,
+		interval: 10 * time.Second,
+	}
+	lm.totalLag.Store(-1)
+	return lm
+}
+
+// TotalLag returns the consumer lag summed over all partitions, as of the
+// last collection. ok is false until the first collection succeeds.
+func (lm *LagMonitor) TotalLag() (lag int64, ok bool) {
+	lag = lm.totalLag.Load()
+	return lag, lag >= 0
+}
+
+// Start launches the monitoring goroutine. It runs until ctx is cancelled or
+// Stop is called.
+func (lm *LagMonitor) Start(ctx context.Context) {
+	ctx, lm.cancel = context.WithCancel(ctx)
+
+	lm.wg.Add(1)
+	go func() {
+		defer lm.wg.Done()
+
+		ticker := time.NewTicker(lm.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := lm.collect(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to collect consumer lag", slog.String("topic", lm.topic), slog.Any("error", err))
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	slog.Info("Consumer lag monitor started", slog.String("topic", lm.topic), slog.String("group", lm.groupID))
+}
+
+func (lm *LagMonitor) Stop() {
+	if lm.cancel != nil {
+		lm.cancel()
+	}
+	lm.wg.Wait()
+}
+
+func (lm *LagMonitor) collect(ctx context.Context) error {
+	metadata, err := lm.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{lm.topic}})
+	if err != nil {
+		return fmt.Errorf("failed to fetch metadata: %w", err)
+	}
+
+	var partitions []int
+	for _, topic := range metadata.Topics {
+		if topic.Name != lm.topic {
+			continue
+		}
+		if topic.Error != nil {
+			return fmt.Errorf("failed to fetch metadata for topic %s: %w", lm.topic, topic.Error)
+		}
+		for _, partition := range topic.Partitions {
+			partitions = append(partitions, partition.ID)
+		}
+	}
+
+	offsetRequests := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, partition := range partitions {
+		offsetRequests = append(offsetRequests, kafka.LastOffsetOf(partition))
+	}
+
+	offsets, err := lm.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{lm.topic: offsetRequests},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	committed, err := lm.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: lm.groupID,
+		Topics:  map[string][]int{lm.topic: partitions},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return fmt.Errorf("failed to fetch committed offsets: %w", committed.Error)
+	}
+
+	committedOffsets := make(map[int]int64)
+	for _, partition := range committed.Topics[lm.topic] {
+		if partition.Error == nil {
+			committedOffsets[partition.Partition] = partition.CommittedOffset
+		}
+	}
+
+	var total int64
+	for _, partition := range offsets.Topics[lm.topic] {
+		if partition.Error != nil {
+			continue
+		}
+
+		lag := partition.LastOffset
+		if offset, ok := committedOffsets[partition.Partition]; ok && offset >= 0 {
+			lag = partition.LastOffset - offset
+		}
+		if lag < 0 {
+			lag = 0
+		}
+
+		metrics.ConsumerLag.WithLabelValues(lm.topic, strconv.Itoa(partition.Partition)).Set(float64(lag))
+		total += lag
+	}
+	lm.totalLag.Store(total)
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	mqttQoS            = 1
+	mqttBufferSize     = 1000
+	mqttConnectTimeout = 10 * time.Second
+	mqttDisconnectWait = 250 // milliseconds
+)
+
+// MQTTConsumer reads telemetry published to an MQTT broker, for deployments
+// without Kafka. Payloads use the same protobuf encoding as the raw Kafka
+// topic. Received messages are keyed by their MQTT topic, so per-device
+// topics keep per-device ordering in the processing loops.
+type MQTTConsumer struct {
+	client   mqtt.Client
+	topic    string
+	messages chan kafka.Message
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewMQTTConsumer(brokerURL, topicPattern, clientID string) (*MQTTConsumer, error) {
+	consumer := newMQTTConsumer(topicPattern)
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(clientID).
+		SetAutoReconnect(true).
+		// Subscriptions do not survive a clean-session reconnect
+		SetOnConnectHandler(consumer.subscribe)
+	consumer.client = mqtt.NewClient(opts)
+
+	token := consumer.client.Connect()
+	if !token.WaitTimeout(mqttConnectTimeout) {
+		return nil, fmt.Errorf("failed to connect to MQTT broker %s: timed out", brokerURL)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker %s: %w", brokerURL, err)
+	}
+
+	slog.Info("MQTT consumer connected",
+		slog.String("broker", brokerURL),
+		slog.String("topic", topicPattern))
+	return consumer, nil
+}
+
+func newMQTTConsumer(topicPattern string) *MQTTConsumer {
+	return &MQTTConsumer{
+		topic:    topicPattern,
+		messages: make(chan kafka.Message, mqttBufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *MQTTConsumer) subscribe(client mqtt.Client) {
+	token := client.Subscribe(c.topic, mqttQoS, func(_ mqtt.Client, msg mqtt.Message) {
+		c.enqueue(msg.Topic(), msg.Payload())
+	})
+	if token.Wait() && token.Error() != nil {
+		slog.Error("Failed to subscribe to MQTT topic",
+			slog.String("topic", c.topic), slog.Any("error", token.Error()))
+	}
+}
+
+// enqueue buffers a received message, blocking while the buffer is full so
+// the broker sees back-pressure instead of losing messages.
+func (c *MQTTConsumer) enqueue(topic string, payload []byte) {
+	msg := kafka.Message{Topic: topic, Key: []byte(topic), Value: payload, Time: time.Now()}
+	select {
+	case c.messages <- msg:
+	case <-c.done:
+	}
+}
+
+func (c *MQTTConsumer) ReadMessage(ctx context.Context) ([]byte, error) {
+	msg, err := c.ReadKafkaMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Value, nil
+}
+
+// ReadKafkaMessage returns the next received message, with its MQTT topic as
+// Topic and Key. It returns io.EOF once the consumer is closed.
+func (c *MQTTConsumer) ReadKafkaMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	case <-c.done:
+		return kafka.Message{}, io.EOF
+	}
+}
+
+func (c *MQTTConsumer) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.client != nil {
+			c.client.Disconnect(mqttDisconnectWait)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMQTTConsumer_ReadsQueuedMessages(t *testing.T) {
+	consumer := newMQTTConsumer("devices/+/telemetry")
+
+	consumer.enqueue("devices/device-1/telemetry", []byte("payload"))
+
+	msg, err := NextMessage(context.Background(), consumer)
+	assert.NoError(t, err)
+	assert.Equal(t, "devices/device-1/telemetry", msg.Topic)
+	assert.Equal(t, []byte("devices/device-1/telemetry"), msg.Key)
+	assert.Equal(t, []byte("payload"), msg.Value)
+}
+
+func TestMQTTConsumer_ReadStopsOnCancelAndClose(t *testing.T) {
+	consumer := newMQTTConsumer("devices/+/telemetry")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := consumer.ReadMessage(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, consumer.Close())
+	assert.NoError(t, consumer.Close())
+	_, err = consumer.ReadMessage(context.Background())
+	assert.ErrorIs(t, err, io.EOF)
+
+	// A full buffer must not block delivery after Close
+	for i := 0; i <= mqttBufferSize; i++ {
+		consumer.enqueue("devices/device-1/telemetry", nil)
+	}
+}
+
+type payloadSource struct{ payload []byte }
+
+func (s *payloadSource) ReadMessage(context.Context) ([]byte, error) { return s.payload, nil }
+func (s *payloadSource) Close() error                                { return nil }
+
+func TestNextMessage_WrapsPayloadOnlySources(t *testing.T) {
+	msg, err := NextMessage(context.Background(), &payloadSource{payload: []byte("payload")})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("payload"), msg.Value)
+	assert.Nil(t, msg.Key)
+}
@@ -2,33 +2,156 @@ package kafka
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"time"
+
+	"go-processor/internal/config"
+	"go-processor/internal/metrics"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// messageWriter is the subset of *kafka.Writer used by Producer.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 type Producer struct {
-	writer *kafka.Writer
+	writer      messageWriter
+	Compression kafka.Compression
+}
+
+// ProducerOptions tunes how a Producer writes to Kafka.
+type ProducerOptions struct {
+	Compression kafka.Compression
 }
 
-func NewProducer(brokers []string, topic string) *Producer {
+// ProducerOptionsFromConfig builds ProducerOptions from the service config.
+func ProducerOptionsFromConfig(cfg *config.Config) (ProducerOptions, error) {
+	compression, err := ParseCompression(cfg.KafkaCompression)
+	if err != nil {
+		return ProducerOptions{}, err
+	}
+	return ProducerOptions{Compression: compression}, nil
+}
+
+// ParseCompression converts "none", "gzip", "snappy", "lz4" or "zstd" into a
+// kafka.Compression. An empty string means no compression.
+func ParseCompression(name string) (kafka.Compression, error) {
+	if name == "" {
+		return kafka.Compression(0), nil
+	}
+
+	var compression kafka.Compression
+	if err := compression.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid Kafka compression: %w", err)
+	}
+	return compression, nil
+}
+
+func NewProducer(brokers []string, topic string, opts ProducerOptions) *Producer {
 	w := &kafka.Writer{
-		Addr:     kafka.TCP(brokers...),
-		Topic:    topic,
-		Balancer: &kafka.LeastBytes{},
+		Addr:        kafka.TCP(brokers...),
+		Topic:       topic,
+		Balancer:    &kafka.LeastBytes{},
+		Compression: opts.Compression,
+		Transport: &kafka.Transport{
+			Dial: countingDial,
+		},
 	}
-	log.Printf("Kafka producer ready for topic %s", topic)
-	return &Producer{writer: w}
+	slog.Info("Kafka producer ready", slog.String("topic", topic), slog.String("compression", opts.Compression.String()))
+	return &Producer{writer: w, Compression: opts.Compression}
 }
 
 func (p *Producer) SendMessage(key, value []byte) error {
+	return p.SendMessageWithHeaders(key, value, nil)
+}
+
+// SendMessageWithHeaders sends a message carrying the given Kafka headers.
+func (p *Producer) SendMessageWithHeaders(key, value []byte, headers []kafka.Header) error {
+	msg := kafka.Message{
+		Key:     key,
+		Value:   value,
+		Headers: headers,
+	}
+	if err := p.writer.WriteMessages(context.Background(), msg); err != nil {
+		return err
+	}
+	metrics.ProducerBytesBeforeCompression.Add(float64(len(key) + len(value)))
+	return nil
+}
+
+// SendMessageWithRetry sends a message, retrying up to maxRetries times with
+// exponential backoff (baseDelay * 2^attempt plus up to 50% jitter). It gives
+// up early and returns the context error if ctx is cancelled. Any headers are
+// attached to the message.
+func (p *Producer) SendMessageWithRetry(ctx context.Context, key, value []byte, maxRetries int, baseDelay time.Duration, headers ...kafka.Header) error {
 	msg := kafka.Message{
-		Key:   key,
-		Value: value,
+		Key:     key,
+		Value:   value,
+		Headers: headers,
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = p.writer.WriteMessages(ctx, msg); err == nil {
+			metrics.ProducerBytesBeforeCompression.Add(float64(len(key) + len(value)))
+			return nil
+		}
+		if attempt >= maxRetries {
+			return err
+		}
+
+		delay := baseDelay << attempt
+		if delay > 0 {
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+		}
+
+		metrics.ProducerRetries.Inc()
+		slog.Warn("Kafka write failed, retrying",
+			slog.Int("attempt", attempt+1),
+			slog.Int("max_attempts", maxRetries+1),
+			slog.Duration("delay", delay),
+			slog.Any("error", err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
 	}
-	return p.writer.WriteMessages(context.Background(), msg)
 }
 
 func (p *Producer) Close() error {
 	return p.writer.Close()
 }
+
+var dialer = &net.Dialer{
+	Timeout: 3 * time.Second,
+}
+
+// countingDial opens broker connections that record the bytes written to the
+// wire, i.e. after compression has been applied to record batches.
+func countingDial(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn}, nil
+}
+
+type countingConn struct {
+	net.Conn
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	metrics.ProducerBytesAfterCompression.Add(float64(n))
+	return n, err
+}
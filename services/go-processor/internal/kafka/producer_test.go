@@ -0,0 +1,138 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type flakyWriter struct {
+	failures int
+	calls    int
+}
+
+func (w *flakyWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.calls++
+	if w.calls <= w.failures {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func (w *flakyWriter) Close() error { return nil }
+
+func TestProducer_SendMessageWithRetry(t *testing.T) {
+	writer := &flakyWriter{failures: 2}
+	producer := &Producer{writer: writer}
+
+	err := producer.SendMessageWithRetry(context.Background(), []byte("key"), []byte("value"), 3, time.Millisecond)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, writer.calls)
+}
+
+func TestProducer_SendMessageWithRetryGivesUp(t *testing.T) {
+	writer := &flakyWriter{failures: 10}
+	producer := &Producer{writer: writer}
+
+	err := producer.SendMessageWithRetry(context.Background(), nil, []byte("value"), 2, time.Millisecond)
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, writer.calls)
+}
+
+func TestProducer_SendMessageWithRetryStopsOnCancel(t *testing.T) {
+	writer := &flakyWriter{failures: 10}
+	producer := &Producer{writer: writer}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := producer.SendMessageWithRetry(ctx, nil, []byte("value"), 5, time.Hour)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, writer.calls)
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, expected := range map[string]kafka.Compression{
+		"":       0,
+		"none":   0,
+		"gzip":   kafka.Gzip,
+		"snappy": kafka.Snappy,
+		"lz4":    kafka.Lz4,
+		"zstd":   kafka.Zstd,
+	} {
+		compression, err := ParseCompression(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, compression, name)
+	}
+
+	_, err := ParseCompression("brotli")
+	assert.Error(t, err)
+}
+
+func TestCompressionCodecsRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"device_id":"device-1","metrics":{"temperature":21.5}}`), 50)
+
+	for _, name := range []string{"gzip", "snappy", "lz4", "zstd"} {
+		compression, err := ParseCompression(name)
+		assert.NoError(t, err)
+
+		codec := compression.Codec()
+		assert.NotNil(t, codec, name)
+
+		var compressed bytes.Buffer
+		writer := codec.NewWriter(&compressed)
+		_, err = writer.Write(payload)
+		assert.NoError(t, err, name)
+		assert.NoError(t, writer.Close(), name)
+		assert.Less(t, compressed.Len(), len(payload), name)
+
+		reader := codec.NewReader(&compressed)
+		decompressed, err := io.ReadAll(reader)
+		assert.NoError(t, err, name)
+		assert.NoError(t, reader.Close(), name)
+		assert.Equal(t, payload, decompressed, name)
+	}
+}
+
+func TestNewProducer_SetsCompression(t *testing.T) {
+	producer := NewProducer([]string{"localhost:9092"}, "test-topic", ProducerOptions{Compression: kafka.Zstd})
+	defer producer.Close()
+
+	assert.Equal(t, kafka.Zstd, producer.Compression)
+	assert.Equal(t, kafka.Zstd, producer.writer.(*kafka.Writer).Compression)
+}
+
+type recordingWriter struct {
+	messages []kafka.Message
+}
+
+func (w *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+func TestProducer_SendsHeaders(t *testing.T) {
+	writer := &recordingWriter{}
+	producer := &Producer{writer: writer}
+	headers := []kafka.Header{{Key: "device-id", Value: []byte("device-1")}}
+
+	assert.NoError(t, producer.SendMessageWithHeaders([]byte("key"), []byte("value"), headers))
+	assert.NoError(t, producer.SendMessageWithRetry(context.Background(), []byte("key"), []byte("value"), 0, time.Millisecond, headers...))
+	assert.NoError(t, producer.SendMessage([]byte("key"), []byte("value")))
+
+	assert.Len(t, writer.messages, 3)
+	assert.Equal(t, headers, writer.messages[0].Headers)
+	assert.Equal(t, headers, writer.messages[1].Headers)
+	assert.Empty(t, writer.messages[2].Headers)
+}
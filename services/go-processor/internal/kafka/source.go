@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go-processor/internal/config"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	SourceTypeKafka = "kafka"
+	SourceTypeMQTT  = "mqtt"
+)
+
+// MessageSource is a stream of raw telemetry messages.
+type MessageSource interface {
+	ReadMessage(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// messageReader is implemented by sources that can return a full message,
+// whose key, headers and offset the processing loops use for ordering,
+// tracing and dead-lettering.
+type messageReader interface {
+	ReadKafkaMessage(ctx context.Context) (kafka.Message, error)
+}
+
+// Committer is implemented by sources whose messages must be committed once
+// processed. Uncommitted messages are redelivered after a restart.
+type Committer interface {
+	CommitMessage(ctx context.Context, msg kafka.Message) error
+}
+
+// NextMessage reads the next message from source. Sources that only provide
+// the payload yield a message with just its Value set.
+func NextMessage(ctx context.Context, source MessageSource) (kafka.Message, error) {
+	if reader, ok := source.(messageReader); ok {
+		return reader.ReadKafkaMessage(ctx)
+	}
+	value, err := source.ReadMessage(ctx)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{Value: value}, nil
+}
+
+// NewMessageSource creates the raw telemetry source selected by
+// cfg.SourceType for processor. Sources of different processors each receive
+// every message.
+func NewMessageSource(cfg *config.Config, processor string) (MessageSource, error) {
+	switch cfg.SourceType {
+	case SourceTypeKafka, "":
+		reader, err := NewConsumer(cfg, ProcessorGroupID(cfg, processor))
+		if err != nil {
+			return nil, err
+		}
+		return NewReaderSource(reader, cfg.KafkaAutoCommit), nil
+	case SourceTypeMQTT:
+		if cfg.MQTTBrokerURL == "" {
+			return nil, fmt.Errorf("MQTT_BROKER_URL is required for source type %q", SourceTypeMQTT)
+		}
+		// The broker disconnects a client whose ID connects again
+		return NewMQTTConsumer(cfg.MQTTBrokerURL, cfg.MQTTTopicPattern, cfg.MQTTClientID+"-"+processor)
+	default:
+		return nil, fmt.Errorf("unknown source type %q", cfg.SourceType)
+	}
+}
+
+// ReaderSource adapts a kafka.Reader to MessageSource. With autoCommit,
+// offsets are committed as messages are read; otherwise only messages passed
+// to CommitMessage are committed.
+type ReaderSource struct {
+	reader     *kafka.Reader
+	autoCommit bool
+
+	// lastMessage is when a message was last read, in Unix nanoseconds.
+	lastMessage atomic.Int64
+}
+
+func NewReaderSource(reader *kafka.Reader, autoCommit bool) *ReaderSource {
+	return &ReaderSource{reader: reader, autoCommit: autoCommit}
+}
+
+func (s *ReaderSource) ReadMessage(ctx context.Context) ([]byte, error) {
+	msg, err := s.ReadKafkaMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Value, nil
+}
+
+func (s *ReaderSource) ReadKafkaMessage(ctx context.Context) (kafka.Message, error) {
+	var msg kafka.Message
+	var err error
+	if s.autoCommit {
+		msg, err = s.reader.ReadMessage(ctx)
+	} else {
+		msg, err = s.reader.FetchMessage(ctx)
+	}
+	if err == nil {
+		s.lastMessage.Store(time.Now().UnixNano())
+	}
+	return msg, err
+}
+
+// LastMessageTime returns when a message was last read, or the zero time if
+// none has been.
+func (s *ReaderSource) LastMessageTime() time.Time {
+	lastMessage := s.lastMessage.Load()
+	if lastMessage == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastMessage)
+}
+
+// CommitMessage commits msg's offset. It does nothing with autoCommit, as the
+// offset was committed when the message was read.
+func (s *ReaderSource) CommitMessage(ctx context.Context, msg kafka.Message) error {
+	if s.autoCommit {
+		return nil
+	}
+	return s.reader.CommitMessages(ctx, msg)
+}
+
+func (s *ReaderSource) Close() error {
+	return s.reader.Close()
+}
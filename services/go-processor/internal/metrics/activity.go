@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// ActivityWindow is how far back RecentActivity counts processed messages.
+const ActivityWindow = 60 * time.Second
+
+// activity counts processed and failed messages in one-second buckets
+// covering ActivityWindow.
+type activity struct {
+	mu      sync.Mutex
+	buckets [int(ActivityWindow / time.Second)]activityBucket
+}
+
+type activityBucket struct {
+	second    int64
+	processed int64
+	failed    int64
+}
+
+func (a *activity) record(now time.Time, failed bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	second := now.Unix()
+	bucket := &a.buckets[second%int64(len(a.buckets))]
+	if bucket.second != second {
+		*bucket = activityBucket{second: second}
+	}
+	bucket.processed++
+	if failed {
+		bucket.failed++
+	}
+}
+
+func (a *activity) totals(now time.Time) (processed, failed int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	oldest := now.Unix() - int64(len(a.buckets)) + 1
+	for _, bucket := range a.buckets {
+		if bucket.second >= oldest && bucket.second <= now.Unix() {
+			processed += bucket.processed
+			failed += bucket.failed
+		}
+	}
+	return processed, failed
+}
+
+var (
+	activityMu  sync.Mutex
+	activityFor = make(map[string]*activity)
+)
+
+func processorActivity(processor string) *activity {
+	activityMu.Lock()
+	defer activityMu.Unlock()
+
+	a, ok := activityFor[processor]
+	if !ok {
+		a = &activity{}
+		activityFor[processor] = a
+	}
+	return a
+}
+
+// RecentActivity returns how many messages processor handled within the
+// last ActivityWindow, and how many of those failed.
+func RecentActivity(processor string) (processed, failed int64) {
+	return processorActivity(processor).totals(time.Now())
+}
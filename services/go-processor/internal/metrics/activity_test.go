@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivity_CountsWithinWindow(t *testing.T) {
+	var a activity
+	start := time.Unix(1_700_000_000, 0)
+
+	a.record(start, false)
+	a.record(start.Add(10*time.Second), true)
+	a.record(start.Add(30*time.Second), false)
+
+	processed, failed := a.totals(start.Add(30 * time.Second))
+	assert.Equal(t, int64(3), processed)
+	assert.Equal(t, int64(1), failed)
+
+	// The first message falls out of the window
+	processed, failed = a.totals(start.Add(ActivityWindow))
+	assert.Equal(t, int64(2), processed)
+	assert.Equal(t, int64(1), failed)
+
+	// A bucket reused a window later starts from zero
+	a.record(start.Add(ActivityWindow+10*time.Second), false)
+	processed, failed = a.totals(start.Add(ActivityWindow + 10*time.Second))
+	assert.Equal(t, int64(2), processed)
+	assert.Equal(t, int64(0), failed)
+}
@@ -1,13 +1,34 @@
 package metrics
 
 import (
-	"log"
+	"hash/fnv"
+	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// latencyBucketsMs are the histogram buckets, in milliseconds, shared by the
+// latency metrics.
+var latencyBucketsMs = []float64{1, 5, 10, 50, 100, 500, 1000}
+
+// deviceBuckets is the number of device_bucket label values devices are
+// hashed into, so per-device metrics don't have a series per device.
+const deviceBuckets = 16
+
+// Processor and status label values for ProcessingLatency.
+const (
+	ProcessorAggregator      = "aggregator"
+	ProcessorAnomalyDetector = "anomaly_detector"
+
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
 var (
 	MessagesProcessed = prometheus.NewCounter(
 		prometheus.CounterOpts{
@@ -15,16 +36,230 @@ var (
 			Help: "Total number of messages processed",
 		},
 	)
+
+	AnomaliesDetected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "anomalies_detected_total",
+			Help: "Total number of anomaly alerts published to Kafka",
+		},
+		[]string{"severity", "detector"},
+	)
+
+	AnomaliesSaved = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "anomalies_saved_total",
+			Help: "Total number of anomaly alerts saved to the database",
+		},
+		[]string{"severity", "detector"},
+	)
+
+	ZScoreDistribution = prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{
+			Name:       "anomaly_zscore",
+			Help:       "Absolute Z-score of each metric value checked by the anomaly detector",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+		[]string{"metric_name"},
+	)
+
+	DLQMessages = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "dlq_messages_total",
+			Help: "Total number of messages published to the dead-letter queue",
+		},
+	)
+
+	ProducerRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_producer_retries_total",
+			Help: "Total number of Kafka producer write retries",
+		},
+	)
+
+	ProducerBytesBeforeCompression = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_producer_bytes_before_compression_total",
+			Help: "Total key and value bytes handed to Kafka producers",
+		},
+	)
+
+	ProducerBytesAfterCompression = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_producer_bytes_after_compression_total",
+			Help: "Total bytes written to Kafka broker connections by producers",
+		},
+	)
+
+	DuplicatesSkipped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_duplicates_skipped_total",
+			Help: "Total number of redelivered Kafka messages skipped as duplicates",
+		},
+	)
+
+	PartitionMetrics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_partition_messages_consumed_total",
+			Help: "Total number of messages read from each Kafka partition",
+		},
+		[]string{"topic", "partition"},
+	)
+
+	ConsumerLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Number of messages between the committed offset and the partition head",
+		},
+		[]string{"topic", "partition"},
+	)
+
+	WebSocketBytesBeforeCompression = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ws_bytes_before_compression_total",
+			Help: "Total payload bytes of messages written to WebSocket clients",
+		},
+	)
+
+	WebSocketBytesAfterCompression = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ws_bytes_after_compression_total",
+			Help: "Total bytes written to WebSocket client connections",
+		},
+	)
+
+	WebSocketDeadConnections = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ws_dead_connections_total",
+			Help: "Total number of WebSocket clients evicted for not answering pings",
+		},
+	)
+
+	ProcessingLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "processor_message_latency_milliseconds",
+			Help:    "Time taken to process a telemetry message, in milliseconds",
+			Buckets: latencyBucketsMs,
+		},
+		[]string{"processor", "status"},
+	)
+
+	DBCircuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "database_circuit_breaker_state",
+			Help: "State of the database write circuit breaker: 0 closed, 1 open, 2 half-open",
+		},
+	)
+
+	DBCircuitTrips = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "database_circuit_breaker_trips_total",
+			Help: "Total number of times the database write circuit breaker opened",
+		},
+	)
+
+	ActiveDevices = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "active_devices",
+			Help: "Number of devices seen in the last 5 minutes",
+		},
+	)
+
+	RateLimitExceeded = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rate_limit_exceeded_total",
+			Help: "Total number of REST API requests rejected by the rate limiter",
+		},
+	)
+
+	APIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_request_duration_seconds",
+			Help:    "Time taken to serve a REST API request, in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "path"},
+	)
+
+	WindowFillHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "aggregator_window_messages",
+			Help:    "Number of messages in each aggregation window when it is flushed",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		},
+		[]string{"device_bucket"},
+	)
+
+	WindowCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "aggregator_open_windows",
+			Help: "Number of aggregation windows buffered across all devices",
+		},
+	)
+
+	DatabaseWriteLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "database_write_latency_milliseconds",
+			Help:    "Time taken to write aggregates or alerts to the database, in milliseconds",
+			Buckets: latencyBucketsMs,
+		},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(MessagesProcessed)
+	prometheus.MustRegister(AnomaliesDetected)
+	prometheus.MustRegister(AnomaliesSaved)
+	prometheus.MustRegister(ZScoreDistribution)
+	prometheus.MustRegister(DLQMessages)
+	prometheus.MustRegister(ConsumerLag)
+	prometheus.MustRegister(PartitionMetrics)
+	prometheus.MustRegister(DuplicatesSkipped)
+	prometheus.MustRegister(ProducerRetries)
+	prometheus.MustRegister(ProducerBytesBeforeCompression)
+	prometheus.MustRegister(ProducerBytesAfterCompression)
+	prometheus.MustRegister(WebSocketBytesBeforeCompression)
+	prometheus.MustRegister(WebSocketBytesAfterCompression)
+	prometheus.MustRegister(WebSocketDeadConnections)
+	prometheus.MustRegister(ProcessingLatency)
+	prometheus.MustRegister(DatabaseWriteLatency)
+	prometheus.MustRegister(DBCircuitState)
+	prometheus.MustRegister(DBCircuitTrips)
+	prometheus.MustRegister(ActiveDevices)
+	prometheus.MustRegister(RateLimitExceeded)
+	prometheus.MustRegister(APIRequestDuration)
+	prometheus.MustRegister(WindowFillHistogram)
+	prometheus.MustRegister(WindowCount)
+}
+
+// DeviceBucket returns the device_bucket label value of deviceID.
+func DeviceBucket(deviceID string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(deviceID))
+	return strconv.Itoa(int(hash.Sum32() % deviceBuckets))
+}
+
+// Milliseconds returns the time elapsed since start in milliseconds, the unit
+// of the latency histograms.
+func Milliseconds(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
+
+// ObserveProcessing records the latency of one ProcessTelemetry call and
+// counts it towards RecentActivity.
+func ObserveProcessing(processor string, start time.Time, err error) {
+	status := StatusSuccess
+	if err != nil {
+		status = StatusError
+	}
+	ProcessingLatency.WithLabelValues(processor, status).Observe(Milliseconds(start))
+	processorActivity(processor).record(time.Now(), err != nil)
 }
 
 func Serve(addr string) {
 	http.Handle("/metrics", promhttp.Handler())
-	log.Printf("Metrics server listening on %s", addr)
+	slog.Info("Metrics server listening", slog.String("addr", addr))
 	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("metrics server error: %v", err)
+		slog.Error("Metrics server error", slog.Any("error", err))
+		os.Exit(1)
 	}
 }
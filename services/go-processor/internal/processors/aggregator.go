@@ -3,7 +3,13 @@ package processors
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,38 +21,222 @@ import (
 	"go-processor/internal/websocket"
 
 	kafkago "github.com/segmentio/kafka-go"
-	"google.golang.org/protobuf/proto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("go-processor/internal/processors")
+
+// Retry policy for publishing aggregates and alerts to Kafka.
+const (
+	producerMaxRetries     = 3
+	producerRetryBaseDelay = 100 * time.Millisecond
+)
+
+// maxTraceIDsPerWindow bounds the trace IDs an aggregate carries, so a busy
+// window doesn't grow without limit.
+const maxTraceIDsPerWindow = 100
+
+// traceIDHeader is the Kafka header carrying the trace_id a device attached
+// to its message, for end-to-end latency measurement.
+const traceIDHeader = "trace-id"
+
+// Function identifies how the samples of a window are reduced to a single value.
+type Function string
+
+const (
+	FunctionMean Function = "mean"
+	FunctionMin  Function = "min"
+	FunctionMax  Function = "max"
+	FunctionSum  Function = "sum"
+	FunctionP95  Function = "p95"
+	FunctionP99  Function = "p99"
+)
+
+// ParseFunction converts a configuration string such as "p95" into a Function.
+func ParseFunction(name string) (Function, error) {
+	switch fn := Function(strings.ToLower(strings.TrimSpace(name))); fn {
+	case FunctionMean, FunctionMin, FunctionMax, FunctionSum, FunctionP95, FunctionP99:
+		return fn, nil
+	default:
+		return "", fmt.Errorf("unknown aggregation function %q", name)
+	}
+}
+
 type AggregateData struct {
 	DeviceID    string             `json:"device_id"`
 	Timestamp   int64              `json:"timestamp"`
 	WindowStart int64              `json:"window_start"`
 	WindowEnd   int64              `json:"window_end"`
+	Function    Function           `json:"function,omitempty"`
 	Metrics     map[string]float64 `json:"metrics"`
 	Count       int                `json:"count"`
+
+	// DeviceCount is how many distinct devices contributed to a fleet
+	// aggregate. It is zero for device aggregates.
+	DeviceCount int `json:"device_count,omitempty"`
+
+	// TraceIDs lists the trace IDs of the messages in the window, up to
+	// maxTraceIDsPerWindow, so load tests can match aggregates to requests.
+	TraceIDs []string `json:"trace_ids,omitempty"`
+
+	// samples buffers the raw values of each metric in the window so that
+	// order statistics (min, max, percentiles) can be computed at flush time.
+	samples map[string][]float64
+
+	// flushDeadline is when a window held in pendingFlush is written out.
+	flushDeadline time.Time
+}
+
+// messagePublisher is the subset of kafka.Producer used to publish
+// aggregates and alerts.
+type messagePublisher interface {
+	SendMessageWithRetry(ctx context.Context, key, value []byte, maxRetries int, baseDelay time.Duration, headers ...kafkago.Header) error
+	Close() error
 }
 
 type Aggregator struct {
-	producer    *kafka.Producer
+	producer    messagePublisher
 	db          *database.TimescaleDB
+	logger      *slog.Logger
 	data        map[string]map[string]*AggregateData
 	mutex       sync.RWMutex
 	windowSize  time.Duration
 	ticker      *time.Ticker
 	stopChannel chan bool
+
+	// knownDevices holds the IDs registered in the devices table by this
+	// process, so registration costs one write per device.
+	knownDevices sync.Map
+
+	// DLQProducer receives messages that fail to process. Nil disables the DLQ.
+	DLQProducer *kafka.Producer
+
+	// Decoder converts raw payloads to telemetry. Nil decodes protobuf.
+	Decoder kafka.MessageDecoder
+
+	// Deduplicator skips messages already processed by this consumer. Nil
+	// disables deduplication.
+	Deduplicator *kafka.Deduplicator
+
+	// GapDetector is told about every device message. Nil disables data gap
+	// detection.
+	GapDetector *GapDetector
+
+	// ShadowSync records every message's metrics as its device's reported
+	// state. Nil disables device shadows.
+	ShadowSync *ShadowSync
+
+	// Observers are told about every decoded message.
+	Observers []TelemetryObserver
+
+	// AggregationFunctions lists the functions computed for every metric of a
+	// flushed window. Each function yields its own AggregateData.
+	AggregationFunctions []Function
+
+	// BulkInsertThreshold is the batch size above which aggregates are written
+	// with the COPY protocol instead of row-by-row inserts. Zero disables COPY.
+	BulkInsertThreshold int
+
+	// wal records every window contribution so buffered windows survive a
+	// restart. Nil disables the WAL.
+	wal *writeAheadLog
+
+	// AlignToClockBoundary starts windows on multiples of the window size
+	// since the epoch, e.g. at :00, :05 and :10 for 5-minute windows. When
+	// false, each device's windows are anchored at its first message.
+	AlignToClockBoundary bool
+
+	// anchors holds the start of the first window of each device with
+	// buffered or pending windows when windows are not aligned to the clock,
+	// guarded by mutex.
+	anchors map[string]int64
+
+	// GracePeriod is how long a due window keeps accepting late messages
+	// before it is written out. Zero writes windows out as soon as they are
+	// due.
+	GracePeriod time.Duration
+
+	// pendingFlush holds due windows until their grace period expires,
+	// guarded by mutex.
+	pendingFlush map[string]map[string]*AggregateData
+
+	// now is the clock used to schedule flushes. Nil uses time.Now.
+	now func() time.Time
 }
 
-func NewAggregator(cfg *config.Config, db *database.TimescaleDB) (*Aggregator, error) {
-	producer := kafka.NewProducer([]string{cfg.KafkaBrokers}, cfg.AggregatesTopic)
+func NewAggregator(cfg *config.Config, db *database.TimescaleDB, logger *slog.Logger) (*Aggregator, error) {
+	functions := make([]Function, 0, len(cfg.AggregationFunctions))
+	for _, name := range cfg.AggregationFunctions {
+		fn, err := ParseFunction(name)
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, fn)
+	}
+	if len(functions) == 0 {
+		functions = []Function{FunctionMean}
+	}
+
+	decoder, err := kafka.NewMessageDecoder(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	producerOpts, err := kafka.ProducerOptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AggregationWindowSeconds <= 0 {
+		return nil, fmt.Errorf("invalid aggregation window %ds", cfg.AggregationWindowSeconds)
+	}
+	windowSize := time.Duration(cfg.AggregationWindowSeconds) * time.Second
+
+	producer := newTopicPublisher(cfg.Brokers, cfg.AggregatesTopic, cfg.AdditionalAggregateTopics, producerOpts)
 
 	aggregator := &Aggregator{
-		producer:    producer,
-		db:          db,
-		data:        make(map[string]map[string]*AggregateData),
-		windowSize:  time.Minute,
-		ticker:      time.NewTicker(time.Minute),
-		stopChannel: make(chan bool),
+		producer:             producer,
+		db:                   db,
+		logger:               loggerOrDefault(logger),
+		data:                 make(map[string]map[string]*AggregateData),
+		windowSize:           windowSize,
+		ticker:               time.NewTicker(windowSize),
+		stopChannel:          make(chan bool),
+		AggregationFunctions: functions,
+		BulkInsertThreshold:  cfg.BulkInsertThreshold,
+		GracePeriod:          cfg.AggregationGracePeriod,
+		AlignToClockBoundary: cfg.AggregationAlignToClock,
+		Decoder:              decoder,
+	}
+
+	if cfg.DLQTopic != "" {
+		aggregator.DLQProducer = kafka.NewProducer(cfg.Brokers, cfg.DLQTopic, producerOpts)
+	}
+
+	if cfg.WALPath != "" {
+		records, err := readWAL(cfg.WALPath)
+		if err != nil {
+			aggregator.logger.Warn("Failed to read aggregation WAL",
+				slog.String("path", cfg.WALPath), slog.Any("error", err))
+		}
+		aggregator.replayWAL(records)
+		if len(records) > 0 {
+			aggregator.logger.Info("Replayed aggregation WAL",
+				slog.String("path", cfg.WALPath), slog.Int("records", len(records)))
+		}
+
+		wal, err := openWAL(cfg.WALPath)
+		if err != nil {
+			producer.Close()
+			if aggregator.DLQProducer != nil {
+				aggregator.DLQProducer.Close()
+			}
+			return nil, err
+		}
+		aggregator.wal = wal
 	}
 
 	// Start background aggregation flush
@@ -66,84 +256,246 @@ func (a *Aggregator) flushLoop() {
 	}
 }
 
-func (a *Aggregator) ProcessTelemetry(data []byte) error {
-	var telemetry pb.Telemetry
-	if err := proto.Unmarshal(data, &telemetry); err != nil {
-		log.Printf("Failed to unmarshal telemetry: %v", err)
-		return err
+// ProcessTelemetry adds an encoded telemetry message to its device's
+// current window. ctx carries the trace span of the message being processed.
+func (a *Aggregator) ProcessTelemetry(ctx context.Context, data []byte) error {
+	_, err := a.processTelemetry(ctx, data)
+	return err
+}
+
+// processTelemetry is ProcessTelemetry, also returning the decoded telemetry.
+func (a *Aggregator) processTelemetry(ctx context.Context, data []byte) (*pb.Telemetry, error) {
+	telemetry, err := decodeTelemetry(a.Decoder, data)
+	if err != nil {
+		a.logger.Error("Failed to decode telemetry", slog.Any("error", err))
+		return nil, err
 	}
 
-	metrics.MessagesProcessed.Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("device_id", telemetry.DeviceId))
 
-	// Calculate window boundaries
-	windowStart := (telemetry.Ts / 60000) * 60000 // Round down to minute
-	windowEnd := windowStart + 60000
+	metrics.MessagesProcessed.Inc()
 
-	windowKey := generateWindowKey(windowStart, windowEnd)
-	deviceID := telemetry.DeviceId
+	for _, observer := range a.Observers {
+		observer.ObserveTelemetry(telemetry.DeviceId, telemetry.Metrics)
+	}
 
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
+	// Calculate window boundaries
+	windowMillis := a.window().Milliseconds()
+	windowStart := a.windowStart(telemetry.DeviceId, telemetry.Ts)
+	record := walRecord{
+		DeviceID:    telemetry.DeviceId,
+		Timestamp:   windowStart + windowMillis/2, // Window center, whenever the message arrives
+		WindowStart: windowStart,
+		WindowEnd:   windowStart + windowMillis,
+		Count:       1,
+		Metrics:     make(map[string]float64, len(telemetry.Metrics)),
+		Samples:     make(map[string][]float64, len(telemetry.Metrics)),
+	}
+	if traceID := traceIDFromContext(ctx); traceID != "" {
+		record.TraceIDs = []string{traceID}
+	}
+	for metricName, metricValue := range telemetry.Metrics {
+		record.Metrics[metricName] = metricValue
+		record.Samples[metricName] = []float64{metricValue}
+	}
+
+	aggregate := a.addContribution(record)
+
+	if a.wal != nil {
+		if err := a.wal.Append(record); err != nil {
+			a.logger.Warn("Failed to append telemetry to WAL",
+				slog.String("device_id", record.DeviceID), slog.Any("error", err))
+		}
+	}
+
+	a.logger.Debug("Aggregated telemetry",
+		slog.String("device_id", record.DeviceID),
+		slog.String("window", generateWindowKey(record.WindowStart, record.WindowEnd)),
+		slog.Int("count", aggregate.Count))
+
+	return telemetry, nil
+}
+
+// windowStart returns the start of the window of deviceID that ts falls in.
+// The caller must hold a.mutex.
+func (a *Aggregator) windowStart(deviceID string, ts int64) int64 {
+	windowMillis := a.window().Milliseconds()
+	if a.AlignToClockBoundary {
+		return (ts / windowMillis) * windowMillis // Round down to window
+	}
+
+	anchor, ok := a.anchors[deviceID]
+	if !ok {
+		if a.anchors == nil {
+			a.anchors = make(map[string]int64)
+		}
+		a.anchors[deviceID] = ts
+		return ts
+	}
+	// Round towards the past for messages older than the anchor too
+	windows := (ts - anchor) / windowMillis
+	if (ts-anchor)%windowMillis < 0 {
+		windows--
+	}
+	return anchor + windows*windowMillis
+}
+
+// addContribution merges a window contribution into its device's window and
+// returns the window. The caller must hold a.mutex.
+func (a *Aggregator) addContribution(record walRecord) *AggregateData {
+	windowKey := generateWindowKey(record.WindowStart, record.WindowEnd)
+	deviceID := record.DeviceID
+
 	// Initialize device aggregates if not exists
 	if a.data[deviceID] == nil {
 		a.data[deviceID] = make(map[string]*AggregateData)
 	}
 
-	// Get or create aggregate for this window
-	aggregate, exists := a.data[deviceID][windowKey]
+	// Late messages update a due window still within its grace period
+	aggregate, exists := a.pendingFlush[deviceID][windowKey]
+	if !exists {
+		aggregate, exists = a.data[deviceID][windowKey]
+	}
+
+	// Create aggregate for this window if not exists
 	if !exists {
 		aggregate = &AggregateData{
 			DeviceID:    deviceID,
-			Timestamp:   time.Now().UnixMilli(),
-			WindowStart: windowStart,
-			WindowEnd:   windowEnd,
+			Timestamp:   record.Timestamp,
+			WindowStart: record.WindowStart,
+			WindowEnd:   record.WindowEnd,
 			Metrics:     make(map[string]float64),
 			Count:       0,
+			samples:     make(map[string][]float64),
 		}
 		a.data[deviceID][windowKey] = aggregate
+		metrics.WindowCount.Inc()
 	}
 
 	// Aggregate metrics (simple average for now)
-	aggregate.Count++
-	for metricName, metricValue := range telemetry.Metrics {
+	aggregate.Count += record.Count
+	for metricName, metricValue := range record.Metrics {
 		if existing, exists := aggregate.Metrics[metricName]; exists {
 			// Running average
-			aggregate.Metrics[metricName] = (existing*float64(aggregate.Count-1) + metricValue) / float64(aggregate.Count)
+			previous := float64(aggregate.Count - record.Count)
+			aggregate.Metrics[metricName] = (existing*previous + metricValue*float64(record.Count)) / float64(aggregate.Count)
 		} else {
 			aggregate.Metrics[metricName] = metricValue
 		}
 	}
+	for metricName, values := range record.Samples {
+		aggregate.samples[metricName] = append(aggregate.samples[metricName], values...)
+	}
+	for _, traceID := range record.TraceIDs {
+		if len(aggregate.TraceIDs) >= maxTraceIDsPerWindow {
+			break
+		}
+		aggregate.TraceIDs = append(aggregate.TraceIDs, traceID)
+	}
 
-	log.Printf("Aggregated telemetry for device %s, window %s, count %d",
-		deviceID, windowKey, aggregate.Count)
+	return aggregate
+}
 
-	return nil
+// replayWAL rebuilds the buffered windows from the records of the WAL.
+func (a *Aggregator) replayWAL(records []walRecord) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, record := range records {
+		a.addContribution(record)
+
+		// Keep anchoring windows where they were before the restart
+		if _, ok := a.anchors[record.DeviceID]; !ok && !a.AlignToClockBoundary {
+			if a.anchors == nil {
+				a.anchors = make(map[string]int64)
+			}
+			a.anchors[record.DeviceID] = record.WindowStart
+		}
+	}
+}
+
+// compactWAL replaces the WAL with one record per buffered or pending
+// window, dropping the contributions of flushed windows. The caller must
+// hold a.mutex.
+func (a *Aggregator) compactWAL() {
+	if a.wal == nil {
+		return
+	}
+
+	var records []walRecord
+	for _, buffered := range []map[string]map[string]*AggregateData{a.data, a.pendingFlush} {
+		for _, windows := range buffered {
+			for _, aggregate := range windows {
+				records = append(records, walRecord{
+					DeviceID:    aggregate.DeviceID,
+					Timestamp:   aggregate.Timestamp,
+					WindowStart: aggregate.WindowStart,
+					WindowEnd:   aggregate.WindowEnd,
+					Count:       aggregate.Count,
+					Metrics:     aggregate.Metrics,
+					Samples:     aggregate.samples,
+					TraceIDs:    aggregate.TraceIDs,
+				})
+			}
+		}
+	}
+
+	if err := a.wal.Rewrite(records); err != nil {
+		a.logger.Error("Failed to compact WAL", slog.Any("error", err))
+	}
+}
+
+// window returns the aggregation window size, one minute if unset.
+func (a *Aggregator) window() time.Duration {
+	if a.windowSize <= 0 {
+		return time.Minute
+	}
+	return a.windowSize
 }
 
 func (a *Aggregator) flushAggregates() {
+	currentTime := a.currentTime().UnixMilli()
+	a.flushWindowsBefore(context.Background(), currentTime-2*a.window().Milliseconds(), false) // 2 windows ago
+}
+
+// Flush writes out every buffered window regardless of age or grace period.
+// It is used to drain in-flight windows on shutdown.
+func (a *Aggregator) Flush() {
+	a.flushWindowsBefore(context.Background(), math.MaxInt64, true)
+}
+
+// currentTime returns the aggregator clock, time.Now unless overridden.
+func (a *Aggregator) currentTime() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
+
+// flushWindowsBefore moves windows that ended before cutoffTime to
+// pendingFlush for GracePeriod, then writes out the pending windows whose
+// grace period has expired. drain writes out every pending window.
+func (a *Aggregator) flushWindowsBefore(ctx context.Context, cutoffTime int64, drain bool) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	currentTime := time.Now().UnixMilli()
-	cutoffTime := currentTime - 120000 // 2 minutes ago
+	now := a.currentTime()
 
 	for deviceID, windows := range a.data {
 		for windowKey, aggregate := range windows {
-			// Flush windows that are at least 2 minutes old
+			// Hold windows that ended before the cutoff for late messages
 			if aggregate.WindowEnd < cutoffTime {
-				// Send to Kafka
-				if err := a.sendAggregate(aggregate); err != nil {
-					log.Printf("Failed to send aggregate to Kafka: %v", err)
+				if a.pendingFlush == nil {
+					a.pendingFlush = make(map[string]map[string]*AggregateData)
 				}
-
-				// Save to database
-				if err := a.saveAggregateToDatabase(aggregate); err != nil {
-					log.Printf("Failed to save aggregate to database: %v", err)
-				} else {
-					log.Printf("Flushed aggregate for device %s, window %s", deviceID, windowKey)
+				if a.pendingFlush[deviceID] == nil {
+					a.pendingFlush[deviceID] = make(map[string]*AggregateData)
 				}
-
+				aggregate.flushDeadline = now.Add(a.GracePeriod)
+				a.pendingFlush[deviceID][windowKey] = aggregate
 				delete(windows, windowKey)
 			}
 		}
@@ -153,69 +505,437 @@ func (a *Aggregator) flushAggregates() {
 			delete(a.data, deviceID)
 		}
 	}
+
+	for deviceID, windows := range a.pendingFlush {
+		for windowKey, aggregate := range windows {
+			if drain || !aggregate.flushDeadline.After(now) {
+				a.flushWindow(ctx, deviceID, windowKey, aggregate)
+				delete(windows, windowKey)
+				metrics.WindowCount.Dec()
+				metrics.WindowFillHistogram.WithLabelValues(metrics.DeviceBucket(deviceID)).Observe(float64(aggregate.Count))
+			}
+		}
+
+		if len(windows) == 0 {
+			delete(a.pendingFlush, deviceID)
+
+			// A device without windows starts a new session, anchored at
+			// its next message
+			if _, ok := a.data[deviceID]; !ok {
+				delete(a.anchors, deviceID)
+			}
+		}
+	}
+
+	a.compactWAL()
+}
+
+// flushWindow publishes a finalized window to Kafka and saves it to the
+// database.
+func (a *Aggregator) flushWindow(ctx context.Context, deviceID, windowKey string, aggregate *AggregateData) {
+	windowCtx, span := tracer.Start(ctx, "aggregator.flushWindow", trace.WithAttributes(
+		attribute.String("device_id", deviceID),
+		attribute.String("window", windowKey),
+	))
+	defer span.End()
+
+	results := a.computeAggregates(aggregate)
+
+	// Send to Kafka
+	for _, result := range results {
+		if err := a.sendAggregate(windowCtx, result); err != nil {
+			a.logger.Error("Failed to send aggregate to Kafka",
+				slog.String("device_id", deviceID), slog.Any("error", err))
+		}
+	}
+
+	// Save to database
+	if err := a.saveAggregateToDatabase(windowCtx, results); err != nil {
+		a.logger.Error("Failed to save aggregate to database",
+			slog.String("device_id", deviceID), slog.Any("error", err))
+	} else {
+		a.logger.Info("Flushed aggregate",
+			slog.String("device_id", deviceID), slog.String("window", windowKey))
+	}
+}
+
+// computeAggregates reduces the buffered samples of a window into one
+// AggregateData per configured function per metric.
+func (a *Aggregator) computeAggregates(aggregate *AggregateData) []*AggregateData {
+	functions := a.AggregationFunctions
+	if len(functions) == 0 {
+		functions = []Function{FunctionMean}
+	}
+
+	var results []*AggregateData
+	for _, fn := range functions {
+		for metricName, values := range aggregate.samples {
+			if len(values) == 0 {
+				continue
+			}
+			results = append(results, &AggregateData{
+				DeviceID:    aggregate.DeviceID,
+				Timestamp:   aggregate.Timestamp,
+				WindowStart: aggregate.WindowStart,
+				WindowEnd:   aggregate.WindowEnd,
+				Function:    fn,
+				Metrics:     map[string]float64{metricName: applyFunction(fn, values)},
+				Count:       len(values),
+				TraceIDs:    aggregate.TraceIDs,
+			})
+		}
+	}
+
+	return results
+}
+
+func applyFunction(fn Function, values []float64) float64 {
+	switch fn {
+	case FunctionMin:
+		return percentile(values, 0)
+	case FunctionMax:
+		return percentile(values, 100)
+	case FunctionSum:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case FunctionP95:
+		return percentile(values, 95)
+	case FunctionP99:
+		return percentile(values, 99)
+	default:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+}
+
+// percentile returns the p-th percentile of values using the nearest-rank
+// method on a sorted copy. The input slice is left untouched.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
 }
 
-func (a *Aggregator) sendAggregate(aggregate *AggregateData) error {
+func (a *Aggregator) sendAggregate(ctx context.Context, aggregate *AggregateData) (err error) {
+	ctx, span := tracer.Start(ctx, "aggregator.sendAggregate", trace.WithAttributes(
+		attribute.String("function", string(aggregate.Function)),
+	))
+	defer func() { endSpan(span, err) }()
+
 	jsonData, err := json.Marshal(aggregate)
 	if err != nil {
 		return err
 	}
 
-	return a.producer.SendMessage([]byte(aggregate.DeviceID), jsonData)
+	return a.producer.SendMessageWithRetry(ctx, []byte(aggregate.DeviceID), jsonData, producerMaxRetries, producerRetryBaseDelay, aggregateHeaders(aggregate)...)
+}
+
+// aggregateHeaders describes the window of an aggregate in Kafka headers so
+// consumers can route it without decoding the body.
+func aggregateHeaders(aggregate *AggregateData) []kafkago.Header {
+	return []kafkago.Header{
+		{Key: "window-start", Value: []byte(time.UnixMilli(aggregate.WindowStart).UTC().Format(time.RFC3339))},
+		{Key: "window-end", Value: []byte(time.UnixMilli(aggregate.WindowEnd).UTC().Format(time.RFC3339))},
+		{Key: "device-id", Value: []byte(aggregate.DeviceID)},
+		{Key: "metric-count", Value: []byte(strconv.Itoa(len(aggregate.Metrics)))},
+	}
 }
 
-func (a *Aggregator) saveAggregateToDatabase(aggregate *AggregateData) error {
-	// Convert to database records - one record per metric
+func (a *Aggregator) saveAggregateToDatabase(ctx context.Context, aggregates []*AggregateData) (err error) {
+	_, span := tracer.Start(ctx, "aggregator.saveAggregateToDatabase")
+	defer func() { endSpan(span, err) }()
+
+	// Convert to database records - one record per function per metric
 	var dbRecords []database.AggregateRecord
 
-	for metricName, metricValue := range aggregate.Metrics {
-		record := database.AggregateRecord{
-			DeviceID:    aggregate.DeviceID,
-			Timestamp:   time.UnixMilli(aggregate.Timestamp),
-			WindowStart: time.UnixMilli(aggregate.WindowStart),
-			WindowEnd:   time.UnixMilli(aggregate.WindowEnd),
-			MetricName:  metricName,
-			MetricValue: metricValue,
-			SampleCount: aggregate.Count,
+	for _, aggregate := range aggregates {
+		for metricName, metricValue := range aggregate.Metrics {
+			record := database.AggregateRecord{
+				DeviceID:    aggregate.DeviceID,
+				Timestamp:   time.UnixMilli(aggregate.Timestamp),
+				WindowStart: time.UnixMilli(aggregate.WindowStart),
+				WindowEnd:   time.UnixMilli(aggregate.WindowEnd),
+				MetricName:  metricName,
+				MetricValue: metricValue,
+				SampleCount: aggregate.Count,
+				Function:    string(aggregate.Function),
+			}
+			dbRecords = append(dbRecords, record)
 		}
-		dbRecords = append(dbRecords, record)
 	}
 
+	span.SetAttributes(attribute.Int("records", len(dbRecords)))
+
+	if a.BulkInsertThreshold > 0 && len(dbRecords) > a.BulkInsertThreshold {
+		return a.db.InsertAggregatesBulk(dbRecords)
+	}
 	return a.db.InsertAggregates(dbRecords)
 }
 
+// registerDevice adds a device to the devices table the first time this
+// process sees it. Fields set through the API are left unchanged.
+func (a *Aggregator) registerDevice(deviceID string) error {
+	if _, known := a.knownDevices.Load(deviceID); known {
+		return nil
+	}
+	if err := a.db.RegisterDevice(database.DeviceRecord{DeviceID: deviceID}); err != nil {
+		return err
+	}
+	a.knownDevices.Store(deviceID, struct{}{})
+	return nil
+}
+
+func (a *Aggregator) Name() string {
+	return metrics.ProcessorAggregator
+}
+
 func (a *Aggregator) Stop() {
 	a.stopChannel <- true
 	a.ticker.Stop()
 	a.producer.Close()
+	if a.DLQProducer != nil {
+		a.DLQProducer.Close()
+	}
+	if a.wal != nil {
+		if err := a.wal.Close(); err != nil {
+			a.logger.Error("Failed to close aggregation WAL", slog.Any("error", err))
+		}
+	}
+}
+
+// isShutdown reports whether a read error was caused by the loop's context
+// being cancelled or timing out, in which case the loop should exit.
+func isShutdown(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// loggerOrDefault lets constructors accept a nil logger.
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// sendToDLQ forwards a message that failed processing to the dead-letter
+// queue, if one is configured.
+func sendToDLQ(logger *slog.Logger, dlq *kafka.Producer, msg kafkago.Message, err error) {
+	if dlq == nil {
+		return
+	}
+	if dlqErr := dlq.SendToDLQ(msg, err); dlqErr != nil {
+		logger.Error("Failed to publish message to DLQ",
+			slog.Int("partition", msg.Partition),
+			slog.Int64("offset", msg.Offset),
+			slog.Any("error", dlqErr))
+	}
+}
+
+// commitMessage commits a processed message on sources that require it.
+// Messages still in flight when shutdown begins are committed too. The commit
+// sets the offset past every earlier message of the partition, even one
+// committed later, so loops commit through an offsetTracker.
+func commitMessage(ctx context.Context, logger *slog.Logger, source kafka.MessageSource, msg kafkago.Message) {
+	committer, ok := source.(kafka.Committer)
+	if !ok {
+		return
+	}
+	if err := committer.CommitMessage(context.WithoutCancel(ctx), msg); err != nil {
+		logger.Warn("Failed to commit message",
+			slog.Int("partition", msg.Partition),
+			slog.Int64("offset", msg.Offset),
+			slog.Any("error", err))
+	}
+}
+
+// newTopicPublisher publishes to topic, and through a FanOutProducer to the
+// additional topics as well when there are any.
+func newTopicPublisher(brokers []string, topic string, additional []string, opts kafka.ProducerOptions) messagePublisher {
+	if len(additional) == 0 {
+		return kafka.NewProducer(brokers, topic, opts)
+	}
+
+	producers := make([]*kafka.Producer, 0, len(additional)+1)
+	for _, t := range append([]string{topic}, additional...) {
+		producers = append(producers, kafka.NewProducer(brokers, strings.TrimSpace(t), opts))
+	}
+	return kafka.NewFanOutProducer(producers...)
+}
+
+// decodeTelemetry decodes a raw payload with decoder, or as protobuf when
+// decoder is nil, and rejects invalid telemetry.
+func decodeTelemetry(decoder kafka.MessageDecoder, data []byte) (*pb.Telemetry, error) {
+	if decoder == nil {
+		decoder = kafka.ProtobufDecoder{}
+	}
+	telemetry, err := decoder.DecodeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateProtobufTelemetry(telemetry); err != nil {
+		return nil, err
+	}
+	return telemetry, nil
+}
+
+// traceIDContextKey is the context key of a message's trace ID.
+type traceIDContextKey struct{}
+
+// withTraceID returns ctx carrying the trace ID of the message being
+// processed. An empty traceID leaves ctx unchanged.
+func withTraceID(ctx context.Context, traceID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDContextKey{}, traceID)
 }
 
+// traceIDFromContext returns the trace ID set by withTraceID, if any.
+func traceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDContextKey{}).(string)
+	return traceID
+}
+
+// generateWindowKey identifies a window by its start and duration, so
+// windows of different sizes starting together never collide.
 func generateWindowKey(start, end int64) string {
-	return time.UnixMilli(start).Format("2006-01-02T15:04:05Z")
+	duration := time.Duration(end-start) * time.Millisecond
+	return time.UnixMilli(start).Format("2006-01-02T15:04:05Z") + "/" + duration.String()
 }
 
-func StartAggregationLoop(reader *kafkago.Reader, cfg *config.Config, aggregator *Aggregator, wsServer *websocket.Server) {
-	log.Println("Starting aggregation loop...")
+func StartAggregationLoop(ctx context.Context, source kafka.MessageSource, cfg *config.Config, aggregator *Aggregator, wsServer *websocket.Server, workerCount int) {
+	logger := aggregator.logger
+	logger.Info("Starting aggregation loop",
+		slog.Int("workers", workerCount),
+		slog.Bool("ordered_by_device", cfg.OrderedByDevice),
+		slog.Int("max_device_channels", cfg.MaxDeviceChannels))
+
+	propagator := otel.GetTextMapPropagator()
+
+	// Workers finish messages out of order, so commits wait for every
+	// earlier message
+	offsets := newOffsetTracker(source, logger)
+
+	handle := func(msg kafkago.Message) {
+		// Continue the producer's trace, if the message carries one
+		carrier := kafka.NewHeaderCarrier(&msg.Headers)
+		msgCtx := propagator.Extract(ctx, carrier)
+		msgCtx = withTraceID(msgCtx, carrier.Get(traceIDHeader))
+		msgCtx, span := tracer.Start(msgCtx, "aggregator.processMessage",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.destination.name", msg.Topic),
+				attribute.Int("messaging.kafka.destination.partition", msg.Partition),
+				attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+			))
+		defer span.End()
+
+		if aggregator.Deduplicator != nil && aggregator.Deduplicator.IsDuplicate(msg.Partition, msg.Offset) {
+			metrics.DuplicatesSkipped.Inc()
+			logger.Debug("Skipping duplicate message",
+				slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+			offsets.Done(ctx, msg)
+			return
+		}
 
-	for {
-		msg, err := reader.ReadMessage(context.Background())
+		start := time.Now()
+		telemetry, err := aggregator.processTelemetry(msgCtx, msg.Value)
+		metrics.ObserveProcessing(metrics.ProcessorAggregator, start, err)
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			continue
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			logger.Error("Error processing telemetry",
+				slog.Int("partition", msg.Partition),
+				slog.Int64("offset", msg.Offset),
+				slog.Any("error", err))
+			sendToDLQ(logger, aggregator.DLQProducer, msg, err)
+			offsets.Fail(msg)
+		} else {
+			offsets.Done(ctx, msg)
 		}
 
-		if err := aggregator.ProcessTelemetry(msg.Value); err != nil {
-			log.Printf("Error processing telemetry: %v", err)
+		// Register new devices and update last seen in database
+		if telemetry != nil {
+			if err := aggregator.registerDevice(telemetry.DeviceId); err != nil {
+				logger.Warn("Failed to register device",
+					slog.String("device_id", telemetry.DeviceId), slog.Any("error", err))
+			}
+			// Protobuf telemetry carries no location, firmware or device type, so
+			// the stored ones are kept
+			if err := aggregator.db.UpdateDeviceLastSeen(telemetry.DeviceId, database.DeviceReport{}); err != nil {
+				logger.Warn("Failed to update device last seen",
+					slog.String("device_id", telemetry.DeviceId), slog.Any("error", err))
+			}
+			if aggregator.GapDetector != nil {
+				aggregator.GapDetector.RecordSeen(telemetry.DeviceId)
+			}
+			if aggregator.ShadowSync != nil {
+				if err := aggregator.ShadowSync.RecordTelemetry(telemetry.DeviceId, telemetry.Metrics); err != nil {
+					logger.Warn("Failed to update device shadow",
+						slog.String("device_id", telemetry.DeviceId), slog.Any("error", err))
+				}
+			}
 		}
 
-		// Update device last seen in database
-		var telemetry pb.Telemetry
-		if err := proto.Unmarshal(msg.Value, &telemetry); err == nil {
-			if err := aggregator.db.UpdateDeviceLastSeen(telemetry.DeviceId); err != nil {
-				log.Printf("Failed to update device last seen: %v", err)
+		logger.Debug("Processed aggregation message",
+			slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+	}
+
+	// A goroutine per device keeps each device's messages in order without
+	// devices sharing a hashed worker
+	var pool messageDispatcher
+	if cfg.MaxDeviceChannels > 0 {
+		pool = NewDeviceRouter(cfg.MaxDeviceChannels, handle)
+	} else {
+		pool = newWorkerPool(workerCount, cfg.OrderedByDevice, handle)
+	}
+	defer pool.Close()
+
+	for {
+		msg, err := kafka.NextMessage(ctx, source)
+		if err != nil {
+			if isShutdown(ctx, err) {
+				logger.Info("Aggregation loop stopped")
+				return
 			}
+			logger.Error("Error reading message", slog.Any("error", err))
+			continue
+		}
+
+		// Sources other than Kafka have no topic or partition
+		if msg.Topic != "" {
+			metrics.PartitionMetrics.WithLabelValues(msg.Topic, strconv.Itoa(msg.Partition)).Inc()
 		}
 
-		log.Printf("Processed aggregation message from partition %d @ offset %d", msg.Partition, msg.Offset)
+		offsets.Track(msg)
+		pool.Submit(msg)
 	}
 }
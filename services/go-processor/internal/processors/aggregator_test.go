@@ -1,11 +1,23 @@
 package processors
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 	"testing"
 	"time"
 
+	"go-processor/internal/config"
+	"go-processor/internal/kafka"
+	"go-processor/internal/metrics"
 	pb "go-processor/internal/proto"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	kafkago "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/proto"
 )
@@ -14,9 +26,11 @@ func TestAggregator_ProcessTelemetry(t *testing.T) {
 	// Create a basic aggregator without external dependencies
 	// Since ProcessTelemetry only updates internal state, we don't need real producer/db
 	agg := &Aggregator{
-		data:        make(map[string]map[string]*AggregateData),
-		windowSize:  time.Minute,
-		stopChannel: make(chan bool),
+		AlignToClockBoundary: true,
+		logger:               slog.Default(),
+		data:                 make(map[string]map[string]*AggregateData),
+		windowSize:           time.Minute,
+		stopChannel:          make(chan bool),
 	}
 
 	deviceID := "test-device"
@@ -36,7 +50,7 @@ func TestAggregator_ProcessTelemetry(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Process first message
-	err = agg.ProcessTelemetry(data)
+	err = agg.ProcessTelemetry(context.Background(), data)
 	assert.NoError(t, err)
 
 	// Verify aggregation
@@ -64,7 +78,7 @@ func TestAggregator_ProcessTelemetry(t *testing.T) {
 	data2, err := proto.Marshal(telemetry2)
 	assert.NoError(t, err)
 
-	err = agg.ProcessTelemetry(data2)
+	err = agg.ProcessTelemetry(context.Background(), data2)
 	assert.NoError(t, err)
 
 	aggData = agg.data[deviceID][windowKey]
@@ -90,3 +104,609 @@ func TestGenerateWindowKey(t *testing.T) {
 
 	assert.Contains(t, key, "2023") // flexible check
 }
+
+func TestAggregator_WindowBoundaries(t *testing.T) {
+	// 2023-11-04T16:00:00Z plus 3m40s
+	ts := int64(1699113600000) + 220000
+
+	tests := []struct {
+		name       string
+		windowSize time.Duration
+		wantStart  int64
+		wantEnd    int64
+	}{
+		{"30 seconds", 30 * time.Second, 1699113600000 + 210000, 1699113600000 + 240000},
+		{"5 minutes", 5 * time.Minute, 1699113600000, 1699113600000 + 300000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := &Aggregator{
+				AlignToClockBoundary: true,
+				logger:               slog.Default(),
+				data:                 make(map[string]map[string]*AggregateData),
+				windowSize:           tt.windowSize,
+			}
+
+			data, err := proto.Marshal(&pb.Telemetry{
+				DeviceId: "test-device",
+				Ts:       ts,
+				Metrics:  map[string]float64{"temperature": 25.0},
+			})
+			assert.NoError(t, err)
+			assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+
+			window := agg.data["test-device"][generateWindowKey(tt.wantStart, tt.wantEnd)]
+			if assert.NotNil(t, window) {
+				assert.Equal(t, tt.wantStart, window.WindowStart)
+				assert.Equal(t, tt.wantEnd, window.WindowEnd)
+			}
+		})
+	}
+}
+
+// windowStarts processes a message of device at each of timestamps and
+// returns the start of the windows they landed in, in order.
+func windowStarts(t *testing.T, agg *Aggregator, device string, timestamps ...int64) []int64 {
+	t.Helper()
+	var starts []int64
+	for _, ts := range timestamps {
+		data, err := proto.Marshal(&pb.Telemetry{
+			DeviceId: device,
+			Ts:       ts,
+			Metrics:  map[string]float64{"temperature": 25.0},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+
+		found := false
+		for _, window := range agg.data[device] {
+			if ts >= window.WindowStart && ts < window.WindowEnd {
+				starts = append(starts, window.WindowStart)
+				found = true
+			}
+		}
+		assert.True(t, found, "no window holds %d", ts)
+	}
+	return starts
+}
+
+func TestAggregator_ClockAlignedWindows(t *testing.T) {
+	hour := int64(1699113600000) // 2023-11-04T16:00:00Z
+	agg := &Aggregator{
+		AlignToClockBoundary: true,
+		logger:               slog.Default(),
+		data:                 make(map[string]map[string]*AggregateData),
+		windowSize:           5 * time.Minute,
+	}
+
+	// 16:02:10, 16:04:59, 16:05:00, 16:07:30 and 16:13:20
+	starts := windowStarts(t, agg, "test-device",
+		hour+130000, hour+299999, hour+300000, hour+450000, hour+800000)
+
+	// Windows start at 16:00, 16:05 and 16:10
+	assert.Equal(t, []int64{hour, hour, hour + 300000, hour + 300000, hour + 600000}, starts)
+	assert.Len(t, agg.data["test-device"], 3)
+}
+
+func TestAggregator_SessionRelativeWindows(t *testing.T) {
+	hour := int64(1699113600000) // 2023-11-04T16:00:00Z
+	agg := &Aggregator{
+		logger:     slog.Default(),
+		data:       make(map[string]map[string]*AggregateData),
+		windowSize: 5 * time.Minute,
+	}
+
+	// The first message at 16:02:10 anchors device-a's windows
+	first := hour + 130000
+	starts := windowStarts(t, agg, "device-a", first, first+299999, first+300000, first-1000)
+	assert.Equal(t, []int64{first, first, first + 300000, first - 300000}, starts)
+
+	// device-b is anchored at its own first message
+	assert.Equal(t, []int64{hour + 10000}, windowStarts(t, agg, "device-b", hour+10000))
+}
+
+func TestAggregator_SessionAnchorDroppedOnFlush(t *testing.T) {
+	agg := &Aggregator{
+		logger:     slog.Default(),
+		data:       make(map[string]map[string]*AggregateData),
+		windowSize: time.Minute,
+	}
+
+	// Messages without metrics let the window flush without Kafka or a
+	// database
+	first := int64(1699113610000) // 2023-11-04T16:00:10Z
+	data, err := proto.Marshal(&pb.Telemetry{DeviceId: "device-a", Ts: first})
+	assert.NoError(t, err)
+	assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+	assert.Equal(t, map[string]int64{"device-a": first}, agg.anchors)
+
+	agg.Flush()
+	assert.Empty(t, agg.anchors)
+
+	// The device's next message starts a new session
+	next := first + 90000
+	assert.Equal(t, []int64{next}, windowStarts(t, agg, "device-a", next))
+}
+
+func TestAggregator_TimestampIsWindowCenter(t *testing.T) {
+	agg := &Aggregator{
+		AlignToClockBoundary: true,
+		logger:               slog.Default(),
+		data:                 make(map[string]map[string]*AggregateData),
+		windowSize:           time.Minute,
+	}
+
+	// A message from a window that started 30s ago, processed now
+	windowStart := (time.Now().Add(-30*time.Second).UnixMilli() / 60000) * 60000
+	data, err := proto.Marshal(&pb.Telemetry{
+		DeviceId: "late-device",
+		Ts:       windowStart + 1000,
+		Metrics:  map[string]float64{"temperature": 25.0},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+
+	window := agg.data["late-device"][generateWindowKey(windowStart, windowStart+60000)]
+	if assert.NotNil(t, window) {
+		assert.Equal(t, windowStart+30000, window.Timestamp)
+	}
+}
+
+type recordingObserver struct {
+	deviceIDs []string
+	metrics   []map[string]float64
+}
+
+func (o *recordingObserver) ObserveTelemetry(deviceID string, metrics map[string]float64) {
+	o.deviceIDs = append(o.deviceIDs, deviceID)
+	o.metrics = append(o.metrics, metrics)
+}
+
+func TestAggregator_NotifiesObservers(t *testing.T) {
+	observer := &recordingObserver{}
+	agg := &Aggregator{
+		logger:     slog.Default(),
+		data:       make(map[string]map[string]*AggregateData),
+		windowSize: time.Minute,
+		Observers:  []TelemetryObserver{observer},
+	}
+
+	data, err := proto.Marshal(&pb.Telemetry{
+		DeviceId: "device-1",
+		Ts:       time.Now().UnixMilli(),
+		Metrics:  map[string]float64{"temperature": 25.0},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+
+	assert.Equal(t, []string{"device-1"}, observer.deviceIDs)
+	assert.Equal(t, []map[string]float64{{"temperature": 25.0}}, observer.metrics)
+}
+
+func TestAggregator_LateMessageWithinGracePeriod(t *testing.T) {
+	windowStart := int64(1699113600000) // 2023-11-04T16:00:00Z
+	clock := time.UnixMilli(windowStart + 3*60000 + 1000)
+	agg := &Aggregator{
+		AlignToClockBoundary: true,
+		logger:               slog.Default(),
+		data:                 make(map[string]map[string]*AggregateData),
+		windowSize:           time.Minute,
+		GracePeriod:          time.Minute,
+		now:                  func() time.Time { return clock },
+	}
+
+	send := func(ts int64, value float64) {
+		data, err := proto.Marshal(&pb.Telemetry{
+			DeviceId: "late-device",
+			Ts:       ts,
+			Metrics:  map[string]float64{"temperature": value},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+	}
+
+	send(windowStart+10000, 20)
+
+	// The window is due but held for the grace period
+	agg.flushAggregates()
+	windowKey := generateWindowKey(windowStart, windowStart+60000)
+	assert.Empty(t, agg.data)
+	assert.NotNil(t, agg.pendingFlush["late-device"][windowKey])
+
+	// A message arriving 45 seconds later still lands in its window
+	clock = clock.Add(45 * time.Second)
+	send(windowStart+50000, 30)
+	agg.flushAggregates()
+
+	assert.Empty(t, agg.data)
+	window := agg.pendingFlush["late-device"][windowKey]
+	if assert.NotNil(t, window) {
+		assert.Equal(t, 2, window.Count)
+		assert.Equal(t, []float64{20, 30}, window.samples["temperature"])
+	}
+}
+
+func TestAggregator_WindowFillMetrics(t *testing.T) {
+	deviceID := "window-fill-device"
+	fill := metrics.WindowFillHistogram.WithLabelValues(metrics.DeviceBucket(deviceID))
+	sumBefore := histogramSum(t, fill)
+	openBefore := testutil.ToFloat64(metrics.WindowCount)
+
+	agg := &Aggregator{
+		AlignToClockBoundary: true,
+		logger:               slog.Default(),
+		data:                 make(map[string]map[string]*AggregateData),
+		windowSize:           time.Minute,
+	}
+
+	// Messages without metrics let the window flush without Kafka or a
+	// database
+	windowStart := int64(1699113600000) // 2023-11-04T16:00:00Z
+	for i := 0; i < 5; i++ {
+		data, err := proto.Marshal(&pb.Telemetry{DeviceId: deviceID, Ts: windowStart + int64(i)*1000})
+		assert.NoError(t, err)
+		assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+	}
+	assert.Equal(t, openBefore+1, testutil.ToFloat64(metrics.WindowCount))
+
+	agg.Flush()
+
+	assert.Equal(t, sumBefore+5, histogramSum(t, fill))
+	assert.Equal(t, openBefore, testutil.ToFloat64(metrics.WindowCount))
+}
+
+// histogramSum returns the sum of the observations of histogram.
+func histogramSum(t *testing.T, histogram prometheus.Observer) float64 {
+	t.Helper()
+	var m dto.Metric
+	assert.NoError(t, histogram.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleSum()
+}
+
+func TestGenerateWindowKey_IncludesDuration(t *testing.T) {
+	ts := int64(1699113600000)
+	assert.NotEqual(t, generateWindowKey(ts, ts+30000), generateWindowKey(ts, ts+300000))
+	assert.Contains(t, generateWindowKey(ts, ts+30000), "/30s")
+}
+
+func TestPercentile_KnownDataset(t *testing.T) {
+	// 1..100 sorted: nearest-rank p95 is the 95th value, p99 the 99th
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = float64(100 - i) // reversed to ensure sorting happens
+	}
+
+	assert.Equal(t, 95.0, percentile(values, 95))
+	assert.Equal(t, 99.0, percentile(values, 99))
+	assert.Equal(t, 1.0, percentile(values, 0))
+	assert.Equal(t, 100.0, percentile(values, 100))
+
+	// Input must not be reordered
+	assert.Equal(t, 100.0, values[0])
+
+	// Small dataset: ceil(0.95 * 10) = 10th value
+	small := []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	assert.Equal(t, 100.0, percentile(small, 95))
+	assert.Equal(t, 0.0, percentile(nil, 95))
+}
+
+func TestAggregator_ComputeAggregates(t *testing.T) {
+	agg := &Aggregator{
+		logger:               slog.Default(),
+		data:                 make(map[string]map[string]*AggregateData),
+		windowSize:           time.Minute,
+		stopChannel:          make(chan bool),
+		AggregationFunctions: []Function{FunctionMean, FunctionMin, FunctionMax, FunctionSum, FunctionP95, FunctionP99},
+	}
+
+	deviceID := "test-device"
+	base := (time.Now().UnixMilli() / 60000) * 60000
+
+	for i := 1; i <= 100; i++ {
+		telemetry := &pb.Telemetry{
+			DeviceId: deviceID,
+			Ts:       base + int64(i*100),
+			Metrics:  map[string]float64{"temperature": float64(i)},
+		}
+		data, err := proto.Marshal(telemetry)
+		assert.NoError(t, err)
+		assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+	}
+
+	window := agg.data[deviceID][generateWindowKey(base, base+60000)]
+	assert.NotNil(t, window)
+
+	results := agg.computeAggregates(window)
+	assert.Len(t, results, 6)
+
+	byFunction := make(map[Function]float64)
+	for _, result := range results {
+		assert.Equal(t, 100, result.Count)
+		byFunction[result.Function] = result.Metrics["temperature"]
+	}
+
+	assert.Equal(t, 50.5, byFunction[FunctionMean])
+	assert.Equal(t, 1.0, byFunction[FunctionMin])
+	assert.Equal(t, 100.0, byFunction[FunctionMax])
+	assert.Equal(t, 5050.0, byFunction[FunctionSum])
+	assert.Equal(t, 95.0, byFunction[FunctionP95])
+	assert.Equal(t, 99.0, byFunction[FunctionP99])
+}
+
+func TestParseFunction(t *testing.T) {
+	fn, err := ParseFunction(" P95 ")
+	assert.NoError(t, err)
+	assert.Equal(t, FunctionP95, fn)
+
+	_, err = ParseFunction("median")
+	assert.Error(t, err)
+}
+
+func TestIsShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.False(t, isShutdown(ctx, errors.New("broker unavailable")))
+	assert.True(t, isShutdown(ctx, context.DeadlineExceeded))
+
+	cancel()
+	assert.True(t, isShutdown(ctx, errors.New("read interrupted")))
+}
+
+// memorySource is a single-partition MessageSource with manual commits. A
+// new memorySource starting at the committed offset simulates a restart.
+type memorySource struct {
+	mu        sync.Mutex
+	messages  []kafkago.Message
+	next      int64
+	committed int64
+	closed    bool
+}
+
+func (s *memorySource) ReadKafkaMessage(ctx context.Context) (kafkago.Message, error) {
+	s.mu.Lock()
+	if s.next < int64(len(s.messages)) {
+		msg := s.messages[s.next]
+		s.next++
+		s.mu.Unlock()
+		return msg, nil
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	return kafkago.Message{}, ctx.Err()
+}
+
+func (s *memorySource) ReadMessage(ctx context.Context) ([]byte, error) {
+	msg, err := s.ReadKafkaMessage(ctx)
+	return msg.Value, err
+}
+
+func (s *memorySource) CommitMessage(ctx context.Context, msg kafkago.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Like kafka-go, a commit sets the offset even if it moves backwards
+	s.committed = msg.Offset + 1
+	return nil
+}
+
+func (s *memorySource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestCommitMessage(t *testing.T) {
+	source := &memorySource{}
+
+	commitMessage(context.Background(), slog.Default(), source, kafkago.Message{Offset: 4})
+	assert.Equal(t, int64(5), source.committed)
+
+	// Commits still go through once shutdown has begun
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	commitMessage(ctx, slog.Default(), source, kafkago.Message{Offset: 5})
+	assert.Equal(t, int64(6), source.committed)
+}
+
+func TestStartAggregationLoop_FailedMessagesAreRedelivered(t *testing.T) {
+	messages := []kafkago.Message{{Offset: 0, Key: []byte("device-1"), Value: []byte("not protobuf")}}
+	source := &memorySource{messages: messages}
+	agg := &Aggregator{
+		logger: slog.Default(),
+		data:   make(map[string]map[string]*AggregateData),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StartAggregationLoop(ctx, source, &config.Config{}, agg, nil, 1)
+	}()
+
+	assert.Eventually(t, func() bool {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		return source.next == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	// The crash loses the failed message's progress: a restarted consumer
+	// resumes from the committed offset and sees it again
+	assert.Equal(t, int64(0), source.committed)
+	restarted := &memorySource{messages: messages, next: source.committed}
+	msg, err := restarted.ReadKafkaMessage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), msg.Offset)
+}
+
+func TestStartAggregationLoop_SkipsDuplicates(t *testing.T) {
+	// A rebalance redelivers offset 0, which failed the first time round
+	msg := kafkago.Message{Offset: 0, Key: []byte("device-1"), Value: []byte("not protobuf")}
+	source := &memorySource{messages: []kafkago.Message{msg, msg}}
+	agg := &Aggregator{
+		logger:       slog.Default(),
+		data:         make(map[string]map[string]*AggregateData),
+		Deduplicator: kafka.NewDeduplicator(time.Minute),
+	}
+
+	skippedBefore := testutil.ToFloat64(metrics.DuplicatesSkipped)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StartAggregationLoop(ctx, source, &config.Config{}, agg, nil, 1)
+	}()
+
+	// The redelivery is skipped, but the failed offset stays uncommitted
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.DuplicatesSkipped) == skippedBefore+1
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int64(0), source.committed)
+}
+
+func TestStartAggregationLoop_DeviceRouter(t *testing.T) {
+	msg := kafkago.Message{Offset: 0, Key: []byte("device-1"), Value: []byte("not protobuf")}
+	source := &memorySource{messages: []kafkago.Message{msg, msg}}
+	agg := &Aggregator{
+		logger:       slog.Default(),
+		data:         make(map[string]map[string]*AggregateData),
+		Deduplicator: kafka.NewDeduplicator(time.Minute),
+	}
+
+	skippedBefore := testutil.ToFloat64(metrics.DuplicatesSkipped)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StartAggregationLoop(ctx, source, &config.Config{MaxDeviceChannels: 1}, agg, nil, 1)
+	}()
+
+	// The device's goroutine handles both messages, skipping the duplicate
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.DuplicatesSkipped) == skippedBefore+1
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int64(0), source.committed)
+}
+
+func TestStartAggregationLoop_CountsMessagesPerPartition(t *testing.T) {
+	topic := "partition-metrics-test"
+	source := &memorySource{messages: []kafkago.Message{
+		{Topic: topic, Partition: 0, Offset: 0, Value: []byte("not protobuf")},
+		{Topic: topic, Partition: 1, Offset: 0, Value: []byte("not protobuf")},
+		{Topic: topic, Partition: 1, Offset: 1, Value: []byte("not protobuf")},
+	}}
+	agg := &Aggregator{
+		logger: slog.Default(),
+		data:   make(map[string]map[string]*AggregateData),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		StartAggregationLoop(ctx, source, &config.Config{}, agg, nil, 1)
+	}()
+
+	assert.Eventually(t, func() bool {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		return source.next == 3
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.PartitionMetrics.WithLabelValues(topic, "0")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.PartitionMetrics.WithLabelValues(topic, "1")))
+}
+
+type recordingPublisher struct {
+	keys    []string
+	values  [][]byte
+	headers [][]kafkago.Header
+}
+
+func (p *recordingPublisher) SendMessageWithRetry(ctx context.Context, key, value []byte, maxRetries int, baseDelay time.Duration, headers ...kafkago.Header) error {
+	p.keys = append(p.keys, string(key))
+	p.values = append(p.values, value)
+	p.headers = append(p.headers, headers)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+func TestAggregator_SendAggregateHeaders(t *testing.T) {
+	publisher := &recordingPublisher{}
+	agg := &Aggregator{logger: slog.Default(), producer: publisher}
+
+	// 2023-11-04T16:00:00Z
+	windowStart := int64(1699113600000)
+	err := agg.sendAggregate(context.Background(), &AggregateData{
+		DeviceID:    "device-1",
+		WindowStart: windowStart,
+		WindowEnd:   windowStart + 60000,
+		Function:    FunctionMean,
+		Metrics:     map[string]float64{"temperature": 21.5},
+		Count:       3,
+	})
+	assert.NoError(t, err)
+
+	assert.Len(t, publisher.headers, 1)
+	headers := make(map[string]string)
+	for _, header := range publisher.headers[0] {
+		headers[header.Key] = string(header.Value)
+	}
+	assert.Equal(t, map[string]string{
+		"window-start": "2023-11-04T16:00:00Z",
+		"window-end":   "2023-11-04T16:01:00Z",
+		"device-id":    "device-1",
+		"metric-count": "1",
+	}, headers)
+}
+
+func TestAggregator_CarriesTraceIDs(t *testing.T) {
+	agg := &Aggregator{logger: slog.Default(), data: make(map[string]map[string]*AggregateData)}
+	windowStart := (time.Now().UnixMilli() / 60000) * 60000
+
+	for i, traceID := range []string{"trace-1", "", "trace-2"} {
+		data, err := proto.Marshal(&pb.Telemetry{
+			DeviceId: "device-1",
+			Ts:       windowStart + int64(i)*1000,
+			Metrics:  map[string]float64{"temperature": 20},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, agg.ProcessTelemetry(withTraceID(context.Background(), traceID), data))
+	}
+
+	aggregate := agg.data["device-1"][generateWindowKey(windowStart, windowStart+60000)]
+	assert.Equal(t, []string{"trace-1", "trace-2"}, aggregate.TraceIDs)
+
+	results := agg.computeAggregates(aggregate)
+	assert.Len(t, results, 1)
+	assert.Equal(t, []string{"trace-1", "trace-2"}, results[0].TraceIDs)
+}
+
+func TestAggregator_TraceIDsAreCapped(t *testing.T) {
+	agg := &Aggregator{logger: slog.Default(), data: make(map[string]map[string]*AggregateData)}
+	windowStart := (time.Now().UnixMilli() / 60000) * 60000
+
+	for i := 0; i < maxTraceIDsPerWindow+10; i++ {
+		data, err := proto.Marshal(&pb.Telemetry{
+			DeviceId: "device-1",
+			Ts:       windowStart,
+			Metrics:  map[string]float64{"temperature": 20},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, agg.ProcessTelemetry(withTraceID(context.Background(), fmt.Sprintf("trace-%d", i)), data))
+	}
+
+	aggregate := agg.data["device-1"][generateWindowKey(windowStart, windowStart+60000)]
+	assert.Equal(t, maxTraceIDsPerWindow+10, aggregate.Count)
+	assert.Len(t, aggregate.TraceIDs, maxTraceIDsPerWindow)
+}
@@ -4,8 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
+	"os"
 	"sync"
 	"time"
 
@@ -16,8 +17,7 @@ import (
 	pb "go-processor/internal/proto"
 	"go-processor/internal/websocket"
 
-	kafkago "github.com/segmentio/kafka-go"
-	"google.golang.org/protobuf/proto"
+	"go.opentelemetry.io/otel"
 )
 
 type DeviceStats struct {
@@ -46,28 +46,211 @@ type Anomaly struct {
 	ExpectedRange [2]float64 `json:"expected_range"` // [min, max]
 	Severity      string     `json:"severity"`       // "low", "medium", "high"
 	ZScore        float64    `json:"z_score"`
+	DetectorType  string     `json:"detector_type"` // "zscore", "ewma", "iqr", ...
+	Threshold     float64    `json:"threshold"`
+	AlertType     string     `json:"alert_type"` // "anomaly" when empty
+}
+
+const (
+	DetectorTypeZScore = "zscore"
+	DetectorTypeEWMA   = "ewma"
+	DetectorTypeIQR    = "iqr"
+)
+
+// Alert types recorded with anomalies.
+const (
+	AlertTypeAnomaly   = "anomaly"
+	AlertTypeThreshold = "threshold"
+)
+
+// Detector is implemented by every anomaly detection algorithm so the
+// detection loop can run whichever one is configured.
+type Detector interface {
+	Processor
+	MessageDecoder() kafka.MessageDecoder
+	DeadLetterQueue() *kafka.Producer
+	Logger() *slog.Logger
+	UpdateConfig(cfg config.Config)
+}
+
+// NewDetector creates the anomaly detector selected by cfg.DetectorType.
+func NewDetector(cfg *config.Config, db *database.TimescaleDB, logger *slog.Logger) (Detector, error) {
+	switch cfg.DetectorType {
+	case DetectorTypeZScore, "":
+		return NewAnomalyDetector(cfg, db, logger)
+	case DetectorTypeEWMA:
+		return NewEWMADetector(cfg, db, logger)
+	case DetectorTypeIQR:
+		return NewIQRDetector(cfg, db, logger)
+	default:
+		return nil, fmt.Errorf("unknown detector type %q", cfg.DetectorType)
+	}
+}
+
+// anomalyStore is the subset of TimescaleDB used to persist alerts.
+type anomalyStore interface {
+	InsertAlert(alert database.AlertRecord) error
 }
 
 type AnomalyDetector struct {
-	producer       *kafka.Producer
-	db             *database.TimescaleDB
+	producer       messagePublisher
+	db             anomalyStore
+	logger         *slog.Logger
 	deviceStats    map[string]*DeviceStats
 	mutex          sync.RWMutex
 	alertThreshold float64 // Z-score threshold for anomalies
-	cleanupTicker  *time.Ticker
-	stopChannel    chan bool
+	thresholds     ThresholdConfig
+	thresholdMutex sync.RWMutex
+
+	// CooldownDuration suppresses repeat alerts for the same device metric
+	// until it has elapsed since the last one. Zero disables deduplication.
+	CooldownDuration time.Duration
+	lastAlertTime    map[string]map[string]time.Time // guarded by mutex
+
+	cleanupTicker *time.Ticker
+	stopChannel   chan bool
+
+	// staleForgetters keep per-device state outside deviceStats, and forget
+	// stale devices along with it. Guarded by mutex.
+	staleForgetters []staleForgetter
+
+	// DLQProducer receives messages that fail to process. Nil disables the DLQ.
+	DLQProducer *kafka.Producer
+
+	// Decoder converts raw payloads to telemetry. Nil decodes protobuf.
+	Decoder kafka.MessageDecoder
+
+	// statsSnapshotPath is where device stats are periodically persisted so
+	// they survive restarts. Empty disables snapshots.
+	statsSnapshotPath string
+	snapshotTicker    *time.Ticker
+
+	// Rules holds fixed threshold rules evaluated alongside the statistical
+	// detection. Nil disables rule evaluation.
+	Rules *RuleEngine
+
+	// RateOfChange flags metrics that change too quickly. Nil disables the
+	// check.
+	RateOfChange *RateOfChangeDetector
+
+	// Flatline flags sensors stuck at one value. Nil disables the check.
+	Flatline *FlatlineDetector
+
+	// Multivariate flags unlikely combinations of metrics. Nil disables the
+	// check.
+	Multivariate *MahalanobisDetector
+
+	// ChangePoint flags sustained shifts from the Z-score baseline. Nil
+	// disables the check.
+	ChangePoint *ChangePointDetector
+
+	// Escalation re-emits anomalies that keep recurring with a higher
+	// severity. Nil disables escalation.
+	Escalation *EscalationPolicy
+
+	// onAnomaly, when set, is invoked for every reported anomaly.
+	onAnomaly func(*Anomaly)
 }
 
-func NewAnomalyDetector(cfg *config.Config, db *database.TimescaleDB) (*AnomalyDetector, error) {
-	producer := kafka.NewProducer([]string{cfg.KafkaBrokers}, cfg.AlertsTopic)
+func NewAnomalyDetector(cfg *config.Config, db *database.TimescaleDB, logger *slog.Logger) (*AnomalyDetector, error) {
+	decoder, err := kafka.NewMessageDecoder(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	producerOpts, err := kafka.ProducerOptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	producer := newTopicPublisher(cfg.Brokers, cfg.AlertsTopic, cfg.AdditionalAlertTopics, producerOpts)
 
 	detector := &AnomalyDetector{
 		producer:       producer,
-		db:             db,
+		logger:         loggerOrDefault(logger),
 		deviceStats:    make(map[string]*DeviceStats),
-		alertThreshold: 3.0, // 3 standard deviations
+		alertThreshold: cfg.AlertThreshold,
 		cleanupTicker:  time.NewTicker(10 * time.Minute),
 		stopChannel:    make(chan bool),
+
+		statsSnapshotPath: cfg.StatsSnapshotPath,
+
+		CooldownDuration: cfg.AnomalyCooldown,
+		lastAlertTime:    make(map[string]map[string]time.Time),
+
+		Decoder: decoder,
+	}
+	// Leave db a nil interface when there is no database so reportAnomaly
+	// skips persisting alerts.
+	if db != nil {
+		detector.db = db
+	}
+
+	if cfg.DLQTopic != "" {
+		detector.DLQProducer = kafka.NewProducer(cfg.Brokers, cfg.DLQTopic, producerOpts)
+	}
+
+	if cfg.ThresholdConfigPath != "" {
+		thresholds, defaultThreshold, err := LoadThresholdConfig(cfg.ThresholdConfigPath)
+		if err != nil {
+			producer.Close()
+			if detector.DLQProducer != nil {
+				detector.DLQProducer.Close()
+			}
+			return nil, err
+		}
+		detector.thresholds = thresholds
+		if defaultThreshold > 0 {
+			detector.alertThreshold = defaultThreshold
+		}
+	}
+
+	if cfg.RulesConfigPath != "" {
+		rules, err := LoadRules(cfg.RulesConfigPath)
+		if err != nil {
+			producer.Close()
+			if detector.DLQProducer != nil {
+				detector.DLQProducer.Close()
+			}
+			return nil, err
+		}
+		detector.Rules = rules
+	}
+
+	if len(cfg.MaxRateOfChange) > 0 {
+		detector.RateOfChange = NewRateOfChangeDetector(cfg.MaxRateOfChange)
+	}
+
+	if cfg.FlatlineWindowSize > 0 {
+		detector.Flatline = NewFlatlineDetector(cfg.FlatlineWindowSize, cfg.FlatlineTolerance)
+	}
+
+	if cfg.CUSUMThreshold > 0 {
+		detector.ChangePoint = NewChangePointDetector(cfg.CUSUMAllowance, cfg.CUSUMThreshold)
+	}
+
+	if cfg.EscalationThreshold > 0 {
+		detector.Escalation = NewEscalationPolicy(cfg.EscalationWindow, cfg.EscalationThreshold, "high")
+	}
+
+	if len(cfg.MultivariateMetrics) >= 2 {
+		detector.Multivariate = NewMahalanobisDetector(cfg.MultivariateMetrics, cfg.MultivariateWindowSize, cfg.MultivariateSignificance)
+	}
+
+	if detector.statsSnapshotPath != "" {
+		if _, err := os.Stat(detector.statsSnapshotPath); err == nil {
+			if err := detector.LoadStats(detector.statsSnapshotPath); err != nil {
+				detector.logger.Warn("Failed to load stats snapshot",
+					slog.String("path", detector.statsSnapshotPath), slog.Any("error", err))
+			}
+		}
+		detector.snapshotTicker = time.NewTicker(5 * time.Minute)
+	}
+
+	if cfg.WarmupLookbackHours > 0 {
+		if err := detector.WarmupFromDatabase(db, cfg.WarmupLookbackHours); err != nil {
+			detector.logger.Warn("Failed to warm up anomaly detector", slog.Any("error", err))
+		}
 	}
 
 	// Start cleanup routine for stale device stats
@@ -77,38 +260,81 @@ func NewAnomalyDetector(cfg *config.Config, db *database.TimescaleDB) (*AnomalyD
 }
 
 func (ad *AnomalyDetector) cleanupLoop() {
+	var snapshotC <-chan time.Time
+	if ad.snapshotTicker != nil {
+		snapshotC = ad.snapshotTicker.C
+	}
+
 	for {
 		select {
 		case <-ad.cleanupTicker.C:
 			ad.cleanupStaleStats()
+		case <-snapshotC:
+			if err := ad.SaveStats(ad.statsSnapshotPath); err != nil {
+				ad.logger.Error("Failed to save stats snapshot",
+					slog.String("path", ad.statsSnapshotPath), slog.Any("error", err))
+			}
 		case <-ad.stopChannel:
 			return
 		}
 	}
 }
 
+// staleForgetter is implemented by detectors wrapping an AnomalyDetector
+// with per-device state of their own.
+type staleForgetter interface {
+	// forgetStale drops the state of devices without telemetry since cutoff,
+	// in Unix milliseconds.
+	forgetStale(cutoff int64)
+}
+
 func (ad *AnomalyDetector) cleanupStaleStats() {
+	cutoffTime := time.Now().UnixMilli() - (24 * 60 * 60 * 1000) // 24 hours ago
+
+	// The wrapping detectors report anomalies holding their own locks, so
+	// they forget outside ad.mutex
+	for _, forgetter := range ad.removeStaleStats(cutoffTime) {
+		forgetter.forgetStale(cutoffTime)
+	}
+}
+
+// removeStaleStats drops the stats of devices without telemetry since
+// cutoffTime and returns the detectors that must forget them too.
+func (ad *AnomalyDetector) removeStaleStats(cutoffTime int64) []staleForgetter {
 	ad.mutex.Lock()
 	defer ad.mutex.Unlock()
 
-	cutoffTime := time.Now().UnixMilli() - (24 * 60 * 60 * 1000) // 24 hours ago
-
 	for deviceID, stats := range ad.deviceStats {
 		if stats.LastUpdated < cutoffTime {
-			log.Printf("Cleaning up stale stats for device %s", deviceID)
+			ad.logger.Info("Cleaning up stale stats", slog.String("device_id", deviceID))
 			delete(ad.deviceStats, deviceID)
+			delete(ad.lastAlertTime, deviceID)
+			if ad.RateOfChange != nil {
+				ad.RateOfChange.Forget(deviceID)
+			}
+			if ad.Flatline != nil {
+				ad.Flatline.Forget(deviceID)
+			}
+			if ad.Multivariate != nil {
+				ad.Multivariate.Forget(deviceID)
+			}
+			if ad.ChangePoint != nil {
+				ad.ChangePoint.Forget(deviceID)
+			}
 		}
 	}
+	return ad.staleForgetters
 }
 
-func (ad *AnomalyDetector) ProcessTelemetry(data []byte) error {
-	var telemetry pb.Telemetry
-	if err := proto.Unmarshal(data, &telemetry); err != nil {
-		log.Printf("Failed to unmarshal telemetry: %v", err)
+func (ad *AnomalyDetector) ProcessTelemetry(ctx context.Context, data []byte) error {
+	telemetry, err := decodeTelemetry(ad.Decoder, data)
+	if err != nil {
+		ad.logger.Error("Failed to decode telemetry", slog.Any("error", err))
 		return err
 	}
 
 	metrics.MessagesProcessed.Inc()
+	ad.runFixedChecks(telemetry)
 
 	deviceID := telemetry.DeviceId
 	timestamp := telemetry.Ts
@@ -145,30 +371,31 @@ func (ad *AnomalyDetector) ProcessTelemetry(data []byte) error {
 		} else {
 			// Check for anomaly before updating stats
 			if stats.Count >= 10 { // Need at least 10 samples for reliable detection
+				threshold := ad.GetThreshold(deviceID, metricName)
 				zScore := ad.calculateZScore(value, stats)
-				if math.Abs(zScore) > ad.alertThreshold {
+				metrics.ZScoreDistribution.WithLabelValues(metricName).Observe(math.Abs(zScore))
+				if math.Abs(zScore) > threshold {
 					anomaly := &Anomaly{
 						DeviceID:   deviceID,
 						Timestamp:  timestamp,
 						MetricName: metricName,
 						Value:      value,
 						ExpectedRange: [2]float64{
-							stats.Mean - ad.alertThreshold*stats.StdDev,
-							stats.Mean + ad.alertThreshold*stats.StdDev,
+							stats.Mean - threshold*stats.StdDev,
+							stats.Mean + threshold*stats.StdDev,
 						},
-						Severity: ad.calculateSeverity(math.Abs(zScore)),
-						ZScore:   zScore,
+						Severity:     ad.calculateSeverity(math.Abs(zScore)),
+						ZScore:       zScore,
+						DetectorType: DetectorTypeZScore,
+						Threshold:    threshold,
 					}
 
-					if err := ad.sendAnomaly(anomaly); err != nil {
-						log.Printf("Failed to send anomaly alert: %v", err)
-					}
+					ad.reportAnomaly(anomaly)
+				}
 
-					if err := ad.saveAnomalyToDatabase(anomaly); err != nil {
-						log.Printf("Failed to save anomaly to database: %v", err)
-					} else {
-						log.Printf("ANOMALY DETECTED: Device %s, Metric %s, Value %.2f, Z-Score %.2f",
-							deviceID, metricName, value, zScore)
+				if ad.ChangePoint != nil {
+					if anomaly := ad.ChangePoint.Check(deviceID, metricName, value, timestamp, *stats); anomaly != nil {
+						ad.reportAnomaly(anomaly)
 					}
 				}
 			}
@@ -184,6 +411,55 @@ func (ad *AnomalyDetector) ProcessTelemetry(data []byte) error {
 	return nil
 }
 
+// runFixedChecks runs the checks that apply whichever statistical detector
+// is configured: threshold rules, rate of change, flat-line and multivariate
+// detection.
+func (ad *AnomalyDetector) runFixedChecks(telemetry *pb.Telemetry) {
+	ad.evaluateRules(telemetry)
+
+	if ad.Multivariate != nil {
+		if anomaly := ad.Multivariate.Check(telemetry.DeviceId, telemetry.Metrics, telemetry.Ts); anomaly != nil {
+			ad.reportAnomaly(anomaly)
+		}
+	}
+
+	for metricName, value := range telemetry.Metrics {
+		if ad.RateOfChange != nil {
+			if anomaly := ad.RateOfChange.Check(telemetry.DeviceId, metricName, value, telemetry.Ts); anomaly != nil {
+				ad.reportAnomaly(anomaly)
+			}
+		}
+		if ad.Flatline != nil {
+			if anomaly := ad.Flatline.Check(telemetry.DeviceId, metricName, value, telemetry.Ts); anomaly != nil {
+				ad.reportAnomaly(anomaly)
+			}
+		}
+	}
+}
+
+// evaluateRules reports a threshold alert for every rule matched by the
+// telemetry's metrics.
+func (ad *AnomalyDetector) evaluateRules(telemetry *pb.Telemetry) {
+	if ad.Rules == nil {
+		return
+	}
+
+	for metricName, value := range telemetry.Metrics {
+		for _, rule := range ad.Rules.Evaluate(telemetry.DeviceId, metricName, value) {
+			ad.reportAnomaly(&Anomaly{
+				DeviceID:     telemetry.DeviceId,
+				Timestamp:    telemetry.Ts,
+				MetricName:   metricName,
+				Value:        value,
+				Severity:     rule.Severity,
+				DetectorType: AlertTypeThreshold,
+				Threshold:    rule.Threshold,
+				AlertType:    AlertTypeThreshold,
+			})
+		}
+	}
+}
+
 func (ad *AnomalyDetector) calculateZScore(value float64, stats *Stats) float64 {
 	if stats.StdDev == 0 {
 		return 0
@@ -229,63 +505,237 @@ func (ad *AnomalyDetector) updateStats(stats *Stats, newValue float64) {
 	}
 }
 
+// inCooldown reports whether an alert for the device metric was emitted
+// within the cooldown window, and records the current time otherwise.
+func (ad *AnomalyDetector) inCooldown(deviceID, metricName string) bool {
+	ad.mutex.Lock()
+	defer ad.mutex.Unlock()
+
+	if ad.CooldownDuration <= 0 {
+		return false
+	}
+
+	if ad.lastAlertTime == nil {
+		ad.lastAlertTime = make(map[string]map[string]time.Time)
+	}
+	if ad.lastAlertTime[deviceID] == nil {
+		ad.lastAlertTime[deviceID] = make(map[string]time.Time)
+	}
+
+	if last, ok := ad.lastAlertTime[deviceID][metricName]; ok && time.Since(last) < ad.CooldownDuration {
+		return true
+	}
+
+	ad.lastAlertTime[deviceID][metricName] = time.Now()
+	return false
+}
+
+// reportAnomaly publishes an anomaly unless its device metric is in
+// cooldown. Every anomaly counts towards escalation, and an escalated alert
+// is published regardless of cooldown.
+func (ad *AnomalyDetector) reportAnomaly(anomaly *Anomaly) {
+	var escalated *Anomaly
+	if ad.Escalation != nil {
+		escalated = ad.Escalation.Record(anomaly)
+	}
+
+	if !ad.inCooldown(anomaly.DeviceID, anomaly.MetricName) {
+		ad.publishAnomaly(anomaly)
+	}
+	if escalated != nil {
+		ad.publishAnomaly(escalated)
+	}
+}
+
+// publishAnomaly publishes an anomaly to Kafka and persists it as an alert.
+// Outputs that are not configured are skipped.
+func (ad *AnomalyDetector) publishAnomaly(anomaly *Anomaly) {
+	if ad.onAnomaly != nil {
+		ad.onAnomaly(anomaly)
+	}
+
+	if ad.producer != nil {
+		if err := ad.sendAnomaly(anomaly); err != nil {
+			ad.logger.Error("Failed to send anomaly alert",
+				slog.String("device_id", anomaly.DeviceID), slog.Any("error", err))
+		} else {
+			metrics.AnomaliesDetected.WithLabelValues(anomaly.Severity, anomaly.DetectorType).Inc()
+		}
+	}
+
+	if ad.db != nil {
+		if err := ad.saveAnomalyToDatabase(anomaly); err != nil {
+			ad.logger.Error("Failed to save anomaly to database",
+				slog.String("device_id", anomaly.DeviceID), slog.Any("error", err))
+			return
+		}
+		metrics.AnomaliesSaved.WithLabelValues(anomaly.Severity, anomaly.DetectorType).Inc()
+	}
+
+	ad.logger.Warn("Anomaly detected",
+		slog.String("detector", anomaly.DetectorType),
+		slog.String("device_id", anomaly.DeviceID),
+		slog.String("metric", anomaly.MetricName),
+		slog.Float64("value", anomaly.Value),
+		slog.Float64("score", anomaly.ZScore),
+		slog.String("severity", anomaly.Severity))
+}
+
 func (ad *AnomalyDetector) sendAnomaly(anomaly *Anomaly) error {
 	jsonData, err := json.Marshal(anomaly)
 	if err != nil {
 		return err
 	}
 
-	return ad.producer.SendMessage([]byte(anomaly.DeviceID), jsonData)
+	return ad.producer.SendMessageWithRetry(context.Background(), []byte(anomaly.DeviceID), jsonData, producerMaxRetries, producerRetryBaseDelay)
 }
 
 func (ad *AnomalyDetector) saveAnomalyToDatabase(anomaly *Anomaly) error {
+	alertType := anomaly.AlertType
+	if alertType == "" {
+		alertType = AlertTypeAnomaly
+	}
+
+	var message string
+	switch alertType {
+	case AlertTypeThreshold:
+		message = fmt.Sprintf("Threshold rule matched for %s: %.2f (threshold: %.2f)", anomaly.MetricName, anomaly.Value, anomaly.Threshold)
+	case AlertTypeRateOfChange:
+		message = fmt.Sprintf("%s changed too quickly: %.2f (expected %.2f to %.2f, max %.2f/s)",
+			anomaly.MetricName, anomaly.Value, anomaly.ExpectedRange[0], anomaly.ExpectedRange[1], anomaly.Threshold)
+	case AlertTypeFlatline:
+		message = fmt.Sprintf("%s appears stuck at %.2f", anomaly.MetricName, anomaly.Value)
+	case AlertTypeChangePoint:
+		message = fmt.Sprintf("Sustained shift in %s detected at %.2f (expected %.2f to %.2f)",
+			anomaly.MetricName, anomaly.Value, anomaly.ExpectedRange[0], anomaly.ExpectedRange[1])
+	case AlertTypeEscalated:
+		message = fmt.Sprintf("%s anomaly repeated %.0f times within the escalation window: %.2f",
+			anomaly.MetricName, anomaly.Threshold, anomaly.Value)
+	case AlertTypeMultivariate:
+		message = fmt.Sprintf("Unusual combination of %s: Mahalanobis distance %.2f (threshold: %.2f)",
+			anomaly.MetricName, anomaly.Value, anomaly.Threshold)
+	default:
+		message = fmt.Sprintf("Anomalous %s value detected: %.2f (Z-score: %.2f)", anomaly.MetricName, anomaly.Value, anomaly.ZScore)
+	}
+
 	dbAlert := database.AlertRecord{
 		DeviceID:    anomaly.DeviceID,
 		Timestamp:   time.UnixMilli(anomaly.Timestamp),
 		MetricName:  anomaly.MetricName,
 		MetricValue: anomaly.Value,
-		AlertType:   "anomaly",
+		AlertType:   alertType,
 		Severity:    anomaly.Severity,
 		ZScore:      anomaly.ZScore,
-		Threshold:   ad.alertThreshold,
+		Threshold:   anomaly.Threshold,
 		Status:      "open",
-		Message:     fmt.Sprintf("Anomalous %s value detected: %.2f (Z-score: %.2f)", anomaly.MetricName, anomaly.Value, anomaly.ZScore),
+		Message:     message,
 	}
 
 	return ad.db.InsertAlert(dbAlert)
 }
 
+// Name returns the detector's processor name.
+func (ad *AnomalyDetector) Name() string {
+	return metrics.ProcessorAnomalyDetector
+}
+
+// UpdateConfig applies the reloadable settings of cfg. The alert threshold
+// replaces the default threshold, including one from the threshold config
+// file; per-device and per-metric thresholds are kept.
+func (ad *AnomalyDetector) UpdateConfig(cfg config.Config) {
+	ad.thresholdMutex.Lock()
+	ad.alertThreshold = cfg.AlertThreshold
+	ad.thresholdMutex.Unlock()
+
+	ad.mutex.Lock()
+	ad.CooldownDuration = cfg.AnomalyCooldown
+	ad.mutex.Unlock()
+
+	ad.logger.Info("Anomaly detector config updated",
+		slog.Float64("alert_threshold", cfg.AlertThreshold),
+		slog.Duration("cooldown", cfg.AnomalyCooldown))
+}
+
+// MessageDecoder returns the decoder for raw telemetry payloads.
+func (ad *AnomalyDetector) MessageDecoder() kafka.MessageDecoder {
+	return ad.Decoder
+}
+
+// DeadLetterQueue returns the producer used for unprocessable messages.
+func (ad *AnomalyDetector) DeadLetterQueue() *kafka.Producer {
+	return ad.DLQProducer
+}
+
+// Logger returns the logger the detector writes to.
+func (ad *AnomalyDetector) Logger() *slog.Logger {
+	return ad.logger
+}
+
 func (ad *AnomalyDetector) Stop() {
 	ad.stopChannel <- true
 	ad.cleanupTicker.Stop()
+	if ad.snapshotTicker != nil {
+		ad.snapshotTicker.Stop()
+		if err := ad.SaveStats(ad.statsSnapshotPath); err != nil {
+			ad.logger.Error("Failed to save stats snapshot",
+				slog.String("path", ad.statsSnapshotPath), slog.Any("error", err))
+		}
+	}
 	ad.producer.Close()
+	if ad.DLQProducer != nil {
+		ad.DLQProducer.Close()
+	}
 }
 
-func StartAnomalyDetectionLoop(reader *kafkago.Reader, cfg *config.Config, detector *AnomalyDetector, wsServer *websocket.Server) {
-	log.Println("Starting anomaly detection loop...")
+func StartAnomalyDetectionLoop(ctx context.Context, source kafka.MessageSource, cfg *config.Config, detector Detector, db *database.TimescaleDB, wsServer *websocket.Server) {
+	logger := detector.Logger()
+	logger.Info("Starting anomaly detection loop")
+
+	propagator := otel.GetTextMapPropagator()
+	offsets := newOffsetTracker(source, logger)
 
 	for {
-		msg, err := reader.ReadMessage(context.Background())
+		msg, err := kafka.NextMessage(ctx, source)
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			if isShutdown(ctx, err) {
+				logger.Info("Anomaly detection loop stopped")
+				return
+			}
+			logger.Error("Error reading message", slog.Any("error", err))
 			continue
 		}
+		offsets.Track(msg)
+
+		// Continue the producer's trace, if the message carries one
+		msgCtx := propagator.Extract(ctx, kafka.NewHeaderCarrier(&msg.Headers))
 
-		if err := detector.ProcessTelemetry(msg.Value); err != nil {
-			log.Printf("Error processing telemetry for anomaly detection: %v", err)
+		start := time.Now()
+		err = detector.ProcessTelemetry(msgCtx, msg.Value)
+		metrics.ObserveProcessing(metrics.ProcessorAnomalyDetector, start, err)
+		if err != nil {
+			logger.Error("Error processing telemetry for anomaly detection",
+				slog.Int("partition", msg.Partition),
+				slog.Int64("offset", msg.Offset),
+				slog.Any("error", err))
+			sendToDLQ(logger, detector.DeadLetterQueue(), msg, err)
+			offsets.Fail(msg)
+		} else {
+			// The detector reads in its own consumer group, so this commits
+			// only its progress, not the aggregator's
+			offsets.Done(ctx, msg)
 		}
 
 		// Broadcast anomaly alerts to WebSocket clients if any were detected
-		var telemetry pb.Telemetry
-		if err := proto.Unmarshal(msg.Value, &telemetry); err == nil {
+		if telemetry, err := decodeTelemetry(detector.MessageDecoder(), msg.Value); err == nil {
 			// Check if this processing resulted in any new alerts
-			alerts, err := detector.db.GetActiveAlerts(telemetry.DeviceId, 1)
+			alerts, err := db.GetActiveAlerts(telemetry.DeviceId, 1)
 			if err == nil && len(alerts) > 0 {
 				// Broadcast the most recent alert
-				wsServer.BroadcastAlert(alerts[0])
+				wsServer.BroadcastAlertWithContext(msgCtx, telemetry.DeviceId, alerts[0])
 			}
 		}
 
-		log.Printf("Processed anomaly detection for offset %d", msg.Offset)
+		logger.Debug("Processed anomaly detection message",
+			slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
 	}
 }
@@ -1,17 +1,31 @@
 package processors
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"go-processor/internal/config"
+	"go-processor/internal/database"
+	"go-processor/internal/metrics"
 	pb "go-processor/internal/proto"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	kafkago "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/proto"
 )
 
 func TestAnomalyDetector_UpdateStats(t *testing.T) {
-	detector := &AnomalyDetector{}
+	detector := &AnomalyDetector{logger: slog.Default()}
 	stats := &Stats{
 		Min: 1000000,  // Init high
 		Max: -1000000, // Init low
@@ -42,6 +56,7 @@ func TestAnomalyDetector_UpdateStats(t *testing.T) {
 
 func TestAnomalyDetector_ProcessTelemetry(t *testing.T) {
 	detector := &AnomalyDetector{
+		logger:         slog.Default(),
 		deviceStats:    make(map[string]*DeviceStats),
 		alertThreshold: 3.0,
 		stopChannel:    make(chan bool),
@@ -61,7 +76,7 @@ func TestAnomalyDetector_ProcessTelemetry(t *testing.T) {
 			},
 		}
 		data, _ := proto.Marshal(telemetry)
-		_ = detector.ProcessTelemetry(data)
+		_ = detector.ProcessTelemetry(context.Background(), data)
 	}
 
 	stats := detector.deviceStats[deviceID].MetricStats["pressure"]
@@ -83,7 +98,7 @@ func TestAnomalyDetector_ProcessTelemetry(t *testing.T) {
 		Metrics:  map[string]float64{"pressure": 105.0},
 	}
 	dataVar, _ := proto.Marshal(telemetryVar)
-	_ = detector.ProcessTelemetry(dataVar)
+	_ = detector.ProcessTelemetry(context.Background(), dataVar)
 
 	// Now we have variance.
 	// Mean slightly > 100, StdDev > 0.
@@ -114,3 +129,210 @@ func TestAnomalyDetector_ProcessTelemetry(t *testing.T) {
 
 	// Or I can add a check in the test to ensure we don't crash on normal updates.
 }
+
+func TestAnomalyDetector_CooldownDeduplicatesAlerts(t *testing.T) {
+	run := func(cooldown time.Duration) int {
+		alerts := 0
+		detector := &AnomalyDetector{
+			logger:           slog.Default(),
+			deviceStats:      make(map[string]*DeviceStats),
+			alertThreshold:   3.0,
+			CooldownDuration: cooldown,
+			onAnomaly:        func(*Anomaly) { alerts++ },
+		}
+
+		send := func(value float64) {
+			data, _ := proto.Marshal(&pb.Telemetry{
+				DeviceId: "stuck-device",
+				Ts:       time.Now().UnixMilli(),
+				Metrics:  map[string]float64{"temperature": value},
+			})
+			assert.NoError(t, detector.ProcessTelemetry(context.Background(), data))
+		}
+
+		// Baseline of 100±10
+		for i := 0; i < 200; i++ {
+			send(90 + float64(i%2)*20)
+		}
+
+		// Sensor stuck at an anomalous value
+		for i := 0; i < 10; i++ {
+			send(10000)
+		}
+		return alerts
+	}
+
+	// Without a cooldown every sample alerts; with one only the first does
+	assert.Equal(t, 10, run(0))
+	assert.Equal(t, 1, run(time.Minute))
+}
+
+func TestAnomalyDetector_LogsStructuredAnomaly(t *testing.T) {
+	var buf bytes.Buffer
+	detector := &AnomalyDetector{
+		logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+	}
+
+	detector.reportAnomaly(&Anomaly{
+		DeviceID:     "device-1",
+		MetricName:   "temperature",
+		Value:        250,
+		ZScore:       6.5,
+		Severity:     "high",
+		DetectorType: DetectorTypeZScore,
+	})
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "Anomaly detected", entry["msg"])
+	assert.Equal(t, "device-1", entry["device_id"])
+	assert.Equal(t, "temperature", entry["metric"])
+	assert.Equal(t, 250.0, entry["value"])
+	assert.Equal(t, "high", entry["severity"])
+}
+
+func TestAnomalyDetector_ReloadsThresholdFromConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"alert_threshold": 3}`), 0o644))
+
+	cfg := &config.Config{AlertThreshold: 3, AnomalyCooldown: time.Minute}
+	detector := &AnomalyDetector{
+		logger:         slog.Default(),
+		alertThreshold: cfg.AlertThreshold,
+	}
+
+	watcher, err := config.NewConfigWatcher(path, cfg)
+	assert.NoError(t, err)
+	watcher.Start(context.Background())
+	defer watcher.Stop()
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"alert_threshold": 1.5, "anomaly_cooldown": "30s"}`), 0o644))
+
+	select {
+	case updated := <-watcher.Updates():
+		detector.UpdateConfig(updated)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no config update after writing the file")
+	}
+
+	assert.Equal(t, 1.5, detector.GetThreshold("device-1", "temperature"))
+	assert.Equal(t, 30*time.Second, detector.CooldownDuration)
+}
+
+type fakeAnomalyPublisher struct {
+	sent int
+}
+
+func (p *fakeAnomalyPublisher) SendMessageWithRetry(ctx context.Context, key, value []byte, maxRetries int, baseDelay time.Duration, headers ...kafkago.Header) error {
+	p.sent++
+	return nil
+}
+
+func (p *fakeAnomalyPublisher) Close() error { return nil }
+
+type fakeAnomalyStore struct {
+	alerts []database.AlertRecord
+	err    error
+}
+
+func (s *fakeAnomalyStore) InsertAlert(alert database.AlertRecord) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func TestAnomalyDetector_CountsAnomaliesBySeverityAndDetector(t *testing.T) {
+	publisher := &fakeAnomalyPublisher{}
+	store := &fakeAnomalyStore{}
+	detector := &AnomalyDetector{
+		producer:       publisher,
+		db:             store,
+		logger:         slog.Default(),
+		deviceStats:    make(map[string]*DeviceStats),
+		alertThreshold: 3.0,
+	}
+
+	detected := metrics.AnomaliesDetected.WithLabelValues("high", DetectorTypeZScore)
+	saved := metrics.AnomaliesSaved.WithLabelValues("high", DetectorTypeZScore)
+	detectedBefore := testutil.ToFloat64(detected)
+	savedBefore := testutil.ToFloat64(saved)
+
+	send := func(value float64) {
+		data, _ := proto.Marshal(&pb.Telemetry{
+			DeviceId: "metrics-device",
+			Ts:       time.Now().UnixMilli(),
+			Metrics:  map[string]float64{"temperature": value},
+		})
+		assert.NoError(t, detector.ProcessTelemetry(context.Background(), data))
+	}
+
+	// Baseline of 100±10, then a spike far beyond a Z-score of 5
+	for i := 0; i < 50; i++ {
+		send(90 + float64(i%2)*20)
+	}
+	send(10000)
+
+	assert.Equal(t, 1, publisher.sent)
+	assert.Len(t, store.alerts, 1)
+	assert.Equal(t, detectedBefore+1, testutil.ToFloat64(detected))
+	assert.Equal(t, savedBefore+1, testutil.ToFloat64(saved))
+}
+
+func TestAnomalyDetector_ObservesZScores(t *testing.T) {
+	detector := &AnomalyDetector{
+		logger:         slog.Default(),
+		deviceStats:    make(map[string]*DeviceStats),
+		alertThreshold: 3.0,
+	}
+
+	summary := metrics.ZScoreDistribution.WithLabelValues("zscore_test_metric")
+	countBefore := summaryCount(t, summary)
+
+	// The first 10 samples only build the baseline, the other 5 are checked
+	for i := 0; i < 15; i++ {
+		data, _ := proto.Marshal(&pb.Telemetry{
+			DeviceId: "zscore-device",
+			Ts:       time.Now().UnixMilli(),
+			Metrics:  map[string]float64{"zscore_test_metric": 90 + float64(i%2)*20},
+		})
+		assert.NoError(t, detector.ProcessTelemetry(context.Background(), data))
+	}
+
+	assert.Equal(t, countBefore+5, summaryCount(t, summary))
+}
+
+// summaryCount returns the number of observations of summary.
+func summaryCount(t *testing.T, summary prometheus.Observer) uint64 {
+	t.Helper()
+	var m dto.Metric
+	assert.NoError(t, summary.(prometheus.Metric).Write(&m))
+	return m.GetSummary().GetSampleCount()
+}
+
+func TestAnomalyDetector_DoesNotCountFailedSaves(t *testing.T) {
+	detector := &AnomalyDetector{
+		producer: &fakeAnomalyPublisher{},
+		db:       &fakeAnomalyStore{err: errors.New("database unavailable")},
+		logger:   slog.Default(),
+	}
+
+	detected := metrics.AnomaliesDetected.WithLabelValues("medium", AlertTypeThreshold)
+	saved := metrics.AnomaliesSaved.WithLabelValues("medium", AlertTypeThreshold)
+	detectedBefore := testutil.ToFloat64(detected)
+	savedBefore := testutil.ToFloat64(saved)
+
+	detector.reportAnomaly(&Anomaly{
+		DeviceID:     "device-1",
+		MetricName:   "temperature",
+		Value:        90,
+		Severity:     "medium",
+		DetectorType: AlertTypeThreshold,
+		AlertType:    AlertTypeThreshold,
+	})
+
+	assert.Equal(t, detectedBefore+1, testutil.ToFloat64(detected))
+	assert.Equal(t, savedBefore, testutil.ToFloat64(saved))
+}
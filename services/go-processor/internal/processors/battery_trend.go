@@ -0,0 +1,202 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-processor/internal/database"
+)
+
+const (
+	AlertTypeBatteryLowTrend = "battery_low_trend"
+
+	batteryMetric = "battery_level"
+
+	// batteryTrendInterval is how often battery trends are checked.
+	batteryTrendInterval = time.Hour
+
+	// batteryLookbackHours is how far back the trend is fitted.
+	batteryLookbackHours = 24
+
+	// batteryDepletionHorizon is how soon a battery must be projected to run
+	// out for an alert.
+	batteryDepletionHorizon = 48 * time.Hour
+
+	// minBatteryReadings is the fewest aggregates a trend is fitted to.
+	minBatteryReadings = 3
+
+	// maxBatteryAggregates bounds the aggregates fetched per device, a day of
+	// per-minute windows for every aggregation function.
+	maxBatteryAggregates = batteryLookbackHours * 60 * 6
+
+	// devicePageSize is how many devices are listed at a time.
+	devicePageSize = 500
+
+	batteryResolvedBy = "battery_trend_analyzer"
+)
+
+// batteryStore is the subset of TimescaleDB used by BatteryTrendAnalyzer.
+type batteryStore interface {
+	ListDevices(status string, limit, offset int) ([]database.DeviceRecord, error)
+	GetAggregatesForAPI(deviceID, metricName string, hours, limit int) ([]database.AggregateRecord, error)
+	GetActiveAlerts(deviceID string, limit int) ([]database.AlertRecord, error)
+	InsertAlert(alert database.AlertRecord) error
+	ResolveAlert(id int, resolvedBy string, notes string) error
+}
+
+// BatteryTrendAnalyzer fits a line to each device's mean battery level over
+// the last day, every hour, and raises a battery_low_trend alert when the
+// battery is projected to run out within two days. The alert is resolved
+// once the trend no longer projects that, e.g. after a battery change.
+type BatteryTrendAnalyzer struct {
+	db          batteryStore
+	broadcaster alertBroadcaster
+	logger      *slog.Logger
+	interval    time.Duration
+
+	// now is replaced in tests
+	now func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewBatteryTrendAnalyzer(db *database.TimescaleDB, broadcaster alertBroadcaster, logger *slog.Logger) *BatteryTrendAnalyzer {
+	return newBatteryTrendAnalyzer(db, broadcaster, batteryTrendInterval, logger)
+}
+
+func newBatteryTrendAnalyzer(db batteryStore, broadcaster alertBroadcaster, interval time.Duration, logger *slog.Logger) *BatteryTrendAnalyzer {
+	return &BatteryTrendAnalyzer{
+		db:          db,
+		broadcaster: broadcaster,
+		logger:      loggerOrDefault(logger),
+		interval:    interval,
+		now:         time.Now,
+	}
+}
+
+// Start launches the check goroutine, which runs until ctx is cancelled or
+// Stop is called.
+func (a *BatteryTrendAnalyzer) Start(ctx context.Context) {
+	ctx, a.cancel = context.WithCancel(ctx)
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.check(); err != nil {
+					a.logger.Warn("Failed to check battery trends", slog.Any("error", err))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (a *BatteryTrendAnalyzer) Stop() {
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.wg.Wait()
+}
+
+// check analyzes the battery trend of every registered device.
+func (a *BatteryTrendAnalyzer) check() error {
+	for offset := 0; ; offset += devicePageSize {
+		devices, err := a.db.ListDevices("", devicePageSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, device := range devices {
+			if err := a.checkDevice(device.DeviceID); err != nil {
+				a.logger.Error("Failed to check battery trend",
+					slog.String("device_id", device.DeviceID), slog.Any("error", err))
+			}
+		}
+		if len(devices) < devicePageSize {
+			return nil
+		}
+	}
+}
+
+func (a *BatteryTrendAnalyzer) checkDevice(deviceID string) error {
+	aggregates, err := a.db.GetAggregatesForAPI(deviceID, batteryMetric, batteryLookbackHours, maxBatteryAggregates)
+	if err != nil {
+		return err
+	}
+
+	// Hours relative to now, so the intercept is the current level
+	now := a.now()
+	var xs, ys []float64
+	for _, aggregate := range aggregates {
+		// Aggregates stored before functions were configurable are means
+		if aggregate.Function != "" && aggregate.Function != string(FunctionMean) {
+			continue
+		}
+		xs = append(xs, aggregate.Timestamp.Sub(now).Hours())
+		ys = append(ys, aggregate.MetricValue)
+	}
+	if len(xs) < minBatteryReadings {
+		return nil
+	}
+
+	slope, level := LinearRegression(xs, ys)
+	depleting := slope < 0
+	var timeToEmpty time.Duration
+	if depleting {
+		timeToEmpty = time.Duration(max(level, 0) / -slope * float64(time.Hour))
+	}
+
+	alerts, err := activeAlertsOfType(a.db, deviceID, AlertTypeBatteryLowTrend)
+	if err != nil {
+		return err
+	}
+
+	if !depleting || timeToEmpty > batteryDepletionHorizon {
+		for _, alert := range alerts {
+			if err := a.db.ResolveAlert(alert.ID, batteryResolvedBy, "Battery no longer projected to run out"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(alerts) > 0 {
+		return nil
+	}
+
+	alert := database.AlertRecord{
+		DeviceID:    deviceID,
+		Timestamp:   now,
+		MetricName:  batteryMetric,
+		MetricValue: level,
+		AlertType:   AlertTypeBatteryLowTrend,
+		Severity:    "medium",
+		Threshold:   batteryDepletionHorizon.Hours(),
+		Status:      "open",
+		Message: fmt.Sprintf("Battery projected to run out in %s, falling %.2f per hour",
+			timeToEmpty.Round(time.Minute), -slope),
+	}
+	if err := a.db.InsertAlert(alert); err != nil {
+		return err
+	}
+	if a.broadcaster != nil {
+		a.broadcaster.BroadcastAlert(deviceID, alert)
+	}
+
+	a.logger.Warn("Battery depleting",
+		slog.String("device_id", deviceID),
+		slog.Float64("battery_level", level),
+		slog.Float64("slope_per_hour", slope),
+		slog.Duration("time_to_empty", timeToEmpty))
+	return nil
+}
@@ -0,0 +1,143 @@
+package processors
+
+import (
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBatteryStore struct {
+	*fakeOfflineStore
+	devices    []database.DeviceRecord
+	aggregates map[string][]database.AggregateRecord
+}
+
+func (s *fakeBatteryStore) ListDevices(status string, limit, offset int) ([]database.DeviceRecord, error) {
+	if offset >= len(s.devices) {
+		return nil, nil
+	}
+	return s.devices[offset:min(offset+limit, len(s.devices))], nil
+}
+
+func (s *fakeBatteryStore) GetAggregatesForAPI(deviceID, metricName string, hours, limit int) ([]database.AggregateRecord, error) {
+	var matching []database.AggregateRecord
+	for _, aggregate := range s.aggregates[deviceID] {
+		if aggregate.MetricName == metricName {
+			matching = append(matching, aggregate)
+		}
+	}
+	return matching, nil
+}
+
+// hourlyBattery returns a day of hourly mean battery levels, newest first,
+// ending at level now and changing by ratePerHour, alongside max aggregates
+// that must be ignored.
+func hourlyBattery(now time.Time, level, ratePerHour float64) []database.AggregateRecord {
+	var aggregates []database.AggregateRecord
+	for h := 0; h < 24; h++ {
+		ts := now.Add(-time.Duration(h) * time.Hour)
+		value := level - ratePerHour*float64(h)
+		aggregates = append(aggregates,
+			database.AggregateRecord{Timestamp: ts, MetricName: batteryMetric, MetricValue: value, Function: "mean"},
+			database.AggregateRecord{Timestamp: ts, MetricName: batteryMetric, MetricValue: 100, Function: "max"})
+	}
+	return aggregates
+}
+
+func newTestBatteryAnalyzer(store *fakeBatteryStore, broadcaster alertBroadcaster, now time.Time) *BatteryTrendAnalyzer {
+	analyzer := newBatteryTrendAnalyzer(store, broadcaster, time.Hour, slog.Default())
+	analyzer.now = func() time.Time { return now }
+	return analyzer
+}
+
+func TestBatteryTrendAnalyzer_AlertsOnDepletion(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeBatteryStore{
+		fakeOfflineStore: &fakeOfflineStore{},
+		devices: []database.DeviceRecord{
+			{DeviceID: "draining"}, {DeviceID: "slow"}, {DeviceID: "steady"}, {DeviceID: "mains"},
+		},
+		aggregates: map[string][]database.AggregateRecord{
+			// 60% at 1.5%/h runs out in 40h
+			"draining": hourlyBattery(now, 60, -1.5),
+			// 80% at 0.5%/h runs out in 160h
+			"slow":   hourlyBattery(now, 80, -0.5),
+			"steady": hourlyBattery(now, 95, 0),
+		},
+	}
+	broadcaster := &recordingBroadcaster{}
+	analyzer := newTestBatteryAnalyzer(store, broadcaster, now)
+
+	assert.NoError(t, analyzer.check())
+
+	if assert.Len(t, store.alerts, 1) {
+		alert := store.alerts[0]
+		assert.Equal(t, "draining", alert.DeviceID)
+		assert.Equal(t, AlertTypeBatteryLowTrend, alert.AlertType)
+		assert.Equal(t, "medium", alert.Severity)
+		assert.Equal(t, batteryMetric, alert.MetricName)
+		assert.InDelta(t, 60, alert.MetricValue, 1e-9)
+		assert.Equal(t, "Battery projected to run out in 40h0m0s, falling 1.50 per hour", alert.Message)
+	}
+	assert.Equal(t, []string{"draining"}, broadcaster.deviceIDs)
+
+	// The open alert isn't repeated
+	assert.NoError(t, analyzer.check())
+	assert.Len(t, store.alerts, 1)
+}
+
+func TestBatteryTrendAnalyzer_ResolvesAfterRecharge(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeBatteryStore{
+		fakeOfflineStore: &fakeOfflineStore{},
+		devices:          []database.DeviceRecord{{DeviceID: "device-1"}},
+		aggregates:       map[string][]database.AggregateRecord{"device-1": hourlyBattery(now, 20, -2)},
+	}
+	analyzer := newTestBatteryAnalyzer(store, nil, now)
+
+	assert.NoError(t, analyzer.check())
+	assert.Len(t, store.alerts, 1)
+
+	// Charging for the last day
+	store.aggregates["device-1"] = hourlyBattery(now, 100, 3)
+	assert.NoError(t, analyzer.check())
+	assert.Equal(t, []int{1}, store.resolved)
+	assert.Len(t, store.alerts, 1)
+}
+
+func TestBatteryTrendAnalyzer_NeedsEnoughReadings(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeBatteryStore{
+		fakeOfflineStore: &fakeOfflineStore{},
+		devices:          []database.DeviceRecord{{DeviceID: "device-1"}},
+		aggregates:       map[string][]database.AggregateRecord{"device-1": hourlyBattery(now, 5, -5)[:4]},
+	}
+	analyzer := newTestBatteryAnalyzer(store, nil, now)
+
+	assert.NoError(t, analyzer.check())
+	assert.Empty(t, store.alerts)
+}
+
+func TestBatteryTrendAnalyzer_PagesThroughDevices(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeBatteryStore{
+		fakeOfflineStore: &fakeOfflineStore{},
+		aggregates:       map[string][]database.AggregateRecord{},
+	}
+	for i := 0; i < devicePageSize+1; i++ {
+		store.devices = append(store.devices, database.DeviceRecord{DeviceID: "device-" + strconv.Itoa(i)})
+	}
+	last := store.devices[devicePageSize].DeviceID
+	store.aggregates[last] = hourlyBattery(now, 30, -1)
+	analyzer := newTestBatteryAnalyzer(store, nil, now)
+
+	assert.NoError(t, analyzer.check())
+	if assert.Len(t, store.alerts, 1) {
+		assert.Equal(t, last, store.alerts[0].DeviceID)
+	}
+}
@@ -0,0 +1,93 @@
+package processors
+
+import "sync"
+
+const (
+	AlertTypeChangePoint = "changepoint"
+	DetectorTypeCUSUM    = "cusum"
+)
+
+// cusumState holds the cumulative sums of one device metric.
+type cusumState struct {
+	upper float64 // C+, evidence of an upward shift
+	lower float64 // C-, evidence of a downward shift
+}
+
+// ChangePointDetector flags sustained shifts in a metric's mean, which
+// Z-score misses when no single sample is extreme. It runs a tabular CUSUM
+// against the metric's baseline Stats: deviations beyond Allowance standard
+// deviations accumulate, and a shift is reported once either sum exceeds
+// Threshold standard deviations.
+type ChangePointDetector struct {
+	Allowance float64 // k, in standard deviations
+	Threshold float64 // h, in standard deviations
+
+	states map[string]map[string]*cusumState
+	mutex  sync.Mutex
+}
+
+func NewChangePointDetector(allowance, threshold float64) *ChangePointDetector {
+	return &ChangePointDetector{
+		Allowance: allowance,
+		Threshold: threshold,
+		states:    make(map[string]map[string]*cusumState),
+	}
+}
+
+// Check adds a sample to the metric's cumulative sums and returns an anomaly
+// when either exceeds the threshold. Both sums restart after a detection.
+// Metrics whose baseline has no spread are skipped.
+func (d *ChangePointDetector) Check(deviceID, metricName string, value float64, timestamp int64, baseline Stats) *Anomaly {
+	if baseline.StdDev == 0 {
+		return nil
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.states[deviceID] == nil {
+		d.states[deviceID] = make(map[string]*cusumState)
+	}
+	state, exists := d.states[deviceID][metricName]
+	if !exists {
+		state = &cusumState{}
+		d.states[deviceID][metricName] = state
+	}
+
+	allowance := d.Allowance * baseline.StdDev
+	limit := d.Threshold * baseline.StdDev
+
+	state.upper = max(0, state.upper+value-baseline.Mean-allowance)
+	state.lower = max(0, state.lower+baseline.Mean-value-allowance)
+
+	var sum float64
+	switch {
+	case state.upper > limit:
+		sum = state.upper
+	case state.lower > limit:
+		sum = -state.lower
+	default:
+		return nil
+	}
+
+	*state = cusumState{}
+	return &Anomaly{
+		DeviceID:      deviceID,
+		Timestamp:     timestamp,
+		MetricName:    metricName,
+		Value:         value,
+		ExpectedRange: [2]float64{baseline.Mean - allowance, baseline.Mean + allowance},
+		Severity:      "medium",
+		ZScore:        sum / baseline.StdDev,
+		DetectorType:  DetectorTypeCUSUM,
+		Threshold:     d.Threshold,
+		AlertType:     AlertTypeChangePoint,
+	}
+}
+
+// Forget drops the cumulative sums of a device.
+func (d *ChangePointDetector) Forget(deviceID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.states, deviceID)
+}
@@ -0,0 +1,59 @@
+package processors
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangePointDetector_DetectsMeanShift(t *testing.T) {
+	detector := NewChangePointDetector(0.5, 5)
+	baseline := Stats{Mean: 100, StdDev: 10}
+	rng := rand.New(rand.NewSource(1))
+
+	// In control: with k=0.5 and h=5 the published in-control ARL is about
+	// 465 samples, so 100 samples should not alarm.
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, detector.Check("device-1", "pressure", 100+10*rng.NormFloat64(), int64(i), baseline))
+	}
+
+	// A 2 sigma shift has an out-of-control ARL of about 4 samples
+	detectedAt := -1
+	for i := 0; i < 30; i++ {
+		anomaly := detector.Check("device-1", "pressure", 120+10*rng.NormFloat64(), int64(100+i), baseline)
+		if anomaly != nil {
+			assert.Equal(t, AlertTypeChangePoint, anomaly.AlertType)
+			assert.Greater(t, anomaly.ZScore, 5.0)
+			detectedAt = i
+			break
+		}
+	}
+	assert.GreaterOrEqual(t, detectedAt, 0, "shift not detected within 30 samples")
+}
+
+func TestChangePointDetector_DownwardShiftAndReset(t *testing.T) {
+	detector := NewChangePointDetector(0.5, 5)
+	baseline := Stats{Mean: 100, StdDev: 10}
+
+	// Each sample adds 20 - 5 = 15 to C-, crossing h*sigma = 50 on the 4th
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, detector.Check("device-1", "pressure", 80, int64(i), baseline))
+	}
+	anomaly := detector.Check("device-1", "pressure", 80, 3, baseline)
+	if assert.NotNil(t, anomaly) {
+		assert.Less(t, anomaly.ZScore, 0.0)
+		assert.Equal(t, [2]float64{95, 105}, anomaly.ExpectedRange)
+	}
+
+	// The sums restart after a detection
+	assert.Nil(t, detector.Check("device-1", "pressure", 80, 4, baseline))
+}
+
+func TestChangePointDetector_SkipsFlatBaseline(t *testing.T) {
+	detector := NewChangePointDetector(0.5, 5)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, detector.Check("device-1", "pressure", 500, int64(i), Stats{Mean: 100}))
+	}
+}
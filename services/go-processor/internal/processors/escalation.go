@@ -0,0 +1,92 @@
+package processors
+
+import (
+	"sync"
+	"time"
+)
+
+const AlertTypeEscalated = "escalated"
+
+// anomalyHistory is a circular buffer of the timestamps of the most recent
+// anomalies of one device metric, in epoch milliseconds.
+type anomalyHistory struct {
+	timestamps []int64
+	next       int
+	full       bool
+}
+
+func newAnomalyHistory(size int) *anomalyHistory {
+	return &anomalyHistory{timestamps: make([]int64, size)}
+}
+
+func (h *anomalyHistory) add(timestamp int64) {
+	h.timestamps[h.next] = timestamp
+	h.next = (h.next + 1) % len(h.timestamps)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// oldest returns the earliest timestamp held once the buffer is full.
+func (h *anomalyHistory) oldest() int64 {
+	return h.timestamps[h.next]
+}
+
+func (h *anomalyHistory) reset() {
+	h.next = 0
+	h.full = false
+}
+
+// EscalationPolicy raises the severity of anomalies that keep recurring: when
+// a device metric has CountThreshold anomalies within Window, the latest one
+// is re-emitted with EscalatedSeverity. The count then starts over, so a
+// persistent problem escalates once per CountThreshold anomalies.
+type EscalationPolicy struct {
+	Window            time.Duration
+	CountThreshold    int
+	EscalatedSeverity string
+
+	histories map[string]map[string]*anomalyHistory
+	mutex     sync.Mutex
+}
+
+func NewEscalationPolicy(window time.Duration, countThreshold int, escalatedSeverity string) *EscalationPolicy {
+	return &EscalationPolicy{
+		Window:            window,
+		CountThreshold:    countThreshold,
+		EscalatedSeverity: escalatedSeverity,
+		histories:         make(map[string]map[string]*anomalyHistory),
+	}
+}
+
+// Record adds an anomaly to its device metric's history and returns the
+// escalated alert when the threshold is reached, or nil.
+func (p *EscalationPolicy) Record(anomaly *Anomaly) *Anomaly {
+	if p.CountThreshold <= 0 || anomaly.AlertType == AlertTypeEscalated {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.histories[anomaly.DeviceID] == nil {
+		p.histories[anomaly.DeviceID] = make(map[string]*anomalyHistory)
+	}
+	history, exists := p.histories[anomaly.DeviceID][anomaly.MetricName]
+	if !exists {
+		history = newAnomalyHistory(p.CountThreshold)
+		p.histories[anomaly.DeviceID][anomaly.MetricName] = history
+	}
+
+	history.add(anomaly.Timestamp)
+	if !history.full || anomaly.Timestamp-history.oldest() > p.Window.Milliseconds() {
+		return nil
+	}
+	history.reset()
+
+	escalated := *anomaly
+	escalated.Severity = p.EscalatedSeverity
+	escalated.AlertType = AlertTypeEscalated
+	escalated.Threshold = float64(p.CountThreshold)
+	return &escalated
+}
@@ -0,0 +1,86 @@
+package processors
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lowAnomaly(timestamp int64) *Anomaly {
+	return &Anomaly{
+		DeviceID:     "device-1",
+		Timestamp:    timestamp,
+		MetricName:   "temperature",
+		Value:        31,
+		Severity:     "low",
+		DetectorType: DetectorTypeZScore,
+	}
+}
+
+func TestEscalationPolicy_EscalatesRepeatedAnomalies(t *testing.T) {
+	policy := NewEscalationPolicy(5*time.Minute, 5, "high")
+	start := time.Now().UnixMilli()
+
+	// Five anomalies a minute apart, all within five minutes
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, policy.Record(lowAnomaly(start+int64(i)*60000)))
+	}
+	escalated := policy.Record(lowAnomaly(start + 4*60000))
+
+	if assert.NotNil(t, escalated) {
+		assert.Equal(t, "high", escalated.Severity)
+		assert.Equal(t, AlertTypeEscalated, escalated.AlertType)
+		assert.Equal(t, start+4*60000, escalated.Timestamp)
+		assert.Equal(t, "temperature", escalated.MetricName)
+	}
+
+	// The count starts over after escalating
+	assert.Nil(t, policy.Record(lowAnomaly(start+5*60000)))
+}
+
+func TestEscalationPolicy_IgnoresSpreadOutAnomalies(t *testing.T) {
+	policy := NewEscalationPolicy(5*time.Minute, 5, "high")
+	start := time.Now().UnixMilli()
+
+	// Two minutes apart, so no five fall within five minutes
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, policy.Record(lowAnomaly(start+int64(i)*120000)))
+	}
+}
+
+func TestEscalationPolicy_TracksMetricsSeparately(t *testing.T) {
+	policy := NewEscalationPolicy(5*time.Minute, 2, "high")
+	start := time.Now().UnixMilli()
+
+	assert.Nil(t, policy.Record(lowAnomaly(start)))
+	humidity := lowAnomaly(start + 1000)
+	humidity.MetricName = "humidity"
+	assert.Nil(t, policy.Record(humidity))
+	assert.NotNil(t, policy.Record(lowAnomaly(start+2000)))
+}
+
+func TestAnomalyDetector_EscalatesDespiteCooldown(t *testing.T) {
+	store := &fakeAnomalyStore{}
+	detector := &AnomalyDetector{
+		producer:         &fakeAnomalyPublisher{},
+		db:               store,
+		logger:           slog.Default(),
+		CooldownDuration: 5 * time.Minute,
+		Escalation:       NewEscalationPolicy(5*time.Minute, 5, "high"),
+	}
+
+	start := time.Now().UnixMilli()
+	for i := 0; i < 5; i++ {
+		detector.reportAnomaly(lowAnomaly(start + int64(i)*30000))
+	}
+
+	// The cooldown lets only the first low alert through, then the escalation
+	if assert.Len(t, store.alerts, 2) {
+		assert.Equal(t, "low", store.alerts[0].Severity)
+		assert.Equal(t, AlertTypeAnomaly, store.alerts[0].AlertType)
+		assert.Equal(t, "high", store.alerts[1].Severity)
+		assert.Equal(t, AlertTypeEscalated, store.alerts[1].AlertType)
+	}
+}
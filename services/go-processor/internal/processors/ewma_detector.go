@@ -0,0 +1,146 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+
+	"go-processor/internal/config"
+	"go-processor/internal/database"
+	"go-processor/internal/metrics"
+)
+
+// EWMAStats tracks the exponentially weighted mean and variance of a metric.
+type EWMAStats struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Count    int     `json:"count"`
+}
+
+// EWMADetector flags values that deviate from an exponentially weighted
+// moving average. Unlike the running Z-score it forgets old samples, so it
+// adapts quickly when a metric drifts to a new baseline.
+type EWMADetector struct {
+	*AnomalyDetector
+
+	Alpha float64 // smoothing factor for the mean
+	Beta  float64 // smoothing factor for the variance
+
+	ewmaStats map[string]map[string]*EWMAStats
+	ewmaMutex sync.Mutex
+
+	// lastUpdated is the timestamp of each device's latest telemetry,
+	// guarded by ewmaMutex.
+	lastUpdated map[string]int64
+}
+
+func NewEWMADetector(cfg *config.Config, db *database.TimescaleDB, logger *slog.Logger) (*EWMADetector, error) {
+	base, err := NewAnomalyDetector(cfg, db, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	ed := &EWMADetector{
+		AnomalyDetector: base,
+		Alpha:           cfg.EWMAAlpha,
+		Beta:            cfg.EWMABeta,
+		ewmaStats:       make(map[string]map[string]*EWMAStats),
+		lastUpdated:     make(map[string]int64),
+	}
+
+	// Forget devices when the base detector cleans up their stats
+	base.mutex.Lock()
+	base.staleForgetters = append(base.staleForgetters, ed)
+	base.mutex.Unlock()
+
+	return ed, nil
+}
+
+func (ed *EWMADetector) ProcessTelemetry(ctx context.Context, data []byte) error {
+	telemetry, err := decodeTelemetry(ed.Decoder, data)
+	if err != nil {
+		ed.logger.Error("Failed to decode telemetry", slog.Any("error", err))
+		return err
+	}
+
+	metrics.MessagesProcessed.Inc()
+	ed.runFixedChecks(telemetry)
+
+	deviceID := telemetry.DeviceId
+
+	ed.ewmaMutex.Lock()
+	defer ed.ewmaMutex.Unlock()
+
+	if ed.ewmaStats[deviceID] == nil {
+		ed.ewmaStats[deviceID] = make(map[string]*EWMAStats)
+	}
+	if ed.lastUpdated == nil {
+		ed.lastUpdated = make(map[string]int64)
+	}
+	ed.lastUpdated[deviceID] = telemetry.Ts
+
+	for metricName, value := range telemetry.Metrics {
+		stats, exists := ed.ewmaStats[deviceID][metricName]
+		if !exists {
+			ed.ewmaStats[deviceID][metricName] = &EWMAStats{Mean: value, Count: 1}
+			continue
+		}
+
+		deviation := value - stats.Mean
+		stdDev := math.Sqrt(stats.Variance)
+
+		// Need at least 10 samples for reliable detection
+		if stats.Count >= 10 && stdDev > 0 {
+			threshold := ed.GetThreshold(deviceID, metricName)
+			score := deviation / stdDev
+			if math.Abs(score) > threshold {
+				ed.reportAnomaly(&Anomaly{
+					DeviceID:   deviceID,
+					Timestamp:  telemetry.Ts,
+					MetricName: metricName,
+					Value:      value,
+					ExpectedRange: [2]float64{
+						stats.Mean - threshold*stdDev,
+						stats.Mean + threshold*stdDev,
+					},
+					Severity:     ed.calculateSeverity(math.Abs(score)),
+					ZScore:       score,
+					DetectorType: DetectorTypeEWMA,
+					Threshold:    threshold,
+				})
+			}
+		}
+
+		ed.updateEWMA(stats, value)
+	}
+
+	return nil
+}
+
+func (ed *EWMADetector) updateEWMA(stats *EWMAStats, value float64) {
+	deviation := value - stats.Mean
+	stats.Mean += ed.Alpha * deviation
+	stats.Variance = ed.Beta*deviation*deviation + (1-ed.Beta)*stats.Variance
+	stats.Count++
+}
+
+// Forget drops the EWMA stats of a device.
+func (ed *EWMADetector) Forget(deviceID string) {
+	ed.ewmaMutex.Lock()
+	defer ed.ewmaMutex.Unlock()
+	delete(ed.ewmaStats, deviceID)
+	delete(ed.lastUpdated, deviceID)
+}
+
+func (ed *EWMADetector) forgetStale(cutoff int64) {
+	ed.ewmaMutex.Lock()
+	defer ed.ewmaMutex.Unlock()
+
+	for deviceID, lastUpdated := range ed.lastUpdated {
+		if lastUpdated < cutoff {
+			delete(ed.ewmaStats, deviceID)
+			delete(ed.lastUpdated, deviceID)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEWMADetector_AdaptsToMeanShift(t *testing.T) {
+	var anomalies []*Anomaly
+	ewma := &EWMADetector{
+		AnomalyDetector: &AnomalyDetector{
+			logger:         slog.Default(),
+			deviceStats:    make(map[string]*DeviceStats),
+			alertThreshold: 3.0,
+			onAnomaly:      func(a *Anomaly) { anomalies = append(anomalies, a) },
+		},
+		Alpha:     0.2,
+		Beta:      0.2,
+		ewmaStats: make(map[string]map[string]*EWMAStats),
+	}
+	zscore := &AnomalyDetector{
+		logger:         slog.Default(),
+		deviceStats:    make(map[string]*DeviceStats),
+		alertThreshold: 3.0,
+		onAnomaly:      func(*Anomaly) {},
+	}
+
+	deviceID := "test-ewma-device"
+	now := time.Now().UnixMilli()
+	send := func(i int, value float64) {
+		data, _ := proto.Marshal(&pb.Telemetry{
+			DeviceId: deviceID,
+			Ts:       now + int64(i*1000),
+			Metrics:  map[string]float64{"temperature": value},
+		})
+		assert.NoError(t, ewma.ProcessTelemetry(context.Background(), data))
+		assert.NoError(t, zscore.ProcessTelemetry(context.Background(), data))
+	}
+
+	// Stable baseline around 100 with small alternating noise
+	for i := 0; i < 100; i++ {
+		send(i, 100+float64(i%2*4-2))
+	}
+	assert.Empty(t, anomalies)
+
+	// Mean shifts by 50%
+	lastAnomaly := -1
+	for i := 0; i < 40; i++ {
+		before := len(anomalies)
+		send(100+i, 150+float64(i%2*4-2))
+		if len(anomalies) > before {
+			lastAnomaly = i
+		}
+	}
+
+	// The shift itself is flagged, but within 20 samples the EWMA has
+	// settled on the new baseline and stops alerting.
+	assert.NotEmpty(t, anomalies)
+	assert.Equal(t, DetectorTypeEWMA, anomalies[0].DetectorType)
+	assert.Less(t, lastAnomaly, 20)
+	stats := ewma.ewmaStats[deviceID]["temperature"]
+	assert.InDelta(t, 150.0, stats.Mean, 2.0)
+
+	// The running Z-score mean is still far from the new baseline
+	zStats := zscore.deviceStats[deviceID].MetricStats["temperature"]
+	assert.Less(t, zStats.Mean, 115.0)
+}
+
+func TestEWMADetector_FlagsSpike(t *testing.T) {
+	var anomalies []*Anomaly
+	ewma := &EWMADetector{
+		AnomalyDetector: &AnomalyDetector{
+			logger:         slog.Default(),
+			alertThreshold: 3.0,
+			onAnomaly:      func(a *Anomaly) { anomalies = append(anomalies, a) },
+		},
+		Alpha:     0.2,
+		Beta:      0.2,
+		ewmaStats: make(map[string]map[string]*EWMAStats),
+	}
+
+	for i := 0; i < 30; i++ {
+		data, _ := proto.Marshal(&pb.Telemetry{
+			DeviceId: "spike-device",
+			Ts:       time.Now().UnixMilli(),
+			Metrics:  map[string]float64{"pressure": 100 + float64(i%2*4-2)},
+		})
+		assert.NoError(t, ewma.ProcessTelemetry(context.Background(), data))
+	}
+
+	data, _ := proto.Marshal(&pb.Telemetry{
+		DeviceId: "spike-device",
+		Ts:       time.Now().UnixMilli(),
+		Metrics:  map[string]float64{"pressure": 200},
+	})
+	assert.NoError(t, ewma.ProcessTelemetry(context.Background(), data))
+
+	assert.Len(t, anomalies, 1)
+	assert.Equal(t, DetectorTypeEWMA, anomalies[0].DetectorType)
+	assert.Equal(t, "high", anomalies[0].Severity)
+}
+
+func TestEWMADetector_ForgetsStaleDevices(t *testing.T) {
+	base := &AnomalyDetector{
+		logger:         slog.Default(),
+		deviceStats:    make(map[string]*DeviceStats),
+		alertThreshold: 3.0,
+		onAnomaly:      func(*Anomaly) {},
+	}
+	ewma := &EWMADetector{
+		AnomalyDetector: base,
+		Alpha:           0.2,
+		Beta:            0.2,
+		ewmaStats:       make(map[string]map[string]*EWMAStats),
+	}
+	base.staleForgetters = []staleForgetter{ewma}
+
+	now := time.Now()
+	send := func(deviceID string, ts time.Time) {
+		data, _ := proto.Marshal(&pb.Telemetry{
+			DeviceId: deviceID,
+			Ts:       ts.UnixMilli(),
+			Metrics:  map[string]float64{"temperature": 20},
+		})
+		assert.NoError(t, ewma.ProcessTelemetry(context.Background(), data))
+	}
+	send("stale-device", now.Add(-48*time.Hour))
+	send("recent-device", now)
+	send("forgotten-device", now)
+
+	base.cleanupStaleStats()
+	assert.NotContains(t, ewma.ewmaStats, "stale-device")
+	assert.Contains(t, ewma.ewmaStats, "recent-device")
+
+	ewma.Forget("forgotten-device")
+	assert.NotContains(t, ewma.ewmaStats, "forgotten-device")
+	assert.NotContains(t, ewma.lastUpdated, "forgotten-device")
+}
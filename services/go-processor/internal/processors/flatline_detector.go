@@ -0,0 +1,91 @@
+package processors
+
+import (
+	"math"
+	"sync"
+)
+
+const AlertTypeFlatline = "flatline"
+
+// flatlineState tracks the recent samples of one device metric.
+type flatlineState struct {
+	buffer  *sampleBuffer
+	last    float64
+	alerted bool // an anomaly was already reported for the current run
+}
+
+// FlatlineDetector flags sensors that report the same value for too long,
+// which usually means the sensor is stuck. A metric is flat when its last
+// WindowSize values all lie within Tolerance of each other.
+type FlatlineDetector struct {
+	WindowSize int
+	Tolerance  float64
+
+	states map[string]map[string]*flatlineState
+	mutex  sync.Mutex
+}
+
+func NewFlatlineDetector(windowSize int, tolerance float64) *FlatlineDetector {
+	return &FlatlineDetector{
+		WindowSize: windowSize,
+		Tolerance:  tolerance,
+		states:     make(map[string]map[string]*flatlineState),
+	}
+}
+
+// Check records a sample and returns an anomaly the first time a metric's
+// window fills with flat values. A value that moves more than Tolerance from
+// the previous one starts a new window.
+func (d *FlatlineDetector) Check(deviceID, metricName string, value float64, timestamp int64) *Anomaly {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.states[deviceID] == nil {
+		d.states[deviceID] = make(map[string]*flatlineState)
+	}
+	state, exists := d.states[deviceID][metricName]
+	if !exists {
+		state = &flatlineState{buffer: newSampleBuffer(d.WindowSize)}
+		d.states[deviceID][metricName] = state
+	}
+
+	if exists && math.Abs(value-state.last) > d.Tolerance {
+		state.buffer.reset()
+		state.alerted = false
+	}
+	state.buffer.add(value)
+	state.last = value
+
+	if state.alerted || !state.buffer.full {
+		return nil
+	}
+
+	low, high := state.buffer.values[0], state.buffer.values[0]
+	for _, v := range state.buffer.values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	if high-low > d.Tolerance {
+		return nil
+	}
+
+	state.alerted = true
+	return &Anomaly{
+		DeviceID:      deviceID,
+		Timestamp:     timestamp,
+		MetricName:    metricName,
+		Value:         value,
+		ExpectedRange: [2]float64{low, high},
+		Severity:      "medium",
+		DetectorType:  AlertTypeFlatline,
+		Threshold:     d.Tolerance,
+		AlertType:     AlertTypeFlatline,
+	}
+}
+
+// Forget drops the samples of a device.
+func (d *FlatlineDetector) Forget(deviceID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.states, deviceID)
+}
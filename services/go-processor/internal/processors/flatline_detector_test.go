@@ -0,0 +1,63 @@
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlatlineDetector_FlagsStuckSensor(t *testing.T) {
+	detector := NewFlatlineDetector(20, 0.001)
+
+	var anomalies []*Anomaly
+	for i := 0; i < 25; i++ {
+		if anomaly := detector.Check("device-1", "temperature", 21.5, int64(i*1000)); anomaly != nil {
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+
+	// Reported once, when the window first fills
+	assert.Len(t, anomalies, 1)
+	assert.Equal(t, AlertTypeFlatline, anomalies[0].AlertType)
+	assert.Equal(t, "medium", anomalies[0].Severity)
+	assert.Equal(t, int64(19000), anomalies[0].Timestamp)
+}
+
+func TestFlatlineDetector_IgnoresVaryingValues(t *testing.T) {
+	detector := NewFlatlineDetector(20, 0.001)
+
+	for i := 0; i < 25; i++ {
+		value := 21.5 + float64(i%2)*0.01
+		assert.Nil(t, detector.Check("device-1", "temperature", value, int64(i*1000)))
+	}
+}
+
+func TestFlatlineDetector_ResetsOnChange(t *testing.T) {
+	detector := NewFlatlineDetector(5, 0.001)
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, detector.Check("device-1", "temperature", 21.5, int64(i)))
+	}
+	// A genuine change starts a new window
+	assert.Nil(t, detector.Check("device-1", "temperature", 30, 4))
+	for i := 5; i < 8; i++ {
+		assert.Nil(t, detector.Check("device-1", "temperature", 30, int64(i)))
+	}
+	assert.NotNil(t, detector.Check("device-1", "temperature", 30, 8))
+
+	// After recovering, getting stuck again is reported again
+	assert.Nil(t, detector.Check("device-1", "temperature", 25, 9))
+	for i := 10; i < 13; i++ {
+		assert.Nil(t, detector.Check("device-1", "temperature", 25, int64(i)))
+	}
+	assert.NotNil(t, detector.Check("device-1", "temperature", 25, 13))
+}
+
+func TestFlatlineDetector_SlowDriftIsNotFlat(t *testing.T) {
+	detector := NewFlatlineDetector(20, 0.001)
+
+	// Each step is within tolerance but the window as a whole is not
+	for i := 0; i < 25; i++ {
+		assert.Nil(t, detector.Check("device-1", "temperature", 21.5+float64(i)*0.0009, int64(i)))
+	}
+}
@@ -0,0 +1,258 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"go-processor/internal/config"
+	"go-processor/internal/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	// FleetDeviceID stands in for the device ID of fleet aggregates.
+	FleetDeviceID = "fleet"
+
+	// fleetPublishInterval is how often the fleet aggregates are published.
+	fleetPublishInterval = time.Minute
+
+	// fleetStaleAfter is how long a device's latest minute aggregate counts
+	// towards the fleet aggregates. Minute aggregates are flushed a couple of
+	// minutes late, so it spans a few windows.
+	fleetStaleAfter = 5 * time.Minute
+)
+
+// fleetContribution is a device's latest minute mean of a metric.
+type fleetContribution struct {
+	value       float64
+	samples     int
+	windowStart int64
+	windowEnd   int64
+}
+
+// FleetAggregator combines the minute mean aggregates of every device into
+// fleet-wide mean, min and max aggregates of each metric, published every
+// minute. Each device counts once, with its latest aggregate, until it goes
+// quiet for fleetStaleAfter.
+type FleetAggregator struct {
+	producer messagePublisher
+	logger   *slog.Logger
+
+	// latest holds the latest contribution of each device to each metric,
+	// keyed by metric name and device ID.
+	mutex  sync.Mutex
+	latest map[string]map[string]fleetContribution
+
+	// now is replaced in tests
+	now func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewFleetAggregator(cfg *config.Config, logger *slog.Logger) (*FleetAggregator, error) {
+	producerOpts, err := kafka.ProducerOptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newFleetAggregator(kafka.NewProducer(cfg.Brokers, cfg.FleetAggregatesTopic, producerOpts), logger), nil
+}
+
+func newFleetAggregator(producer messagePublisher, logger *slog.Logger) *FleetAggregator {
+	return &FleetAggregator{
+		producer: producer,
+		logger:   loggerOrDefault(logger),
+		latest:   make(map[string]map[string]fleetContribution),
+		now:      time.Now,
+	}
+}
+
+// ProcessAggregate records a JSON-encoded minute aggregate as its device's
+// latest contribution to each of its metrics. Aggregates for functions other
+// than the mean, and aggregates older than the device's latest, are ignored.
+func (f *FleetAggregator) ProcessAggregate(data []byte) error {
+	var aggregate AggregateData
+	if err := json.Unmarshal(data, &aggregate); err != nil {
+		f.logger.Error("Failed to unmarshal aggregate", slog.Any("error", err))
+		return err
+	}
+
+	if aggregate.Function != "" && aggregate.Function != FunctionMean {
+		return nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for metricName, value := range aggregate.Metrics {
+		devices := f.latest[metricName]
+		if devices == nil {
+			devices = make(map[string]fleetContribution)
+			f.latest[metricName] = devices
+		}
+		if previous, ok := devices[aggregate.DeviceID]; ok && previous.windowStart > aggregate.WindowStart {
+			continue
+		}
+		devices[aggregate.DeviceID] = fleetContribution{
+			value:       value,
+			samples:     aggregate.Count,
+			windowStart: aggregate.WindowStart,
+			windowEnd:   aggregate.WindowEnd,
+		}
+	}
+
+	return nil
+}
+
+// Start launches the publishing goroutine, which runs until ctx is cancelled
+// or Stop is called.
+func (f *FleetAggregator) Start(ctx context.Context) {
+	ctx, f.cancel = context.WithCancel(ctx)
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+
+		ticker := time.NewTicker(fleetPublishInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f.publish(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the publishing goroutine and closes the producer.
+func (f *FleetAggregator) Stop() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.wg.Wait()
+	f.producer.Close()
+}
+
+// publish sends the current fleet aggregates.
+func (f *FleetAggregator) publish(ctx context.Context) {
+	for _, aggregate := range f.aggregates(f.now()) {
+		data, err := json.Marshal(aggregate)
+		if err != nil {
+			f.logger.Error("Failed to marshal fleet aggregate", slog.Any("error", err))
+			continue
+		}
+		if err := f.producer.SendMessageWithRetry(ctx, []byte(FleetDeviceID), data, producerMaxRetries, producerRetryBaseDelay); err != nil {
+			f.logger.Error("Failed to publish fleet aggregate",
+				slog.String("function", string(aggregate.Function)), slog.Any("error", err))
+		}
+	}
+}
+
+// aggregates returns the fleet mean, min and max aggregates of the devices
+// heard from within fleetStaleAfter of now, forgetting the others. The mean
+// is weighted by sample count. It returns nil when no device is current.
+func (f *FleetAggregator) aggregates(now time.Time) []*AggregateData {
+	cutoff := now.Add(-fleetStaleAfter).UnixMilli()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	mean := make(map[string]float64)
+	minimum := make(map[string]float64)
+	maximum := make(map[string]float64)
+	deviceSamples := make(map[string]int)
+	windowStart, windowEnd := int64(math.MaxInt64), int64(0)
+
+	for metricName, devices := range f.latest {
+		var weightedSum, weights float64
+		low, high := math.Inf(1), math.Inf(-1)
+		for deviceID, contribution := range devices {
+			if contribution.windowEnd < cutoff {
+				delete(devices, deviceID)
+				continue
+			}
+			// Aggregates without a count weigh as a single sample
+			weight := float64(max(contribution.samples, 1))
+			weightedSum += contribution.value * weight
+			weights += weight
+			low = math.Min(low, contribution.value)
+			high = math.Max(high, contribution.value)
+
+			// A device's messages usually carry all its metrics, so its
+			// busiest metric counts its messages
+			deviceSamples[deviceID] = max(deviceSamples[deviceID], contribution.samples)
+			windowStart = min(windowStart, contribution.windowStart)
+			windowEnd = max(windowEnd, contribution.windowEnd)
+		}
+		if len(devices) == 0 {
+			delete(f.latest, metricName)
+			continue
+		}
+		mean[metricName] = weightedSum / weights
+		minimum[metricName] = low
+		maximum[metricName] = high
+	}
+
+	if len(deviceSamples) == 0 {
+		return nil
+	}
+
+	var count int
+	for _, samples := range deviceSamples {
+		count += samples
+	}
+
+	aggregates := make([]*AggregateData, 0, 3)
+	for _, function := range []struct {
+		fn      Function
+		metrics map[string]float64
+	}{
+		{FunctionMean, mean},
+		{FunctionMin, minimum},
+		{FunctionMax, maximum},
+	} {
+		aggregates = append(aggregates, &AggregateData{
+			DeviceID:    FleetDeviceID,
+			Timestamp:   now.UnixMilli(),
+			WindowStart: windowStart,
+			WindowEnd:   windowEnd,
+			Function:    function.fn,
+			Metrics:     function.metrics,
+			Count:       count,
+			DeviceCount: len(deviceSamples),
+		})
+	}
+	return aggregates
+}
+
+func StartFleetAggregationLoop(ctx context.Context, reader *kafkago.Reader, fleet *FleetAggregator) {
+	logger := fleet.logger
+	logger.Info("Starting fleet aggregation loop")
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if isShutdown(ctx, err) {
+				logger.Info("Fleet aggregation loop stopped")
+				return
+			}
+			logger.Error("Error reading message", slog.Any("error", err))
+			continue
+		}
+
+		if err := fleet.ProcessAggregate(msg.Value); err != nil {
+			logger.Error("Error processing aggregate",
+				slog.Int("partition", msg.Partition),
+				slog.Int64("offset", msg.Offset),
+				slog.Any("error", err))
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func minuteAggregate(t *testing.T, deviceID string, windowStart time.Time, function Function, count int, metrics map[string]float64) []byte {
+	t.Helper()
+	data, err := json.Marshal(AggregateData{
+		DeviceID:    deviceID,
+		Timestamp:   windowStart.Add(30 * time.Second).UnixMilli(),
+		WindowStart: windowStart.UnixMilli(),
+		WindowEnd:   windowStart.Add(time.Minute).UnixMilli(),
+		Function:    function,
+		Metrics:     metrics,
+		Count:       count,
+	})
+	assert.NoError(t, err)
+	return data
+}
+
+func TestFleetAggregator_CombinesDevices(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := now.Add(-3 * time.Minute)
+	fleet := newFleetAggregator(&recordingPublisher{}, slog.Default())
+
+	for _, data := range [][]byte{
+		minuteAggregate(t, "device-1", window, FunctionMean, 10, map[string]float64{"temperature": 20, "humidity": 40}),
+		minuteAggregate(t, "device-2", window, FunctionMean, 30, map[string]float64{"temperature": 24}),
+		minuteAggregate(t, "device-3", window.Add(time.Minute), "", 20, map[string]float64{"temperature": 30}),
+		// Only means are combined
+		minuteAggregate(t, "device-1", window, FunctionMax, 10, map[string]float64{"temperature": 99}),
+	} {
+		assert.NoError(t, fleet.ProcessAggregate(data))
+	}
+
+	aggregates := fleet.aggregates(now)
+	if !assert.Len(t, aggregates, 3) {
+		return
+	}
+	for _, aggregate := range aggregates {
+		assert.Equal(t, FleetDeviceID, aggregate.DeviceID)
+		assert.Equal(t, 3, aggregate.DeviceCount)
+		assert.Equal(t, 60, aggregate.Count)
+		assert.Equal(t, window.UnixMilli(), aggregate.WindowStart)
+		assert.Equal(t, window.Add(2*time.Minute).UnixMilli(), aggregate.WindowEnd)
+		assert.Equal(t, now.UnixMilli(), aggregate.Timestamp)
+	}
+
+	assert.Equal(t, FunctionMean, aggregates[0].Function)
+	// (20×10 + 24×30 + 30×20) / 60
+	assert.InDelta(t, 25.3333, aggregates[0].Metrics["temperature"], 1e-4)
+	assert.Equal(t, 40.0, aggregates[0].Metrics["humidity"])
+
+	assert.Equal(t, FunctionMin, aggregates[1].Function)
+	assert.Equal(t, map[string]float64{"temperature": 20, "humidity": 40}, aggregates[1].Metrics)
+
+	assert.Equal(t, FunctionMax, aggregates[2].Function)
+	assert.Equal(t, map[string]float64{"temperature": 30, "humidity": 40}, aggregates[2].Metrics)
+}
+
+func TestFleetAggregator_KeepsLatestAggregatePerDevice(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fleet := newFleetAggregator(&recordingPublisher{}, slog.Default())
+
+	assert.NoError(t, fleet.ProcessAggregate(minuteAggregate(t, "device-1", now.Add(-2*time.Minute), FunctionMean, 10, map[string]float64{"temperature": 22})))
+	// A late aggregate for an earlier window doesn't replace it
+	assert.NoError(t, fleet.ProcessAggregate(minuteAggregate(t, "device-1", now.Add(-4*time.Minute), FunctionMean, 10, map[string]float64{"temperature": 10})))
+
+	aggregates := fleet.aggregates(now)
+	if assert.Len(t, aggregates, 3) {
+		assert.Equal(t, 1, aggregates[0].DeviceCount)
+		assert.Equal(t, 22.0, aggregates[0].Metrics["temperature"])
+	}
+}
+
+func TestFleetAggregator_ForgetsQuietDevices(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fleet := newFleetAggregator(&recordingPublisher{}, slog.Default())
+
+	assert.NoError(t, fleet.ProcessAggregate(minuteAggregate(t, "quiet", now.Add(-10*time.Minute), FunctionMean, 10, map[string]float64{"temperature": 50, "pressure": 1000})))
+	assert.NoError(t, fleet.ProcessAggregate(minuteAggregate(t, "active", now.Add(-2*time.Minute), FunctionMean, 10, map[string]float64{"temperature": 20})))
+
+	aggregates := fleet.aggregates(now)
+	if assert.Len(t, aggregates, 3) {
+		assert.Equal(t, 1, aggregates[0].DeviceCount)
+		assert.Equal(t, map[string]float64{"temperature": 20}, aggregates[0].Metrics)
+	}
+
+	assert.Nil(t, fleet.aggregates(now.Add(time.Hour)))
+	assert.Empty(t, fleet.latest)
+}
+
+func TestFleetAggregator_Publish(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	publisher := &recordingPublisher{}
+	fleet := newFleetAggregator(publisher, slog.Default())
+	fleet.now = func() time.Time { return now }
+
+	// Nothing to publish yet
+	fleet.publish(context.Background())
+	assert.Empty(t, publisher.values)
+
+	assert.NoError(t, fleet.ProcessAggregate(minuteAggregate(t, "device-1", now.Add(-2*time.Minute), FunctionMean, 10, map[string]float64{"temperature": 21.5})))
+	fleet.publish(context.Background())
+
+	assert.Equal(t, []string{FleetDeviceID, FleetDeviceID, FleetDeviceID}, publisher.keys)
+	var published AggregateData
+	assert.NoError(t, json.Unmarshal(publisher.values[0], &published))
+	assert.Equal(t, FunctionMean, published.Function)
+	assert.Equal(t, 1, published.DeviceCount)
+	assert.Equal(t, map[string]float64{"temperature": 21.5}, published.Metrics)
+}
+
+func TestFleetAggregator_RejectsMalformedAggregates(t *testing.T) {
+	fleet := newFleetAggregator(&recordingPublisher{}, slog.Default())
+	assert.Error(t, fleet.ProcessAggregate([]byte("not json")))
+}
@@ -0,0 +1,232 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-processor/internal/config"
+	"go-processor/internal/database"
+)
+
+const (
+	AlertTypeDataGap = "data_gap"
+
+	// gapResolvedBy is recorded as the resolver of data gap alerts closed
+	// when a device reports again.
+	gapResolvedBy = "gap_detector"
+)
+
+// gapStore is the subset of TimescaleDB used by GapDetector.
+type gapStore interface {
+	GetDevice(deviceID string) (*database.DeviceRecord, error)
+	GetActiveAlerts(deviceID string, limit int) ([]database.AlertRecord, error)
+	InsertAlert(alert database.AlertRecord) error
+	ResolveAlert(id int, resolvedBy string, notes string) error
+}
+
+// GapDetector raises a data_gap alert when a device goes more than
+// GapThresholdMultiplier times its expected reporting interval without
+// sending data, and resolves it when the device next reports. Unlike
+// OfflineDetector it works from messages seen by this process, so it reacts
+// within a few reporting intervals.
+type GapDetector struct {
+	db          gapStore
+	broadcaster alertBroadcaster
+	logger      *slog.Logger
+
+	// ReportingInterval is the expected interval of devices without their
+	// own ExpectedInterval. The check runs every ReportingInterval / 2.
+	ReportingInterval      time.Duration
+	GapThresholdMultiplier float64
+
+	lastSeen  map[string]time.Time
+	intervals map[string]time.Duration
+	// gaps holds the devices with an open data gap alert.
+	gaps  map[string]bool
+	mutex sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewGapDetector(cfg *config.Config, db *database.TimescaleDB, broadcaster alertBroadcaster, logger *slog.Logger) *GapDetector {
+	return newGapDetector(db, broadcaster, cfg.ReportingInterval, cfg.GapThresholdMultiplier, logger)
+}
+
+func newGapDetector(db gapStore, broadcaster alertBroadcaster, interval time.Duration, multiplier float64, logger *slog.Logger) *GapDetector {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if multiplier <= 1 {
+		multiplier = 10
+	}
+	return &GapDetector{
+		db:                     db,
+		broadcaster:            broadcaster,
+		logger:                 loggerOrDefault(logger),
+		ReportingInterval:      interval,
+		GapThresholdMultiplier: multiplier,
+		lastSeen:               make(map[string]time.Time),
+		intervals:              make(map[string]time.Duration),
+		gaps:                   make(map[string]bool),
+	}
+}
+
+// Start launches the check goroutine, which runs until ctx is cancelled or
+// Stop is called.
+func (d *GapDetector) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.ReportingInterval / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				d.check(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (d *GapDetector) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+}
+
+// RecordSeen notes that a device has just reported. The device's expected
+// interval is loaded on first sight, and an open data gap alert is resolved.
+func (d *GapDetector) RecordSeen(deviceID string) {
+	d.mutex.Lock()
+	_, known := d.lastSeen[deviceID]
+	d.lastSeen[deviceID] = time.Now()
+	inGap := d.gaps[deviceID]
+	delete(d.gaps, deviceID)
+	d.mutex.Unlock()
+
+	if !known {
+		d.loadInterval(deviceID)
+	}
+	if inGap {
+		if err := d.resolveGap(deviceID); err != nil {
+			d.logger.Error("Failed to resolve data gap alert",
+				slog.String("device_id", deviceID), slog.Any("error", err))
+		}
+	}
+}
+
+func (d *GapDetector) loadInterval(deviceID string) {
+	device, err := d.db.GetDevice(deviceID)
+	if err != nil {
+		if !errors.Is(err, database.ErrDeviceNotFound) {
+			d.logger.Warn("Failed to load device reporting interval",
+				slog.String("device_id", deviceID), slog.Any("error", err))
+		}
+		return
+	}
+	if device.ExpectedInterval > 0 {
+		d.mutex.Lock()
+		d.intervals[deviceID] = device.ExpectedInterval
+		d.mutex.Unlock()
+	}
+}
+
+// intervalFor returns the device's expected reporting interval. The caller
+// must hold d.mutex.
+func (d *GapDetector) intervalFor(deviceID string) time.Duration {
+	if interval, ok := d.intervals[deviceID]; ok {
+		return interval
+	}
+	return d.ReportingInterval
+}
+
+type dataGap struct {
+	deviceID string
+	lastSeen time.Time
+	interval time.Duration
+}
+
+// check raises an alert for every device whose silence has exceeded its gap
+// threshold since the previous check.
+func (d *GapDetector) check(now time.Time) {
+	var found []dataGap
+
+	d.mutex.Lock()
+	for deviceID, lastSeen := range d.lastSeen {
+		if d.gaps[deviceID] {
+			continue
+		}
+		interval := d.intervalFor(deviceID)
+		if now.Sub(lastSeen) > time.Duration(d.GapThresholdMultiplier*float64(interval)) {
+			d.gaps[deviceID] = true
+			found = append(found, dataGap{deviceID: deviceID, lastSeen: lastSeen, interval: interval})
+		}
+	}
+	d.mutex.Unlock()
+
+	for _, gap := range found {
+		if err := d.raiseGap(gap); err != nil {
+			d.logger.Error("Failed to raise data gap alert",
+				slog.String("device_id", gap.deviceID), slog.Any("error", err))
+
+			// Retry on the next check unless the device reported meanwhile
+			d.mutex.Lock()
+			if d.lastSeen[gap.deviceID].Equal(gap.lastSeen) {
+				delete(d.gaps, gap.deviceID)
+			}
+			d.mutex.Unlock()
+		}
+	}
+}
+
+func (d *GapDetector) raiseGap(gap dataGap) error {
+	alert := database.AlertRecord{
+		DeviceID:  gap.deviceID,
+		Timestamp: time.Now(),
+		AlertType: AlertTypeDataGap,
+		Severity:  "medium",
+		Threshold: d.GapThresholdMultiplier * gap.interval.Seconds(),
+		Status:    "open",
+		Message: fmt.Sprintf("No data since %s (expected every %s)",
+			gap.lastSeen.UTC().Format(time.RFC3339), gap.interval),
+	}
+
+	if err := d.db.InsertAlert(alert); err != nil {
+		return err
+	}
+	if d.broadcaster != nil {
+		d.broadcaster.BroadcastAlert(gap.deviceID, alert)
+	}
+
+	d.logger.Warn("Data gap detected",
+		slog.String("device_id", gap.deviceID),
+		slog.Duration("expected_interval", gap.interval))
+	return nil
+}
+
+func (d *GapDetector) resolveGap(deviceID string) error {
+	alerts, err := activeAlertsOfType(d.db, deviceID, AlertTypeDataGap)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		if err := d.db.ResolveAlert(alert.ID, gapResolvedBy, "Device reported again"); err != nil {
+			return err
+		}
+	}
+
+	d.logger.Info("Data gap closed", slog.String("device_id", deviceID))
+	return nil
+}
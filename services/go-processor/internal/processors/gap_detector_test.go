@@ -0,0 +1,69 @@
+package processors
+
+import (
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeGapStore struct {
+	fakeOfflineStore
+	devices map[string]database.DeviceRecord
+}
+
+func (s *fakeGapStore) GetDevice(deviceID string) (*database.DeviceRecord, error) {
+	device, ok := s.devices[deviceID]
+	if !ok {
+		return nil, fmt.Errorf("device %s: %w", deviceID, database.ErrDeviceNotFound)
+	}
+	return &device, nil
+}
+
+func TestGapDetector_AlertsAndResolves(t *testing.T) {
+	store := &fakeGapStore{}
+	detector := newGapDetector(store, nil, 10*time.Second, 3, slog.Default())
+
+	detector.RecordSeen("device-1")
+	seen := detector.lastSeen["device-1"]
+
+	// Within 3 intervals: no alert
+	detector.check(seen.Add(25 * time.Second))
+	assert.Empty(t, store.alerts)
+
+	detector.check(seen.Add(31 * time.Second))
+	if assert.Len(t, store.alerts, 1) {
+		assert.Equal(t, AlertTypeDataGap, store.alerts[0].AlertType)
+		assert.Equal(t, 30.0, store.alerts[0].Threshold)
+	}
+
+	// An ongoing gap is alerted once
+	detector.check(seen.Add(time.Minute))
+	assert.Len(t, store.alerts, 1)
+
+	detector.RecordSeen("device-1")
+	assert.Equal(t, []int{1}, store.resolved)
+}
+
+func TestGapDetector_UsesDeviceInterval(t *testing.T) {
+	store := &fakeGapStore{devices: map[string]database.DeviceRecord{
+		"device-1": {DeviceID: "device-1", ExpectedInterval: time.Minute},
+	}}
+	detector := newGapDetector(store, nil, 10*time.Second, 3, slog.Default())
+
+	detector.RecordSeen("device-1")
+	detector.RecordSeen("device-2")
+	seen := detector.lastSeen["device-1"]
+
+	detector.check(seen.Add(time.Minute))
+	if assert.Len(t, store.alerts, 1) {
+		assert.Equal(t, "device-2", store.alerts[0].DeviceID)
+	}
+
+	detector.check(seen.Add(4 * time.Minute))
+	assert.Len(t, store.alerts, 2)
+}
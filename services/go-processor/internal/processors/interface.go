@@ -0,0 +1,19 @@
+package processors
+
+import "context"
+
+// Processor consumes raw telemetry messages. Implementations are registered
+// with a ProcessorRegistry, which feeds them from the raw events source.
+type Processor interface {
+	// Name identifies the processor in logs and metrics.
+	Name() string
+	ProcessTelemetry(ctx context.Context, data []byte) error
+	Stop()
+}
+
+// TelemetryObserver is told about every telemetry message the Aggregator
+// processes, as it arrives, e.g. to aggregate it without waiting for the
+// window to be flushed.
+type TelemetryObserver interface {
+	ObserveTelemetry(deviceID string, metrics map[string]float64)
+}
@@ -0,0 +1,135 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+
+	"go-processor/internal/config"
+	"go-processor/internal/database"
+	"go-processor/internal/metrics"
+)
+
+// sampleBuffer is a fixed-size circular buffer of the most recent samples.
+type sampleBuffer struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newSampleBuffer(size int) *sampleBuffer {
+	return &sampleBuffer{values: make([]float64, 0, size)}
+}
+
+func (b *sampleBuffer) add(value float64) {
+	if !b.full {
+		b.values = append(b.values, value)
+		if len(b.values) == cap(b.values) {
+			b.full = true
+		}
+		return
+	}
+	b.values[b.next] = value
+	b.next = (b.next + 1) % len(b.values)
+}
+
+func (b *sampleBuffer) reset() {
+	b.values = b.values[:0]
+	b.next = 0
+	b.full = false
+}
+
+// IQRDetector flags values outside the Tukey fences Q1 - k*IQR and
+// Q3 + k*IQR computed over the last BufferSize samples. It makes no
+// assumption about the distribution, which suits skewed metrics such as
+// battery level better than the Z-score.
+type IQRDetector struct {
+	*AnomalyDetector
+
+	BufferSize    int
+	IQRMultiplier float64
+
+	buffers  map[string]map[string]*sampleBuffer
+	iqrMutex sync.Mutex
+}
+
+func NewIQRDetector(cfg *config.Config, db *database.TimescaleDB, logger *slog.Logger) (*IQRDetector, error) {
+	base, err := NewAnomalyDetector(cfg, db, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	detector := &IQRDetector{
+		AnomalyDetector: base,
+		BufferSize:      cfg.IQRBufferSize,
+		IQRMultiplier:   cfg.IQRMultiplier,
+		buffers:         make(map[string]map[string]*sampleBuffer),
+	}
+	if detector.BufferSize <= 0 {
+		detector.BufferSize = 100
+	}
+	if detector.IQRMultiplier <= 0 {
+		detector.IQRMultiplier = 1.5
+	}
+
+	return detector, nil
+}
+
+func (id *IQRDetector) ProcessTelemetry(ctx context.Context, data []byte) error {
+	telemetry, err := decodeTelemetry(id.Decoder, data)
+	if err != nil {
+		id.logger.Error("Failed to decode telemetry", slog.Any("error", err))
+		return err
+	}
+
+	metrics.MessagesProcessed.Inc()
+	id.runFixedChecks(telemetry)
+
+	deviceID := telemetry.DeviceId
+
+	id.iqrMutex.Lock()
+	defer id.iqrMutex.Unlock()
+
+	if id.buffers[deviceID] == nil {
+		id.buffers[deviceID] = make(map[string]*sampleBuffer)
+	}
+
+	for metricName, value := range telemetry.Metrics {
+		buffer, exists := id.buffers[deviceID][metricName]
+		if !exists {
+			buffer = newSampleBuffer(id.BufferSize)
+			id.buffers[deviceID][metricName] = buffer
+		}
+
+		// Need at least 10 samples for reliable detection
+		if len(buffer.values) >= 10 {
+			q1 := percentile(buffer.values, 25)
+			median := percentile(buffer.values, 50)
+			q3 := percentile(buffer.values, 75)
+			iqr := q3 - q1
+
+			lower := q1 - id.IQRMultiplier*iqr
+			upper := q3 + id.IQRMultiplier*iqr
+
+			if iqr > 0 && (value < lower || value > upper) {
+				score := (value - median) / iqr
+				id.reportAnomaly(&Anomaly{
+					DeviceID:      deviceID,
+					Timestamp:     telemetry.Ts,
+					MetricName:    metricName,
+					Value:         value,
+					ExpectedRange: [2]float64{lower, upper},
+					Severity:      id.calculateSeverity(math.Abs(score)),
+					ZScore:        score,
+					DetectorType:  DetectorTypeIQR,
+					Threshold:     id.IQRMultiplier,
+				})
+			}
+		}
+
+		buffer.add(value)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"testing"
+	"time"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestIQRDetector(anomalies *[]*Anomaly) *IQRDetector {
+	return &IQRDetector{
+		AnomalyDetector: &AnomalyDetector{
+			logger:         slog.Default(),
+			alertThreshold: 3.0,
+			onAnomaly:      func(a *Anomaly) { *anomalies = append(*anomalies, a) },
+		},
+		BufferSize:    100,
+		IQRMultiplier: 1.5,
+		buffers:       make(map[string]map[string]*sampleBuffer),
+	}
+}
+
+func sendIQRValue(t *testing.T, detector *IQRDetector, value float64) {
+	data, err := proto.Marshal(&pb.Telemetry{
+		DeviceId: "iqr-device",
+		Ts:       time.Now().UnixMilli(),
+		Metrics:  map[string]float64{"battery_level": value},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, detector.ProcessTelemetry(context.Background(), data))
+}
+
+func TestIQRDetector_NoFalsePositivesOnUniformData(t *testing.T) {
+	var anomalies []*Anomaly
+	detector := newTestIQRDetector(&anomalies)
+
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		sendIQRValue(t, detector, rng.Float64()*100)
+	}
+
+	assert.Empty(t, anomalies)
+}
+
+func TestIQRDetector_FlagsOutlier(t *testing.T) {
+	var anomalies []*Anomaly
+	detector := newTestIQRDetector(&anomalies)
+
+	// 1..100 gives Q1=25, median=50, Q3=75 and IQR=50
+	for i := 1; i <= 100; i++ {
+		sendIQRValue(t, detector, float64(i))
+	}
+	assert.Empty(t, anomalies)
+
+	// 3×IQR above the median lies beyond the upper fence of 75 + 1.5×50
+	sendIQRValue(t, detector, 50+3*50)
+
+	assert.Len(t, anomalies, 1)
+	assert.Equal(t, DetectorTypeIQR, anomalies[0].DetectorType)
+	assert.Equal(t, 200.0, anomalies[0].Value)
+	assert.Equal(t, [2]float64{-50, 150}, anomalies[0].ExpectedRange)
+	assert.InDelta(t, 3.0, anomalies[0].ZScore, 0.1)
+}
+
+func TestSampleBuffer_Wraps(t *testing.T) {
+	buffer := newSampleBuffer(3)
+	for i := 1; i <= 5; i++ {
+		buffer.add(float64(i))
+	}
+
+	assert.True(t, buffer.full)
+	assert.ElementsMatch(t, []float64{3, 4, 5}, buffer.values)
+}
@@ -0,0 +1,170 @@
+package processors
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+const (
+	AlertTypeMultivariate   = "multivariate"
+	DetectorTypeMahalanobis = "mahalanobis"
+)
+
+// observationWindow is a fixed-size circular buffer of the most recent
+// observation vectors.
+type observationWindow struct {
+	rows [][]float64
+	next int
+	size int
+}
+
+func (w *observationWindow) add(row []float64) {
+	if len(w.rows) < w.size {
+		w.rows = append(w.rows, row)
+		return
+	}
+	w.rows[w.next] = row
+	w.next = (w.next + 1) % w.size
+}
+
+// MahalanobisDetector flags observations whose combination of metrics is
+// unlikely given the metrics' recent joint distribution, such as a humidity
+// reading that is normal on its own but inconsistent with the temperature.
+// An observation is anomalous when its squared Mahalanobis distance exceeds
+// the chi-squared quantile for Significance.
+type MahalanobisDetector struct {
+	Metrics      []string
+	WindowSize   int
+	Significance float64
+
+	// threshold is the squared distance above which an observation is
+	// anomalous.
+	threshold float64
+
+	windows map[string]*observationWindow
+	mutex   sync.Mutex
+}
+
+func NewMahalanobisDetector(metrics []string, windowSize int, significance float64) *MahalanobisDetector {
+	if windowSize <= 0 {
+		windowSize = 100
+	}
+	if significance <= 0 || significance >= 1 {
+		significance = 0.001
+	}
+	chiSquared := distuv.ChiSquared{K: float64(len(metrics))}
+	return &MahalanobisDetector{
+		Metrics:      metrics,
+		WindowSize:   windowSize,
+		Significance: significance,
+		threshold:    chiSquared.Quantile(1 - significance),
+		windows:      make(map[string]*observationWindow),
+	}
+}
+
+// Check scores an observation against the device's window and then adds it
+// to the window. Observations missing any of the configured metrics are
+// ignored.
+func (d *MahalanobisDetector) Check(deviceID string, metrics map[string]float64, timestamp int64) *Anomaly {
+	observation := make([]float64, len(d.Metrics))
+	for i, name := range d.Metrics {
+		value, ok := metrics[name]
+		if !ok {
+			return nil
+		}
+		observation[i] = value
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	window, exists := d.windows[deviceID]
+	if !exists {
+		window = &observationWindow{size: d.WindowSize}
+		d.windows[deviceID] = window
+	}
+
+	var anomaly *Anomaly
+	// Need enough samples for a stable covariance estimate
+	if len(window.rows) >= max(10, 2*len(d.Metrics)) {
+		if distanceSq, ok := mahalanobisSq(window.rows, observation); ok && distanceSq > d.threshold {
+			severity := "medium"
+			if distanceSq >= 2*d.threshold {
+				severity = "high"
+			}
+			distance := math.Sqrt(distanceSq)
+			limit := math.Sqrt(d.threshold)
+			anomaly = &Anomaly{
+				DeviceID:      deviceID,
+				Timestamp:     timestamp,
+				MetricName:    strings.Join(d.Metrics, ","),
+				Value:         distance,
+				ExpectedRange: [2]float64{0, limit},
+				Severity:      severity,
+				ZScore:        distance,
+				DetectorType:  DetectorTypeMahalanobis,
+				Threshold:     limit,
+				AlertType:     AlertTypeMultivariate,
+			}
+		}
+	}
+
+	window.add(observation)
+	return anomaly
+}
+
+// Forget drops the observations of a device.
+func (d *MahalanobisDetector) Forget(deviceID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.windows, deviceID)
+}
+
+// mahalanobisSq returns the squared Mahalanobis distance of x from the
+// samples. The covariance is accumulated with Welford's method. It returns
+// false when the covariance is singular, e.g. when a metric is constant.
+func mahalanobisSq(samples [][]float64, x []float64) (float64, bool) {
+	dims := len(x)
+	mean := make([]float64, dims)
+	comoment := mat.NewDense(dims, dims, nil)
+	delta := make([]float64, dims)
+
+	for n, sample := range samples {
+		for i := range sample {
+			delta[i] = sample[i] - mean[i]
+			mean[i] += delta[i] / float64(n+1)
+		}
+		for i := range sample {
+			for j := range sample {
+				comoment.Set(i, j, comoment.At(i, j)+delta[i]*(sample[j]-mean[j]))
+			}
+		}
+	}
+
+	covariance := mat.NewSymDense(dims, nil)
+	for i := 0; i < dims; i++ {
+		for j := i; j < dims; j++ {
+			covariance.SetSym(i, j, (comoment.At(i, j)+comoment.At(j, i))/2/float64(len(samples)-1))
+		}
+	}
+
+	var chol mat.Cholesky
+	if !chol.Factorize(covariance) {
+		return 0, false
+	}
+	var inverse mat.SymDense
+	if err := chol.InverseTo(&inverse); err != nil {
+		return 0, false
+	}
+
+	diff := make([]float64, dims)
+	for i := range x {
+		diff[i] = x[i] - mean[i]
+	}
+	v := mat.NewVecDense(dims, diff)
+	return mat.Inner(v, &inverse, v), true
+}
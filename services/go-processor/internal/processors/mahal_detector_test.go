@@ -0,0 +1,53 @@
+package processors
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMahalanobisDetector_FlagsCorrelationBreak(t *testing.T) {
+	detector := NewMahalanobisDetector([]string{"temperature", "humidity"}, 200, 0.001)
+
+	// Humidity tracks temperature closely
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		temperature := 15 + 10*rng.Float64()
+		humidity := 2*temperature + rng.Float64() - 0.5
+		assert.Nil(t, detector.Check("device-1", map[string]float64{
+			"temperature": temperature,
+			"humidity":    humidity,
+		}, int64(i)))
+	}
+
+	// Consistent with the correlation
+	assert.Nil(t, detector.Check("device-1", map[string]float64{"temperature": 20, "humidity": 40}, 200))
+
+	// Both values lie within their own ranges, but not together
+	anomaly := detector.Check("device-1", map[string]float64{"temperature": 16, "humidity": 48}, 201)
+	if assert.NotNil(t, anomaly) {
+		assert.Equal(t, AlertTypeMultivariate, anomaly.AlertType)
+		assert.Equal(t, "temperature,humidity", anomaly.MetricName)
+		assert.Equal(t, "high", anomaly.Severity)
+		assert.Greater(t, anomaly.Value, anomaly.Threshold)
+	}
+}
+
+func TestMahalanobisDetector_IgnoresIncompleteObservations(t *testing.T) {
+	detector := NewMahalanobisDetector([]string{"temperature", "humidity"}, 50, 0.001)
+
+	for i := 0; i < 50; i++ {
+		detector.Check("device-1", map[string]float64{"temperature": 20}, int64(i))
+	}
+	assert.Empty(t, detector.windows)
+}
+
+func TestMahalanobisDetector_SkipsSingularCovariance(t *testing.T) {
+	detector := NewMahalanobisDetector([]string{"temperature", "humidity"}, 50, 0.001)
+
+	for i := 0; i < 50; i++ {
+		detector.Check("device-1", map[string]float64{"temperature": 20, "humidity": float64(i)}, int64(i))
+	}
+	assert.Nil(t, detector.Check("device-1", map[string]float64{"temperature": 30, "humidity": 10}, 50))
+}
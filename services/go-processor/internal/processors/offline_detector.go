@@ -0,0 +1,221 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-processor/internal/config"
+	"go-processor/internal/database"
+)
+
+const (
+	AlertTypeDeviceOffline = "device_offline"
+
+	// offlineResolvedBy is recorded as the resolver of offline alerts closed
+	// when a device reports again.
+	offlineResolvedBy = "offline_detector"
+
+	// maxActiveAlertsChecked bounds the active alerts fetched when looking
+	// for a device's open offline alert.
+	maxActiveAlertsChecked = 100
+)
+
+// offlineStore is the subset of TimescaleDB used by OfflineDetector.
+type offlineStore interface {
+	GetDevicesOfflineSince(threshold time.Duration) ([]database.DeviceRecord, error)
+	GetActiveAlerts(deviceID string, limit int) ([]database.AlertRecord, error)
+	InsertAlert(alert database.AlertRecord) error
+	ResolveAlert(id int, resolvedBy string, notes string) error
+}
+
+// alertBroadcaster pushes alerts to connected dashboards.
+type alertBroadcaster interface {
+	BroadcastAlert(deviceID string, alert interface{})
+}
+
+// OfflineDetector periodically raises a device_offline alert for every device
+// whose last_seen is older than Threshold, and resolves the alert once the
+// device reports again.
+type OfflineDetector struct {
+	db          offlineStore
+	broadcaster alertBroadcaster
+	logger      *slog.Logger
+	interval    time.Duration
+
+	// Threshold is how long a device may go without reporting before it is
+	// considered offline.
+	Threshold time.Duration
+
+	// offline holds the devices with an open offline alert. It is only used
+	// by the check goroutine.
+	offline map[string]bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewOfflineDetector(cfg *config.Config, db *database.TimescaleDB, broadcaster alertBroadcaster, logger *slog.Logger) *OfflineDetector {
+	return newOfflineDetector(db, broadcaster, cfg.OfflineCheckInterval, cfg.OfflineThreshold, logger)
+}
+
+func newOfflineDetector(db offlineStore, broadcaster alertBroadcaster, interval, threshold time.Duration, logger *slog.Logger) *OfflineDetector {
+	return &OfflineDetector{
+		db:          db,
+		broadcaster: broadcaster,
+		logger:      loggerOrDefault(logger),
+		interval:    interval,
+		Threshold:   threshold,
+		offline:     make(map[string]bool),
+	}
+}
+
+// Start launches the check goroutine. The first check runs one interval after
+// start, giving devices time to report after a processor restart. It runs
+// until ctx is cancelled or Stop is called.
+func (d *OfflineDetector) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.check(); err != nil {
+					d.logger.Warn("Failed to check for offline devices", slog.Any("error", err))
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (d *OfflineDetector) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+}
+
+// check alerts on newly offline devices and resolves the alerts of devices
+// that have reported since the previous check.
+func (d *OfflineDetector) check() error {
+	devices, err := d.db.GetDevicesOfflineSince(d.Threshold)
+	if err != nil {
+		return err
+	}
+
+	stillOffline := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		stillOffline[device.DeviceID] = true
+		if d.offline[device.DeviceID] {
+			continue
+		}
+		if err := d.markOffline(device); err != nil {
+			d.logger.Error("Failed to raise offline alert",
+				slog.String("device_id", device.DeviceID), slog.Any("error", err))
+			continue
+		}
+		d.offline[device.DeviceID] = true
+	}
+
+	for deviceID := range d.offline {
+		if stillOffline[deviceID] {
+			continue
+		}
+		if err := d.resolveOffline(deviceID); err != nil {
+			d.logger.Error("Failed to resolve offline alert",
+				slog.String("device_id", deviceID), slog.Any("error", err))
+			continue
+		}
+		delete(d.offline, deviceID)
+	}
+
+	return nil
+}
+
+func (d *OfflineDetector) markOffline(device database.DeviceRecord) error {
+	// An alert left open by a previous run still covers this outage
+	alerts, err := d.openOfflineAlerts(device.DeviceID)
+	if err != nil {
+		return err
+	}
+	if len(alerts) > 0 {
+		return nil
+	}
+
+	alert := database.AlertRecord{
+		DeviceID:  device.DeviceID,
+		Timestamp: time.Now(),
+		AlertType: AlertTypeDeviceOffline,
+		Severity:  "high",
+		Threshold: d.Threshold.Seconds(),
+		Status:    "open",
+		Message:   fmt.Sprintf("Device has not reported for more than %s", d.Threshold),
+	}
+	if device.LastSeen != nil {
+		alert.Message = fmt.Sprintf("Device has not reported since %s", device.LastSeen.UTC().Format(time.RFC3339))
+	}
+
+	if err := d.db.InsertAlert(alert); err != nil {
+		return err
+	}
+	if d.broadcaster != nil {
+		d.broadcaster.BroadcastAlert(device.DeviceID, alert)
+	}
+
+	d.logger.Warn("Device offline",
+		slog.String("device_id", device.DeviceID),
+		slog.Duration("threshold", d.Threshold))
+	return nil
+}
+
+func (d *OfflineDetector) resolveOffline(deviceID string) error {
+	alerts, err := d.openOfflineAlerts(deviceID)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		if err := d.db.ResolveAlert(alert.ID, offlineResolvedBy, "Device reported again"); err != nil {
+			return err
+		}
+	}
+
+	d.logger.Info("Device back online", slog.String("device_id", deviceID))
+	return nil
+}
+
+// openOfflineAlerts returns the device's open or acknowledged offline alerts.
+func (d *OfflineDetector) openOfflineAlerts(deviceID string) ([]database.AlertRecord, error) {
+	return activeAlertsOfType(d.db, deviceID, AlertTypeDeviceOffline)
+}
+
+// activeAlertStore looks up the open and acknowledged alerts of a device.
+type activeAlertStore interface {
+	GetActiveAlerts(deviceID string, limit int) ([]database.AlertRecord, error)
+}
+
+// activeAlertsOfType returns the device's open or acknowledged alerts of one
+// type.
+func activeAlertsOfType(db activeAlertStore, deviceID, alertType string) ([]database.AlertRecord, error) {
+	alerts, err := db.GetActiveAlerts(deviceID, maxActiveAlertsChecked)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []database.AlertRecord
+	for _, alert := range alerts {
+		if alert.AlertType == alertType {
+			matching = append(matching, alert)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,90 @@
+package processors
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOfflineStore struct {
+	offline  []database.DeviceRecord
+	alerts   []database.AlertRecord
+	resolved []int
+}
+
+func (s *fakeOfflineStore) GetDevicesOfflineSince(time.Duration) ([]database.DeviceRecord, error) {
+	return s.offline, nil
+}
+
+func (s *fakeOfflineStore) GetActiveAlerts(deviceID string, limit int) ([]database.AlertRecord, error) {
+	var active []database.AlertRecord
+	for _, alert := range s.alerts {
+		if alert.DeviceID == deviceID && alert.Status == "open" {
+			active = append(active, alert)
+		}
+	}
+	return active, nil
+}
+
+func (s *fakeOfflineStore) InsertAlert(alert database.AlertRecord) error {
+	alert.ID = len(s.alerts) + 1
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func (s *fakeOfflineStore) ResolveAlert(id int, resolvedBy string, notes string) error {
+	s.alerts[id-1].Status = "resolved"
+	s.resolved = append(s.resolved, id)
+	return nil
+}
+
+type recordingBroadcaster struct {
+	deviceIDs []string
+}
+
+func (b *recordingBroadcaster) BroadcastAlert(deviceID string, alert interface{}) {
+	b.deviceIDs = append(b.deviceIDs, deviceID)
+}
+
+func TestOfflineDetector_AlertsAndResolves(t *testing.T) {
+	store := &fakeOfflineStore{}
+	broadcaster := &recordingBroadcaster{}
+	detector := newOfflineDetector(store, broadcaster, time.Minute, 10*time.Minute, slog.Default())
+
+	lastSeen := time.Now().Add(-time.Hour)
+	store.offline = []database.DeviceRecord{{DeviceID: "device-1", LastSeen: &lastSeen}}
+
+	assert.NoError(t, detector.check())
+	assert.Len(t, store.alerts, 1)
+	assert.Equal(t, AlertTypeDeviceOffline, store.alerts[0].AlertType)
+	assert.Equal(t, "high", store.alerts[0].Severity)
+	assert.Equal(t, []string{"device-1"}, broadcaster.deviceIDs)
+
+	// Still offline: no duplicate alert
+	assert.NoError(t, detector.check())
+	assert.Len(t, store.alerts, 1)
+
+	// Reported again: the alert is resolved
+	store.offline = nil
+	assert.NoError(t, detector.check())
+	assert.Equal(t, []int{1}, store.resolved)
+	assert.Empty(t, detector.offline)
+}
+
+func TestOfflineDetector_AdoptsOpenAlertAfterRestart(t *testing.T) {
+	store := &fakeOfflineStore{
+		offline: []database.DeviceRecord{{DeviceID: "device-1"}},
+		alerts: []database.AlertRecord{
+			{ID: 1, DeviceID: "device-1", AlertType: AlertTypeDeviceOffline, Status: "open"},
+		},
+	}
+	detector := newOfflineDetector(store, nil, time.Minute, 10*time.Minute, slog.Default())
+
+	assert.NoError(t, detector.check())
+	assert.Len(t, store.alerts, 1)
+	assert.True(t, detector.offline["device-1"])
+}
@@ -0,0 +1,129 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"go-processor/internal/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// partitionProgress is the uncommitted messages of a partition.
+type partitionProgress struct {
+	// inFlight holds the offsets read but not yet committed, in read order,
+	// and done how many times each has completed.
+	inFlight []int64
+	done     map[int64]int
+
+	// failed is set once a message fails, after which nothing more is
+	// committed, so the failed message is redelivered after a restart.
+	failed bool
+}
+
+// offsetTracker commits the messages of a source that are processed out of
+// order, e.g. by a worker pool. A commit sets a partition's offset whether
+// or not it moves forward, so a message is committed only once every message
+// read before it on its partition has completed. Sources that need no
+// commits are left alone.
+type offsetTracker struct {
+	source kafka.MessageSource
+	logger *slog.Logger
+
+	// mutex also orders the commits of a partition
+	mutex      sync.Mutex
+	partitions map[topicPartition]*partitionProgress
+}
+
+func newOffsetTracker(source kafka.MessageSource, logger *slog.Logger) *offsetTracker {
+	if _, ok := source.(kafka.Committer); !ok {
+		return &offsetTracker{logger: logger}
+	}
+	return &offsetTracker{
+		source:     source,
+		logger:     logger,
+		partitions: make(map[topicPartition]*partitionProgress),
+	}
+}
+
+// Track records that msg was read. Call it in read order, before msg is
+// handed to a worker.
+func (t *offsetTracker) Track(msg kafkago.Message) {
+	if t.source == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := topicPartition{topic: msg.Topic, partition: msg.Partition}
+	progress := t.partitions[key]
+	if progress == nil {
+		progress = &partitionProgress{done: make(map[int64]int)}
+		t.partitions[key] = progress
+	}
+	if !progress.failed {
+		progress.inFlight = append(progress.inFlight, msg.Offset)
+	}
+}
+
+// Done records that msg was processed, and commits the highest offset of its
+// partition below which every message has completed.
+func (t *offsetTracker) Done(ctx context.Context, msg kafkago.Message) {
+	if t.source == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	progress := t.partitions[topicPartition{topic: msg.Topic, partition: msg.Partition}]
+	if progress == nil || progress.failed {
+		return
+	}
+	progress.done[msg.Offset]++
+
+	committed := int64(-1)
+	for len(progress.inFlight) > 0 && progress.done[progress.inFlight[0]] > 0 {
+		offset := progress.inFlight[0]
+		if progress.done[offset]--; progress.done[offset] == 0 {
+			delete(progress.done, offset)
+		}
+		progress.inFlight = progress.inFlight[1:]
+		committed = offset
+	}
+	if committed >= 0 {
+		commitMessage(ctx, t.logger, t.source, kafkago.Message{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    committed,
+		})
+	}
+}
+
+// Fail records that msg could not be processed. Its partition is committed
+// no further, so msg is redelivered after a restart.
+func (t *offsetTracker) Fail(msg kafkago.Message) {
+	if t.source == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	progress := t.partitions[topicPartition{topic: msg.Topic, partition: msg.Partition}]
+	if progress == nil || progress.failed {
+		return
+	}
+	progress.failed = true
+	progress.inFlight = nil
+	progress.done = nil
+
+	t.logger.Warn("Partition no longer committed until restart, so the failed message is redelivered",
+		slog.String("topic", msg.Topic),
+		slog.Int("partition", msg.Partition),
+		slog.Int64("offset", msg.Offset))
+}
@@ -0,0 +1,91 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func trackedMessages(t *testing.T, count int) ([]kafkago.Message, *memorySource, *offsetTracker) {
+	t.Helper()
+	messages := make([]kafkago.Message, count)
+	for i := range messages {
+		messages[i] = kafkago.Message{Offset: int64(i), Value: []byte{byte(i)}}
+	}
+	source := &memorySource{messages: messages}
+	offsets := newOffsetTracker(source, slog.Default())
+	for range messages {
+		msg, err := source.ReadKafkaMessage(context.Background())
+		assert.NoError(t, err)
+		offsets.Track(msg)
+	}
+	return messages, source, offsets
+}
+
+// restart returns the offset a consumer restarted after a crash reads first.
+func restart(t *testing.T, messages []kafkago.Message, source *memorySource) int64 {
+	t.Helper()
+	restarted := &memorySource{messages: messages, next: source.committed}
+	msg, err := restarted.ReadKafkaMessage(context.Background())
+	assert.NoError(t, err)
+	return msg.Offset
+}
+
+func TestOffsetTracker_LaterOffsetFinishesFirst(t *testing.T) {
+	ctx := context.Background()
+	messages, source, offsets := trackedMessages(t, 3)
+
+	// Offset 2 finishes while 0 and 1 are still being processed
+	offsets.Done(ctx, messages[2])
+	assert.Equal(t, int64(0), source.committed)
+	assert.Equal(t, int64(0), restart(t, messages, source))
+
+	offsets.Done(ctx, messages[0])
+	assert.Equal(t, int64(1), source.committed)
+
+	// A crash now redelivers offset 1, which has not finished
+	assert.Equal(t, int64(1), restart(t, messages, source))
+
+	offsets.Done(ctx, messages[1])
+	assert.Equal(t, int64(3), source.committed)
+}
+
+func TestOffsetTracker_FailedOffsetIsRedelivered(t *testing.T) {
+	ctx := context.Background()
+	messages, source, offsets := trackedMessages(t, 4)
+
+	offsets.Done(ctx, messages[0])
+	offsets.Fail(messages[1])
+	offsets.Done(ctx, messages[2])
+	offsets.Done(ctx, messages[3])
+
+	// Later successes don't commit past the failed message
+	assert.Equal(t, int64(1), source.committed)
+	assert.Equal(t, int64(1), restart(t, messages, source))
+
+	// Nor do messages read after the failure
+	source.messages = append(source.messages, kafkago.Message{Offset: 4})
+	msg, err := source.ReadKafkaMessage(ctx)
+	assert.NoError(t, err)
+	offsets.Track(msg)
+	offsets.Done(ctx, msg)
+	assert.Equal(t, int64(1), source.committed)
+}
+
+func TestOffsetTracker_Partitions(t *testing.T) {
+	ctx := context.Background()
+	source := &memorySource{}
+	offsets := newOffsetTracker(source, slog.Default())
+
+	first := kafkago.Message{Partition: 0, Offset: 7}
+	second := kafkago.Message{Partition: 1, Offset: 3}
+	offsets.Track(first)
+	offsets.Track(second)
+
+	// A message of another partition doesn't wait for partition 0
+	offsets.Done(ctx, second)
+	assert.Equal(t, int64(4), source.committed)
+}
@@ -0,0 +1,141 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go-processor/internal/kafka"
+	"go-processor/internal/metrics"
+)
+
+// LoopFunc consumes source until ctx is cancelled.
+type LoopFunc func(ctx context.Context, source kafka.MessageSource)
+
+// SourceFactory creates the raw events source read by the named processor.
+type SourceFactory func(processor string) (kafka.MessageSource, error)
+
+type registeredProcessor struct {
+	processor Processor
+	loop      LoopFunc
+}
+
+// ProcessorRegistry runs the registered processors, each in its own loop
+// over its own raw events source.
+type ProcessorRegistry struct {
+	logger     *slog.Logger
+	processors []registeredProcessor
+	mutex      sync.Mutex
+	wg         sync.WaitGroup
+}
+
+func NewProcessorRegistry(logger *slog.Logger) *ProcessorRegistry {
+	return &ProcessorRegistry{logger: loggerOrDefault(logger)}
+}
+
+// RegisterProcessor adds a processor fed by the registry's dispatch loop,
+// which passes every message to ProcessTelemetry and commits it on success.
+// After a failure the loop commits nothing more, so the failed message is
+// redelivered after a restart.
+func (r *ProcessorRegistry) RegisterProcessor(p Processor) {
+	r.RegisterProcessorLoop(p, func(ctx context.Context, source kafka.MessageSource) {
+		r.dispatchLoop(ctx, source, p)
+	})
+}
+
+// RegisterProcessorLoop adds a processor that consumes the source with its
+// own loop, for processors that do more per message than ProcessTelemetry.
+func (r *ProcessorRegistry) RegisterProcessorLoop(p Processor, loop LoopFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.processors = append(r.processors, registeredProcessor{processor: p, loop: loop})
+}
+
+// Processors returns the registered processors in registration order.
+func (r *ProcessorRegistry) Processors() []Processor {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	processors := make([]Processor, len(r.processors))
+	for i, rp := range r.processors {
+		processors[i] = rp.processor
+	}
+	return processors
+}
+
+// Start creates a source for every registered processor and launches the
+// processor's loop over it. Every processor receives every message and
+// commits only its own progress. The loops run until ctx is cancelled, and
+// each source is closed once its loop returns.
+func (r *ProcessorRegistry) Start(ctx context.Context, newSource SourceFactory) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sources := make([]kafka.MessageSource, 0, len(r.processors))
+	for _, rp := range r.processors {
+		source, err := newSource(rp.processor.Name())
+		if err != nil {
+			for _, source := range sources {
+				source.Close()
+			}
+			return fmt.Errorf("failed to create source for processor %s: %w", rp.processor.Name(), err)
+		}
+		sources = append(sources, source)
+	}
+
+	for i, rp := range r.processors {
+		r.wg.Add(1)
+		go func(rp registeredProcessor, source kafka.MessageSource) {
+			defer r.wg.Done()
+			defer source.Close()
+			r.logger.Info("Starting processor", slog.String("processor", rp.processor.Name()))
+			rp.loop(ctx, source)
+		}(rp, sources[i])
+	}
+	return nil
+}
+
+// Stop waits for the loops to return, then stops the processors in reverse
+// registration order. Cancel the context passed to Start first.
+func (r *ProcessorRegistry) Stop() {
+	r.wg.Wait()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := len(r.processors) - 1; i >= 0; i-- {
+		r.processors[i].processor.Stop()
+	}
+}
+
+func (r *ProcessorRegistry) dispatchLoop(ctx context.Context, source kafka.MessageSource, p Processor) {
+	logger := r.logger.With(slog.String("processor", p.Name()))
+	offsets := newOffsetTracker(source, logger)
+
+	for {
+		msg, err := kafka.NextMessage(ctx, source)
+		if err != nil {
+			if isShutdown(ctx, err) {
+				logger.Info("Processor loop stopped")
+				return
+			}
+			logger.Error("Error reading message", slog.Any("error", err))
+			continue
+		}
+		offsets.Track(msg)
+
+		start := time.Now()
+		err = p.ProcessTelemetry(ctx, msg.Value)
+		metrics.ObserveProcessing(p.Name(), start, err)
+		if err != nil {
+			logger.Error("Error processing telemetry",
+				slog.Int("partition", msg.Partition),
+				slog.Int64("offset", msg.Offset),
+				slog.Any("error", err))
+			offsets.Fail(msg)
+			continue
+		}
+		offsets.Done(ctx, msg)
+	}
+}
@@ -0,0 +1,164 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-processor/internal/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockProcessor struct {
+	name    string
+	stopped *[]string
+
+	mu       sync.Mutex
+	received []string
+}
+
+func (p *mockProcessor) Name() string { return p.name }
+
+func (p *mockProcessor) ProcessTelemetry(ctx context.Context, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.received = append(p.received, string(data))
+	if string(data) == "bad" {
+		return errors.New("bad payload")
+	}
+	return nil
+}
+
+func (p *mockProcessor) Received() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.received...)
+}
+
+func (p *mockProcessor) Stop() {
+	*p.stopped = append(*p.stopped, p.name)
+}
+
+// sourcesByName returns a SourceFactory serving each processor its source.
+func sourcesByName(sources map[string]*memorySource) SourceFactory {
+	return func(processor string) (kafka.MessageSource, error) {
+		source, ok := sources[processor]
+		if !ok {
+			return nil, errors.New("no source")
+		}
+		return source, nil
+	}
+}
+
+func TestProcessorRegistry_Dispatch(t *testing.T) {
+	var stopped []string
+	processor := &mockProcessor{name: "mock", stopped: &stopped}
+	source := &memorySource{messages: []kafkago.Message{
+		{Offset: 0, Value: []byte("good")},
+		{Offset: 1, Value: []byte("bad")},
+	}}
+
+	registry := NewProcessorRegistry(nil)
+	registry.RegisterProcessor(processor)
+	assert.Equal(t, []Processor{processor}, registry.Processors())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, registry.Start(ctx, sourcesByName(map[string]*memorySource{"mock": source})))
+
+	assert.Eventually(t, func() bool {
+		return len(processor.Received()) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	registry.Stop()
+
+	assert.Equal(t, []string{"good", "bad"}, processor.Received())
+	assert.Equal(t, []string{"mock"}, stopped)
+
+	// The failed message is left uncommitted
+	assert.Equal(t, int64(1), source.committed)
+	assert.True(t, source.closed)
+}
+
+func TestProcessorRegistry_EveryProcessorReceivesEveryMessage(t *testing.T) {
+	var stopped []string
+	first := &mockProcessor{name: "first", stopped: &stopped}
+	second := &mockProcessor{name: "second", stopped: &stopped}
+
+	messages := []kafkago.Message{
+		{Offset: 0, Value: []byte("one")},
+		{Offset: 1, Value: []byte("bad")},
+		{Offset: 2, Value: []byte("three")},
+	}
+	sources := map[string]*memorySource{
+		"first":  {messages: messages},
+		"second": {messages: messages},
+	}
+
+	registry := NewProcessorRegistry(nil)
+	registry.RegisterProcessor(first)
+	registry.RegisterProcessor(second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, registry.Start(ctx, sourcesByName(sources)))
+
+	assert.Eventually(t, func() bool {
+		return len(first.Received()) == 3 && len(second.Received()) == 3
+	}, time.Second, time.Millisecond)
+	cancel()
+	registry.Stop()
+
+	assert.Equal(t, []string{"one", "bad", "three"}, first.Received())
+	assert.Equal(t, []string{"one", "bad", "three"}, second.Received())
+
+	// Each processor commits its own progress, up to the failed message
+	assert.Equal(t, int64(1), sources["first"].committed)
+	assert.Equal(t, int64(1), sources["second"].committed)
+}
+
+func TestProcessorRegistry_SourceError(t *testing.T) {
+	var stopped []string
+	source := &memorySource{}
+
+	registry := NewProcessorRegistry(nil)
+	registry.RegisterProcessor(&mockProcessor{name: "first", stopped: &stopped})
+	registry.RegisterProcessor(&mockProcessor{name: "second", stopped: &stopped})
+
+	err := registry.Start(context.Background(), sourcesByName(map[string]*memorySource{"first": source}))
+	assert.ErrorContains(t, err, "processor second")
+
+	// Sources already created are closed
+	assert.True(t, source.closed)
+}
+
+func TestProcessorRegistry_CustomLoop(t *testing.T) {
+	var stopped []string
+	first := &mockProcessor{name: "first", stopped: &stopped}
+	second := &mockProcessor{name: "second", stopped: &stopped}
+
+	registry := NewProcessorRegistry(nil)
+	registry.RegisterProcessor(first)
+
+	loopSource := make(chan kafka.MessageSource, 1)
+	registry.RegisterProcessorLoop(second, func(ctx context.Context, source kafka.MessageSource) {
+		loopSource <- source
+		<-ctx.Done()
+	})
+
+	source := &memorySource{}
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, registry.Start(ctx, sourcesByName(map[string]*memorySource{
+		"first":  {},
+		"second": source,
+	})))
+	assert.Equal(t, kafka.MessageSource(source), <-loopSource)
+
+	cancel()
+	registry.Stop()
+
+	// Processors stop in reverse registration order
+	assert.Equal(t, []string{"second", "first"}, stopped)
+}
@@ -0,0 +1,32 @@
+package processors
+
+// LinearRegression fits the line y = slope*x + intercept to the points by
+// least squares. With fewer than two distinct xs the line is flat through
+// the mean of ys.
+func LinearRegression(xs, ys []float64) (slope, intercept float64) {
+	n := float64(len(xs))
+	if n == 0 {
+		return 0, 0
+	}
+
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	// Centring on the means keeps large xs, such as timestamps, accurate
+	var covariance, variance float64
+	for i := range xs {
+		dx := xs[i] - meanX
+		covariance += dx * (ys[i] - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return 0, meanY
+	}
+
+	slope = covariance / variance
+	return slope, meanY - slope*meanX
+}
@@ -0,0 +1,35 @@
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinearRegression(t *testing.T) {
+	// y = -1.5x + 90 exactly
+	slope, intercept := LinearRegression([]float64{0, 1, 2, 3, 4}, []float64{90, 88.5, 87, 85.5, 84})
+	assert.InDelta(t, -1.5, slope, 1e-9)
+	assert.InDelta(t, 90, intercept, 1e-9)
+
+	// Noise around y = 2x + 1 averages out
+	slope, intercept = LinearRegression([]float64{0, 1, 2, 3}, []float64{1.5, 2.5, 5.5, 6.5})
+	assert.InDelta(t, 1.8, slope, 1e-9)
+	assert.InDelta(t, 1.3, intercept, 1e-9)
+
+	// Large xs such as Unix timestamps don't lose precision
+	slope, intercept = LinearRegression([]float64{1.7e9, 1.7e9 + 3600, 1.7e9 + 7200}, []float64{50, 49, 48})
+	assert.InDelta(t, -1.0/3600, slope, 1e-12)
+	assert.InDelta(t, 50, slope*1.7e9+intercept, 1e-6)
+}
+
+func TestLinearRegression_Degenerate(t *testing.T) {
+	slope, intercept := LinearRegression(nil, nil)
+	assert.Equal(t, 0.0, slope)
+	assert.Equal(t, 0.0, intercept)
+
+	// A single x has no slope
+	slope, intercept = LinearRegression([]float64{5, 5, 5}, []float64{10, 20, 30})
+	assert.Equal(t, 0.0, slope)
+	assert.Equal(t, 20.0, intercept)
+}
@@ -0,0 +1,95 @@
+package processors
+
+import (
+	"math"
+	"sync"
+)
+
+const AlertTypeRateOfChange = "rate_of_change"
+
+// prevSample is the last value seen for a device metric.
+type prevSample struct {
+	Value     float64
+	Timestamp int64 // epoch ms
+}
+
+// RateOfChangeDetector flags metrics that change faster than physically
+// plausible, such as a temperature jumping 10°C in a second, which usually
+// indicates a sensor fault even when both readings are in the normal range.
+type RateOfChangeDetector struct {
+	// MaxRateOfChange is the largest allowed change per second for each
+	// metric. Metrics without an entry are not checked.
+	MaxRateOfChange map[string]float64
+
+	previous map[string]map[string]prevSample
+	mutex    sync.Mutex
+}
+
+func NewRateOfChangeDetector(maxRateOfChange map[string]float64) *RateOfChangeDetector {
+	return &RateOfChangeDetector{
+		MaxRateOfChange: maxRateOfChange,
+		previous:        make(map[string]map[string]prevSample),
+	}
+}
+
+// Check records a sample and returns an anomaly if the metric changed faster
+// than its MaxRateOfChange since the previous sample. Samples that are not
+// newer than the previous one are ignored.
+func (d *RateOfChangeDetector) Check(deviceID, metricName string, value float64, timestamp int64) *Anomaly {
+	maxRate, ok := d.MaxRateOfChange[metricName]
+	if !ok {
+		return nil
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.previous[deviceID] == nil {
+		d.previous[deviceID] = make(map[string]prevSample)
+	}
+	prev, seen := d.previous[deviceID][metricName]
+	if seen && timestamp <= prev.Timestamp {
+		return nil
+	}
+	d.previous[deviceID][metricName] = prevSample{Value: value, Timestamp: timestamp}
+	if !seen {
+		return nil
+	}
+
+	elapsedSeconds := float64(timestamp-prev.Timestamp) / 1000
+	rate := (value - prev.Value) / elapsedSeconds
+	if math.Abs(rate) <= maxRate {
+		return nil
+	}
+
+	allowed := maxRate * elapsedSeconds
+	return &Anomaly{
+		DeviceID:      deviceID,
+		Timestamp:     timestamp,
+		MetricName:    metricName,
+		Value:         value,
+		ExpectedRange: [2]float64{prev.Value - allowed, prev.Value + allowed},
+		Severity:      rateOfChangeSeverity(math.Abs(rate) / maxRate),
+		DetectorType:  AlertTypeRateOfChange,
+		Threshold:     maxRate,
+		AlertType:     AlertTypeRateOfChange,
+	}
+}
+
+// Forget drops the samples of a device.
+func (d *RateOfChangeDetector) Forget(deviceID string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.previous, deviceID)
+}
+
+// rateOfChangeSeverity grades an anomaly by how many times the allowed rate
+// was exceeded.
+func rateOfChangeSeverity(ratio float64) string {
+	if ratio >= 5 {
+		return "high"
+	} else if ratio >= 2 {
+		return "medium"
+	}
+	return "low"
+}
@@ -0,0 +1,69 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRateOfChangeDetector_FlagsFastChange(t *testing.T) {
+	detector := NewRateOfChangeDetector(map[string]float64{"temperature": 10})
+
+	assert.Nil(t, detector.Check("device-1", "temperature", 20, 1000))
+
+	// 100 units in 1 second against a limit of 10 units/second
+	anomaly := detector.Check("device-1", "temperature", 120, 2000)
+	assert.NotNil(t, anomaly)
+	assert.Equal(t, AlertTypeRateOfChange, anomaly.AlertType)
+	assert.Equal(t, 10.0, anomaly.Threshold)
+	assert.Equal(t, [2]float64{10, 30}, anomaly.ExpectedRange)
+	assert.Equal(t, "high", anomaly.Severity)
+
+	// Drops are as suspicious as jumps
+	assert.NotNil(t, detector.Check("device-1", "temperature", 20, 3000))
+}
+
+func TestRateOfChangeDetector_AllowsGradualChange(t *testing.T) {
+	detector := NewRateOfChangeDetector(map[string]float64{"temperature": 10})
+
+	assert.Nil(t, detector.Check("device-1", "temperature", 20, 1000))
+	// 100 units over 20 seconds is 5 units/second
+	assert.Nil(t, detector.Check("device-1", "temperature", 120, 21000))
+
+	// Out-of-order and duplicate samples are ignored
+	assert.Nil(t, detector.Check("device-1", "temperature", 500, 21000))
+	assert.Nil(t, detector.Check("device-1", "temperature", 500, 15000))
+
+	// Metrics without a limit are not tracked
+	assert.Nil(t, detector.Check("device-1", "humidity", 0, 1000))
+	assert.Nil(t, detector.Check("device-1", "humidity", 1000, 2000))
+	assert.NotContains(t, detector.previous["device-1"], "humidity")
+}
+
+func TestAnomalyDetector_ReportsRateOfChange(t *testing.T) {
+	var anomalies []*Anomaly
+	detector := &AnomalyDetector{
+		logger:       slog.Default(),
+		deviceStats:  make(map[string]*DeviceStats),
+		RateOfChange: NewRateOfChangeDetector(map[string]float64{"temperature": 10}),
+		onAnomaly:    func(a *Anomaly) { anomalies = append(anomalies, a) },
+	}
+
+	for i, value := range []float64{20, 120} {
+		data, err := proto.Marshal(&pb.Telemetry{
+			DeviceId: "device-1",
+			Ts:       int64(1000 * (i + 1)),
+			Metrics:  map[string]float64{"temperature": value},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, detector.ProcessTelemetry(context.Background(), data))
+	}
+
+	assert.Len(t, anomalies, 1)
+	assert.Equal(t, AlertTypeRateOfChange, anomalies[0].AlertType)
+}
@@ -0,0 +1,240 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"go-processor/internal/config"
+	"go-processor/internal/database"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// rollupGracePeriod is how long a bucket stays open after its end so that
+// minute aggregates, which are flushed a few minutes late, still land in it.
+const rollupGracePeriod = 5 * time.Minute
+
+type rollupStats struct {
+	Sum   float64
+	Min   float64
+	Max   float64
+	Count int
+}
+
+type rollupBucket struct {
+	DeviceID    string
+	BucketStart int64
+	BucketEnd   int64
+	Metrics     map[string]*rollupStats
+}
+
+// rollupLevel describes one rollup resolution (hourly, daily) and where its
+// results are written.
+type rollupLevel struct {
+	name    string
+	size    time.Duration
+	buckets map[string]map[int64]*rollupBucket
+	insert  func(database.RollupRecord) error
+}
+
+// RollupProcessor folds per-minute mean aggregates into hourly and daily
+// buckets, computing the mean, min and max of the minute means.
+type RollupProcessor struct {
+	db          *database.TimescaleDB
+	logger      *slog.Logger
+	levels      []*rollupLevel
+	mutex       sync.Mutex
+	ticker      *time.Ticker
+	stopChannel chan bool
+}
+
+func NewRollupProcessor(cfg *config.Config, db *database.TimescaleDB, logger *slog.Logger) (*RollupProcessor, error) {
+	rollup := newRollupProcessor(db, logger)
+	rollup.ticker = time.NewTicker(time.Minute)
+
+	// Start background rollup flush
+	go rollup.flushLoop()
+
+	return rollup, nil
+}
+
+func newRollupProcessor(db *database.TimescaleDB, logger *slog.Logger) *RollupProcessor {
+	rollup := &RollupProcessor{
+		db:          db,
+		logger:      loggerOrDefault(logger),
+		stopChannel: make(chan bool),
+	}
+
+	rollup.levels = []*rollupLevel{
+		{
+			name:    "hourly",
+			size:    time.Hour,
+			buckets: make(map[string]map[int64]*rollupBucket),
+			insert: func(record database.RollupRecord) error {
+				return rollup.db.InsertHourlyAggregate(record)
+			},
+		},
+		{
+			name:    "daily",
+			size:    24 * time.Hour,
+			buckets: make(map[string]map[int64]*rollupBucket),
+			insert: func(record database.RollupRecord) error {
+				return rollup.db.InsertDailyAggregate(record)
+			},
+		},
+	}
+
+	return rollup
+}
+
+func (r *RollupProcessor) flushLoop() {
+	for {
+		select {
+		case <-r.ticker.C:
+			r.flushBuckets(time.Now())
+		case <-r.stopChannel:
+			return
+		}
+	}
+}
+
+// ProcessAggregate adds a JSON-encoded minute aggregate to the hourly and
+// daily buckets it falls into. Aggregates for functions other than the mean
+// are ignored.
+func (r *RollupProcessor) ProcessAggregate(data []byte) error {
+	var aggregate AggregateData
+	if err := json.Unmarshal(data, &aggregate); err != nil {
+		r.logger.Error("Failed to unmarshal aggregate", slog.Any("error", err))
+		return err
+	}
+
+	if aggregate.Function != "" && aggregate.Function != FunctionMean {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, level := range r.levels {
+		sizeMs := level.size.Milliseconds()
+		bucketStart := (aggregate.WindowStart / sizeMs) * sizeMs
+
+		if level.buckets[aggregate.DeviceID] == nil {
+			level.buckets[aggregate.DeviceID] = make(map[int64]*rollupBucket)
+		}
+
+		bucket, exists := level.buckets[aggregate.DeviceID][bucketStart]
+		if !exists {
+			bucket = &rollupBucket{
+				DeviceID:    aggregate.DeviceID,
+				BucketStart: bucketStart,
+				BucketEnd:   bucketStart + sizeMs,
+				Metrics:     make(map[string]*rollupStats),
+			}
+			level.buckets[aggregate.DeviceID][bucketStart] = bucket
+		}
+
+		for metricName, value := range aggregate.Metrics {
+			stats, exists := bucket.Metrics[metricName]
+			if !exists {
+				stats = &rollupStats{Min: math.Inf(1), Max: math.Inf(-1)}
+				bucket.Metrics[metricName] = stats
+			}
+			stats.Sum += value
+			stats.Count++
+			stats.Min = math.Min(stats.Min, value)
+			stats.Max = math.Max(stats.Max, value)
+		}
+	}
+
+	return nil
+}
+
+func (r *RollupProcessor) flushBuckets(now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cutoffTime := now.Add(-rollupGracePeriod).UnixMilli()
+
+	for _, level := range r.levels {
+		for deviceID, buckets := range level.buckets {
+			for bucketStart, bucket := range buckets {
+				if bucket.BucketEnd >= cutoffTime {
+					continue
+				}
+
+				for _, record := range bucket.records() {
+					if err := level.insert(record); err != nil {
+						r.logger.Error("Failed to save rollup to database",
+							slog.String("level", level.name),
+							slog.String("device_id", deviceID),
+							slog.Any("error", err))
+					}
+				}
+				r.logger.Info("Flushed rollup",
+					slog.String("level", level.name),
+					slog.String("device_id", deviceID),
+					slog.String("bucket", generateWindowKey(bucket.BucketStart, bucket.BucketEnd)))
+
+				delete(buckets, bucketStart)
+			}
+
+			if len(buckets) == 0 {
+				delete(level.buckets, deviceID)
+			}
+		}
+	}
+}
+
+func (b *rollupBucket) records() []database.RollupRecord {
+	records := make([]database.RollupRecord, 0, len(b.Metrics))
+	for metricName, stats := range b.Metrics {
+		records = append(records, database.RollupRecord{
+			DeviceID:    b.DeviceID,
+			BucketStart: time.UnixMilli(b.BucketStart),
+			BucketEnd:   time.UnixMilli(b.BucketEnd),
+			MetricName:  metricName,
+			MeanValue:   stats.Sum / float64(stats.Count),
+			MinValue:    stats.Min,
+			MaxValue:    stats.Max,
+			SampleCount: stats.Count,
+		})
+	}
+	return records
+}
+
+func (r *RollupProcessor) Stop() {
+	r.stopChannel <- true
+	r.ticker.Stop()
+}
+
+func StartRollupLoop(ctx context.Context, reader *kafkago.Reader, cfg *config.Config, rollup *RollupProcessor) {
+	logger := rollup.logger
+	logger.Info("Starting rollup loop")
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if isShutdown(ctx, err) {
+				logger.Info("Rollup loop stopped")
+				return
+			}
+			logger.Error("Error reading message", slog.Any("error", err))
+			continue
+		}
+
+		if err := rollup.ProcessAggregate(msg.Value); err != nil {
+			logger.Error("Error processing aggregate",
+				slog.Int("partition", msg.Partition),
+				slog.Int64("offset", msg.Offset),
+				slog.Any("error", err))
+		}
+
+		logger.Debug("Processed rollup message",
+			slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+	}
+}
@@ -0,0 +1,68 @@
+package processors
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupProcessor_ProcessAggregate(t *testing.T) {
+	rollup := newRollupProcessor(nil, slog.Default())
+
+	var hourly, daily []database.RollupRecord
+	rollup.levels[0].insert = func(record database.RollupRecord) error {
+		hourly = append(hourly, record)
+		return nil
+	}
+	rollup.levels[1].insert = func(record database.RollupRecord) error {
+		daily = append(daily, record)
+		return nil
+	}
+
+	// 2023-11-04T12:00:00Z
+	hour := int64(1699099200000)
+	for i, value := range []float64{10, 20, 30} {
+		start := hour + int64(i)*60000
+		data, err := json.Marshal(AggregateData{
+			DeviceID:    "test-device",
+			WindowStart: start,
+			WindowEnd:   start + 60000,
+			Function:    FunctionMean,
+			Metrics:     map[string]float64{"temperature": value},
+			Count:       5,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, rollup.ProcessAggregate(data))
+	}
+
+	// Non-mean aggregates must not skew the rollup
+	data, _ := json.Marshal(AggregateData{
+		DeviceID:    "test-device",
+		WindowStart: hour,
+		WindowEnd:   hour + 60000,
+		Function:    FunctionMax,
+		Metrics:     map[string]float64{"temperature": 1000},
+	})
+	assert.NoError(t, rollup.ProcessAggregate(data))
+
+	// Hourly bucket closes after its end plus the grace period; daily stays open
+	rollup.flushBuckets(time.UnixMilli(hour).Add(time.Hour + rollupGracePeriod + time.Second))
+
+	assert.Len(t, hourly, 1)
+	assert.Empty(t, daily)
+	assert.Equal(t, "temperature", hourly[0].MetricName)
+	assert.Equal(t, 20.0, hourly[0].MeanValue)
+	assert.Equal(t, 10.0, hourly[0].MinValue)
+	assert.Equal(t, 30.0, hourly[0].MaxValue)
+	assert.Equal(t, 3, hourly[0].SampleCount)
+	assert.Equal(t, time.UnixMilli(hour), hourly[0].BucketStart)
+
+	rollup.flushBuckets(time.UnixMilli(hour).Add(48 * time.Hour))
+	assert.Len(t, daily, 1)
+	assert.Equal(t, 20.0, daily[0].MeanValue)
+}
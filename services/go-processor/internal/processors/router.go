@@ -0,0 +1,100 @@
+package processors
+
+import (
+	"container/list"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// deviceChannelBuffer is the number of messages queued per device before
+// Submit blocks.
+const deviceChannelBuffer = 100
+
+// DeviceRouter gives every device, identified by its message key, a channel
+// and goroutine of its own, so each device's messages are handled one at a
+// time in the order they were read while devices are handled concurrently.
+// Past maxChannels devices, the least recently used device's goroutine is
+// stopped to make room.
+type DeviceRouter struct {
+	handle      func(kafkago.Message)
+	maxChannels int
+
+	devices map[string]*list.Element
+	// recent orders devices from most to least recently used
+	recent *list.List
+}
+
+// deviceChannel is a device's queue and the goroutine draining it.
+type deviceChannel struct {
+	deviceID string
+	messages chan kafkago.Message
+	done     chan struct{}
+}
+
+// NewDeviceRouter creates a router keeping at most maxChannels device
+// goroutines. A maxChannels below 1 means no limit.
+func NewDeviceRouter(maxChannels int, handle func(kafkago.Message)) *DeviceRouter {
+	return &DeviceRouter{
+		handle:      handle,
+		maxChannels: maxChannels,
+		devices:     make(map[string]*list.Element),
+		recent:      list.New(),
+	}
+}
+
+// Submit queues a message on its device's channel, starting the device's
+// goroutine on its first message. It blocks while the channel is full. It
+// must not be called concurrently.
+func (r *DeviceRouter) Submit(msg kafkago.Message) {
+	deviceID := string(msg.Key)
+
+	element, ok := r.devices[deviceID]
+	if ok {
+		r.recent.MoveToFront(element)
+	} else {
+		if r.maxChannels > 0 && r.recent.Len() >= r.maxChannels {
+			r.evict(r.recent.Back())
+		}
+		element = r.recent.PushFront(r.start(deviceID))
+		r.devices[deviceID] = element
+	}
+
+	element.Value.(*deviceChannel).messages <- msg
+}
+
+// Len returns the number of device goroutines running.
+func (r *DeviceRouter) Len() int {
+	return r.recent.Len()
+}
+
+// Close stops accepting messages and waits for queued ones to be handled.
+func (r *DeviceRouter) Close() {
+	for r.recent.Len() > 0 {
+		r.evict(r.recent.Back())
+	}
+}
+
+func (r *DeviceRouter) start(deviceID string) *deviceChannel {
+	device := &deviceChannel{
+		deviceID: deviceID,
+		messages: make(chan kafkago.Message, deviceChannelBuffer),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(device.done)
+		for msg := range device.messages {
+			r.handle(msg)
+		}
+	}()
+	return device
+}
+
+// evict stops a device's goroutine once its queued messages are handled.
+// Waiting for them keeps a later goroutine for the same device from
+// overtaking them.
+func (r *DeviceRouter) evict(element *list.Element) {
+	device := r.recent.Remove(element).(*deviceChannel)
+	delete(r.devices, device.deviceID)
+	close(device.messages)
+	<-device.done
+}
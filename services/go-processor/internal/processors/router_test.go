@@ -0,0 +1,109 @@
+package processors
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordSequences returns a handler recording the sequence number in each
+// message's value per device, after a random delay that would reorder
+// messages handled concurrently.
+func recordSequences(mutex *sync.Mutex, seen map[string][]int) func(kafkago.Message) {
+	return func(msg kafkago.Message) {
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+
+		sequence, _ := strconv.Atoi(string(msg.Value))
+		mutex.Lock()
+		seen[string(msg.Key)] = append(seen[string(msg.Key)], sequence)
+		mutex.Unlock()
+	}
+}
+
+func TestDeviceRouter_KeepsDeviceOrder(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make(map[string][]int)
+
+	router := NewDeviceRouter(0, recordSequences(&mutex, seen))
+	for i := 0; i < 50; i++ {
+		for d := 0; d < 10; d++ {
+			router.Submit(kafkago.Message{
+				Key:   []byte(fmt.Sprintf("device-%d", d)),
+				Value: []byte(strconv.Itoa(i)),
+			})
+		}
+	}
+	assert.Equal(t, 10, router.Len())
+	router.Close()
+
+	assert.Len(t, seen, 10)
+	for device, sequence := range seen {
+		assert.Len(t, sequence, 50, device)
+		for i, value := range sequence {
+			assert.Equal(t, i, value, device)
+		}
+	}
+	assert.Equal(t, 0, router.Len())
+}
+
+func TestDeviceRouter_EvictsLeastRecentlyUsed(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make(map[string][]int)
+
+	router := NewDeviceRouter(3, recordSequences(&mutex, seen))
+	submit := func(deviceID string, sequence int) {
+		router.Submit(kafkago.Message{Key: []byte(deviceID), Value: []byte(strconv.Itoa(sequence))})
+	}
+
+	submit("device-a", 0)
+	submit("device-b", 0)
+	submit("device-c", 0)
+	submit("device-a", 1)
+	// device-b is now the least recently used
+	submit("device-d", 0)
+	assert.Equal(t, 3, router.Len())
+	assert.NotContains(t, router.devices, "device-b")
+	assert.Contains(t, router.devices, "device-a")
+
+	// An evicted device gets a new goroutine, after the old one finished
+	submit("device-b", 1)
+	assert.Equal(t, 3, router.Len())
+	assert.NotContains(t, router.devices, "device-c")
+	router.Close()
+
+	assert.Equal(t, []int{0, 1}, seen["device-a"])
+	assert.Equal(t, []int{0, 1}, seen["device-b"])
+	assert.Equal(t, []int{0}, seen["device-c"])
+	assert.Equal(t, []int{0}, seen["device-d"])
+}
+
+func TestDeviceRouter_OrderSurvivesEviction(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make(map[string][]int)
+
+	// With fewer channels than devices, every device is evicted repeatedly
+	router := NewDeviceRouter(2, recordSequences(&mutex, seen))
+	for i := 0; i < 20; i++ {
+		for d := 0; d < 5; d++ {
+			router.Submit(kafkago.Message{
+				Key:   []byte(fmt.Sprintf("device-%d", d)),
+				Value: []byte(strconv.Itoa(i)),
+			})
+		}
+	}
+	router.Close()
+
+	assert.Len(t, seen, 5)
+	for device, sequence := range seen {
+		assert.Len(t, sequence, 20, device)
+		for i, value := range sequence {
+			assert.Equal(t, i, value, device)
+		}
+	}
+}
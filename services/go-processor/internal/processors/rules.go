@@ -0,0 +1,179 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Rule operators compare a metric value against a rule's threshold.
+const (
+	OperatorGT  = "gt"
+	OperatorLT  = "lt"
+	OperatorGTE = "gte"
+	OperatorLTE = "lte"
+	OperatorEQ  = "eq"
+)
+
+// RuleWildcard as a rule's DeviceID matches every device.
+const RuleWildcard = "*"
+
+// Rule raises a threshold alert when a device metric satisfies
+// "value <Operator> Threshold".
+type Rule struct {
+	DeviceID   string  `json:"device_id"`
+	MetricName string  `json:"metric_name"`
+	Operator   string  `json:"operator"`
+	Threshold  float64 `json:"threshold"`
+	Severity   string  `json:"severity"`
+}
+
+// Matches reports whether the rule applies to the device metric and the value
+// satisfies it.
+func (r Rule) Matches(deviceID, metricName string, value float64) bool {
+	if r.DeviceID != RuleWildcard && r.DeviceID != deviceID {
+		return false
+	}
+	if r.MetricName != metricName {
+		return false
+	}
+
+	switch r.Operator {
+	case OperatorGT:
+		return value > r.Threshold
+	case OperatorLT:
+		return value < r.Threshold
+	case OperatorGTE:
+		return value >= r.Threshold
+	case OperatorLTE:
+		return value <= r.Threshold
+	case OperatorEQ:
+		return value == r.Threshold
+	default:
+		return false
+	}
+}
+
+func (r Rule) validate() error {
+	if r.DeviceID == "" {
+		return fmt.Errorf("rule has no device_id; use %q for all devices", RuleWildcard)
+	}
+	if r.MetricName == "" {
+		return fmt.Errorf("rule for device %s has no metric_name", r.DeviceID)
+	}
+	switch r.Operator {
+	case OperatorGT, OperatorLT, OperatorGTE, OperatorLTE, OperatorEQ:
+	default:
+		return fmt.Errorf("rule for %s/%s has unknown operator %q", r.DeviceID, r.MetricName, r.Operator)
+	}
+	switch r.Severity {
+	case "low", "medium", "high":
+	default:
+		return fmt.Errorf("rule for %s/%s has unknown severity %q", r.DeviceID, r.MetricName, r.Severity)
+	}
+	return nil
+}
+
+// RuleEngine evaluates fixed threshold rules, for alert conditions that are
+// not statistical such as "battery_level lt 10". Rules can be changed while
+// telemetry is being processed.
+type RuleEngine struct {
+	rules []Rule
+	mutex sync.RWMutex
+}
+
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+func NewRuleEngine(rules []Rule) (*RuleEngine, error) {
+	engine := &RuleEngine{}
+	for _, rule := range rules {
+		if err := engine.AddRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	return engine, nil
+}
+
+// LoadRules reads a JSON rules file such as
+//
+//	{
+//	  "rules": [
+//	    {"device_id": "*", "metric_name": "battery_level", "operator": "lt", "threshold": 10, "severity": "medium"},
+//	    {"device_id": "boiler-1", "metric_name": "temperature", "operator": "gte", "threshold": 90, "severity": "high"}
+//	  ]
+//	}
+//
+// and returns an engine evaluating them.
+func LoadRules(path string) (*RuleEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules config: %w", err)
+	}
+
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules config %s: %w", path, err)
+	}
+
+	engine, err := NewRuleEngine(file.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules config %s: %w", path, err)
+	}
+	return engine, nil
+}
+
+// AddRule validates a rule and adds it to the engine.
+func (re *RuleEngine) AddRule(rule Rule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+	re.rules = append(re.rules, rule)
+	return nil
+}
+
+// RemoveRule removes every rule equal to rule and reports whether any was
+// found.
+func (re *RuleEngine) RemoveRule(rule Rule) bool {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+
+	kept := re.rules[:0]
+	for _, existing := range re.rules {
+		if existing != rule {
+			kept = append(kept, existing)
+		}
+	}
+	removed := len(kept) < len(re.rules)
+	re.rules = kept
+	return removed
+}
+
+// ListRules returns a copy of the engine's rules.
+func (re *RuleEngine) ListRules() []Rule {
+	re.mutex.RLock()
+	defer re.mutex.RUnlock()
+
+	rules := make([]Rule, len(re.rules))
+	copy(rules, re.rules)
+	return rules
+}
+
+// Evaluate returns the rules matched by a device metric value.
+func (re *RuleEngine) Evaluate(deviceID, metricName string, value float64) []Rule {
+	re.mutex.RLock()
+	defer re.mutex.RUnlock()
+
+	var matched []Rule
+	for _, rule := range re.rules {
+		if rule.Matches(deviceID, metricName, value) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
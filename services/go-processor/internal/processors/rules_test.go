@@ -0,0 +1,119 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRule_Operators(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    float64
+		want     bool
+	}{
+		{OperatorGT, 101, true},
+		{OperatorGT, 100, false},
+		{OperatorLT, 99, true},
+		{OperatorLT, 100, false},
+		{OperatorGTE, 100, true},
+		{OperatorGTE, 99, false},
+		{OperatorLTE, 100, true},
+		{OperatorLTE, 101, false},
+		{OperatorEQ, 100, true},
+		{OperatorEQ, 100.5, false},
+	}
+
+	for _, tt := range tests {
+		rule := Rule{DeviceID: "device-1", MetricName: "temperature", Operator: tt.operator, Threshold: 100, Severity: "high"}
+		assert.Equal(t, tt.want, rule.Matches("device-1", "temperature", tt.value), "%s %v", tt.operator, tt.value)
+	}
+}
+
+func TestRule_DeviceMatching(t *testing.T) {
+	wildcard := Rule{DeviceID: RuleWildcard, MetricName: "battery_level", Operator: OperatorLT, Threshold: 10, Severity: "medium"}
+	assert.True(t, wildcard.Matches("device-1", "battery_level", 5))
+	assert.True(t, wildcard.Matches("device-2", "battery_level", 5))
+	assert.False(t, wildcard.Matches("device-1", "temperature", 5))
+
+	specific := Rule{DeviceID: "device-1", MetricName: "battery_level", Operator: OperatorLT, Threshold: 10, Severity: "medium"}
+	assert.True(t, specific.Matches("device-1", "battery_level", 5))
+	assert.False(t, specific.Matches("device-2", "battery_level", 5))
+}
+
+func TestRuleEngine_AddRemoveList(t *testing.T) {
+	engine, err := NewRuleEngine(nil)
+	assert.NoError(t, err)
+
+	low := Rule{DeviceID: RuleWildcard, MetricName: "battery_level", Operator: OperatorLT, Threshold: 10, Severity: "medium"}
+	hot := Rule{DeviceID: "device-1", MetricName: "temperature", Operator: OperatorGTE, Threshold: 90, Severity: "high"}
+	assert.NoError(t, engine.AddRule(low))
+	assert.NoError(t, engine.AddRule(hot))
+	assert.Equal(t, []Rule{low, hot}, engine.ListRules())
+
+	assert.Equal(t, []Rule{hot}, engine.Evaluate("device-1", "temperature", 95))
+	assert.Empty(t, engine.Evaluate("device-2", "temperature", 95))
+
+	assert.True(t, engine.RemoveRule(low))
+	assert.False(t, engine.RemoveRule(low))
+	assert.Equal(t, []Rule{hot}, engine.ListRules())
+
+	assert.Error(t, engine.AddRule(Rule{DeviceID: "*", MetricName: "temperature", Operator: "ne", Severity: "high"}))
+	assert.Error(t, engine.AddRule(Rule{DeviceID: "*", MetricName: "temperature", Operator: OperatorGT, Severity: "critical"}))
+	assert.Error(t, engine.AddRule(Rule{MetricName: "temperature", Operator: OperatorGT, Severity: "high"}))
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(path, []byte(`{
+		"rules": [
+			{"device_id": "*", "metric_name": "battery_level", "operator": "lt", "threshold": 10, "severity": "medium"}
+		]
+	}`), 0o644)
+	assert.NoError(t, err)
+
+	engine, err := LoadRules(path)
+	assert.NoError(t, err)
+	assert.Len(t, engine.ListRules(), 1)
+
+	_, err = LoadRules(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestAnomalyDetector_ReportsThresholdAlerts(t *testing.T) {
+	rules, err := NewRuleEngine([]Rule{
+		{DeviceID: RuleWildcard, MetricName: "temperature", Operator: OperatorGT, Threshold: 80, Severity: "high"},
+	})
+	assert.NoError(t, err)
+
+	var anomalies []*Anomaly
+	detector := &AnomalyDetector{
+		logger:      slog.Default(),
+		deviceStats: make(map[string]*DeviceStats),
+		Rules:       rules,
+		onAnomaly:   func(a *Anomaly) { anomalies = append(anomalies, a) },
+	}
+
+	for _, value := range []float64{20, 85} {
+		data, err := proto.Marshal(&pb.Telemetry{
+			DeviceId: "device-1",
+			Ts:       time.Now().UnixMilli(),
+			Metrics:  map[string]float64{"temperature": value},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, detector.ProcessTelemetry(context.Background(), data))
+	}
+
+	assert.Len(t, anomalies, 1)
+	assert.Equal(t, AlertTypeThreshold, anomalies[0].AlertType)
+	assert.Equal(t, 85.0, anomalies[0].Value)
+	assert.Equal(t, "high", anomalies[0].Severity)
+}
@@ -0,0 +1,93 @@
+package processors
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go-processor/internal/database"
+)
+
+// shadowStore is the subset of TimescaleDB used by ShadowSync.
+type shadowStore interface {
+	UpdateReportedState(deviceID string, reported map[string]interface{}) error
+	GetDeviceShadow(deviceID string) (*database.DeviceShadow, error)
+}
+
+// shadowBroadcaster pushes shadow deltas to connected dashboards.
+type shadowBroadcaster interface {
+	BroadcastShadowDelta(deviceID string, delta interface{})
+}
+
+// ShadowDelta lists the desired values a device has not reported yet. An
+// empty Delta means the device has reached its desired state.
+type ShadowDelta struct {
+	DeviceID string                 `json:"device_id"`
+	Delta    map[string]interface{} `json:"delta"`
+	Version  int                    `json:"version"`
+}
+
+// ShadowSync records the metrics of every telemetry message as the reported
+// state of the device's shadow, and broadcasts the shadow's delta whenever it
+// changes: when the device diverges from its desired state, moves closer to
+// it, or reaches it.
+type ShadowSync struct {
+	db          shadowStore
+	broadcaster shadowBroadcaster
+
+	// deltas holds the last delta broadcast for each device.
+	deltas map[string]map[string]interface{}
+	mutex  sync.Mutex
+}
+
+func NewShadowSync(db shadowStore, broadcaster shadowBroadcaster) *ShadowSync {
+	return &ShadowSync{
+		db:          db,
+		broadcaster: broadcaster,
+		deltas:      make(map[string]map[string]interface{}),
+	}
+}
+
+// RecordTelemetry stores metrics as the reported state of deviceID.
+func (s *ShadowSync) RecordTelemetry(deviceID string, metrics map[string]float64) error {
+	reported := make(map[string]interface{}, len(metrics))
+	for name, value := range metrics {
+		reported[name] = value
+	}
+	if err := s.db.UpdateReportedState(deviceID, reported); err != nil {
+		return err
+	}
+
+	shadow, err := s.db.GetDeviceShadow(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to read device shadow: %w", err)
+	}
+
+	delta := shadow.Delta()
+	if !s.deltaChanged(deviceID, delta) {
+		return nil
+	}
+	s.broadcaster.BroadcastShadowDelta(deviceID, ShadowDelta{
+		DeviceID: deviceID,
+		Delta:    delta,
+		Version:  shadow.Version,
+	})
+	return nil
+}
+
+// deltaChanged records delta as the latest of deviceID and reports whether
+// it differs from the one before. Devices start out in their desired state.
+func (s *ShadowSync) deltaChanged(deviceID string, delta map[string]interface{}) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.deltas[deviceID]
+	if len(previous) == 0 && len(delta) == 0 {
+		return false
+	}
+	if reflect.DeepEqual(previous, delta) {
+		return false
+	}
+	s.deltas[deviceID] = delta
+	return true
+}
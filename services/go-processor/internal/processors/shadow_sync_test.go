@@ -0,0 +1,74 @@
+package processors
+
+import (
+	"testing"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeShadowStore struct {
+	shadow database.DeviceShadow
+}
+
+func (s *fakeShadowStore) UpdateReportedState(deviceID string, reported map[string]interface{}) error {
+	if s.shadow.Reported == nil {
+		s.shadow.Reported = make(map[string]interface{})
+	}
+	for key, value := range reported {
+		s.shadow.Reported[key] = value
+	}
+	s.shadow.DeviceID = deviceID
+	s.shadow.Version++
+	return nil
+}
+
+func (s *fakeShadowStore) GetDeviceShadow(deviceID string) (*database.DeviceShadow, error) {
+	shadow := s.shadow
+	return &shadow, nil
+}
+
+type recordingShadowBroadcaster struct {
+	deltas []ShadowDelta
+}
+
+func (b *recordingShadowBroadcaster) BroadcastShadowDelta(deviceID string, delta interface{}) {
+	b.deltas = append(b.deltas, delta.(ShadowDelta))
+}
+
+func TestShadowSync_BroadcastsDeltaChanges(t *testing.T) {
+	store := &fakeShadowStore{shadow: database.DeviceShadow{
+		Desired: map[string]interface{}{"setpoint": 21.0},
+	}}
+	broadcaster := &recordingShadowBroadcaster{}
+	shadowSync := NewShadowSync(store, broadcaster)
+
+	// Diverged: the delta is broadcast once
+	assert.NoError(t, shadowSync.RecordTelemetry("device-1", map[string]float64{"setpoint": 18}))
+	assert.NoError(t, shadowSync.RecordTelemetry("device-1", map[string]float64{"setpoint": 18}))
+	assert.Equal(t, []ShadowDelta{{
+		DeviceID: "device-1",
+		Delta:    map[string]interface{}{"setpoint": 21.0},
+		Version:  1,
+	}}, broadcaster.deltas)
+
+	// Converged: an empty delta tells dashboards the device caught up
+	assert.NoError(t, shadowSync.RecordTelemetry("device-1", map[string]float64{"setpoint": 21}))
+	assert.Len(t, broadcaster.deltas, 2)
+	assert.Empty(t, broadcaster.deltas[1].Delta)
+	assert.Equal(t, 3, broadcaster.deltas[1].Version)
+
+	assert.NoError(t, shadowSync.RecordTelemetry("device-1", map[string]float64{"setpoint": 21}))
+	assert.Len(t, broadcaster.deltas, 2)
+}
+
+func TestShadowSync_NoDesiredState(t *testing.T) {
+	store := &fakeShadowStore{}
+	broadcaster := &recordingShadowBroadcaster{}
+	shadowSync := NewShadowSync(store, broadcaster)
+
+	assert.NoError(t, shadowSync.RecordTelemetry("device-1", map[string]float64{"temperature": 22.5}))
+	assert.Equal(t, map[string]interface{}{"temperature": 22.5}, store.shadow.Reported)
+	assert.Empty(t, broadcaster.deltas)
+}
@@ -0,0 +1,106 @@
+package processors
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// deviceStatsSnapshot is the serialisable form of DeviceStats, without the
+// mutex that guards the live struct.
+type deviceStatsSnapshot struct {
+	DeviceID    string
+	MetricStats map[string]Stats
+	LastUpdated int64
+	SampleCount int
+}
+
+// SaveStats writes the current per-device statistics to a gob-encoded file.
+// The file is written to a temporary path first and renamed into place so a
+// crash mid-write never leaves a truncated snapshot behind.
+func (ad *AnomalyDetector) SaveStats(path string) error {
+	// Collect the devices first so the detector mutex is never held while
+	// waiting on a device mutex; ProcessTelemetry acquires them the other way
+	// round.
+	ad.mutex.RLock()
+	devices := make(map[string]*DeviceStats, len(ad.deviceStats))
+	for deviceID, deviceStats := range ad.deviceStats {
+		devices[deviceID] = deviceStats
+	}
+	ad.mutex.RUnlock()
+
+	snapshot := make(map[string]deviceStatsSnapshot, len(devices))
+	for deviceID, deviceStats := range devices {
+		deviceStats.mutex.RLock()
+		metricStats := make(map[string]Stats, len(deviceStats.MetricStats))
+		for metricName, stats := range deviceStats.MetricStats {
+			metricStats[metricName] = *stats
+		}
+		snapshot[deviceID] = deviceStatsSnapshot{
+			DeviceID:    deviceStats.DeviceID,
+			MetricStats: metricStats,
+			LastUpdated: deviceStats.LastUpdated,
+			SampleCount: deviceStats.SampleCount,
+		}
+		deviceStats.mutex.RUnlock()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create stats snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode stats snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write stats snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace stats snapshot: %w", err)
+	}
+
+	ad.logger.Info("Saved stats snapshot", slog.Int("devices", len(snapshot)), slog.String("path", path))
+	return nil
+}
+
+// LoadStats replaces the per-device statistics with those stored in a
+// snapshot previously written by SaveStats.
+func (ad *AnomalyDetector) LoadStats(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open stats snapshot: %w", err)
+	}
+	defer file.Close()
+
+	var snapshot map[string]deviceStatsSnapshot
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to decode stats snapshot: %w", err)
+	}
+
+	deviceStats := make(map[string]*DeviceStats, len(snapshot))
+	for deviceID, saved := range snapshot {
+		metricStats := make(map[string]*Stats, len(saved.MetricStats))
+		for metricName, stats := range saved.MetricStats {
+			stats := stats
+			metricStats[metricName] = &stats
+		}
+		deviceStats[deviceID] = &DeviceStats{
+			DeviceID:    saved.DeviceID,
+			MetricStats: metricStats,
+			LastUpdated: saved.LastUpdated,
+			SampleCount: saved.SampleCount,
+		}
+	}
+
+	ad.mutex.Lock()
+	ad.deviceStats = deviceStats
+	ad.mutex.Unlock()
+
+	ad.logger.Info("Loaded stats snapshot", slog.Int("devices", len(deviceStats)), slog.String("path", path))
+	return nil
+}
@@ -0,0 +1,52 @@
+package processors
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyDetector_SaveLoadStats(t *testing.T) {
+	detector := &AnomalyDetector{logger: slog.Default(), deviceStats: make(map[string]*DeviceStats)}
+	detector.deviceStats["device-1"] = &DeviceStats{
+		DeviceID: "device-1",
+		MetricStats: map[string]*Stats{
+			"temperature": {Mean: 21.5, StdDev: 1.25, Min: 18, Max: 25, Count: 42, Sum: 903, SumSq: 19500.5},
+			"humidity":    {Mean: 55, StdDev: 3, Min: 40, Max: 70, Count: 42, Sum: 2310, SumSq: 127428},
+		},
+		LastUpdated: 1699113600000,
+		SampleCount: 42,
+	}
+	detector.deviceStats["device-2"] = &DeviceStats{
+		DeviceID:    "device-2",
+		MetricStats: map[string]*Stats{"pressure": {Mean: 1013, Count: 1, Sum: 1013, SumSq: 1026169, Min: 1013, Max: 1013}},
+		LastUpdated: 1699113660000,
+		SampleCount: 1,
+	}
+
+	path := filepath.Join(t.TempDir(), "stats.gob")
+	assert.NoError(t, detector.SaveStats(path))
+
+	restored := &AnomalyDetector{logger: slog.Default(), deviceStats: make(map[string]*DeviceStats)}
+	assert.NoError(t, restored.LoadStats(path))
+
+	assert.Len(t, restored.deviceStats, 2)
+	for deviceID, original := range detector.deviceStats {
+		loaded := restored.deviceStats[deviceID]
+		assert.NotNil(t, loaded)
+		assert.Equal(t, original.DeviceID, loaded.DeviceID)
+		assert.Equal(t, original.LastUpdated, loaded.LastUpdated)
+		assert.Equal(t, original.SampleCount, loaded.SampleCount)
+		assert.Equal(t, len(original.MetricStats), len(loaded.MetricStats))
+		for metricName, stats := range original.MetricStats {
+			assert.Equal(t, *stats, *loaded.MetricStats[metricName])
+		}
+	}
+}
+
+func TestAnomalyDetector_LoadStatsMissingFile(t *testing.T) {
+	detector := &AnomalyDetector{logger: slog.Default(), deviceStats: make(map[string]*DeviceStats)}
+	assert.Error(t, detector.LoadStats(filepath.Join(t.TempDir(), "missing.gob")))
+}
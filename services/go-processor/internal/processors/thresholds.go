@@ -0,0 +1,68 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ThresholdWildcard matches any device or any metric in a ThresholdConfig.
+const ThresholdWildcard = "*"
+
+// ThresholdConfig maps device → metric → anomaly threshold. A wildcard device
+// key holds per-metric thresholds for all devices, and a wildcard metric key
+// holds the threshold for every metric of a device.
+type ThresholdConfig map[string]map[string]float64
+
+type thresholdFile struct {
+	DefaultThreshold float64         `json:"default_threshold"`
+	Thresholds       ThresholdConfig `json:"thresholds"`
+}
+
+// LoadThresholdConfig reads a JSON threshold file such as
+//
+//	{
+//	  "default_threshold": 3.0,
+//	  "thresholds": {
+//	    "device-1": {"temperature": 2.5, "*": 4.0},
+//	    "*": {"battery_level": 2.0}
+//	  }
+//	}
+//
+// and returns the thresholds along with the global default.
+func LoadThresholdConfig(path string) (ThresholdConfig, float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read threshold config: %w", err)
+	}
+
+	var file thresholdFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse threshold config %s: %w", path, err)
+	}
+
+	return file.Thresholds, file.DefaultThreshold, nil
+}
+
+// GetThreshold returns the anomaly threshold for a device metric. The most
+// specific match wins: device and metric, then device, then metric, then the
+// global default.
+func (ad *AnomalyDetector) GetThreshold(deviceID, metricName string) float64 {
+	ad.thresholdMutex.RLock()
+	defer ad.thresholdMutex.RUnlock()
+
+	if deviceThresholds, ok := ad.thresholds[deviceID]; ok {
+		if threshold, ok := deviceThresholds[metricName]; ok {
+			return threshold
+		}
+		if threshold, ok := deviceThresholds[ThresholdWildcard]; ok {
+			return threshold
+		}
+	}
+
+	if threshold, ok := ad.thresholds[ThresholdWildcard][metricName]; ok {
+		return threshold
+	}
+
+	return ad.alertThreshold
+}
@@ -0,0 +1,46 @@
+package processors
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyDetector_GetThresholdPriority(t *testing.T) {
+	detector := &AnomalyDetector{
+		logger:         slog.Default(),
+		alertThreshold: 3.0,
+		thresholds: ThresholdConfig{
+			"device-1":        {"temperature": 1.5, ThresholdWildcard: 2.0},
+			ThresholdWildcard: {"temperature": 2.5, "humidity": 4.5},
+		},
+	}
+
+	// device-metric > device > metric > global
+	assert.Equal(t, 1.5, detector.GetThreshold("device-1", "temperature"))
+	assert.Equal(t, 2.0, detector.GetThreshold("device-1", "humidity"))
+	assert.Equal(t, 2.5, detector.GetThreshold("device-2", "temperature"))
+	assert.Equal(t, 4.5, detector.GetThreshold("device-2", "humidity"))
+	assert.Equal(t, 3.0, detector.GetThreshold("device-2", "pressure"))
+}
+
+func TestLoadThresholdConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "thresholds.json")
+	err := os.WriteFile(path, []byte(`{
+		"default_threshold": 3.5,
+		"thresholds": {"device-1": {"temperature": 2.5}, "*": {"humidity": 4}}
+	}`), 0o644)
+	assert.NoError(t, err)
+
+	thresholds, defaultThreshold, err := LoadThresholdConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.5, defaultThreshold)
+	assert.Equal(t, 2.5, thresholds["device-1"]["temperature"])
+	assert.Equal(t, 4.0, thresholds[ThresholdWildcard]["humidity"])
+
+	_, _, err = LoadThresholdConfig(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
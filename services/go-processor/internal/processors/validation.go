@@ -0,0 +1,30 @@
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	pb "go-processor/internal/proto"
+)
+
+// ErrInvalidTelemetry is wrapped by the errors of telemetry that decodes but
+// can't be processed. Such messages go to the DLQ.
+var ErrInvalidTelemetry = errors.New("invalid telemetry")
+
+// ValidateProtobufTelemetry checks that telemetry names its device, has a
+// positive timestamp and that all its metric values are finite.
+func ValidateProtobufTelemetry(telemetry *pb.Telemetry) error {
+	if telemetry.DeviceId == "" {
+		return fmt.Errorf("%w: device_id is required", ErrInvalidTelemetry)
+	}
+	if telemetry.Ts <= 0 {
+		return fmt.Errorf("%w: ts must be a positive epoch millisecond timestamp", ErrInvalidTelemetry)
+	}
+	for name, value := range telemetry.Metrics {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("%w: metric %q is not a finite number", ErrInvalidTelemetry, name)
+		}
+	}
+	return nil
+}
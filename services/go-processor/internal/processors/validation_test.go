@@ -0,0 +1,86 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"testing"
+	"time"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestValidateProtobufTelemetry(t *testing.T) {
+	now := time.Now().UnixMilli()
+	tests := []struct {
+		name      string
+		telemetry *pb.Telemetry
+		wantErr   string
+	}{
+		{
+			name:      "valid",
+			telemetry: &pb.Telemetry{DeviceId: "device-1", Ts: now, Metrics: map[string]float64{"temperature": 21.5}},
+		},
+		{
+			name:      "no metrics",
+			telemetry: &pb.Telemetry{DeviceId: "device-1", Ts: now},
+		},
+		{
+			name:      "missing device ID",
+			telemetry: &pb.Telemetry{Ts: now, Metrics: map[string]float64{"temperature": 21.5}},
+			wantErr:   "invalid telemetry: device_id is required",
+		},
+		{
+			name:      "missing timestamp",
+			telemetry: &pb.Telemetry{DeviceId: "device-1", Metrics: map[string]float64{"temperature": 21.5}},
+			wantErr:   "invalid telemetry: ts must be a positive epoch millisecond timestamp",
+		},
+		{
+			name:      "negative timestamp",
+			telemetry: &pb.Telemetry{DeviceId: "device-1", Ts: -1},
+			wantErr:   "invalid telemetry: ts must be a positive epoch millisecond timestamp",
+		},
+		{
+			name:      "NaN metric",
+			telemetry: &pb.Telemetry{DeviceId: "device-1", Ts: now, Metrics: map[string]float64{"temperature": math.NaN()}},
+			wantErr:   `invalid telemetry: metric "temperature" is not a finite number`,
+		},
+		{
+			name:      "infinite metric",
+			telemetry: &pb.Telemetry{DeviceId: "device-1", Ts: now, Metrics: map[string]float64{"pressure": math.Inf(-1)}},
+			wantErr:   `invalid telemetry: metric "pressure" is not a finite number`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateProtobufTelemetry(tt.telemetry)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidTelemetry)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestAnomalyDetector_RejectsInvalidTelemetry(t *testing.T) {
+	detector := &AnomalyDetector{
+		logger:      slog.Default(),
+		deviceStats: make(map[string]*DeviceStats),
+	}
+
+	data, err := proto.Marshal(&pb.Telemetry{
+		DeviceId: "device-1",
+		Ts:       time.Now().UnixMilli(),
+		Metrics:  map[string]float64{"temperature": math.Inf(1)},
+	})
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, detector.ProcessTelemetry(context.Background(), data), ErrInvalidTelemetry)
+	assert.Empty(t, detector.deviceStats)
+}
@@ -0,0 +1,208 @@
+package processors
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Buffered WAL records are written to disk every walFlushEvery appends or
+// every walFlushInterval, whichever comes first.
+const (
+	walFlushEvery    = 100
+	walFlushInterval = time.Second
+)
+
+// walRecord is one contribution to an aggregation window: a single telemetry
+// message, or the whole state of a window when the log is compacted.
+type walRecord struct {
+	DeviceID    string               `json:"device_id"`
+	Timestamp   int64                `json:"timestamp"`
+	WindowStart int64                `json:"window_start"`
+	WindowEnd   int64                `json:"window_end"`
+	Count       int                  `json:"count"`
+	Metrics     map[string]float64   `json:"metrics"`
+	Samples     map[string][]float64 `json:"samples"`
+	TraceIDs    []string             `json:"trace_ids,omitempty"`
+}
+
+// writeAheadLog persists the window contributions of the Aggregator as
+// newline-delimited JSON so in-flight windows survive a restart.
+type writeAheadLog struct {
+	path    string
+	file    *os.File
+	writer  *bufio.Writer
+	pending int
+	mutex   sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openWAL opens the log at path for appending, creating it if needed, and
+// starts flushing it in the background.
+func openWAL(path string) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+
+	w := &writeAheadLog{
+		path:   path,
+		file:   file,
+		writer: bufio.NewWriter(file),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.flushLoop()
+	return w, nil
+}
+
+// readWAL returns the records in the log at path. A missing file holds no
+// records. A record cut short by a crash mid-write ends the log.
+func readWAL(path string) ([]walRecord, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+	defer file.Close()
+
+	var records []walRecord
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var record walRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to decode WAL record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+func (w *writeAheadLog) flushLoop() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(walFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mutex.Lock()
+			w.flushLocked()
+			w.mutex.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Append buffers a record, writing the buffer out once walFlushEvery records
+// are pending.
+func (w *writeAheadLog) Append(record walRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode WAL record: %w", err)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write WAL record: %w", err)
+	}
+	w.pending++
+	if w.pending >= walFlushEvery {
+		return w.flushLocked()
+	}
+	return nil
+}
+
+func (w *writeAheadLog) flushLocked() error {
+	if w.pending == 0 {
+		return nil
+	}
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush WAL: %w", err)
+	}
+	w.pending = 0
+	return nil
+}
+
+// Rewrite replaces the log with records, dropping everything appended so
+// far. The new log is written to a temporary file and renamed into place so
+// a crash never leaves a partial log behind.
+func (w *writeAheadLog) Rewrite(records []walRecord) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create WAL: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode WAL record: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write WAL: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write WAL: %w", err)
+	}
+
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close WAL: %w", err)
+	}
+	renameErr := os.Rename(tmp.Name(), w.path)
+
+	// Keep appending to the old log if it could not be replaced
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL: %w", err)
+	}
+	w.file = file
+	w.writer.Reset(file)
+
+	if renameErr != nil {
+		return fmt.Errorf("failed to replace WAL: %w", renameErr)
+	}
+	return nil
+}
+
+// Close flushes buffered records and closes the log.
+func (w *writeAheadLog) Close() error {
+	close(w.stop)
+	<-w.done
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.flushLocked(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
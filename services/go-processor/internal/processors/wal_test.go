@@ -0,0 +1,146 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "go-processor/internal/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func newWALTestAggregator(t *testing.T, path string) *Aggregator {
+	agg := &Aggregator{
+		logger: slog.Default(),
+		data:   make(map[string]map[string]*AggregateData),
+	}
+	if path != "" {
+		wal, err := openWAL(path)
+		assert.NoError(t, err)
+		agg.wal = wal
+	}
+	return agg
+}
+
+func processWALTestMessages(t *testing.T, agg *Aggregator, base int64) {
+	for i := 0; i < 30; i++ {
+		data, err := proto.Marshal(&pb.Telemetry{
+			DeviceId: []string{"device-a", "device-b"}[i%2],
+			Ts:       base + int64(i)*5000,
+			Metrics: map[string]float64{
+				"temperature": 20 + float64(i%7),
+				"humidity":    40 + float64(i%3)*1.5,
+			},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, agg.ProcessTelemetry(context.Background(), data))
+	}
+}
+
+func TestWAL_ReplayMatchesDirectProcessing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.wal")
+	base := (time.Now().UnixMilli() / 60000) * 60000
+
+	direct := newWALTestAggregator(t, path)
+	processWALTestMessages(t, direct, base)
+	assert.NoError(t, direct.wal.Close())
+
+	records, err := readWAL(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 30)
+
+	replayed := newWALTestAggregator(t, "")
+	replayed.replayWAL(records)
+
+	assert.Equal(t, direct.data, replayed.data)
+}
+
+func TestWAL_CompactionKeepsInFlightWindows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.wal")
+	now := time.Now().UnixMilli()
+
+	agg := newWALTestAggregator(t, path)
+	// An old window that gets flushed and a current one that stays buffered
+	processWALTestMessages(t, agg, ((now-10*60000)/60000)*60000)
+	processWALTestMessages(t, agg, (now/60000)*60000)
+
+	// Drop the old windows as flushWindowsBefore would, then compact
+	for deviceID, windows := range agg.data {
+		for windowKey, aggregate := range windows {
+			if aggregate.WindowEnd < now-120000 {
+				delete(windows, windowKey)
+			}
+		}
+		if len(windows) == 0 {
+			delete(agg.data, deviceID)
+		}
+	}
+	agg.mutex.Lock()
+	agg.compactWAL()
+	agg.mutex.Unlock()
+	compacted, err := readWAL(path)
+	assert.NoError(t, err)
+
+	processWALTestMessages(t, agg, (now/60000)*60000)
+	assert.NoError(t, agg.wal.Close())
+
+	records, err := readWAL(path)
+	assert.NoError(t, err)
+
+	replayed := newWALTestAggregator(t, "")
+	replayed.replayWAL(records)
+
+	assert.Len(t, records, len(compacted)+30)
+	assert.Equal(t, agg.data, replayed.data)
+	for _, windows := range replayed.data {
+		for _, aggregate := range windows {
+			assert.GreaterOrEqual(t, aggregate.WindowEnd, now-120000)
+		}
+	}
+}
+
+func TestWAL_ReplayKeepsSessionAnchors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.wal")
+	base := (time.Now().UnixMilli()/60000)*60000 + 17000
+
+	direct := newWALTestAggregator(t, path)
+	processWALTestMessages(t, direct, base)
+	assert.NoError(t, direct.wal.Close())
+
+	records, err := readWAL(path)
+	assert.NoError(t, err)
+	replayed := newWALTestAggregator(t, "")
+	replayed.replayWAL(records)
+
+	// Windows stay anchored at each device's first message before the restart
+	assert.Equal(t, direct.anchors, replayed.anchors)
+	assert.Equal(t, base, replayed.anchors["device-a"])
+}
+
+func TestWAL_IgnoresTruncatedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aggregator.wal")
+
+	agg := newWALTestAggregator(t, path)
+	processWALTestMessages(t, agg, (time.Now().UnixMilli()/60000)*60000)
+	assert.NoError(t, agg.wal.Close())
+
+	// Simulate a crash halfway through writing the last record
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-10))
+
+	records, err := readWAL(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 29)
+}
+
+func TestWAL_MissingFileHasNoRecords(t *testing.T) {
+	records, err := readWAL(filepath.Join(t.TempDir(), "missing.wal"))
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
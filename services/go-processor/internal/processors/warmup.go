@@ -0,0 +1,108 @@
+package processors
+
+import (
+	"log/slog"
+	"math"
+
+	"go-processor/internal/database"
+)
+
+// WarmupFromDatabase seeds the per-device statistics from the aggregates
+// stored over the last lookbackHours so anomaly detection is effective
+// immediately after a restart. Metrics that already have statistics, for
+// example from a snapshot, are left untouched.
+func (ad *AnomalyDetector) WarmupFromDatabase(db *database.TimescaleDB, lookbackHours int) error {
+	records, err := db.GetAggregatesForWarmup(lookbackHours)
+	if err != nil {
+		return err
+	}
+
+	seeded := ad.applyWarmup(records)
+	ad.logger.Info("Warmed up anomaly detector",
+		slog.Int("aggregates", len(records)), slog.Int("metric_series", seeded))
+	return nil
+}
+
+// applyWarmup folds historical aggregates into the detector using Welford's
+// online algorithm and returns the number of metric series it initialised.
+func (ad *AnomalyDetector) applyWarmup(records []database.AggregateRecord) int {
+	type welford struct {
+		count    int
+		mean     float64
+		m2       float64
+		min      float64
+		max      float64
+		lastSeen int64
+	}
+
+	series := make(map[string]map[string]*welford)
+	for _, record := range records {
+		if series[record.DeviceID] == nil {
+			series[record.DeviceID] = make(map[string]*welford)
+		}
+		w, exists := series[record.DeviceID][record.MetricName]
+		if !exists {
+			w = &welford{min: record.MetricValue, max: record.MetricValue}
+			series[record.DeviceID][record.MetricName] = w
+		}
+
+		w.count++
+		delta := record.MetricValue - w.mean
+		w.mean += delta / float64(w.count)
+		w.m2 += delta * (record.MetricValue - w.mean)
+		w.min = math.Min(w.min, record.MetricValue)
+		w.max = math.Max(w.max, record.MetricValue)
+		if ts := record.Timestamp.UnixMilli(); ts > w.lastSeen {
+			w.lastSeen = ts
+		}
+	}
+
+	seeded := 0
+	for deviceID, metricSeries := range series {
+		ad.mutex.Lock()
+		deviceStats, exists := ad.deviceStats[deviceID]
+		if !exists {
+			deviceStats = &DeviceStats{
+				DeviceID:    deviceID,
+				MetricStats: make(map[string]*Stats),
+			}
+			ad.deviceStats[deviceID] = deviceStats
+		}
+		ad.mutex.Unlock()
+
+		deviceStats.mutex.Lock()
+		for metricName, w := range metricSeries {
+			if _, exists := deviceStats.MetricStats[metricName]; exists {
+				continue
+			}
+
+			stdDev := 0.0
+			if w.count > 1 {
+				stdDev = math.Sqrt(w.m2 / float64(w.count-1))
+			}
+
+			// Sum and SumSq are derived so that updateStats continues the
+			// running statistics seamlessly from the warmed-up state.
+			n := float64(w.count)
+			deviceStats.MetricStats[metricName] = &Stats{
+				Mean:   w.mean,
+				StdDev: stdDev,
+				Min:    w.min,
+				Max:    w.max,
+				Count:  w.count,
+				Sum:    w.mean * n,
+				SumSq:  w.m2 + n*w.mean*w.mean,
+			}
+			if w.count > deviceStats.SampleCount {
+				deviceStats.SampleCount = w.count
+			}
+			if w.lastSeen > deviceStats.LastUpdated {
+				deviceStats.LastUpdated = w.lastSeen
+			}
+			seeded++
+		}
+		deviceStats.mutex.Unlock()
+	}
+
+	return seeded
+}
@@ -0,0 +1,66 @@
+package processors
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"go-processor/internal/database"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyDetector_ApplyWarmup(t *testing.T) {
+	detector := &AnomalyDetector{logger: slog.Default(), deviceStats: make(map[string]*DeviceStats)}
+
+	start := time.Now().Add(-time.Hour)
+	var records []database.AggregateRecord
+	for i, value := range []float64{10, 20, 30} {
+		records = append(records, database.AggregateRecord{
+			DeviceID:    "device-1",
+			Timestamp:   start.Add(time.Duration(i) * time.Minute),
+			MetricName:  "temperature",
+			MetricValue: value,
+		})
+	}
+	records = append(records, database.AggregateRecord{
+		DeviceID:    "device-2",
+		Timestamp:   start,
+		MetricName:  "humidity",
+		MetricValue: 50,
+	})
+
+	seeded := detector.applyWarmup(records)
+	assert.Equal(t, 2, seeded)
+
+	stats := detector.deviceStats["device-1"].MetricStats["temperature"]
+	assert.Equal(t, 3, stats.Count)
+	assert.InDelta(t, 20.0, stats.Mean, 1e-9)
+	assert.InDelta(t, 10.0, stats.StdDev, 1e-9)
+	assert.Equal(t, 10.0, stats.Min)
+	assert.Equal(t, 30.0, stats.Max)
+	assert.Equal(t, start.Add(2*time.Minute).UnixMilli(), detector.deviceStats["device-1"].LastUpdated)
+
+	// Running statistics continue from the warmed-up state
+	detector.updateStats(stats, 40)
+	assert.Equal(t, 4, stats.Count)
+	assert.InDelta(t, 25.0, stats.Mean, 1e-9)
+
+	single := detector.deviceStats["device-2"].MetricStats["humidity"]
+	assert.Equal(t, 1, single.Count)
+	assert.Equal(t, 0.0, single.StdDev)
+}
+
+func TestAnomalyDetector_ApplyWarmupKeepsExistingStats(t *testing.T) {
+	existing := &Stats{Mean: 99, Count: 500}
+	detector := &AnomalyDetector{logger: slog.Default(), deviceStats: map[string]*DeviceStats{
+		"device-1": {DeviceID: "device-1", MetricStats: map[string]*Stats{"temperature": existing}},
+	}}
+
+	seeded := detector.applyWarmup([]database.AggregateRecord{
+		{DeviceID: "device-1", MetricName: "temperature", MetricValue: 1, Timestamp: time.Now()},
+	})
+
+	assert.Equal(t, 0, seeded)
+	assert.Same(t, existing, detector.deviceStats["device-1"].MetricStats["temperature"])
+}
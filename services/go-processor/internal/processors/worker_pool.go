@@ -0,0 +1,77 @@
+package processors
+
+import (
+	"hash/fnv"
+	"sync"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// messageDispatcher hands Kafka messages to the goroutines processing them.
+type messageDispatcher interface {
+	Submit(msg kafkago.Message)
+	Close()
+}
+
+// workerPool fans Kafka messages out to a fixed number of goroutines. When
+// ordered by device, each message key is pinned to one worker so messages
+// for the same device are handled in the order they were read.
+type workerPool struct {
+	channels []chan kafkago.Message
+	ordered  bool
+	wg       sync.WaitGroup
+}
+
+func newWorkerPool(workerCount int, orderedByDevice bool, handle func(kafkago.Message)) *workerPool {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+
+	pool := &workerPool{ordered: orderedByDevice}
+
+	if orderedByDevice {
+		pool.channels = make([]chan kafkago.Message, workerCount)
+		for i := range pool.channels {
+			pool.channels[i] = make(chan kafkago.Message, 100)
+		}
+	} else {
+		pool.channels = []chan kafkago.Message{make(chan kafkago.Message, workerCount*100)}
+	}
+
+	for i := 0; i < workerCount; i++ {
+		messages := pool.channels[0]
+		if orderedByDevice {
+			messages = pool.channels[i]
+		}
+
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for msg := range messages {
+				handle(msg)
+			}
+		}()
+	}
+
+	return pool
+}
+
+// Submit queues a message for processing, blocking while its worker is busy.
+func (p *workerPool) Submit(msg kafkago.Message) {
+	if !p.ordered {
+		p.channels[0] <- msg
+		return
+	}
+
+	hash := fnv.New32a()
+	hash.Write(msg.Key)
+	p.channels[hash.Sum32()%uint32(len(p.channels))] <- msg
+}
+
+// Close stops accepting messages and waits for queued ones to be handled.
+func (p *workerPool) Close() {
+	for _, messages := range p.channels {
+		close(messages)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,61 @@
+package processors
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool_ProcessesAllMessages(t *testing.T) {
+	var processed int64
+	pool := newWorkerPool(8, false, func(kafkago.Message) {
+		atomic.AddInt64(&processed, 1)
+	})
+
+	for i := 0; i < 1000; i++ {
+		pool.Submit(kafkago.Message{Offset: int64(i)})
+	}
+	pool.Close()
+
+	assert.Equal(t, int64(1000), processed)
+}
+
+func TestWorkerPool_OrderedByDevice(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make(map[string][]int)
+
+	pool := newWorkerPool(4, true, func(msg kafkago.Message) {
+		// Random delays would reorder messages if they were not pinned
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+
+		sequence, _ := strconv.Atoi(string(msg.Value))
+		mutex.Lock()
+		seen[string(msg.Key)] = append(seen[string(msg.Key)], sequence)
+		mutex.Unlock()
+	})
+
+	for i := 0; i < 50; i++ {
+		for d := 0; d < 10; d++ {
+			pool.Submit(kafkago.Message{
+				Key:   []byte(fmt.Sprintf("device-%d", d)),
+				Value: []byte(strconv.Itoa(i)),
+			})
+		}
+	}
+	pool.Close()
+
+	assert.Len(t, seen, 10)
+	for device, sequence := range seen {
+		assert.Len(t, sequence, 50, device)
+		for i, value := range sequence {
+			assert.Equal(t, i, value, device)
+		}
+	}
+}
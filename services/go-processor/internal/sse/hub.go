@@ -0,0 +1,118 @@
+package sse
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"go-processor/internal/websocket"
+)
+
+// subscriber is one connected event stream. A nil devices set receives every
+// broadcast. Broadcasts without a device reach every subscriber unless
+// deviceOnly is set.
+type subscriber struct {
+	events     chan []byte
+	devices    map[string]bool
+	deviceOnly bool
+}
+
+func (s *subscriber) wants(deviceID string) bool {
+	if deviceID == "" {
+		return !s.deviceOnly
+	}
+	return s.devices == nil || s.devices[deviceID]
+}
+
+// SSEHub fans broadcasts out to event stream subscribers. It consumes the
+// same BroadcastMessage values as the WebSocket hub, so a websocket.Server
+// can feed it through AddSubscriber.
+type SSEHub struct {
+	subscribers map[*subscriber]bool
+	broadcast   chan websocket.BroadcastMessage
+	register    chan *subscriber
+	unregister  chan *subscriber
+	done        chan struct{}
+
+	// subscriberCount mirrors len(subscribers) for readers outside Run.
+	subscriberCount atomic.Int64
+}
+
+func NewSSEHub() *SSEHub {
+	return &SSEHub{
+		subscribers: make(map[*subscriber]bool),
+		broadcast:   make(chan websocket.BroadcastMessage),
+		register:    make(chan *subscriber),
+		unregister:  make(chan *subscriber),
+		done:        make(chan struct{}),
+	}
+}
+
+// Broadcast returns the channel messages are published on.
+func (h *SSEHub) Broadcast() chan<- websocket.BroadcastMessage {
+	return h.broadcast
+}
+
+// Subscribers returns the number of connected event streams.
+func (h *SSEHub) Subscribers() int {
+	return int(h.subscriberCount.Load())
+}
+
+// Close ends every event stream and stops the hub.
+func (h *SSEHub) Close() {
+	close(h.done)
+}
+
+func (h *SSEHub) Run() {
+	for {
+		select {
+		case sub := <-h.register:
+			h.subscribers[sub] = true
+			h.subscriberCount.Store(int64(len(h.subscribers)))
+			slog.Info("SSE client connected", slog.Int("clients", len(h.subscribers)))
+		case sub := <-h.unregister:
+			if _, ok := h.subscribers[sub]; ok {
+				h.remove(sub)
+				slog.Info("SSE client disconnected", slog.Int("clients", len(h.subscribers)))
+			}
+		case message := <-h.broadcast:
+			for sub := range h.subscribers {
+				if !sub.wants(message.DeviceID) {
+					continue
+				}
+				select {
+				case sub.events <- message.Data:
+				default:
+					// Drop clients that cannot keep up
+					h.remove(sub)
+				}
+			}
+		case <-h.done:
+			for sub := range h.subscribers {
+				h.remove(sub)
+			}
+			return
+		}
+	}
+}
+
+func (h *SSEHub) remove(sub *subscriber) {
+	close(sub.events)
+	delete(h.subscribers, sub)
+	h.subscriberCount.Store(int64(len(h.subscribers)))
+}
+
+func (h *SSEHub) subscribe(sub *subscriber) bool {
+	select {
+	case h.register <- sub:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+func (h *SSEHub) unsubscribe(sub *subscriber) {
+	select {
+	case h.unregister <- sub:
+	case <-h.done:
+	}
+}
@@ -0,0 +1,173 @@
+package sse
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-processor/internal/api"
+	"go-processor/internal/websocket"
+)
+
+// deviceStreamIdleTimeout ends a device stream that has received no event
+// for that long. EventSource clients reconnect on their own.
+const deviceStreamIdleTimeout = 30 * time.Second
+
+// SSEServer streams alerts and metrics as server-sent events for clients
+// that cannot use WebSocket.
+type SSEServer struct {
+	hub       *SSEHub
+	server    *http.Server
+	jwtSecret string
+
+	// idleTimeout ends device streams without events; see
+	// deviceStreamIdleTimeout.
+	idleTimeout time.Duration
+}
+
+// NewSSEServer creates a server listening on addr. When jwtSecret is set,
+// clients must present a bearer token signed with it, as for the WebSocket
+// server. When apiKeys is set, they must also present one of the keys, as for
+// the REST API.
+func NewSSEServer(addr string, jwtSecret string, apiKeys *api.APIKeys) *SSEServer {
+	s := &SSEServer{
+		hub:         NewSSEHub(),
+		jwtSecret:   jwtSecret,
+		idleTimeout: deviceStreamIdleTimeout,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", s.HandleSSE)
+	mux.HandleFunc("GET /api/v1/devices/{device_id}/stream", s.HandleDeviceStream)
+
+	var handler http.Handler = mux
+	if apiKeys != nil {
+		handler = api.APIKeyAuth(apiKeys, slog.Default())(handler)
+	}
+	s.server = &http.Server{Addr: addr, Handler: handler}
+
+	return s
+}
+
+// Hub returns the hub that distributes broadcasts to connected clients.
+func (s *SSEServer) Hub() *SSEHub {
+	return s.hub
+}
+
+func (s *SSEServer) Run() {
+	go s.hub.Run()
+
+	slog.Info("SSE server starting", slog.String("addr", s.server.Addr))
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("SSE server error", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+func (s *SSEServer) Stop(ctx context.Context) error {
+	// End the open streams first; Shutdown waits for them to finish
+	s.hub.Close()
+	return s.server.Shutdown(ctx)
+}
+
+// HandleSSE streams broadcasts to the client as "data: <json>" events until
+// it disconnects. The optional devices query parameter, a comma-separated
+// list of device IDs, limits alerts and metrics to those devices.
+func (s *SSEServer) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	s.serveStream(w, r, &subscriber{
+		events:  make(chan []byte, 256),
+		devices: parseDevices(r.URL.Query().Get("devices")),
+	}, 0)
+}
+
+// HandleDeviceStream streams the alerts and metrics of one device, leaving
+// out broadcasts that concern no device. The stream ends after idleTimeout
+// without events.
+func (s *SSEServer) HandleDeviceStream(w http.ResponseWriter, r *http.Request) {
+	s.serveStream(w, r, &subscriber{
+		events:     make(chan []byte, 256),
+		devices:    map[string]bool{r.PathValue("device_id"): true},
+		deviceOnly: true,
+	}, s.idleTimeout)
+}
+
+// serveStream subscribes sub to the hub and writes its events to the client
+// until it disconnects or, for a positive idleTimeout, no event arrives for
+// that long.
+func (s *SSEServer) serveStream(w http.ResponseWriter, r *http.Request, sub *subscriber, idleTimeout time.Duration) {
+	if s.jwtSecret != "" {
+		token, err := websocket.TokenFromRequest(r)
+		if err == nil {
+			_, err = websocket.ValidateToken(token, []byte(s.jwtSecret))
+		}
+		if err != nil {
+			slog.Warn("SSE authentication failed", slog.String("remote_addr", r.RemoteAddr), slog.Any("error", err))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sse"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if !s.hub.subscribe(sub) {
+		return
+	}
+	defer s.hub.unsubscribe(sub)
+
+	// idle stays nil, and never fires, for streams without a timeout
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if idleTimeout > 0 {
+		timer = time.NewTimer(idleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	for {
+		select {
+		case data, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+			if timer != nil {
+				timer.Reset(idleTimeout)
+			}
+		case <-idle:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func parseDevices(value string) map[string]bool {
+	if value == "" {
+		return nil
+	}
+	devices := make(map[string]bool)
+	for _, deviceID := range strings.Split(value, ",") {
+		if deviceID = strings.TrimSpace(deviceID); deviceID != "" {
+			devices[deviceID] = true
+		}
+	}
+	return devices
+}
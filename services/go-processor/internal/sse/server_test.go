@@ -0,0 +1,145 @@
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-processor/internal/api"
+	"go-processor/internal/websocket"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// stream serves req through the server's routes, publishes messages once the client has
+// subscribed, closes the hub to end the stream, and returns the recorder and
+// the data of every event it received.
+func stream(t *testing.T, server *SSEServer, req *http.Request, messages ...websocket.BroadcastMessage) (*httptest.ResponseRecorder, []string) {
+	t.Helper()
+	go server.hub.Run()
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.server.Handler.ServeHTTP(rec, req)
+	}()
+
+	if len(messages) > 0 {
+		assert.Eventually(t, func() bool { return server.hub.Subscribers() == 1 }, time.Second, time.Millisecond)
+		for _, message := range messages {
+			server.hub.Broadcast() <- message
+		}
+	}
+	server.hub.Close()
+	<-done
+
+	var events []string
+	scanner := bufio.NewScanner(strings.NewReader(rec.Body.String()))
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	return rec, events
+}
+
+func TestHandleSSE_StreamsBroadcasts(t *testing.T) {
+	server := NewSSEServer(":0", "", nil)
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+
+	rec, events := stream(t, server, req,
+		websocket.BroadcastMessage{DeviceID: "device-001", Data: []byte(`{"type":"alert"}`)},
+		websocket.BroadcastMessage{Data: []byte(`{"type":"device_status"}`)},
+	)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, []string{`{"type":"alert"}`, `{"type":"device_status"}`}, events)
+}
+
+func TestHandleSSE_FiltersByDevice(t *testing.T) {
+	server := NewSSEServer(":0", "", nil)
+	req := httptest.NewRequest(http.MethodGet, "/events?devices=device-001,device-003", nil)
+
+	_, events := stream(t, server, req,
+		websocket.BroadcastMessage{DeviceID: "device-001", Data: []byte(`1`)},
+		websocket.BroadcastMessage{DeviceID: "device-002", Data: []byte(`2`)},
+		websocket.BroadcastMessage{DeviceID: "device-003", Data: []byte(`3`)},
+	)
+
+	assert.Equal(t, []string{"1", "3"}, events)
+}
+
+func TestHandleSSE_RequiresToken(t *testing.T) {
+	server := NewSSEServer(":0", "secret", nil)
+
+	rec, events := stream(t, server, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, events)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	server = NewSSEServer(":0", "secret", nil)
+	rec, _ = stream(t, server, httptest.NewRequest(http.MethodGet, "/events?token="+token, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestSSEServer_RequiresAPIKey(t *testing.T) {
+	keys := api.NewAPIKeys(map[string]api.APIKeyRecord{"dashboard-key": {Name: "dashboard"}})
+
+	for _, target := range []string{"/events", "/api/v1/devices/device-001/stream"} {
+		server := NewSSEServer(":0", "", keys)
+		rec, events := stream(t, server, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, target)
+		assert.Empty(t, events)
+
+		server = NewSSEServer(":0", "", keys)
+		rec, _ = stream(t, server, httptest.NewRequest(http.MethodGet, target+"?api_key=dashboard-key", nil))
+		assert.Equal(t, http.StatusOK, rec.Code, target)
+	}
+}
+
+func TestHandleDeviceStream_StreamsDeviceBroadcasts(t *testing.T) {
+	server := NewSSEServer(":0", "", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/devices/device-001/stream", nil)
+
+	rec, events := stream(t, server, req,
+		websocket.BroadcastMessage{DeviceID: "device-001", Data: []byte(`{"type":"metric","value":21.5}`)},
+		websocket.BroadcastMessage{DeviceID: "device-002", Data: []byte(`{"type":"metric","value":30}`)},
+		websocket.BroadcastMessage{Data: []byte(`{"type":"device_status"}`)},
+		websocket.BroadcastMessage{DeviceID: "device-001", Data: []byte(`{"type":"alert"}`)},
+	)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, []string{`{"type":"metric","value":21.5}`, `{"type":"alert"}`}, events)
+}
+
+func TestHandleDeviceStream_EndsWhenIdle(t *testing.T) {
+	server := NewSSEServer(":0", "", nil)
+	server.idleTimeout = 10 * time.Millisecond
+	go server.hub.Run()
+	defer server.hub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/devices/device-001/stream", nil)
+		server.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected an idle device stream to end")
+	}
+	assert.Eventually(t, func() bool { return server.hub.Subscribers() == 0 }, time.Second, time.Millisecond)
+}
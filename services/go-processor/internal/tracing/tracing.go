@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go-processor/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const serviceName = "go-processor"
+
+// Init installs the global tracer provider and W3C trace context propagator.
+// Spans are exported over OTLP gRPC to cfg.OTLPEndpoint; when it is empty,
+// spans are still created so trace context propagates, but none are exported.
+// The returned function flushes pending spans and must be called on shutdown.
+func Init(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	res := resource.NewSchemaless(attribute.String("service.name", serviceName))
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+
+	if cfg.OTLPEndpoint != "" {
+		exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(cfg.OTLPEndpoint))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+		slog.Info("Exporting traces over OTLP", slog.String("endpoint", cfg.OTLPEndpoint))
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
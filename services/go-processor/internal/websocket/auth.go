@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrMissingToken is returned when a request carries no bearer token.
+var ErrMissingToken = errors.New("missing bearer token")
+
+// TokenFromRequest extracts the bearer token from the Authorization header,
+// falling back to the token query parameter for browser clients, which cannot
+// set headers on WebSocket handshakes.
+func TokenFromRequest(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", fmt.Errorf("malformed Authorization header")
+		}
+		return token, nil
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, nil
+	}
+
+	return "", ErrMissingToken
+}
+
+// ValidateToken verifies the signature and expiry of an HMAC-signed JWT
+// against secret and returns its claims.
+func ValidateToken(tokenString string, secret []byte) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	return claims, nil
+}
+
+// authenticate validates the bearer token of a WebSocket handshake. It
+// accepts every request when no secret is configured.
+func (s *Server) authenticate(r *http.Request) (*jwt.RegisteredClaims, error) {
+	if s.opts.JWTSecret == "" {
+		return &jwt.RegisteredClaims{}, nil
+	}
+
+	token, err := TokenFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateToken(token, []byte(s.opts.JWTSecret))
+}
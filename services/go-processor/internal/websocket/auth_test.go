@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-secret"
+
+func signToken(t *testing.T, secret string, expiresAt time.Time) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "dashboard",
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	signed, err := token.SignedString([]byte(secret))
+	assert.NoError(t, err)
+	return signed
+}
+
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	server := NewServer(":0", ServerOptions{JWTSecret: testSecret})
+	go server.hub.Run()
+
+	ts := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func dial(url string, header http.Header) (*http.Response, error) {
+	conn, resp, err := gorilla.DefaultDialer.Dial(url, header)
+	if conn != nil {
+		conn.Close()
+	}
+	return resp, err
+}
+
+func TestHandleWebSocket_ValidToken(t *testing.T) {
+	url := newTestServer(t)
+	token := signToken(t, testSecret, time.Now().Add(time.Hour))
+
+	resp, err := dial(url, http.Header{"Authorization": []string{"Bearer " + token}})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// Browser clients pass the token as a query parameter instead
+	resp, err = dial(url+"?token="+token, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+}
+
+func TestHandleWebSocket_ExpiredToken(t *testing.T) {
+	url := newTestServer(t)
+	token := signToken(t, testSecret, time.Now().Add(-time.Minute))
+
+	resp, err := dial(url, http.Header{"Authorization": []string{"Bearer " + token}})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestHandleWebSocket_WrongSecret(t *testing.T) {
+	url := newTestServer(t)
+	token := signToken(t, "other-secret", time.Now().Add(time.Hour))
+
+	resp, err := dial(url, http.Header{"Authorization": []string{"Bearer " + token}})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestHandleWebSocket_MissingToken(t *testing.T) {
+	url := newTestServer(t)
+
+	resp, err := dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	_, err := TokenFromRequest(req)
+	assert.ErrorIs(t, err, ErrMissingToken)
+
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, err = TokenFromRequest(req)
+	assert.Error(t, err)
+
+	req.Header.Set("Authorization", "Bearer abc.def.ghi")
+	token, err := TokenFromRequest(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc.def.ghi", token)
+}
@@ -1,41 +1,268 @@
 package websocket
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"go-processor/internal/kafka"
+	"go-processor/internal/metrics"
+
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// writeWait bounds how long a single write to a client may block.
+const writeWait = 10 * time.Second
+
+// Defaults for clients that redial their connection with reconnect.
+const (
+	defaultMaxReconnectAttempts = 5
+	defaultReconnectBaseDelay   = 500 * time.Millisecond
+)
+
 type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
 	send chan []byte
+
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+
+	// commands publishes the device commands the client sends. Nil rejects
+	// them.
+	commands CommandSender
+
+	// MaxReconnectAttempts bounds how often reconnect dials before giving
+	// up, waiting ReconnectBaseDelay * 2^attempt before each attempt.
+	MaxReconnectAttempts int
+	ReconnectBaseDelay   time.Duration
+}
+
+// clientMessage is sent by clients to choose which devices they receive
+// broadcasts for, e.g. {"subscribe": ["device-001"]} or
+// {"subscribe_all": true}, or realtime aggregates for, e.g.
+// {"subscribe_realtime": ["device-001"]}, or, with Type "command", to send
+// a kafka.DeviceCommand to a device.
+type clientMessage struct {
+	Type              string   `json:"type"`
+	Subscribe         []string `json:"subscribe"`
+	SubscribeAll      bool     `json:"subscribe_all"`
+	SubscribeRealtime []string `json:"subscribe_realtime"`
+}
+
+// Client message types besides subscriptions.
+const (
+	messageTypeCommand      = "command"
+	messageTypeCommandAck   = "command_ack"
+	messageTypeCommandError = "command_error"
+)
+
+// CommandSender publishes the device commands clients send.
+type CommandSender interface {
+	SendCommand(command kafka.DeviceCommand) error
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn) *Client {
+// commandReply tells a client whether its command was published: a
+// "command_ack" once it is on the commands topic, or a "command_error".
+type commandReply struct {
+	Type      string `json:"type"`
+	CommandID string `json:"command_id"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewClient wraps an upgraded connection. The client is pinged every
+// pingInterval and considered dead if no pong arrives within pongTimeout of a
+// ping; a zero pingInterval disables health checking.
+func NewClient(hub *Hub, conn *websocket.Conn, pingInterval, pongTimeout time.Duration) *Client {
+	// Only takes effect when permessage-deflate was negotiated. The
+	// connection keeps gorilla's default compression level (flate.BestSpeed).
+	conn.EnableWriteCompression(true)
+
 	return &Client{
 		hub:  hub,
 		conn: conn,
 		send: make(chan []byte, 256),
+
+		pingInterval: pingInterval,
+		pongTimeout:  pongTimeout,
+
+		MaxReconnectAttempts: defaultMaxReconnectAttempts,
+		ReconnectBaseDelay:   defaultReconnectBaseDelay,
 	}
 }
 
+// reconnect replaces a lost connection with one from dialFunc, retrying with
+// exponential backoff. It is meant for clients the service dials itself,
+// such as a co-located dashboard, and must only be called once the pumps of
+// the previous connection have returned.
+func (c *Client) reconnect(ctx context.Context, dialFunc func() (*websocket.Conn, error)) error {
+	var lastErr error
+	for attempt := 0; attempt < c.MaxReconnectAttempts; attempt++ {
+		delay := c.ReconnectBaseDelay * time.Duration(1<<attempt)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		conn, err := dialFunc()
+		if err != nil {
+			lastErr = err
+			slog.Warn("WebSocket reconnect attempt failed",
+				slog.Int("attempt", attempt+1), slog.Duration("delay", delay), slog.Any("error", err))
+			continue
+		}
+
+		c.conn.Close()
+		conn.EnableWriteCompression(true)
+		c.conn = conn
+		slog.Info("WebSocket reconnected", slog.Int("attempt", attempt+1))
+		return nil
+	}
+
+	return fmt.Errorf("failed to reconnect after %d attempts: %w", c.MaxReconnectAttempts, lastErr)
+}
+
+// extendReadDeadline gives the client until the next ping is due, plus the
+// pong timeout, to show it is alive.
+func (c *Client) extendReadDeadline() error {
+	if c.pingInterval <= 0 {
+		return nil
+	}
+	return c.conn.SetReadDeadline(time.Now().Add(c.pingInterval + c.pongTimeout))
+}
+
 func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
+
+	c.extendReadDeadline()
+	c.conn.SetPongHandler(func(string) error {
+		return c.extendReadDeadline()
+	})
+
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				metrics.WebSocketDeadConnections.Inc()
+				slog.Warn("Evicting WebSocket client that stopped answering pings",
+					slog.String("remote_addr", c.conn.RemoteAddr().String()))
+			}
 			break
 		}
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			slog.Warn("Ignoring malformed WebSocket message", slog.Any("error", err))
+			continue
+		}
+		if msg.Type == messageTypeCommand {
+			c.handleCommand(data)
+			continue
+		}
+		if msg.SubscribeRealtime != nil {
+			c.hub.subscribe <- SubscriptionRequest{
+				Client:    c,
+				DeviceIDs: msg.SubscribeRealtime,
+				Realtime:  true,
+			}
+			// Leave the broadcast subscription alone unless it is set too
+			if msg.Subscribe == nil && !msg.SubscribeAll {
+				continue
+			}
+		}
+		c.hub.subscribe <- SubscriptionRequest{
+			Client:    c,
+			DeviceIDs: msg.Subscribe,
+			All:       msg.SubscribeAll,
+		}
 	}
 }
 
+// handleCommand publishes the command in data and replies to the client
+// with the outcome. Commands without a command_id are given one.
+func (c *Client) handleCommand(data []byte) {
+	var command kafka.DeviceCommand
+	if err := json.Unmarshal(data, &command); err != nil {
+		c.reply(commandReply{Type: messageTypeCommandError, Error: fmt.Sprintf("invalid command: %v", err)})
+		return
+	}
+	if command.CommandID == "" {
+		command.CommandID = uuid.NewString()
+	}
+
+	var err error
+	if c.commands == nil {
+		err = errors.New("commands are not enabled")
+	} else {
+		err = c.commands.SendCommand(command)
+	}
+	if err != nil {
+		slog.Warn("Rejected WebSocket command",
+			slog.String("command_id", command.CommandID),
+			slog.String("device_id", command.DeviceID),
+			slog.Any("error", err))
+		c.reply(commandReply{Type: messageTypeCommandError, CommandID: command.CommandID, Error: err.Error()})
+		return
+	}
+
+	slog.Info("Published WebSocket command",
+		slog.String("command_id", command.CommandID),
+		slog.String("device_id", command.DeviceID),
+		slog.String("command", command.Command))
+	c.reply(commandReply{Type: messageTypeCommandAck, CommandID: command.CommandID})
+}
+
+// reply sends a message to this client only, through the hub, which owns
+// the send channel.
+func (c *Client) reply(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("Failed to marshal WebSocket reply", slog.Any("error", err))
+		return
+	}
+	c.hub.direct <- directMessage{client: c, data: data}
+}
+
 func (c *Client) WritePump() {
+	var pingC <-chan time.Time
+	if c.pingInterval > 0 {
+		ticker := time.NewTicker(c.pingInterval)
+		defer ticker.Stop()
+		pingC = ticker.C
+	}
+	// Closing the connection makes ReadPump fail and unregister the client
 	defer c.conn.Close()
-	for msg := range c.send {
-		if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-			break
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub dropped the client
+				c.conn.WriteMessage(websocket.CloseMessage, nil)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+			metrics.WebSocketBytesBeforeCompression.Add(float64(len(msg)))
+		case <-pingC:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
 		}
 	}
 }
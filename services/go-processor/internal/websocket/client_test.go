@@ -0,0 +1,261 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-processor/internal/kafka"
+	"go-processor/internal/metrics"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testPingInterval = 50 * time.Millisecond
+	testPongTimeout  = 50 * time.Millisecond
+)
+
+func dialHealthChecked(t *testing.T) (*Server, *gorilla.Conn) {
+	t.Helper()
+
+	server := NewServer(":0", ServerOptions{PingInterval: testPingInterval, PongTimeout: testPongTimeout})
+	go server.hub.Run()
+	ts := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	assert.Eventually(t, func() bool { return server.GetConnectedClients() == 1 }, time.Second, time.Millisecond)
+	return server, conn
+}
+
+func TestClient_EvictsClientWithoutPongs(t *testing.T) {
+	deadBefore := testutil.ToFloat64(metrics.WebSocketDeadConnections)
+
+	// The client never reads, so it never answers the server's pings
+	server, _ := dialHealthChecked(t)
+
+	assert.Eventually(t, func() bool { return server.GetConnectedClients() == 0 },
+		testPongTimeout+testPingInterval+100*time.Millisecond, 5*time.Millisecond)
+	assert.Equal(t, deadBefore+1, testutil.ToFloat64(metrics.WebSocketDeadConnections))
+}
+
+func TestClient_KeepsClientAnsweringPongs(t *testing.T) {
+	server, conn := dialHealthChecked(t)
+
+	// Reading lets the client's default ping handler reply with pongs
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(4 * (testPingInterval + testPongTimeout))
+	assert.Equal(t, 1, server.GetConnectedClients())
+}
+
+// closingServer accepts WebSocket connections and closes each one right
+// away, as a restarting server would.
+func closingServer(t *testing.T) (url string, accepted *atomic.Int32) {
+	t.Helper()
+
+	accepted = &atomic.Int32{}
+	upgrader := gorilla.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted.Add(1)
+		conn.WriteMessage(gorilla.CloseMessage, gorilla.FormatCloseMessage(gorilla.CloseServiceRestart, ""))
+		conn.Close()
+	}))
+	t.Cleanup(ts.Close)
+
+	return "ws" + strings.TrimPrefix(ts.URL, "http"), accepted
+}
+
+func TestClient_ReconnectsAfterDisconnect(t *testing.T) {
+	url, accepted := closingServer(t)
+	dial := func() (*gorilla.Conn, error) {
+		conn, _, err := gorilla.DefaultDialer.Dial(url, nil)
+		return conn, err
+	}
+
+	conn, err := dial()
+	assert.NoError(t, err)
+	client := NewClient(nil, conn, 0, 0)
+	client.ReconnectBaseDelay = time.Millisecond
+	t.Cleanup(func() { client.conn.Close() })
+
+	_, _, err = client.conn.ReadMessage()
+	assert.True(t, gorilla.IsCloseError(err, gorilla.CloseServiceRestart))
+
+	assert.NoError(t, client.reconnect(context.Background(), dial))
+	assert.NotSame(t, conn, client.conn)
+	assert.Equal(t, int32(2), accepted.Load())
+}
+
+func TestClient_ReconnectBacksOffAndGivesUp(t *testing.T) {
+	url, _ := closingServer(t)
+	conn, _, err := gorilla.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+
+	client := NewClient(nil, conn, 0, 0)
+	client.MaxReconnectAttempts = 3
+	client.ReconnectBaseDelay = 10 * time.Millisecond
+
+	var attempts []time.Time
+	dialErr := errors.New("connection refused")
+	start := time.Now()
+	err = client.reconnect(context.Background(), func() (*gorilla.Conn, error) {
+		attempts = append(attempts, time.Now())
+		return nil, dialErr
+	})
+
+	assert.ErrorIs(t, err, dialErr)
+	assert.Len(t, attempts, 3)
+	// Waits of 10ms, 20ms and 40ms precede the attempts
+	assert.GreaterOrEqual(t, attempts[0].Sub(start), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, attempts[2].Sub(attempts[1]), 40*time.Millisecond)
+}
+
+func TestClient_ReconnectStopsWhenCancelled(t *testing.T) {
+	url, _ := closingServer(t)
+	conn, _, err := gorilla.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+
+	client := NewClient(nil, conn, 0, 0)
+	client.ReconnectBaseDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.reconnect(ctx, func() (*gorilla.Conn, error) {
+		t.Error("dialled after cancellation")
+		return nil, errors.New("unexpected dial")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// recordingCommands stands in for the Kafka command producer.
+type recordingCommands struct {
+	commands chan kafka.DeviceCommand
+	err      error
+}
+
+func (r *recordingCommands) SendCommand(command kafka.DeviceCommand) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.commands <- command
+	return nil
+}
+
+func dialWithCommands(t *testing.T, commands CommandSender) *gorilla.Conn {
+	t.Helper()
+
+	server := NewServer(":0", ServerOptions{Commands: commands})
+	go server.hub.Run()
+	ts := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestClient_PublishesCommands(t *testing.T) {
+	commands := &recordingCommands{commands: make(chan kafka.DeviceCommand, 1)}
+	conn := dialWithCommands(t, commands)
+
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte(`{
+		"type": "command",
+		"command_id": "cmd-1",
+		"device_id": "device-001",
+		"command": "set_interval",
+		"parameters": {"seconds": 30}
+	}`)))
+
+	select {
+	case command := <-commands.commands:
+		assert.Equal(t, kafka.DeviceCommand{
+			CommandID:  "cmd-1",
+			DeviceID:   "device-001",
+			Command:    "set_interval",
+			Parameters: map[string]interface{}{"seconds": 30.0},
+		}, command)
+	case <-time.After(time.Second):
+		t.Fatal("expected the command to be published")
+	}
+
+	_, reply, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "command_ack", "command_id": "cmd-1"}`, string(reply))
+}
+
+func TestClient_RejectsFailedCommands(t *testing.T) {
+	conn := dialWithCommands(t, &recordingCommands{err: errors.New("invalid command: command is required")})
+
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte(`{"type": "command", "command_id": "cmd-2", "device_id": "device-001"}`)))
+
+	_, reply, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "command_error", "command_id": "cmd-2", "error": "invalid command: command is required"}`, string(reply))
+}
+
+func TestClient_RejectsCommandsWhenDisabled(t *testing.T) {
+	conn := dialWithCommands(t, nil)
+
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte(`{"type": "command", "device_id": "device-001", "command": "reboot"}`)))
+
+	_, reply, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	var ack commandReply
+	assert.NoError(t, json.Unmarshal(reply, &ack))
+	assert.Equal(t, messageTypeCommandError, ack.Type)
+	assert.NotEmpty(t, ack.CommandID)
+	assert.Equal(t, "commands are not enabled", ack.Error)
+}
+
+func TestClient_SubscribesToRealtimeAggregates(t *testing.T) {
+	server := NewServer(":0", ServerOptions{})
+	go server.hub.Run()
+	ts := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte(`{"subscribe": ["device-001"]}`)))
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte(`{"subscribe_realtime": ["device-002"]}`)))
+	assert.Eventually(t, func() bool { return server.RealtimeSubscribed("device-002") }, time.Second, time.Millisecond)
+
+	// The realtime subscription kept the broadcast subscription
+	server.BroadcastMetric("device-001", map[string]float64{"temperature": 21})
+	server.BroadcastRealtimeAggregate("device-002", RealtimeAggregate{DeviceID: "device-002"})
+
+	var metric, aggregate Message
+	assert.NoError(t, conn.ReadJSON(&metric))
+	assert.NoError(t, conn.ReadJSON(&aggregate))
+	assert.Equal(t, "metric", metric.Type)
+	assert.Equal(t, "realtime_aggregate", aggregate.Type)
+
+	assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, []byte(`{"subscribe_realtime": []}`)))
+	assert.Eventually(t, func() bool { return !server.RealtimeSubscribed("device-002") }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,43 @@
+package websocket
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"go-processor/internal/metrics"
+)
+
+// countingResponseWriter wraps the connection hijacked by the upgrader so
+// that every byte written to the client, after permessage-deflate, is
+// counted in ws_bytes_after_compression_total.
+type countingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counted := &countingConn{Conn: conn}
+	return counted, bufio.NewReadWriter(brw.Reader, bufio.NewWriter(counted)), nil
+}
+
+// countingConn counts the bytes written to a client connection, including
+// frame headers and control frames.
+type countingConn struct {
+	net.Conn
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	metrics.WebSocketBytesAfterCompression.Add(float64(n))
+	return n, err
+}
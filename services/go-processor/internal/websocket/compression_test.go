@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-processor/internal/metrics"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// bytesWritten broadcasts a large, repetitive message to a single client and
+// returns the payload size and the bytes written to the connection for it.
+func bytesWritten(t *testing.T, compression bool) (before, after float64) {
+	t.Helper()
+
+	server := NewServer(":0", ServerOptions{Compression: compression})
+	go server.hub.Run()
+	ts := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+	defer ts.Close()
+
+	dialer := gorilla.Dialer{EnableCompression: true}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// Wait for the hub to register the client before broadcasting
+	assert.Eventually(t, func() bool { return server.GetConnectedClients() == 1 }, time.Second, time.Millisecond)
+
+	beforeStart := testutil.ToFloat64(metrics.WebSocketBytesBeforeCompression)
+	afterStart := testutil.ToFloat64(metrics.WebSocketBytesAfterCompression)
+
+	server.BroadcastDeviceStatus(strings.Repeat(`{"device_id":"sensor-001","status":"online"}`, 500))
+
+	_, payload, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), "sensor-001")
+
+	// The counters are updated after the write returns
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.WebSocketBytesBeforeCompression) > beforeStart
+	}, time.Second, time.Millisecond)
+
+	return testutil.ToFloat64(metrics.WebSocketBytesBeforeCompression) - beforeStart,
+		testutil.ToFloat64(metrics.WebSocketBytesAfterCompression) - afterStart
+}
+
+func TestWritePump_CompressesPayloads(t *testing.T) {
+	before, after := bytesWritten(t, true)
+	assert.Less(t, after, before/10)
+}
+
+func TestWritePump_CompressionDisabled(t *testing.T) {
+	before, after := bytesWritten(t, false)
+	assert.GreaterOrEqual(t, after, before)
+}
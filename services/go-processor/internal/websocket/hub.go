@@ -1,22 +1,82 @@
 package websocket
 
 import (
-	"log"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 )
 
+// subscribeAllKey marks a client subscribed to every device in the
+// subscription table.
+const subscribeAllKey = "*"
+
+// SubscriptionRequest replaces the set of devices a client receives
+// broadcasts for, or with Realtime, the set it receives realtime aggregates
+// for.
+type SubscriptionRequest struct {
+	Client    *Client
+	DeviceIDs []string
+	All       bool
+	Realtime  bool
+}
+
+// BroadcastMessage is an encoded Message for the clients subscribed to
+// DeviceID. An empty DeviceID reaches every client.
+type BroadcastMessage struct {
+	DeviceID string
+	Data     []byte
+
+	// Replay is the message encoded with IsReplay set, sent to clients that
+	// join later. Nil leaves the message out of the replay buffer.
+	Replay []byte
+
+	// Realtime sends the message only to the clients subscribed to
+	// realtime aggregates of DeviceID.
+	Realtime bool
+}
+
+// directMessage is sent to a single client, such as the reply to a
+// command.
+type directMessage struct {
+	client *Client
+	data   []byte
+}
+
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
+	clients       map[*Client]bool
+	subscriptions map[*Client]map[string]bool
+	realtime      map[*Client]map[string]bool
+	broadcast     chan BroadcastMessage
+	register      chan *Client
+	unregister    chan *Client
+	subscribe     chan SubscriptionRequest
+	direct        chan directMessage
+
+	// replay holds recent broadcasts, sent to each client on its first
+	// subscription. Nil disables replay.
+	replay *ReplayBuffer
+
+	// clientCount mirrors len(clients) for readers outside Run.
+	clientCount atomic.Int64
+
+	// realtimeDevices counts the clients subscribed to realtime aggregates
+	// of each device, for readers outside Run.
+	realtimeMutex   sync.RWMutex
+	realtimeDevices map[string]int
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		clients:       make(map[*Client]bool),
+		subscriptions: make(map[*Client]map[string]bool),
+		realtime:      make(map[*Client]map[string]bool),
+		broadcast:     make(chan BroadcastMessage),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		subscribe:     make(chan SubscriptionRequest),
+		direct:        make(chan directMessage),
+
+		realtimeDevices: make(map[string]int),
 	}
 }
 
@@ -25,22 +85,129 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
-			log.Println("WebSocket client connected")
+			h.clientCount.Store(int64(len(h.clients)))
+			slog.Info("WebSocket client connected", slog.Int("clients", len(h.clients)))
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				log.Println("WebSocket client disconnected")
+				h.removeClient(client)
+				slog.Info("WebSocket client disconnected", slog.Int("clients", len(h.clients)))
+			}
+		case request := <-h.subscribe:
+			if _, ok := h.clients[request.Client]; ok && request.Realtime {
+				h.setRealtime(request.Client, subscriptionSet(request))
+				slog.Info("WebSocket client subscribed to realtime aggregates",
+					slog.Any("device_ids", request.DeviceIDs))
+			} else if ok {
+				_, resubscribed := h.subscriptions[request.Client]
+				h.subscriptions[request.Client] = subscriptionSet(request)
+				slog.Info("WebSocket client subscribed",
+					slog.Bool("all", request.All), slog.Any("device_ids", request.DeviceIDs))
+
+				// Clients only receive broadcasts once subscribed, so
+				// catch them up then, before any live broadcast
+				if !resubscribed {
+					h.replayTo(request.Client)
+				}
+			}
+		case message := <-h.direct:
+			// The client may have been dropped since it sent its request
+			if _, ok := h.clients[message.client]; ok {
+				select {
+				case message.client.send <- message.data:
+				default:
+					h.removeClient(message.client)
+				}
 			}
 		case message := <-h.broadcast:
+			if message.Replay != nil {
+				h.replay.Add(message)
+			}
 			for client := range h.clients {
+				if message.Realtime && !h.realtime[client][message.DeviceID] {
+					continue
+				}
+				if !message.Realtime && !h.isSubscribed(client, message.DeviceID) {
+					continue
+				}
 				select {
-				case client.send <- message:
+				case client.send <- message.Data:
 				default:
-					close(client.send)
-					delete(h.clients, client)
+					h.removeClient(client)
 				}
 			}
 		}
 	}
 }
+
+// replayTo queues the buffered broadcasts client is subscribed to.
+func (h *Hub) replayTo(client *Client) {
+	for _, message := range h.replay.Messages() {
+		if !h.isSubscribed(client, message.DeviceID) {
+			continue
+		}
+		select {
+		case client.send <- message.Replay:
+		default:
+			h.removeClient(client)
+			return
+		}
+	}
+}
+
+func (h *Hub) removeClient(client *Client) {
+	close(client.send)
+	delete(h.clients, client)
+	delete(h.subscriptions, client)
+	h.setRealtime(client, nil)
+	h.clientCount.Store(int64(len(h.clients)))
+}
+
+// setRealtime replaces the devices client receives realtime aggregates for.
+// Nil removes its realtime subscription.
+func (h *Hub) setRealtime(client *Client, devices map[string]bool) {
+	h.realtimeMutex.Lock()
+	defer h.realtimeMutex.Unlock()
+
+	for deviceID := range h.realtime[client] {
+		if h.realtimeDevices[deviceID]--; h.realtimeDevices[deviceID] == 0 {
+			delete(h.realtimeDevices, deviceID)
+		}
+	}
+	if devices == nil {
+		delete(h.realtime, client)
+		return
+	}
+	h.realtime[client] = devices
+	for deviceID := range devices {
+		h.realtimeDevices[deviceID]++
+	}
+}
+
+// wantsRealtime reports whether any client is subscribed to realtime
+// aggregates of deviceID.
+func (h *Hub) wantsRealtime(deviceID string) bool {
+	h.realtimeMutex.RLock()
+	defer h.realtimeMutex.RUnlock()
+	return h.realtimeDevices[deviceID] > 0
+}
+
+// isSubscribed reports whether client should receive a broadcast for
+// deviceID. Broadcasts without a device go to every client.
+func (h *Hub) isSubscribed(client *Client, deviceID string) bool {
+	if deviceID == "" {
+		return true
+	}
+	devices := h.subscriptions[client]
+	return devices[subscribeAllKey] || devices[deviceID]
+}
+
+func subscriptionSet(request SubscriptionRequest) map[string]bool {
+	if request.All {
+		return map[string]bool{subscribeAllKey: true}
+	}
+	devices := make(map[string]bool, len(request.DeviceIDs))
+	for _, deviceID := range request.DeviceIDs {
+		devices[deviceID] = true
+	}
+	return devices
+}
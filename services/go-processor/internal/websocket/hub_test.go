@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(hub *Hub) *Client {
+	client := &Client{hub: hub, send: make(chan []byte, 16)}
+	hub.register <- client
+	return client
+}
+
+// nextMessage returns the next message queued for client.
+func nextMessage(t *testing.T, client *Client) string {
+	t.Helper()
+	select {
+	case msg := <-client.send:
+		return string(msg)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for broadcast")
+		return ""
+	}
+}
+
+func TestHub_FiltersBroadcastsBySubscription(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	one := newTestClient(hub)
+	all := newTestClient(hub)
+	none := newTestClient(hub)
+
+	hub.subscribe <- SubscriptionRequest{Client: one, DeviceIDs: []string{"device-001"}}
+	hub.subscribe <- SubscriptionRequest{Client: all, All: true}
+
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-001", Data: []byte("a")}
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-002", Data: []byte("b")}
+	// Device-less broadcasts reach everyone and mark the end of the sequence
+	hub.broadcast <- BroadcastMessage{Data: []byte("end")}
+
+	assert.Equal(t, "a", nextMessage(t, one))
+	assert.Equal(t, "end", nextMessage(t, one))
+
+	assert.Equal(t, "a", nextMessage(t, all))
+	assert.Equal(t, "b", nextMessage(t, all))
+	assert.Equal(t, "end", nextMessage(t, all))
+
+	assert.Equal(t, "end", nextMessage(t, none))
+}
+
+func TestHub_SubscriptionReplacesPrevious(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	client := newTestClient(hub)
+	hub.subscribe <- SubscriptionRequest{Client: client, All: true}
+	hub.subscribe <- SubscriptionRequest{Client: client, DeviceIDs: []string{"device-002"}}
+
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-001", Data: []byte("a")}
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-002", Data: []byte("b")}
+
+	assert.Equal(t, "b", nextMessage(t, client))
+}
+
+func replayable(deviceID, data string) BroadcastMessage {
+	return BroadcastMessage{DeviceID: deviceID, Data: []byte(data), Replay: []byte("replay " + data)}
+}
+
+func TestReplayBuffer_KeepsLatestInOrder(t *testing.T) {
+	buffer := NewReplayBuffer(3)
+	assert.Empty(t, buffer.Messages())
+
+	for _, data := range []string{"a", "b", "c", "d"} {
+		buffer.Add(BroadcastMessage{Data: []byte(data)})
+	}
+
+	var got []string
+	for _, message := range buffer.Messages() {
+		got = append(got, string(message.Data))
+	}
+	assert.Equal(t, []string{"b", "c", "d"}, got)
+
+	assert.Nil(t, NewReplayBuffer(0))
+}
+
+func TestHub_ReplaysBufferedBroadcastsOnFirstSubscription(t *testing.T) {
+	hub := NewHub()
+	hub.replay = NewReplayBuffer(2)
+	go hub.Run()
+
+	hub.broadcast <- replayable("device-001", "a")
+	hub.broadcast <- replayable("device-002", "b")
+	hub.broadcast <- replayable("device-001", "c")
+
+	client := newTestClient(hub)
+	hub.subscribe <- SubscriptionRequest{Client: client, DeviceIDs: []string{"device-001"}}
+	hub.broadcast <- replayable("device-001", "live")
+
+	// "a" was evicted and "b" is for another device
+	assert.Equal(t, "replay c", nextMessage(t, client))
+	assert.Equal(t, "live", nextMessage(t, client))
+
+	// Changing the subscription does not replay again
+	hub.subscribe <- SubscriptionRequest{Client: client, All: true}
+	hub.broadcast <- BroadcastMessage{Data: []byte("end")}
+	assert.Equal(t, "end", nextMessage(t, client))
+}
+
+func TestServer_BroadcastMarksReplayedMessages(t *testing.T) {
+	server := NewServer(":0", ServerOptions{ReplayBufferSize: 10})
+	go server.hub.Run()
+
+	server.BroadcastAlert("device-001", map[string]string{"severity": "high"})
+
+	client := newTestClient(server.hub)
+	server.hub.subscribe <- SubscriptionRequest{Client: client, All: true}
+	server.BroadcastAlert("device-001", map[string]string{"severity": "low"})
+
+	var replayed, live Message
+	assert.NoError(t, json.Unmarshal([]byte(nextMessage(t, client)), &replayed))
+	assert.NoError(t, json.Unmarshal([]byte(nextMessage(t, client)), &live))
+	assert.True(t, replayed.IsReplay)
+	assert.Equal(t, "high", replayed.Data.(map[string]interface{})["severity"])
+	assert.False(t, live.IsReplay)
+	assert.Equal(t, "low", live.Data.(map[string]interface{})["severity"])
+}
@@ -0,0 +1,207 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// messageTypeRealtimeAggregate is the type of the messages carrying
+	// RealtimeAggregates.
+	messageTypeRealtimeAggregate = "realtime_aggregate"
+
+	// realtimeWindowSeconds is the length of the rolling window, kept as
+	// one bucket per second.
+	realtimeWindowSeconds = 60
+
+	// realtimePublishInterval is how often the current aggregates are sent.
+	realtimePublishInterval = 5 * time.Second
+)
+
+// RealtimeAggregate summarizes a device's telemetry over the last minute.
+type RealtimeAggregate struct {
+	DeviceID    string                    `json:"device_id"`
+	WindowStart int64                     `json:"window_start"` // epoch ms
+	WindowEnd   int64                     `json:"window_end"`
+	Metrics     map[string]RealtimeMetric `json:"metrics"`
+}
+
+// RealtimeMetric is the summary of one metric in a RealtimeAggregate.
+type RealtimeMetric struct {
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// realtimeBucket summarizes the samples of a metric received in one second.
+type realtimeBucket struct {
+	second        int64
+	sum, min, max float64
+	count         int
+}
+
+// realtimeWindow holds a metric's buckets, indexed by second modulo the
+// window length.
+type realtimeWindow [realtimeWindowSeconds]realtimeBucket
+
+// realtimeBroadcaster is the subset of Server used by RealtimeAggregator.
+type realtimeBroadcaster interface {
+	RealtimeSubscribed(deviceID string) bool
+	BroadcastRealtimeAggregate(deviceID string, aggregate interface{})
+}
+
+// RealtimeAggregator keeps a rolling 60-second window of the telemetry of
+// devices with realtime subscribers and sends them its aggregate every 5
+// seconds, for dashboards that can't wait for the minute aggregates to be
+// flushed. Samples are bucketed by arrival time.
+type RealtimeAggregator struct {
+	broadcaster realtimeBroadcaster
+
+	mutex   sync.Mutex
+	windows map[string]map[string]*realtimeWindow // device, metric
+
+	// now is replaced in tests
+	now func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRealtimeAggregator(server *Server) *RealtimeAggregator {
+	return newRealtimeAggregator(server)
+}
+
+func newRealtimeAggregator(broadcaster realtimeBroadcaster) *RealtimeAggregator {
+	return &RealtimeAggregator{
+		broadcaster: broadcaster,
+		windows:     make(map[string]map[string]*realtimeWindow),
+		now:         time.Now,
+	}
+}
+
+// ObserveTelemetry adds a message's metrics to its device's window, if any
+// client is subscribed to the device's realtime aggregates.
+func (r *RealtimeAggregator) ObserveTelemetry(deviceID string, metrics map[string]float64) {
+	if !r.broadcaster.RealtimeSubscribed(deviceID) {
+		return
+	}
+	second := r.now().Unix()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	windows := r.windows[deviceID]
+	if windows == nil {
+		windows = make(map[string]*realtimeWindow)
+		r.windows[deviceID] = windows
+	}
+	for metricName, value := range metrics {
+		window := windows[metricName]
+		if window == nil {
+			window = &realtimeWindow{}
+			windows[metricName] = window
+		}
+		bucket := &window[second%realtimeWindowSeconds]
+		if bucket.second != second {
+			*bucket = realtimeBucket{second: second, min: value, max: value}
+		}
+		bucket.sum += value
+		bucket.min = min(bucket.min, value)
+		bucket.max = max(bucket.max, value)
+		bucket.count++
+	}
+}
+
+// Start launches the publishing goroutine, which runs until ctx is
+// cancelled or Stop is called.
+func (r *RealtimeAggregator) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(realtimePublishInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.publish()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *RealtimeAggregator) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
+}
+
+// publish sends the current aggregates.
+func (r *RealtimeAggregator) publish() {
+	now := r.now()
+	for _, aggregate := range r.aggregates(now) {
+		r.broadcaster.BroadcastRealtimeAggregate(aggregate.DeviceID, aggregate)
+	}
+}
+
+// aggregates returns the aggregate of every device with samples in the
+// window ending at now, forgetting the other devices and those no longer
+// subscribed to.
+func (r *RealtimeAggregator) aggregates(now time.Time) []RealtimeAggregate {
+	oldest := now.Unix() - realtimeWindowSeconds + 1
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var aggregates []RealtimeAggregate
+	for deviceID, windows := range r.windows {
+		if !r.broadcaster.RealtimeSubscribed(deviceID) {
+			delete(r.windows, deviceID)
+			continue
+		}
+
+		aggregate := RealtimeAggregate{
+			DeviceID:    deviceID,
+			WindowStart: oldest * 1000,
+			WindowEnd:   now.UnixMilli(),
+			Metrics:     make(map[string]RealtimeMetric, len(windows)),
+		}
+		for metricName, window := range windows {
+			var sum float64
+			var metric RealtimeMetric
+			for _, bucket := range window {
+				if bucket.count == 0 || bucket.second < oldest {
+					continue
+				}
+				if metric.Count == 0 {
+					metric.Min, metric.Max = bucket.min, bucket.max
+				}
+				sum += bucket.sum
+				metric.Min = min(metric.Min, bucket.min)
+				metric.Max = max(metric.Max, bucket.max)
+				metric.Count += bucket.count
+			}
+			if metric.Count == 0 {
+				delete(windows, metricName)
+				continue
+			}
+			metric.Mean = sum / float64(metric.Count)
+			aggregate.Metrics[metricName] = metric
+		}
+
+		if len(windows) == 0 {
+			delete(r.windows, deviceID)
+			continue
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	return aggregates
+}
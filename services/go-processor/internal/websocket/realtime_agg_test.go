@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRealtimeBroadcaster struct {
+	subscribed map[string]bool
+	sent       []RealtimeAggregate
+}
+
+func (b *fakeRealtimeBroadcaster) RealtimeSubscribed(deviceID string) bool {
+	return b.subscribed[deviceID]
+}
+
+func (b *fakeRealtimeBroadcaster) BroadcastRealtimeAggregate(deviceID string, aggregate interface{}) {
+	b.sent = append(b.sent, aggregate.(RealtimeAggregate))
+}
+
+func TestRealtimeAggregator_AggregatesLastMinute(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	broadcaster := &fakeRealtimeBroadcaster{subscribed: map[string]bool{"device-1": true}}
+	aggregator := newRealtimeAggregator(broadcaster)
+	aggregator.now = func() time.Time { return now }
+
+	aggregator.ObserveTelemetry("device-1", map[string]float64{"temperature": 100})
+	now = start.Add(30 * time.Second)
+	aggregator.ObserveTelemetry("device-1", map[string]float64{"temperature": 20, "humidity": 40})
+	aggregator.ObserveTelemetry("device-1", map[string]float64{"temperature": 30})
+	now = start.Add(45 * time.Second)
+	aggregator.ObserveTelemetry("device-1", map[string]float64{"temperature": 10})
+	// Nobody is watching device-2
+	aggregator.ObserveTelemetry("device-2", map[string]float64{"temperature": 50})
+
+	// The first sample has left the window
+	now = start.Add(70 * time.Second)
+	aggregator.publish()
+
+	assert.Equal(t, []RealtimeAggregate{{
+		DeviceID:    "device-1",
+		WindowStart: start.Add(11 * time.Second).UnixMilli(),
+		WindowEnd:   now.UnixMilli(),
+		Metrics: map[string]RealtimeMetric{
+			"temperature": {Mean: 20, Min: 10, Max: 30, Count: 3},
+			"humidity":    {Mean: 40, Min: 40, Max: 40, Count: 1},
+		},
+	}}, broadcaster.sent)
+}
+
+func TestRealtimeAggregator_ReusesBucketsAfterWrapping(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	broadcaster := &fakeRealtimeBroadcaster{subscribed: map[string]bool{"device-1": true}}
+	aggregator := newRealtimeAggregator(broadcaster)
+	aggregator.now = func() time.Time { return now }
+
+	aggregator.ObserveTelemetry("device-1", map[string]float64{"temperature": 100})
+	// Same bucket, a minute later
+	now = start.Add(time.Minute)
+	aggregator.ObserveTelemetry("device-1", map[string]float64{"temperature": 5})
+	aggregator.publish()
+
+	if assert.Len(t, broadcaster.sent, 1) {
+		assert.Equal(t, RealtimeMetric{Mean: 5, Min: 5, Max: 5, Count: 1}, broadcaster.sent[0].Metrics["temperature"])
+	}
+}
+
+func TestRealtimeAggregator_ForgetsIdleAndUnsubscribedDevices(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	broadcaster := &fakeRealtimeBroadcaster{subscribed: map[string]bool{"idle": true, "dropped": true}}
+	aggregator := newRealtimeAggregator(broadcaster)
+	aggregator.now = func() time.Time { return now }
+
+	aggregator.ObserveTelemetry("idle", map[string]float64{"temperature": 20})
+	aggregator.ObserveTelemetry("dropped", map[string]float64{"temperature": 20})
+	delete(broadcaster.subscribed, "dropped")
+
+	now = start.Add(2 * time.Minute)
+	aggregator.publish()
+
+	assert.Empty(t, broadcaster.sent)
+	assert.Empty(t, aggregator.windows)
+}
+
+func TestServer_BroadcastRealtimeAggregate(t *testing.T) {
+	server := NewServer(":0", ServerOptions{ReplayBufferSize: 10})
+	go server.hub.Run()
+
+	// Without subscribers nothing is sent
+	server.BroadcastRealtimeAggregate("device-001", RealtimeAggregate{DeviceID: "device-001"})
+
+	watcher := newTestClient(server.hub)
+	other := newTestClient(server.hub)
+	server.hub.subscribe <- SubscriptionRequest{Client: watcher, DeviceIDs: []string{"device-001"}, Realtime: true}
+	server.hub.subscribe <- SubscriptionRequest{Client: other, All: true}
+	assert.True(t, server.RealtimeSubscribed("device-001"))
+	assert.False(t, server.RealtimeSubscribed("device-002"))
+
+	server.BroadcastRealtimeAggregate("device-001", RealtimeAggregate{DeviceID: "device-001"})
+	server.BroadcastDeviceStatus("end")
+
+	var message Message
+	assert.NoError(t, json.Unmarshal([]byte(nextMessage(t, watcher)), &message))
+	assert.Equal(t, "realtime_aggregate", message.Type)
+	assert.Equal(t, "device-001", message.Data.(map[string]interface{})["device_id"])
+
+	// Subscribing to every device's broadcasts doesn't include realtime
+	// aggregates, and they aren't replayed
+	assert.Contains(t, nextMessage(t, other), `"device_status"`)
+	assert.Len(t, server.hub.replay.Messages(), 1)
+}
+
+func TestHub_RealtimeSubscriptions(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	client := newTestClient(hub)
+	hub.subscribe <- SubscriptionRequest{Client: client, DeviceIDs: []string{"device-001"}}
+	hub.subscribe <- SubscriptionRequest{Client: client, DeviceIDs: []string{"device-002"}, Realtime: true}
+
+	// Realtime subscriptions leave the broadcast subscription unchanged
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-001", Data: []byte("a")}
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-001", Data: []byte("realtime a"), Realtime: true}
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-002", Data: []byte("b")}
+	hub.broadcast <- BroadcastMessage{DeviceID: "device-002", Data: []byte("realtime b"), Realtime: true}
+	assert.Equal(t, "a", nextMessage(t, client))
+	assert.Equal(t, "realtime b", nextMessage(t, client))
+
+	hub.subscribe <- SubscriptionRequest{Client: client, Realtime: true}
+	assert.Eventually(t, func() bool { return !hub.wantsRealtime("device-002") }, time.Second, time.Millisecond)
+
+	hub.subscribe <- SubscriptionRequest{Client: client, DeviceIDs: []string{"device-002"}, Realtime: true}
+	hub.unregister <- client
+	assert.Eventually(t, func() bool { return !hub.wantsRealtime("device-002") }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,54 @@
+package websocket
+
+import "sync"
+
+// ReplayBuffer keeps the most recent broadcasts so that clients joining
+// later can catch up on them.
+type ReplayBuffer struct {
+	mutex    sync.RWMutex
+	messages []BroadcastMessage
+	next     int
+	full     bool
+}
+
+// NewReplayBuffer creates a buffer of the last size broadcasts. It returns
+// nil, which buffers nothing, when size is not positive.
+func NewReplayBuffer(size int) *ReplayBuffer {
+	if size <= 0 {
+		return nil
+	}
+	return &ReplayBuffer{messages: make([]BroadcastMessage, size)}
+}
+
+// Add stores message, overwriting the oldest one once the buffer is full.
+func (b *ReplayBuffer) Add(message BroadcastMessage) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.messages[b.next] = message
+	b.next = (b.next + 1) % len(b.messages)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Messages returns the buffered broadcasts, oldest first.
+func (b *ReplayBuffer) Messages() []BroadcastMessage {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if !b.full {
+		return append([]BroadcastMessage(nil), b.messages[:b.next]...)
+	}
+	messages := make([]BroadcastMessage, 0, len(b.messages))
+	messages = append(messages, b.messages[b.next:]...)
+	return append(messages, b.messages[:b.next]...)
+}
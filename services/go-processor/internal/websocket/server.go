@@ -1,37 +1,104 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
+	"go-processor/internal/api"
+	"go-processor/internal/health"
+
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from any origin in development
-		// In production, you should restrict this to known origins
-		return true
-	},
+func newUpgrader(compression bool, allowedOrigins []string) websocket.Upgrader {
+	return websocket.Upgrader{
+		// Accept clients without an Origin header (not browsers), pages
+		// served from this host and the allowed origins
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || api.SameOrigin(r) || api.OriginAllowed(allowedOrigins, origin)
+		},
+		// Negotiate permessage-deflate with clients that support it
+		EnableCompression: compression,
+	}
+}
+
+// ServerOptions configures authentication and connection handling of a
+// Server.
+type ServerOptions struct {
+	// JWTSecret verifies client bearer tokens. Empty disables authentication.
+	JWTSecret string
+
+	// Compression negotiates permessage-deflate with clients.
+	Compression bool
+
+	// PingInterval is how often clients are pinged, and PongTimeout how long
+	// a client may take to answer before it is evicted as dead.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
+	// Health checks the service's dependencies and processors for /health.
+	// Nil reports only the connected clients.
+	Health *health.Registry
+
+	// ReplayBufferSize is how many recent broadcasts are replayed to newly
+	// subscribed clients. Zero disables replay.
+	ReplayBufferSize int
+
+	// AllowedOrigins lists the browser origins, besides this host, that may
+	// connect and get CORS headers. "*" allows every origin.
+	AllowedOrigins []string
+
+	// Commands publishes the device commands clients send. Nil rejects
+	// them.
+	Commands CommandSender
 }
 
+// healthCheckTimeout bounds the component checks of a /health request.
+const healthCheckTimeout = 3 * time.Second
+
 type Server struct {
-	hub  *Hub
-	addr string
+	hub      *Hub
+	addr     string
+	upgrader websocket.Upgrader
+	opts     ServerOptions
+
+	// subscribers receive a copy of every broadcast, for other transports
+	// such as server-sent events.
+	subscribers []chan<- BroadcastMessage
 }
 
 type Message struct {
 	Type      string      `json:"type"`
-	Timestamp int64       `json:"timestamp"`
+	Timestamp int64       `json:"timestamp"` // epoch ms when broadcast
 	Data      interface{} `json:"data"`
+
+	// IsReplay marks a message that was broadcast before the client
+	// subscribed and is being replayed to it.
+	IsReplay bool `json:"is_replay"`
+
+	// TraceID correlates the message with server-side logs and spans. It is
+	// the OpenTelemetry trace ID when the broadcast is traced.
+	TraceID string `json:"trace_id"`
 }
 
-func NewServer(addr string) *Server {
+func NewServer(addr string, opts ServerOptions) *Server {
 	hub := NewHub()
+	hub.replay = NewReplayBuffer(opts.ReplayBufferSize)
+	if opts.JWTSecret == "" {
+		slog.Warn("WS_JWT_SECRET is not set; WebSocket clients are not authenticated")
+	}
 	return &Server{
-		hub:  hub,
-		addr: addr,
+		hub:      hub,
+		addr:     addr,
+		upgrader: newUpgrader(opts.Compression, opts.AllowedOrigins),
+		opts:     opts,
 	}
 }
 
@@ -43,18 +110,33 @@ func (s *Server) Run() {
 	http.HandleFunc("/ws", s.handleWebSocket)
 	http.HandleFunc("/health", s.handleHealth)
 
-	log.Printf("WebSocket server starting on %s", s.addr)
-	log.Fatal(http.ListenAndServe(s.addr, nil))
+	slog.Info("WebSocket server starting", slog.String("addr", s.addr))
+	handler := api.CORSMiddleware(s.opts.AllowedOrigins)(http.DefaultServeMux)
+	if err := http.ListenAndServe(s.addr, handler); err != nil {
+		slog.Error("WebSocket server error", slog.Any("error", err))
+		os.Exit(1)
+	}
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	claims, err := s.authenticate(r)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		slog.Warn("WebSocket authentication failed", slog.String("remote_addr", r.RemoteAddr), slog.Any("error", err))
+		w.Header().Set("WWW-Authenticate", `Bearer realm="websocket"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	client := NewClient(s.hub, conn)
+	conn, err := s.upgrader.Upgrade(countingResponseWriter{w}, r, nil)
+	if err != nil {
+		slog.Warn("WebSocket upgrade error", slog.String("remote_addr", r.RemoteAddr), slog.Any("error", err))
+		return
+	}
+
+	slog.Info("WebSocket client authenticated", slog.String("subject", claims.Subject))
+
+	client := NewClient(s.hub, conn, s.opts.PingInterval, s.opts.PongTimeout)
+	client.commands = s.opts.Commands
 	s.hub.register <- client
 
 	// Start client goroutines
@@ -62,65 +144,139 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	go client.ReadPump()
 }
 
+// handleHealth reports the status of each registered component. It responds
+// 503 if any component is unhealthy.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	body := map[string]interface{}{
+		"status":            health.StatusHealthy,
+		"connected_clients": int(s.hub.clientCount.Load()),
+	}
+	code := http.StatusOK
+	if s.opts.Health != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		report := s.opts.Health.Check(ctx)
+		body["status"] = report.Status
+		body["components"] = report.Components
+		if !report.Healthy() {
+			for name, status := range report.Components {
+				if !status.Healthy() {
+					slog.Warn("Health check failed", slog.String("component", name), slog.String("error", status.Error))
+				}
+			}
+			code = http.StatusServiceUnavailable
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":            "healthy",
-		"connected_clients": len(s.hub.clients),
-	})
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
 }
 
-func (s *Server) BroadcastAlert(alert interface{}) {
-	message := Message{
-		Type:      "alert",
-		Timestamp: 0, // Will be set by the client
-		Data:      alert,
-	}
+// BroadcastAlert sends an alert to the clients subscribed to deviceID.
+func (s *Server) BroadcastAlert(deviceID string, alert interface{}) {
+	s.BroadcastAlertWithContext(context.Background(), deviceID, alert)
+}
 
-	if data, err := json.Marshal(message); err == nil {
-		s.hub.broadcast <- data
-	} else {
-		log.Printf("Failed to marshal alert message: %v", err)
-	}
+// BroadcastAlertWithContext is BroadcastAlert tagged with the trace ID of the
+// span in ctx.
+func (s *Server) BroadcastAlertWithContext(ctx context.Context, deviceID string, alert interface{}) {
+	s.broadcast(ctx, "alert", deviceID, alert)
 }
 
-func (s *Server) BroadcastMetric(metric interface{}) {
-	message := Message{
-		Type:      "metric",
-		Timestamp: 0,
-		Data:      metric,
+// BroadcastMetric sends a metric to the clients subscribed to deviceID.
+func (s *Server) BroadcastMetric(deviceID string, metric interface{}) {
+	s.broadcast(context.Background(), "metric", deviceID, metric)
+}
+
+// BroadcastRealtimeAggregate sends a device's rolling aggregate to the
+// clients subscribed to its realtime aggregates. It is neither replayed nor
+// forwarded to other transports.
+func (s *Server) BroadcastRealtimeAggregate(deviceID string, aggregate interface{}) {
+	if !s.hub.wantsRealtime(deviceID) {
+		return
 	}
 
-	if data, err := json.Marshal(message); err == nil {
-		s.hub.broadcast <- data
-	} else {
-		log.Printf("Failed to marshal metric message: %v", err)
+	payload, err := json.Marshal(Message{
+		Type:      messageTypeRealtimeAggregate,
+		Timestamp: time.Now().UnixMilli(),
+		Data:      aggregate,
+		TraceID:   traceID(context.Background()),
+	})
+	if err != nil {
+		slog.Error("Failed to marshal WebSocket message",
+			slog.String("type", messageTypeRealtimeAggregate), slog.Any("error", err))
+		return
 	}
+	s.hub.broadcast <- BroadcastMessage{DeviceID: deviceID, Data: payload, Realtime: true}
+}
+
+// RealtimeSubscribed reports whether any client is subscribed to realtime
+// aggregates of deviceID.
+func (s *Server) RealtimeSubscribed(deviceID string) bool {
+	return s.hub.wantsRealtime(deviceID)
+}
+
+// BroadcastShadowDelta sends the difference between the desired and reported
+// state of a device to the clients subscribed to deviceID.
+func (s *Server) BroadcastShadowDelta(deviceID string, delta interface{}) {
+	s.broadcast(context.Background(), "shadow_delta", deviceID, delta)
 }
 
+// BroadcastDeviceStatus sends a device status update to every client.
 func (s *Server) BroadcastDeviceStatus(status interface{}) {
+	s.broadcast(context.Background(), "device_status", "", status)
+}
+
+// traceID returns the trace ID of the span in ctx, or a random ID when there
+// is none.
+func traceID(ctx context.Context) string {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
+	return uuid.NewString()
+}
+
+func (s *Server) broadcast(ctx context.Context, messageType, deviceID string, data interface{}) {
 	message := Message{
-		Type:      "device_status",
-		Timestamp: 0,
-		Data:      status,
+		Type:      messageType,
+		Timestamp: time.Now().UnixMilli(),
+		Data:      data,
+		TraceID:   traceID(ctx),
 	}
 
-	if data, err := json.Marshal(message); err == nil {
-		s.hub.broadcast <- data
-	} else {
-		log.Printf("Failed to marshal device status message: %v", err)
+	payload, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("Failed to marshal WebSocket message", slog.String("type", messageType), slog.Any("error", err))
+		return
+	}
+	broadcast := BroadcastMessage{DeviceID: deviceID, Data: payload}
+
+	if s.hub.replay != nil {
+		message.IsReplay = true
+		// Marshalling succeeded above, so it succeeds again
+		broadcast.Replay, _ = json.Marshal(message)
 	}
+	s.hub.broadcast <- broadcast
+	for _, subscriber := range s.subscribers {
+		subscriber <- broadcast
+	}
+}
+
+// AddSubscriber forwards every broadcast to ch in addition to the WebSocket
+// clients. It must be called before the server starts broadcasting.
+func (s *Server) AddSubscriber(ch chan<- BroadcastMessage) {
+	s.subscribers = append(s.subscribers, ch)
 }
 
 func (s *Server) GetConnectedClients() int {
-	return len(s.hub.clients)
+	return int(s.hub.clientCount.Load())
 }
 
 func (s *Server) Stop() {
-	// Close all client connections
+	// Close all client connections; their read pumps then unregister them
 	for client := range s.hub.clients {
-		close(client.send)
 		client.conn.Close()
 	}
 }
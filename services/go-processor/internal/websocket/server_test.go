@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-processor/internal/health"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func getHealth(t *testing.T, opts ServerOptions, wantCode int) map[string]interface{} {
+	t.Helper()
+	server := NewServer(":0", opts)
+
+	rec := httptest.NewRecorder()
+	server.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, wantCode, rec.Code)
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return body
+}
+
+func TestHandleHealth_Components(t *testing.T) {
+	body := getHealth(t, ServerOptions{}, http.StatusOK)
+	assert.Equal(t, "healthy", body["status"])
+	assert.NotContains(t, body, "components")
+
+	registry := health.NewRegistry()
+	registry.Register("database", health.CheckerFunc(func(context.Context) health.HealthStatus {
+		return health.HealthStatus{Status: health.StatusHealthy, Details: map[string]interface{}{"ping_latency_ms": 1.5}}
+	}))
+	body = getHealth(t, ServerOptions{Health: registry}, http.StatusOK)
+	assert.Equal(t, "healthy", body["status"])
+	assert.Equal(t, map[string]interface{}{
+		"database": map[string]interface{}{"status": "healthy", "details": map[string]interface{}{"ping_latency_ms": 1.5}},
+	}, body["components"])
+
+	registry.Register("kafka", health.CheckerFunc(func(context.Context) health.HealthStatus {
+		return health.Unhealthy(errors.New("dial tcp: connection refused"), nil)
+	}))
+	body = getHealth(t, ServerOptions{Health: registry}, http.StatusServiceUnavailable)
+	assert.Equal(t, "unhealthy", body["status"])
+	components := body["components"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"status": "unhealthy", "error": "dial tcp: connection refused"}, components["kafka"])
+	assert.Equal(t, "healthy", components["database"].(map[string]interface{})["status"])
+}
+
+func receiveBroadcast(t *testing.T, ch <-chan BroadcastMessage) Message {
+	t.Helper()
+	var message Message
+	select {
+	case broadcast := <-ch:
+		assert.NoError(t, json.Unmarshal(broadcast.Data, &message))
+	case <-time.After(time.Second):
+		t.Fatal("no broadcast received")
+	}
+	return message
+}
+
+func TestBroadcastAlertWithContext_TraceID(t *testing.T) {
+	server := NewServer(":0", ServerOptions{})
+	go server.hub.Run()
+	ch := make(chan BroadcastMessage, 1)
+	server.AddSubscriber(ch)
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	assert.NoError(t, err)
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+
+	before := time.Now().UnixMilli()
+	server.BroadcastAlertWithContext(ctx, "device-1", map[string]string{"severity": "high"})
+
+	message := receiveBroadcast(t, ch)
+	assert.Equal(t, "alert", message.Type)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", message.TraceID)
+	assert.GreaterOrEqual(t, message.Timestamp, before)
+	assert.LessOrEqual(t, message.Timestamp, time.Now().UnixMilli())
+}
+
+func TestBroadcast_RandomTraceIDWithoutSpan(t *testing.T) {
+	server := NewServer(":0", ServerOptions{})
+	go server.hub.Run()
+	ch := make(chan BroadcastMessage, 1)
+	server.AddSubscriber(ch)
+
+	server.BroadcastMetric("device-1", map[string]float64{"temperature": 21.5})
+	first := receiveBroadcast(t, ch)
+	server.BroadcastMetric("device-1", map[string]float64{"temperature": 21.6})
+	second := receiveBroadcast(t, ch)
+
+	assert.NotEmpty(t, first.TraceID)
+	assert.NotEqual(t, first.TraceID, second.TraceID)
+	assert.NotZero(t, first.Timestamp)
+}
+
+func TestUpgrader_CheckOrigin(t *testing.T) {
+	upgrader := newUpgrader(false, []string{"https://dashboard.example.com"})
+
+	check := func(origin string) bool {
+		req := httptest.NewRequest(http.MethodGet, "http://processor.example.com/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return upgrader.CheckOrigin(req)
+	}
+
+	assert.True(t, check(""), "clients without an Origin are not browsers")
+	assert.True(t, check("http://processor.example.com"), "same origin")
+	assert.True(t, check("https://dashboard.example.com"))
+	assert.False(t, check("https://evil.example.com"))
+
+	wildcard := newUpgrader(false, []string{"*"})
+	req := httptest.NewRequest(http.MethodGet, "http://processor.example.com/ws", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	assert.True(t, wildcard.CheckOrigin(req))
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS metric_aggregates_daily;
+DROP TABLE IF EXISTS metric_aggregates_hourly;
+DROP TABLE IF EXISTS metric_aggregates;
@@ -0,0 +1,117 @@
+-- Aggregates
+CREATE TABLE IF NOT EXISTS metric_aggregates (
+    device_id TEXT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    metric_name TEXT NOT NULL,
+    metric_value DOUBLE PRECISION NOT NULL,
+    sample_count INTEGER NOT NULL,
+    aggregation_function TEXT NOT NULL DEFAULT 'mean',
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Older deployments predate per-function aggregates
+ALTER TABLE metric_aggregates
+ADD COLUMN IF NOT EXISTS aggregation_function TEXT NOT NULL DEFAULT 'mean';
+
+SELECT create_hypertable('metric_aggregates', 'timestamp', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS idx_metric_aggregates_device_time
+ON metric_aggregates (device_id, timestamp DESC);
+
+CREATE INDEX IF NOT EXISTS idx_metric_aggregates_metric_time
+ON metric_aggregates (metric_name, timestamp DESC);
+
+-- Hourly and daily rollups
+CREATE TABLE IF NOT EXISTS metric_aggregates_hourly (
+    device_id TEXT NOT NULL,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    bucket_end TIMESTAMPTZ NOT NULL,
+    metric_name TEXT NOT NULL,
+    mean_value DOUBLE PRECISION NOT NULL,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    sample_count INTEGER NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+SELECT create_hypertable('metric_aggregates_hourly', 'bucket_start', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS idx_metric_aggregates_hourly_device_time
+ON metric_aggregates_hourly (device_id, bucket_start DESC);
+
+CREATE TABLE IF NOT EXISTS metric_aggregates_daily (
+    device_id TEXT NOT NULL,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    bucket_end TIMESTAMPTZ NOT NULL,
+    metric_name TEXT NOT NULL,
+    mean_value DOUBLE PRECISION NOT NULL,
+    min_value DOUBLE PRECISION NOT NULL,
+    max_value DOUBLE PRECISION NOT NULL,
+    sample_count INTEGER NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+SELECT create_hypertable('metric_aggregates_daily', 'bucket_start', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS idx_metric_aggregates_daily_device_time
+ON metric_aggregates_daily (device_id, bucket_start DESC);
+
+-- Alerts
+CREATE TABLE IF NOT EXISTS alerts (
+    id SERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    metric_name TEXT NOT NULL,
+    metric_value DOUBLE PRECISION NOT NULL,
+    alert_type TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    z_score DOUBLE PRECISION,
+    threshold DOUBLE PRECISION,
+    status TEXT DEFAULT 'open',
+    message TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    acknowledged_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    resolved_by TEXT,
+    notes TEXT
+);
+
+-- Older deployments predate alert state tracking
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS resolved_by TEXT;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS notes TEXT;
+
+SELECT create_hypertable('alerts', 'timestamp', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_device_time
+ON alerts (device_id, timestamp DESC);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_status_time
+ON alerts (status, timestamp DESC);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_severity_time
+ON alerts (severity, timestamp DESC);
+
+-- Device metadata
+CREATE TABLE IF NOT EXISTS devices (
+    device_id TEXT PRIMARY KEY,
+    device_name TEXT,
+    device_type TEXT,
+    location TEXT,
+    last_seen TIMESTAMPTZ,
+    status TEXT DEFAULT 'active',
+    metadata JSONB,
+    expected_interval_ms BIGINT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Older deployments predate per-device reporting intervals
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS expected_interval_ms BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_devices_last_seen
+ON devices (last_seen DESC);
+
+CREATE INDEX IF NOT EXISTS idx_devices_status
+ON devices (status);
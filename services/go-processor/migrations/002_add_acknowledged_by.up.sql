@@ -0,0 +1,2 @@
+-- Records who acknowledged an alert
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS acknowledged_by TEXT;
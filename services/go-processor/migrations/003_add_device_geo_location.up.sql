@@ -0,0 +1,2 @@
+-- Geographic position of a device as {latitude, longitude, building_id, floor}
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS geo_location JSONB;
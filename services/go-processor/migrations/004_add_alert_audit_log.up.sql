@@ -0,0 +1,14 @@
+-- Who changed the status of an alert, and when
+CREATE TABLE IF NOT EXISTS alert_audit_log (
+    id SERIAL PRIMARY KEY,
+    alert_id INT NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT,
+    timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    old_status TEXT,
+    new_status TEXT,
+    notes TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_audit_log_alert_time
+ON alert_audit_log (alert_id, timestamp);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_devices_firmware_version;
+ALTER TABLE devices DROP COLUMN IF EXISTS firmware_version;
@@ -0,0 +1,5 @@
+-- Firmware version last reported by a device
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS firmware_version TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_devices_firmware_version
+ON devices (firmware_version);
@@ -0,0 +1,8 @@
+-- Desired and reported state of each device
+CREATE TABLE IF NOT EXISTS device_shadows (
+    device_id TEXT PRIMARY KEY,
+    desired JSONB NOT NULL DEFAULT '{}',
+    reported JSONB NOT NULL DEFAULT '{}',
+    version INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,17 @@
+-- Aggregates re-aggregated into coarser buckets once they are old enough
+CREATE TABLE IF NOT EXISTS metric_aggregates_downsampled (
+    device_id TEXT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    metric_name TEXT NOT NULL,
+    metric_value DOUBLE PRECISION NOT NULL,
+    sample_count INTEGER NOT NULL,
+    aggregation_function TEXT NOT NULL DEFAULT 'mean',
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+SELECT create_hypertable('metric_aggregates_downsampled', 'timestamp', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS idx_metric_aggregates_downsampled_device_time
+ON metric_aggregates_downsampled (device_id, timestamp DESC);
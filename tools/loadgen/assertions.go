@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Assertion is a service level objective checked against the final
+// statistics of a load test.
+type Assertion interface {
+	// Check reports whether stats meet the objective, and a message
+	// comparing the measured value with it.
+	Check(stats Statistics) (passed bool, message string)
+}
+
+type successRateAssertion struct{ minPercent float64 }
+
+// AssertSuccessRate requires at least minPercent of requests to succeed.
+func AssertSuccessRate(minPercent float64) Assertion {
+	return successRateAssertion{minPercent: minPercent}
+}
+
+func (a successRateAssertion) Check(stats Statistics) (bool, string) {
+	rate := successRate(stats)
+	if rate >= a.minPercent {
+		return true, fmt.Sprintf("success rate %.2f%% >= %.2f%%", rate, a.minPercent)
+	}
+	return false, fmt.Sprintf("success rate %.2f%% < %.2f%%", rate, a.minPercent)
+}
+
+type p99LatencyAssertion struct{ max time.Duration }
+
+// AssertP99Latency requires the 99th percentile latency to be at most max.
+func AssertP99Latency(max time.Duration) Assertion {
+	return p99LatencyAssertion{max: max}
+}
+
+func (a p99LatencyAssertion) Check(stats Statistics) (bool, string) {
+	if stats.P99Latency <= a.max {
+		return true, fmt.Sprintf("p99 latency %v <= %v", stats.P99Latency, a.max)
+	}
+	return false, fmt.Sprintf("p99 latency %v > %v", stats.P99Latency, a.max)
+}
+
+type throughputAssertion struct{ minRPS float64 }
+
+// AssertThroughput requires at least minRPS requests per second.
+func AssertThroughput(minRPS float64) Assertion {
+	return throughputAssertion{minRPS: minRPS}
+}
+
+func (a throughputAssertion) Check(stats Statistics) (bool, string) {
+	if stats.RequestsPerSec >= a.minRPS {
+		return true, fmt.Sprintf("throughput %.2f req/s >= %.2f req/s", stats.RequestsPerSec, a.minRPS)
+	}
+	return false, fmt.Sprintf("throughput %.2f req/s < %.2f req/s", stats.RequestsPerSec, a.minRPS)
+}
+
+// assertionSpec is the JSON form of the --assert flag, e.g.
+// {"success_rate": 99, "p99_latency": "500ms", "throughput": 80}.
+type assertionSpec struct {
+	SuccessRate *float64 `json:"success_rate"`
+	P99Latency  string   `json:"p99_latency"`
+	Throughput  *float64 `json:"throughput"`
+}
+
+// ParseAssertions returns the assertions set in a JSON assertionSpec
+func ParseAssertions(value string) ([]Assertion, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+
+	var spec assertionSpec
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("invalid assertion %q: %w", value, err)
+	}
+
+	var assertions []Assertion
+	if spec.SuccessRate != nil {
+		if *spec.SuccessRate < 0 || *spec.SuccessRate > 100 {
+			return nil, fmt.Errorf("success_rate must be between 0 and 100, got %v", *spec.SuccessRate)
+		}
+		assertions = append(assertions, AssertSuccessRate(*spec.SuccessRate))
+	}
+	if spec.P99Latency != "" {
+		maxLatency, err := time.ParseDuration(spec.P99Latency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid p99_latency: %w", err)
+		}
+		assertions = append(assertions, AssertP99Latency(maxLatency))
+	}
+	if spec.Throughput != nil {
+		assertions = append(assertions, AssertThroughput(*spec.Throughput))
+	}
+	if len(assertions) == 0 {
+		return nil, fmt.Errorf("assertion %q sets none of success_rate, p99_latency or throughput", value)
+	}
+	return assertions, nil
+}
+
+// assertionFlag is a repeatable flag.Value collecting the assertions of
+// JSON assertion specs.
+type assertionFlag struct {
+	specs      []string
+	assertions *[]Assertion
+}
+
+func (f *assertionFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.specs, " ")
+}
+
+func (f *assertionFlag) Set(value string) error {
+	assertions, err := ParseAssertions(value)
+	if err != nil {
+		return err
+	}
+	f.specs = append(f.specs, value)
+	*f.assertions = append(*f.assertions, assertions...)
+	return nil
+}
+
+// checkAssertions prints PASS or FAIL for every assertion and reports
+// whether they all passed
+func checkAssertions(assertions []Assertion, stats Statistics) bool {
+	if len(assertions) == 0 {
+		return true
+	}
+
+	fmt.Printf("\nSLO ASSERTIONS\n")
+	allPassed := true
+	for _, assertion := range assertions {
+		passed, message := assertion.Check(stats)
+		result := "PASS"
+		if !passed {
+			result = "FAIL"
+			allPassed = false
+		}
+		fmt.Printf("  %s  %s\n", result, message)
+	}
+	return allPassed
+}
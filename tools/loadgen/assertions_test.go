@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		name      string
+		assertion Assertion
+		stats     Statistics
+		passed    bool
+		message   string
+	}{
+		{
+			name:      "success rate met",
+			assertion: AssertSuccessRate(99),
+			stats:     Statistics{TotalRequests: 1000, SuccessRequests: 995},
+			passed:    true,
+			message:   "success rate 99.50% >= 99.00%",
+		},
+		{
+			name:      "success rate exactly met",
+			assertion: AssertSuccessRate(99),
+			stats:     Statistics{TotalRequests: 100, SuccessRequests: 99},
+			passed:    true,
+			message:   "success rate 99.00% >= 99.00%",
+		},
+		{
+			name:      "success rate missed",
+			assertion: AssertSuccessRate(99),
+			stats:     Statistics{TotalRequests: 1000, SuccessRequests: 972},
+			passed:    false,
+			message:   "success rate 97.20% < 99.00%",
+		},
+		{
+			name:      "success rate without requests",
+			assertion: AssertSuccessRate(99),
+			stats:     Statistics{},
+			passed:    false,
+			message:   "success rate 0.00% < 99.00%",
+		},
+		{
+			name:      "p99 latency met",
+			assertion: AssertP99Latency(500 * time.Millisecond),
+			stats:     Statistics{P99Latency: 320 * time.Millisecond},
+			passed:    true,
+			message:   "p99 latency 320ms <= 500ms",
+		},
+		{
+			name:      "p99 latency missed",
+			assertion: AssertP99Latency(500 * time.Millisecond),
+			stats:     Statistics{P99Latency: 750 * time.Millisecond},
+			passed:    false,
+			message:   "p99 latency 750ms > 500ms",
+		},
+		{
+			name:      "throughput met",
+			assertion: AssertThroughput(80),
+			stats:     Statistics{RequestsPerSec: 95.5},
+			passed:    true,
+			message:   "throughput 95.50 req/s >= 80.00 req/s",
+		},
+		{
+			name:      "throughput missed",
+			assertion: AssertThroughput(80),
+			stats:     Statistics{RequestsPerSec: 42.25},
+			passed:    false,
+			message:   "throughput 42.25 req/s < 80.00 req/s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passed, message := tt.assertion.Check(tt.stats)
+			if passed != tt.passed {
+				t.Errorf("passed = %v, want %v", passed, tt.passed)
+			}
+			if message != tt.message {
+				t.Errorf("message = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseAssertions(t *testing.T) {
+	assertions, err := ParseAssertions(`{"success_rate": 99, "p99_latency": "500ms", "throughput": 80}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Assertion{AssertSuccessRate(99), AssertP99Latency(500 * time.Millisecond), AssertThroughput(80)}
+	if len(assertions) != len(want) {
+		t.Fatalf("expected %d assertions, got %d", len(want), len(assertions))
+	}
+	for i := range want {
+		if assertions[i] != want[i] {
+			t.Errorf("assertion %d = %#v, want %#v", i, assertions[i], want[i])
+		}
+	}
+
+	for _, value := range []string{
+		`{}`,
+		`not json`,
+		`{"success_rate": 101}`,
+		`{"p99_latency": "fast"}`,
+		`{"p99": "500ms"}`,
+	} {
+		if _, err := ParseAssertions(value); err == nil {
+			t.Errorf("expected an error for %s", value)
+		}
+	}
+}
+
+func TestAssertionFlag_Repeatable(t *testing.T) {
+	var assertions []Assertion
+	flags := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&assertionFlag{assertions: &assertions}, "assert", "")
+
+	err := flags.Parse([]string{
+		"--assert", `{"success_rate": 99}`,
+		"--assert", `{"throughput": 80, "p99_latency": "1s"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assertions) != 3 {
+		t.Fatalf("expected 3 assertions, got %d", len(assertions))
+	}
+
+	if err := flags.Parse([]string{"--assert", `{"success": 99}`}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	stats := Statistics{TotalRequests: 100, SuccessRequests: 100, RequestsPerSec: 50, P99Latency: 100 * time.Millisecond}
+
+	if !checkAssertions(nil, stats) {
+		t.Error("expected no assertions to pass")
+	}
+	if !checkAssertions([]Assertion{AssertSuccessRate(99), AssertP99Latency(time.Second)}, stats) {
+		t.Error("expected the assertions to pass")
+	}
+	if checkAssertions([]Assertion{AssertSuccessRate(99), AssertThroughput(80)}, stats) {
+		t.Error("expected a failed assertion to fail the run")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// chaosDelayRate is the probability that a request is delayed
+const chaosDelayRate = 0.1
+
+// ErrChaosFault is returned for requests failed on purpose by ChaosTransport
+var ErrChaosFault = errors.New("chaos: simulated network failure")
+
+// ChaosConfig describes the network problems ChaosTransport simulates
+type ChaosConfig struct {
+	// FailureRate is the probability that a request fails with ErrChaosFault
+	FailureRate float64
+
+	// MaxDelay bounds the random delay added to some requests
+	MaxDelay time.Duration
+
+	// CorruptPayload flips random bytes in request bodies
+	CorruptPayload bool
+}
+
+// ChaosTransport is an http.RoundTripper that injects failures, delays and
+// corrupted payloads into the requests it forwards to Base
+type ChaosTransport struct {
+	Base   http.RoundTripper
+	Config ChaosConfig
+
+	mutex sync.Mutex
+	rng   *rand.Rand
+}
+
+// NewChaosTransport wraps base, or http.DefaultTransport if nil
+func NewChaosTransport(base http.RoundTripper, config ChaosConfig) *ChaosTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &ChaosTransport{
+		Base:   base,
+		Config: config,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (t *ChaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.chance(t.Config.FailureRate) {
+		closeBody(req)
+		return nil, ErrChaosFault
+	}
+
+	if t.Config.MaxDelay > 0 && t.chance(chaosDelayRate) {
+		timer := time.NewTimer(t.duration(t.Config.MaxDelay))
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+
+	if t.Config.CorruptPayload && req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		t.corrupt(body)
+
+		// RoundTrippers must not modify the request they are given
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+
+	return t.Base.RoundTrip(req)
+}
+
+// chance reports true with probability p
+func (t *ChaosTransport) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.rng.Float64() < p
+}
+
+// duration returns a random duration up to max
+func (t *ChaosTransport) duration(max time.Duration) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return time.Duration(t.rng.Int63n(int64(max) + 1))
+}
+
+// corrupt flips a random bit in up to 1% of body's bytes, and at least one
+func (t *ChaosTransport) corrupt(body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i := 0; i < len(body)/100+1; i++ {
+		body[t.rng.Intn(len(body))] ^= 1 << t.rng.Intn(8)
+	}
+}
+
+// closeBody closes the body of a request that will not be sent, as
+// RoundTrippers must
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
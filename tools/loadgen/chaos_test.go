@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestChaosTransport_FailsRequests(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewChaosTransport(nil, ChaosConfig{FailureRate: 1})}
+	_, err := client.Post(server.URL, "application/json", bytes.NewReader([]byte(`{}`)))
+	if !errors.Is(err, ErrChaosFault) {
+		t.Errorf("expected a chaos fault, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("expected the request not to reach the server, got %d calls", calls)
+	}
+
+	client = &http.Client{Transport: NewChaosTransport(nil, ChaosConfig{})}
+	resp, err := client.Post(server.URL, "application/json", bytes.NewReader([]byte(`{}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("expected the request to reach the server without chaos, got %d calls", calls)
+	}
+}
+
+func TestChaosTransport_CorruptsPayload(t *testing.T) {
+	sent := []byte(`{"device_id":"device-1","ts":1700000000000,"metrics":{"temperature":21.5}}`)
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewChaosTransport(nil, ChaosConfig{CorruptPayload: true})}
+	resp, err := client.Post(server.URL, "application/json", bytes.NewReader(append([]byte(nil), sent...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if len(received) != len(sent) {
+		t.Fatalf("expected %d bytes, got %d", len(sent), len(received))
+	}
+	if bytes.Equal(received, sent) {
+		t.Error("expected the payload to be corrupted")
+	}
+}
+
+func TestSendRequest_CountsChaosFaults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   server.URL,
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+		Chaos:       &ChaosConfig{FailureRate: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	if err := lg.sendRequest(lg.generateTelemetry("device-1")); !errors.Is(err, ErrChaosFault) {
+		t.Fatalf("expected a chaos fault, got %v", err)
+	}
+
+	stats := lg.stats.GetStats()
+	if stats.FailedRequests != 1 || stats.ChaosFaults != 1 {
+		t.Errorf("expected 1 failed request and 1 chaos fault, got %d and %d", stats.FailedRequests, stats.ChaosFaults)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DeviceCommand is a command sent to a device through the processor's
+// WebSocket server and published to the commands topic.
+type DeviceCommand struct {
+	CommandID  string                 `json:"command_id"`
+	DeviceID   string                 `json:"device_id"`
+	Command    string                 `json:"command"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// newCommandReader reads the commands topic from its end, in a consumer
+// group of its own so every partition is read and no other consumer is
+// disturbed
+func newCommandReader(brokers []string, topic string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     "loadgen-commands-" + newTraceID()[:8],
+		StartOffset: kafka.LastOffset,
+	})
+}
+
+// listenCommands logs every command read from reader, as the simulated
+// devices would receive them, until the load test stops
+func (lg *LoadGenerator) listenCommands(reader *kafka.Reader) {
+	defer reader.Close()
+
+	for {
+		msg, err := reader.ReadMessage(lg.ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Printf("Command consumer error: %v", err)
+			continue
+		}
+
+		command, err := lg.recordCommand(msg.Value)
+		if err != nil {
+			log.Printf("Skipping command: %v", err)
+			continue
+		}
+		log.Printf("Command %s for %s: %s %v", command.CommandID, command.DeviceID, command.Command, command.Parameters)
+	}
+}
+
+// recordCommand decodes a command and counts it as received
+func (lg *LoadGenerator) recordCommand(value []byte) (DeviceCommand, error) {
+	var command DeviceCommand
+	if err := json.Unmarshal(value, &command); err != nil {
+		return DeviceCommand{}, fmt.Errorf("failed to decode command: %w", err)
+	}
+	lg.stats.RecordCommand()
+	return command, nil
+}
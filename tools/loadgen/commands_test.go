@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordCommand(t *testing.T) {
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:      "http://localhost",
+		Protocol:       ProtocolHTTP,
+		Rate:           100,
+		MetricTypes:    []string{"temperature"},
+		HTTPTimeout:    time.Second,
+		BatchSize:      1,
+		ListenCommands: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	command, err := lg.recordCommand([]byte(`{"command_id":"cmd-1","device_id":"loadgen-device-0001","command":"set_interval","parameters":{"seconds":30}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.CommandID != "cmd-1" || command.DeviceID != "loadgen-device-0001" || command.Command != "set_interval" {
+		t.Errorf("unexpected command %+v", command)
+	}
+	if seconds := command.Parameters["seconds"]; seconds != 30.0 {
+		t.Errorf("expected a seconds parameter of 30, got %v", seconds)
+	}
+
+	if _, err := lg.recordCommand([]byte("not json")); err == nil {
+		t.Error("expected an error for an undecodable command")
+	}
+	if received := lg.stats.GetStats().CommandsReceived; received != 1 {
+		t.Errorf("expected 1 command received, got %d", received)
+	}
+}
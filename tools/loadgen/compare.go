@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ComparisonReport compares a candidate load test run against a baseline.
+// Deltas are candidate minus baseline, so positive latency deltas and
+// negative success rate or throughput deltas are regressions.
+type ComparisonReport struct {
+	Baseline  Statistics
+	Candidate Statistics
+
+	P50LatencyDelta  time.Duration
+	P95LatencyDelta  time.Duration
+	P99LatencyDelta  time.Duration
+	SuccessRateDelta float64 // percentage points
+	ThroughputDelta  float64 // requests per second
+}
+
+// CompareRun compares candidate b against baseline a.
+func CompareRun(a, b Statistics) ComparisonReport {
+	return ComparisonReport{
+		Baseline:         a,
+		Candidate:        b,
+		P50LatencyDelta:  b.P50Latency - a.P50Latency,
+		P95LatencyDelta:  b.P95Latency - a.P95Latency,
+		P99LatencyDelta:  b.P99Latency - a.P99Latency,
+		SuccessRateDelta: successRate(b) - successRate(a),
+		ThroughputDelta:  b.RequestsPerSec - a.RequestsPerSec,
+	}
+}
+
+func (r ComparisonReport) JSON() map[string]interface{} {
+	return map[string]interface{}{
+		"p50_latency_delta_ms":      milliseconds(r.P50LatencyDelta),
+		"p95_latency_delta_ms":      milliseconds(r.P95LatencyDelta),
+		"p99_latency_delta_ms":      milliseconds(r.P99LatencyDelta),
+		"success_rate_delta_points": r.SuccessRateDelta,
+		"throughput_delta_rps":      r.ThroughputDelta,
+	}
+}
+
+// runComparison load tests config.TargetURL with baseline and
+// config.CompareURL with a second generator at the same time, then prints
+// the comparison.
+func runComparison(baseline *LoadGenerator, config Config) {
+	candidateConfig := config
+	candidateConfig.TargetURL = config.CompareURL
+	candidate, err := NewLoadGenerator(candidateConfig)
+	if err != nil {
+		log.Fatalf("Failed to create comparison load generator: %v", err)
+	}
+	baseline.name = "baseline"
+	candidate.name = "candidate"
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		log.Printf("Received shutdown signal...")
+		baseline.cancel()
+		candidate.cancel()
+	}()
+
+	var wg sync.WaitGroup
+	for _, lg := range []*LoadGenerator{baseline, candidate} {
+		wg.Add(1)
+		go func(lg *LoadGenerator) {
+			defer wg.Done()
+			if err := lg.Run(); err != nil {
+				log.Fatalf("Load test of %s failed: %v", lg.config.TargetURL, err)
+			}
+		}(lg)
+	}
+	wg.Wait()
+
+	report := CompareRun(baseline.stats.GetStats(), candidate.stats.GetStats())
+	printComparison(report, config)
+}
+
+func printComparison(r ComparisonReport, config Config) {
+	a, b := r.Baseline, r.Candidate
+
+	fmt.Printf("\n" + strings.Repeat("=", 78) + "\n")
+	fmt.Printf("LOAD TEST COMPARISON\n")
+	fmt.Printf(strings.Repeat("=", 78) + "\n")
+	fmt.Printf("Baseline:  %s\n", config.TargetURL)
+	fmt.Printf("Candidate: %s\n\n", config.CompareURL)
+	fmt.Printf("%-22s %18s %18s %18s\n", "", "Baseline", "Candidate", "Delta")
+	fmt.Printf("%-22s %18d %18d %18d\n", "Total Requests", a.TotalRequests, b.TotalRequests, b.TotalRequests-a.TotalRequests)
+	fmt.Printf("%-22s %17.2f%% %17.2f%% %+17.2f%%\n", "Success Rate", successRate(a), successRate(b), r.SuccessRateDelta)
+	fmt.Printf("%-22s %18.2f %18.2f %+18.2f\n", "Requests per Second", a.RequestsPerSec, b.RequestsPerSec, r.ThroughputDelta)
+	fmt.Printf("%-22s %18v %18v %18s\n", "P50 Latency", a.P50Latency, b.P50Latency, signedDuration(r.P50LatencyDelta))
+	fmt.Printf("%-22s %18v %18v %18s\n", "P95 Latency", a.P95Latency, b.P95Latency, signedDuration(r.P95LatencyDelta))
+	fmt.Printf("%-22s %18v %18v %18s\n", "P99 Latency", a.P99Latency, b.P99Latency, signedDuration(r.P99LatencyDelta))
+	fmt.Printf(strings.Repeat("=", 78) + "\n")
+
+	if config.OutputFormat == "json" {
+		jsonReport := map[string]interface{}{
+			"baseline":   statsJSON(a),
+			"candidate":  statsJSON(b),
+			"comparison": r.JSON(),
+		}
+		if jsonData, err := json.MarshalIndent(jsonReport, "", "  "); err == nil {
+			fmt.Printf("\nJSON Output:\n%s\n", string(jsonData))
+		}
+	}
+}
+
+func signedDuration(d time.Duration) string {
+	if d >= 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareRun(t *testing.T) {
+	baseline := Statistics{
+		TotalRequests:   1000,
+		SuccessRequests: 990,
+		FailedRequests:  10,
+		RequestsPerSec:  100,
+		P50Latency:      10 * time.Millisecond,
+		P95Latency:      40 * time.Millisecond,
+		P99Latency:      80 * time.Millisecond,
+	}
+	candidate := Statistics{
+		TotalRequests:   1200,
+		SuccessRequests: 1140,
+		FailedRequests:  60,
+		RequestsPerSec:  120,
+		P50Latency:      8 * time.Millisecond,
+		P95Latency:      50 * time.Millisecond,
+		P99Latency:      120 * time.Millisecond,
+	}
+
+	report := CompareRun(baseline, candidate)
+
+	if report.P50LatencyDelta != -2*time.Millisecond {
+		t.Errorf("P50LatencyDelta = %v, want -2ms", report.P50LatencyDelta)
+	}
+	if report.P95LatencyDelta != 10*time.Millisecond {
+		t.Errorf("P95LatencyDelta = %v, want 10ms", report.P95LatencyDelta)
+	}
+	if report.P99LatencyDelta != 40*time.Millisecond {
+		t.Errorf("P99LatencyDelta = %v, want 40ms", report.P99LatencyDelta)
+	}
+	// 95% against 99%
+	if diff := report.SuccessRateDelta - -4; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("SuccessRateDelta = %v, want -4", report.SuccessRateDelta)
+	}
+	if report.ThroughputDelta != 20 {
+		t.Errorf("ThroughputDelta = %v, want 20", report.ThroughputDelta)
+	}
+	if report.Baseline != baseline || report.Candidate != candidate {
+		t.Error("report does not carry both runs")
+	}
+
+	fields := report.JSON()
+	if fields["p99_latency_delta_ms"] != 40.0 || fields["throughput_delta_rps"] != 20.0 {
+		t.Errorf("unexpected JSON %v", fields)
+	}
+}
+
+func TestCompareRun_NoRequests(t *testing.T) {
+	report := CompareRun(Statistics{}, Statistics{TotalRequests: 10, SuccessRequests: 5})
+	if report.SuccessRateDelta != 50 {
+		t.Errorf("SuccessRateDelta = %v, want 50", report.SuccessRateDelta)
+	}
+}
+
+func TestGetStats_Percentiles(t *testing.T) {
+	stats := &StatsRecorder{}
+	for i := 100; i >= 1; i-- {
+		stats.RecordRequest(time.Duration(i)*time.Millisecond, true, 0)
+	}
+
+	got := stats.GetStats()
+	if got.P50Latency != 50*time.Millisecond || got.P95Latency != 95*time.Millisecond || got.P99Latency != 99*time.Millisecond {
+		t.Errorf("got p50=%v p95=%v p99=%v, want 50ms/95ms/99ms", got.P50Latency, got.P95Latency, got.P99Latency)
+	}
+}
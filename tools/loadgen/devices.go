@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ParseDeviceFile reads a newline-delimited file of device IDs, skipping
+// blank lines
+func ParseDeviceFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open device file: %w", err)
+	}
+	defer file.Close()
+
+	var deviceIDs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if deviceID := strings.TrimSpace(scanner.Text()); deviceID != "" {
+			deviceIDs = append(deviceIDs, deviceID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read device file: %w", err)
+	}
+	if len(deviceIDs) == 0 {
+		return nil, fmt.Errorf("device file %s contains no device IDs", path)
+	}
+	return deviceIDs, nil
+}
+
+// assignDeviceIDs returns the device ID of each of count workers, taken from
+// fileIDs round-robin, or generated when there are none
+func assignDeviceIDs(fileIDs []string, count int) []string {
+	deviceIDs := make([]string, count)
+	for i := range deviceIDs {
+		if len(fileIDs) > 0 {
+			deviceIDs[i] = fileIDs[i%len(fileIDs)]
+		} else {
+			deviceIDs[i] = fmt.Sprintf("loadgen-device-%04d", i+1)
+		}
+	}
+	return deviceIDs
+}
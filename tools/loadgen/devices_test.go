@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeDeviceFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "devices.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseDeviceFile(t *testing.T) {
+	deviceIDs, err := ParseDeviceFile(writeDeviceFile(t, "sensor-a\n\n  sensor-b \r\nsensor-c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sensor-a", "sensor-b", "sensor-c"}; !reflect.DeepEqual(deviceIDs, want) {
+		t.Errorf("expected %v, got %v", want, deviceIDs)
+	}
+
+	if _, err := ParseDeviceFile(writeDeviceFile(t, "\n\n")); err == nil {
+		t.Error("expected an error for a file without device IDs")
+	}
+	if _, err := ParseDeviceFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestNewLoadGenerator_CyclesDeviceFile(t *testing.T) {
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   "http://localhost",
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		DeviceCount: 7,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+		DeviceFile:  writeDeviceFile(t, "sensor-a\nsensor-b\nsensor-c\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	want := []string{"sensor-a", "sensor-b", "sensor-c", "sensor-a", "sensor-b", "sensor-c", "sensor-a"}
+	if !reflect.DeepEqual(lg.deviceIDs, want) {
+		t.Errorf("expected %v, got %v", want, lg.deviceIDs)
+	}
+}
+
+func TestNewLoadGenerator_GeneratesDeviceIDs(t *testing.T) {
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   "http://localhost",
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		DeviceCount: 2,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	if want := []string{"loadgen-device-0001", "loadgen-device-0002"}; !reflect.DeepEqual(lg.deviceIDs, want) {
+		t.Errorf("expected %v, got %v", want, lg.deviceIDs)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// e2ePendingTTL is how long a trace ID waits for its aggregate before it is
+// given up on. Aggregates are only published a couple of windows after the
+// messages they cover.
+const e2ePendingTTL = 10 * time.Minute
+
+// E2ETracker remembers when each traced message was sent, so its end-to-end
+// latency can be measured when its trace ID shows up in an aggregate
+type E2ETracker struct {
+	mutex sync.Mutex
+	sent  map[string]time.Time
+}
+
+func NewE2ETracker() *E2ETracker {
+	return &E2ETracker{sent: make(map[string]time.Time)}
+}
+
+// Track gives telemetry a new trace ID and records it as sent at
+func (t *E2ETracker) Track(telemetry *TelemetryData, at time.Time) {
+	telemetry.TraceID = newTraceID()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sent[telemetry.TraceID] = at
+}
+
+// Observe returns how long ago traceID was sent and forgets it. ok is false
+// for trace IDs that are unknown or were already observed, as an aggregate
+// per metric and function repeats the same IDs.
+func (t *E2ETracker) Observe(traceID string, at time.Time) (latency time.Duration, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sent, ok := t.sent[traceID]
+	if !ok {
+		return 0, false
+	}
+	delete(t.sent, traceID)
+	return at.Sub(sent), true
+}
+
+// Expire forgets trace IDs sent before cutoff and returns how many there were
+func (t *E2ETracker) Expire(cutoff time.Time) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	expired := 0
+	for traceID, sent := range t.sent {
+		if sent.Before(cutoff) {
+			delete(t.sent, traceID)
+			expired++
+		}
+	}
+	return expired
+}
+
+// newTraceID returns a random 128-bit ID in hex
+func newTraceID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// newE2EReader reads the aggregates topic from its end, in a consumer group
+// of its own so every partition is read and no other consumer is disturbed
+func newE2EReader(brokers []string, topic string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     "loadgen-e2e-" + newTraceID()[:8],
+		StartOffset: kafka.LastOffset,
+	})
+}
+
+// consumeAggregates records the end-to-end latency of every traced message
+// found in the aggregates read from reader, until the load test stops
+func (lg *LoadGenerator) consumeAggregates(reader *kafka.Reader) {
+	defer reader.Close()
+
+	for {
+		msg, err := reader.ReadMessage(lg.ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Printf("E2E consumer error: %v", err)
+			continue
+		}
+
+		if err := lg.recordAggregate(msg.Value, time.Now()); err != nil && lg.config.Verbose {
+			log.Printf("Skipping aggregate: %v", err)
+		}
+	}
+}
+
+// recordAggregate records the latency of the tracked trace IDs listed in an
+// aggregate received at
+func (lg *LoadGenerator) recordAggregate(value []byte, at time.Time) error {
+	var aggregate struct {
+		TraceIDs []string `json:"trace_ids"`
+	}
+	if err := json.Unmarshal(value, &aggregate); err != nil {
+		return fmt.Errorf("failed to decode aggregate: %w", err)
+	}
+
+	for _, traceID := range aggregate.TraceIDs {
+		if latency, ok := lg.e2e.Observe(traceID, at); ok {
+			lg.stats.RecordE2ELatency(latency)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestE2ETracker(t *testing.T) {
+	tracker := NewE2ETracker()
+	sent := time.Now()
+
+	var first, second TelemetryData
+	tracker.Track(&first, sent)
+	tracker.Track(&second, sent.Add(-time.Hour))
+	if first.TraceID == "" || first.TraceID == second.TraceID {
+		t.Fatalf("expected distinct trace IDs, got %q and %q", first.TraceID, second.TraceID)
+	}
+
+	latency, ok := tracker.Observe(first.TraceID, sent.Add(3*time.Second))
+	if !ok || latency != 3*time.Second {
+		t.Errorf("expected a 3s latency, got %v (ok=%v)", latency, ok)
+	}
+	if _, ok := tracker.Observe(first.TraceID, sent.Add(4*time.Second)); ok {
+		t.Error("expected a trace ID to be observed only once")
+	}
+	if _, ok := tracker.Observe("unknown", sent); ok {
+		t.Error("expected an unknown trace ID not to be observed")
+	}
+
+	if expired := tracker.Expire(sent.Add(-time.Minute)); expired != 1 {
+		t.Errorf("expected 1 expired trace ID, got %d", expired)
+	}
+	if _, ok := tracker.Observe(second.TraceID, sent); ok {
+		t.Error("expected an expired trace ID not to be observed")
+	}
+}
+
+func TestRecordAggregate_RecordsE2ELatency(t *testing.T) {
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   "http://localhost",
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+		E2ELatency:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	// Warm-up messages are not traced
+	lg.startWarmup()
+	if telemetry := lg.generateTelemetry("device-1"); telemetry.TraceID != "" {
+		t.Errorf("expected no trace ID during warm-up, got %q", telemetry.TraceID)
+	}
+	lg.endWarmup()
+
+	first := lg.generateTelemetry("device-1")
+	second := lg.generateTelemetry("device-1")
+	if first.TraceID == "" {
+		t.Fatal("expected a trace ID")
+	}
+
+	// One aggregate per metric and function repeats the same trace IDs
+	aggregate, err := json.Marshal(map[string]interface{}{
+		"device_id": "device-1",
+		"trace_ids": []string{first.TraceID, second.TraceID, "from-another-run"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := time.Now().Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if err := lg.recordAggregate(aggregate, received); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := lg.stats.GetStats()
+	if stats.E2EMessages != 2 {
+		t.Errorf("expected 2 E2E messages, got %d", stats.E2EMessages)
+	}
+	if stats.E2ELatency < time.Second || stats.E2ELatency > 2*time.Second {
+		t.Errorf("expected an E2E latency of about 1s, got %v", stats.E2ELatency)
+	}
+
+	if err := lg.recordAggregate([]byte("not json"), received); err == nil {
+		t.Error("expected an error for an undecodable aggregate")
+	}
+}
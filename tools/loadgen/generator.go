@@ -2,16 +2,129 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"math/rand"
 	"strconv"
 	"time"
 )
 
+// maxTelemetryClockSkew bounds how far a message's timestamp may be from now
+const maxTelemetryClockSkew = time.Hour
+
 // TelemetryGenerator handles the generation of realistic IoT telemetry data
 type TelemetryGenerator struct {
 	DeviceID    string
 	MetricTypes []string
+
+	// Location, when set, is included in every message
+	Location *DeviceLocation
+
+	// FirmwareVersion and DeviceType, when set, are included in every message
+	FirmwareVersion string
+	DeviceType      string
+
+	// Profile, when set, overrides the default range of the metrics it lists
+	Profile *DeviceProfile
+}
+
+// DeviceProfile describes the readings of a kind of device
+type DeviceProfile struct {
+	// MetricRanges holds the minimum and maximum value of each metric
+	MetricRanges map[string][2]float64
+}
+
+// ProfileRegistry holds the built-in device profiles, keyed by device type
+var ProfileRegistry = map[string]*DeviceProfile{
+	"thermostat": {MetricRanges: map[string][2]float64{
+		"temperature":     {16, 26},
+		"humidity":        {30, 60},
+		"battery_level":   {20, 100},
+		"signal_strength": {-80, -40},
+	}},
+	"industrial_sensor": {MetricRanges: map[string][2]float64{
+		"temperature": {40, 120},
+		"humidity":    {10, 60},
+		"pressure":    {900, 1500},
+		"vibration":   {5, 50},
+		"noise_level": {70, 110},
+		"cpu_usage":   {20, 95},
+	}},
+	"wearable": {MetricRanges: map[string][2]float64{
+		"temperature":     {33, 38},
+		"battery_level":   {5, 100},
+		"signal_strength": {-100, -50},
+		"light_level":     {0, 10000},
+		"noise_level":     {30, 90},
+	}},
+}
+
+// DeviceLocation is the physical position of a device
+type DeviceLocation struct {
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	BuildingID string  `json:"building_id,omitempty"`
+	Floor      string  `json:"floor,omitempty"`
+}
+
+// site is a building that simulated devices are clustered around
+type site struct {
+	buildingID string
+	latitude   float64
+	longitude  float64
+	floors     int
+}
+
+var sites = []site{
+	{buildingID: "berlin-hq", latitude: 52.5200, longitude: 13.4050, floors: 6},
+	{buildingID: "munich-plant", latitude: 48.1351, longitude: 11.5820, floors: 2},
+	{buildingID: "hamburg-warehouse", latitude: 53.5511, longitude: 9.9937, floors: 1},
+	{buildingID: "frankfurt-office", latitude: 50.1109, longitude: 8.6821, floors: 12},
+}
+
+// ClusteredLocation places a device in one of a few buildings, within about
+// 100m of its centre. The same device ID always gets the same location.
+func ClusteredLocation(deviceID string) DeviceLocation {
+	hash := fnv.New64a()
+	hash.Write([]byte(deviceID))
+	rng := rand.New(rand.NewSource(int64(hash.Sum64())))
+
+	s := sites[rng.Intn(len(sites))]
+	return DeviceLocation{
+		Latitude:   s.latitude + (rng.Float64()-0.5)*0.002,
+		Longitude:  s.longitude + (rng.Float64()-0.5)*0.002,
+		BuildingID: s.buildingID,
+		Floor:      strconv.Itoa(rng.Intn(s.floors) + 1),
+	}
+}
+
+// deviceTypes are the kinds of device a simulated fleet is made of
+var deviceTypes = []string{"environmental-sensor", "industrial-monitor", "smart-meter", "gateway"}
+
+// deviceHash hashes a device ID, salted so that different device properties
+// are assigned independently
+func deviceHash(salt, deviceID string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(salt))
+	hash.Write([]byte(deviceID))
+	return hash.Sum64()
+}
+
+// AssignFirmware picks one of versions for a device. The same device ID
+// always gets the same version.
+func AssignFirmware(deviceID string, versions []string) string {
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[deviceHash("firmware:", deviceID)%uint64(len(versions))]
+}
+
+// AssignDeviceType picks the kind of device a device ID simulates. The same
+// device ID always gets the same type.
+func AssignDeviceType(deviceID string) string {
+	return deviceTypes[deviceHash("type:", deviceID)%uint64(len(deviceTypes))]
 }
 
 // NewTelemetryGenerator creates a new telemetry generator for a device
@@ -28,6 +141,13 @@ func (tg *TelemetryGenerator) GenerateRealisticTelemetry() TelemetryData {
 
 	// Generate different types of realistic IoT metrics
 	for _, metricType := range tg.MetricTypes {
+		if tg.Profile != nil {
+			if bounds, ok := tg.Profile.MetricRanges[metricType]; ok {
+				metrics[metricType] = bounds[0] + rand.Float64()*(bounds[1]-bounds[0])
+				continue
+			}
+		}
+
 		switch metricType {
 		case "temperature":
 			// Simulate temperature readings between 18-28°C with some variation
@@ -75,6 +195,10 @@ func (tg *TelemetryGenerator) GenerateRealisticTelemetry() TelemetryData {
 		DeviceID:  tg.DeviceID,
 		Timestamp: time.Now().UnixMilli(),
 		Metrics:   metrics,
+		Location:  tg.Location,
+
+		FirmwareVersion: tg.FirmwareVersion,
+		DeviceType:      tg.DeviceType,
 	}
 
 	// Add raw data occasionally for testing
@@ -127,3 +251,23 @@ func (tg *TelemetryGenerator) GenerateAnomalyTelemetry() TelemetryData {
 
 	return telemetry
 }
+
+// ValidateTelemetry checks that telemetry names its device, has a timestamp
+// within an hour of now and that all its metric values are finite
+func ValidateTelemetry(t *TelemetryData) error {
+	if t.DeviceID == "" {
+		return errors.New("device_id is required")
+	}
+	if t.Timestamp <= 0 {
+		return errors.New("ts must be a positive epoch millisecond timestamp")
+	}
+	if skew := time.Since(time.UnixMilli(t.Timestamp)).Abs(); skew > maxTelemetryClockSkew {
+		return fmt.Errorf("ts is %v from now, more than %v", skew.Round(time.Second), maxTelemetryClockSkew)
+	}
+	for name, value := range t.Metrics {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("metric %q is not a finite number", name)
+		}
+	}
+	return nil
+}
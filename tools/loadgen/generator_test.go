@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClusteredLocation(t *testing.T) {
+	first := ClusteredLocation("loadgen-device-0001")
+	if again := ClusteredLocation("loadgen-device-0001"); again != first {
+		t.Errorf("expected a stable location, got %+v then %+v", first, again)
+	}
+
+	for i := 0; i < 50; i++ {
+		deviceID := "device-" + string(rune('a'+i%26)) + string(rune('0'+i/26))
+		location := ClusteredLocation(deviceID)
+
+		var building *site
+		for j := range sites {
+			if sites[j].buildingID == location.BuildingID {
+				building = &sites[j]
+			}
+		}
+		if building == nil {
+			t.Fatalf("unknown building %q", location.BuildingID)
+		}
+		if math.Abs(location.Latitude-building.latitude) > 0.001 || math.Abs(location.Longitude-building.longitude) > 0.001 {
+			t.Errorf("%s at %v,%v is too far from %s", deviceID, location.Latitude, location.Longitude, building.buildingID)
+		}
+	}
+}
+
+func TestGenerateRealisticTelemetry_IncludesLocation(t *testing.T) {
+	generator := NewTelemetryGenerator("device-1", []string{"temperature"})
+
+	data, err := json.Marshal(generator.GenerateRealisticTelemetry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["location"]; ok {
+		t.Error("expected no location without one configured")
+	}
+
+	location := ClusteredLocation("device-1")
+	generator.Location = &location
+	if got := generator.GenerateRealisticTelemetry().Location; got == nil || *got != location {
+		t.Errorf("expected location %+v, got %+v", location, got)
+	}
+}
+
+func TestAssignFirmware(t *testing.T) {
+	versions := []string{"1.0.0", "1.1.0", "2.0.0-beta"}
+
+	if got := AssignFirmware("device-1", nil); got != "" {
+		t.Errorf("expected no firmware without versions, got %q", got)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		deviceID := "loadgen-device-" + strconv.Itoa(i)
+		version := AssignFirmware(deviceID, versions)
+		if again := AssignFirmware(deviceID, versions); again != version {
+			t.Errorf("expected a stable version for %s, got %q then %q", deviceID, version, again)
+		}
+		if deviceType := AssignDeviceType(deviceID); !contains(deviceTypes, deviceType) {
+			t.Errorf("unknown device type %q for %s", deviceType, deviceID)
+		}
+		seen[version] = true
+	}
+	for _, version := range versions {
+		if !seen[version] {
+			t.Errorf("expected some devices on %s", version)
+		}
+	}
+}
+
+func TestGenerateRealisticTelemetry_IncludesFirmware(t *testing.T) {
+	generator := NewTelemetryGenerator("device-1", []string{"temperature"})
+	generator.FirmwareVersion = "2.0.0-beta"
+	generator.DeviceType = "gateway"
+
+	data, err := json.Marshal(generator.GenerateRealisticTelemetry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["firmware_version"] != "2.0.0-beta" || fields["device_type"] != "gateway" {
+		t.Errorf("expected firmware and device type in %s", data)
+	}
+}
+
+func TestGenerateRealisticTelemetry_UsesProfileRanges(t *testing.T) {
+	metricTypes := []string{"temperature", "vibration", "humidity"}
+	generator := NewTelemetryGenerator("device-1", metricTypes)
+	generator.Profile = ProfileRegistry["industrial_sensor"]
+
+	for i := 0; i < 200; i++ {
+		metrics := generator.GenerateRealisticTelemetry().Metrics
+		for _, metric := range metricTypes {
+			bounds := generator.Profile.MetricRanges[metric]
+			if value := metrics[metric]; value < bounds[0] || value > bounds[1] {
+				t.Fatalf("%s of %v is outside the industrial_sensor range %v", metric, value, bounds)
+			}
+		}
+	}
+}
+
+func TestGenerateRealisticTelemetry_ProfileFallsBackToDefaults(t *testing.T) {
+	generator := NewTelemetryGenerator("device-1", []string{"temperature", "pressure"})
+	generator.Profile = ProfileRegistry["wearable"]
+
+	for i := 0; i < 200; i++ {
+		metrics := generator.GenerateRealisticTelemetry().Metrics
+		if temperature := metrics["temperature"]; temperature < 33 || temperature > 38 {
+			t.Fatalf("temperature of %v is outside the wearable range", temperature)
+		}
+		// The wearable profile has no pressure range
+		if pressure := metrics["pressure"]; pressure < 963 || pressure > 1063 {
+			t.Fatalf("pressure of %v is outside the default range", pressure)
+		}
+	}
+}
+
+func TestProfileRegistry_RangesAreOrdered(t *testing.T) {
+	for _, name := range []string{"thermostat", "industrial_sensor", "wearable"} {
+		profile, ok := ProfileRegistry[name]
+		if !ok {
+			t.Fatalf("missing built-in profile %s", name)
+		}
+		for metric, bounds := range profile.MetricRanges {
+			if bounds[0] >= bounds[1] {
+				t.Errorf("%s: %s range %v has its minimum above its maximum", name, metric, bounds)
+			}
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateTelemetry(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		telemetry TelemetryData
+		wantErr   string
+	}{
+		{
+			name:      "valid",
+			telemetry: TelemetryData{DeviceID: "device-1", Timestamp: now.UnixMilli(), Metrics: map[string]float64{"temperature": 21.5}},
+		},
+		{
+			name:      "slightly old",
+			telemetry: TelemetryData{DeviceID: "device-1", Timestamp: now.Add(-59 * time.Minute).UnixMilli()},
+		},
+		{
+			name:      "missing device ID",
+			telemetry: TelemetryData{Timestamp: now.UnixMilli()},
+			wantErr:   "device_id is required",
+		},
+		{
+			name:      "missing timestamp",
+			telemetry: TelemetryData{DeviceID: "device-1"},
+			wantErr:   "ts must be a positive",
+		},
+		{
+			name:      "too old",
+			telemetry: TelemetryData{DeviceID: "device-1", Timestamp: now.Add(-2 * time.Hour).UnixMilli()},
+			wantErr:   "more than 1h0m0s",
+		},
+		{
+			name:      "too far in the future",
+			telemetry: TelemetryData{DeviceID: "device-1", Timestamp: now.Add(61 * time.Minute).UnixMilli()},
+			wantErr:   "more than 1h0m0s",
+		},
+		{
+			name:      "NaN metric",
+			telemetry: TelemetryData{DeviceID: "device-1", Timestamp: now.UnixMilli(), Metrics: map[string]float64{"temperature": math.NaN()}},
+			wantErr:   `metric "temperature" is not a finite number`,
+		},
+		{
+			name:      "infinite metric",
+			telemetry: TelemetryData{DeviceID: "device-1", Timestamp: now.UnixMilli(), Metrics: map[string]float64{"pressure": math.Inf(1)}},
+			wantErr:   `metric "pressure" is not a finite number`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTelemetry(&tt.telemetry)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	generated := NewTelemetryGenerator("device-1", []string{"temperature", "humidity"}).GenerateAnomalyTelemetry()
+	if err := ValidateTelemetry(&generated); err != nil {
+		t.Errorf("expected generated telemetry to be valid, got %v", err)
+	}
+}
@@ -1,5 +1,19 @@
 module loadgen
 
-go 1.20
+go 1.21
 
-require golang.org/x/time v0.3.0
+require (
+	github.com/segmentio/kafka-go v0.4.37
+	golang.org/x/time v0.3.0
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.35.1
+)
+
+require (
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "loadgen/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCClient creates a client for the processor's TelemetryIngestion
+// service. The connection is established lazily by the first stream.
+func newGRPCClient(addr string) (*grpc.ClientConn, pb.TelemetryIngestionClient, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	return conn, pb.NewTelemetryIngestionClient(conn), nil
+}
+
+// grpcSender sends one device's telemetry over a single Ingest stream,
+// reopening it after an error.
+type grpcSender struct {
+	client pb.TelemetryIngestionClient
+	stream grpc.BidiStreamingClient[pb.Telemetry, pb.IngestAck]
+}
+
+func (s *grpcSender) send(ctx context.Context, stats *StatsRecorder, telemetry TelemetryData) error {
+	if s.stream == nil {
+		start := time.Now()
+		stream, err := s.client.Ingest(ctx)
+		if err != nil {
+			stats.RecordRequest(time.Since(start), false, 0)
+			return fmt.Errorf("failed to open stream: %w", err)
+		}
+		s.stream = stream
+	}
+
+	message := &pb.Telemetry{
+		DeviceId: telemetry.DeviceID,
+		Ts:       telemetry.Timestamp,
+		Metrics:  telemetry.Metrics,
+		Raw:      telemetry.Raw,
+	}
+	size := int64(proto.Size(message))
+
+	// Acks arrive in order, so the round trip of one message is its latency
+	start := time.Now()
+	err := s.stream.Send(message)
+	var ack *pb.IngestAck
+	if err == nil {
+		ack, err = s.stream.Recv()
+	}
+	latency := time.Since(start)
+
+	if err != nil {
+		s.stream = nil
+		stats.RecordRequest(latency, false, size)
+		return fmt.Errorf("stream failed: %w", err)
+	}
+
+	stats.RecordRequest(latency, ack.Accepted, size)
+	if !ack.Accepted {
+		return fmt.Errorf("telemetry rejected: %s", ack.Error)
+	}
+	return nil
+}
+
+func (s *grpcSender) close() {
+	if s.stream != nil {
+		s.stream.CloseSend()
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// headerFlag is a repeatable flag.Value collecting "Key: Value" headers.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	pairs := make([]string, 0, len(h))
+	for key, value := range h {
+		pairs = append(pairs, key+": "+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+func (h headerFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("header %q must be in \"Key: Value\" format", value)
+	}
+	h[key] = strings.TrimSpace(val)
+	return nil
+}
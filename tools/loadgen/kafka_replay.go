@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "loadgen/proto"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// KafkaReplayConfig selects the telemetry replayed from Kafka instead of
+// generating it.
+type KafkaReplayConfig struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+
+	// SpeedMultiplier scales the original pace of the messages: 2 replays
+	// them twice as fast, 0.5 half as fast.
+	SpeedMultiplier float64
+}
+
+// messageReader is the subset of *kafka.Reader used by KafkaReplayer.
+type messageReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// newReplayReader reads Topic from its beginning, or from where GroupID last
+// stopped
+func newReplayReader(config KafkaReplayConfig) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     config.Brokers,
+		Topic:       config.Topic,
+		GroupID:     config.GroupID,
+		StartOffset: kafka.FirstOffset,
+	})
+}
+
+// KafkaReplayer hands out the telemetry read from Kafka in order, each one
+// no sooner than its original offset from the first message, divided by the
+// speed multiplier. It is shared by all workers.
+type KafkaReplayer struct {
+	reader messageReader
+	speed  float64
+
+	// now and wait are replaced in tests
+	now  func() time.Time
+	wait func(ctx context.Context, d time.Duration) error
+
+	mutex         sync.Mutex
+	started       time.Time
+	firstOriginal time.Time
+}
+
+func NewKafkaReplayer(reader messageReader, speed float64) *KafkaReplayer {
+	return &KafkaReplayer{
+		reader: reader,
+		speed:  speed,
+		now:    time.Now,
+		wait:   sleepContext,
+	}
+}
+
+// Next returns the next message, re-stamped with the time it is replayed
+// at. The lock is held while waiting, so workers send messages in their
+// original order.
+func (r *KafkaReplayer) Next(ctx context.Context) (TelemetryData, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	msg, err := r.reader.ReadMessage(ctx)
+	if err != nil {
+		return TelemetryData{}, err
+	}
+	telemetry, err := decodeReplayedTelemetry(msg.Value)
+	if err != nil {
+		return TelemetryData{}, fmt.Errorf("offset %d: %w", msg.Offset, err)
+	}
+
+	if r.started.IsZero() {
+		r.started = r.now()
+		r.firstOriginal = msg.Time
+	}
+	due := r.started.Add(time.Duration(float64(msg.Time.Sub(r.firstOriginal)) / r.speed))
+	if delay := due.Sub(r.now()); delay > 0 {
+		if err := r.wait(ctx, delay); err != nil {
+			return TelemetryData{}, err
+		}
+	}
+
+	telemetry.Timestamp = r.now().UnixMilli()
+	return telemetry, nil
+}
+
+func (r *KafkaReplayer) Close() error {
+	return r.reader.Close()
+}
+
+// decodeReplayedTelemetry decodes a raw telemetry message, in JSON or the
+// protobuf encoding the processor reads by default
+func decodeReplayedTelemetry(value []byte) (TelemetryData, error) {
+	var telemetry TelemetryData
+	if trimmed := bytes.TrimSpace(value); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &telemetry); err != nil {
+			return TelemetryData{}, fmt.Errorf("failed to decode JSON telemetry: %w", err)
+		}
+		// The original trace ID has been measured already
+		telemetry.TraceID = ""
+		return telemetry, nil
+	}
+
+	var message pb.Telemetry
+	if err := proto.Unmarshal(value, &message); err != nil {
+		return TelemetryData{}, fmt.Errorf("failed to decode protobuf telemetry: %w", err)
+	}
+	return TelemetryData{
+		DeviceID:  message.DeviceId,
+		Timestamp: message.Ts,
+		Metrics:   message.Metrics,
+		Raw:       message.Raw,
+	}, nil
+}
+
+// sleepContext waits for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// replayTelemetry returns the next replayed message, traced like generated
+// ones when E2ELatency is enabled
+func (lg *LoadGenerator) replayTelemetry() (TelemetryData, error) {
+	telemetry, err := lg.replayer.Next(lg.ctx)
+	if err != nil {
+		return TelemetryData{}, err
+	}
+	if lg.e2e != nil && !lg.warmingUp.Load() {
+		lg.e2e.Track(&telemetry, time.Now())
+	}
+	return telemetry, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	pb "loadgen/proto"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeMessageReader struct {
+	messages []kafka.Message
+}
+
+func (r *fakeMessageReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.messages) == 0 {
+		return kafka.Message{}, io.EOF
+	}
+	msg := r.messages[0]
+	r.messages = r.messages[1:]
+	return msg, nil
+}
+
+func (r *fakeMessageReader) Close() error { return nil }
+
+func replayMessage(t *testing.T, deviceID string, at time.Time) kafka.Message {
+	t.Helper()
+	value, err := proto.Marshal(&pb.Telemetry{
+		DeviceId: deviceID,
+		Ts:       at.UnixMilli(),
+		Metrics:  map[string]float64{"temperature": 21.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Value: value, Time: at}
+}
+
+// newFakeClockReplayer returns a replayer whose clock only moves when it
+// waits
+func newFakeClockReplayer(reader messageReader, speed float64, start time.Time) *KafkaReplayer {
+	replayer := NewKafkaReplayer(reader, speed)
+	now := start
+	replayer.now = func() time.Time { return now }
+	replayer.wait = func(ctx context.Context, d time.Duration) error {
+		now = now.Add(d)
+		return nil
+	}
+	return replayer
+}
+
+func TestKafkaReplayer_PreservesOriginalTiming(t *testing.T) {
+	original := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	reader := &fakeMessageReader{messages: []kafka.Message{
+		replayMessage(t, "device-a", original),
+		replayMessage(t, "device-b", original.Add(250*time.Millisecond)),
+		replayMessage(t, "device-a", original.Add(time.Second)),
+		replayMessage(t, "device-c", original.Add(4*time.Second)),
+	}}
+
+	start := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	replayer := newFakeClockReplayer(reader, 1.0, start)
+
+	expected := []struct {
+		deviceID string
+		offset   time.Duration
+	}{
+		{"device-a", 0},
+		{"device-b", 250 * time.Millisecond},
+		{"device-a", time.Second},
+		{"device-c", 4 * time.Second},
+	}
+	for i, want := range expected {
+		telemetry, err := replayer.Next(context.Background())
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if telemetry.DeviceID != want.deviceID {
+			t.Errorf("message %d: expected device %s, got %s", i, want.deviceID, telemetry.DeviceID)
+		}
+		if stamped := start.Add(want.offset).UnixMilli(); telemetry.Timestamp != stamped {
+			t.Errorf("message %d: expected timestamp %d, got %d", i, stamped, telemetry.Timestamp)
+		}
+	}
+
+	if _, err := replayer.Next(context.Background()); err != io.EOF {
+		t.Errorf("expected io.EOF after the last message, got %v", err)
+	}
+}
+
+func TestKafkaReplayer_SpeedMultiplier(t *testing.T) {
+	original := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	reader := &fakeMessageReader{messages: []kafka.Message{
+		replayMessage(t, "device-a", original),
+		replayMessage(t, "device-a", original.Add(10*time.Second)),
+	}}
+
+	start := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	replayer := newFakeClockReplayer(reader, 4.0, start)
+
+	replayer.Next(context.Background())
+	telemetry, err := replayer.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamped := start.Add(2500 * time.Millisecond).UnixMilli(); telemetry.Timestamp != stamped {
+		t.Errorf("expected timestamp %d, got %d", stamped, telemetry.Timestamp)
+	}
+}
+
+func TestKafkaReplayer_StopsWaitingWhenCancelled(t *testing.T) {
+	original := time.Now()
+	reader := &fakeMessageReader{messages: []kafka.Message{
+		replayMessage(t, "device-a", original),
+		replayMessage(t, "device-a", original.Add(time.Hour)),
+	}}
+	replayer := NewKafkaReplayer(reader, 1.0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := replayer.Next(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := replayer.Next(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDecodeReplayedTelemetry_JSON(t *testing.T) {
+	value, _ := json.Marshal(TelemetryData{
+		DeviceID:  "device-1",
+		Timestamp: 1700000000000,
+		Metrics:   map[string]float64{"humidity": 40},
+		TraceID:   "old-trace",
+	})
+
+	telemetry, err := decodeReplayedTelemetry(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if telemetry.DeviceID != "device-1" || telemetry.Metrics["humidity"] != 40 {
+		t.Errorf("unexpected telemetry %+v", telemetry)
+	}
+	if telemetry.TraceID != "" {
+		t.Errorf("expected the original trace ID to be dropped, got %q", telemetry.TraceID)
+	}
+
+	if _, err := decodeReplayedTelemetry([]byte("{not json")); err == nil {
+		t.Error("expected an error for malformed JSON")
+	}
+}
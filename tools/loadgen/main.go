@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,11 +22,21 @@ import (
 	"syscall"
 	"time"
 
+	pb "loadgen/proto"
+
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+)
+
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
 )
 
 type Config struct {
 	TargetURL    string
+	Protocol     string
+	GRPCAddr     string
 	Rate         int
 	Duration     time.Duration
 	DeviceCount  int
@@ -30,6 +45,72 @@ type Config struct {
 	Verbose      bool
 	HTTPTimeout  time.Duration
 	BatchSize    int
+
+	// KeepAliveInterval is the TCP keepalive interval of HTTP connections,
+	// so firewalls don't drop them while idle between bursts. Negative
+	// disables keepalives.
+	KeepAliveInterval time.Duration
+
+	// BatchSubmit sends BatchSize messages per request to /telemetry/batch
+	// instead of one per request to /telemetry.
+	BatchSubmit bool
+
+	// CompareURL runs a second load test against this URL in parallel and
+	// compares the results. Empty disables comparison.
+	CompareURL string
+
+	// ValidateResponse checks successful response bodies with a
+	// JSONFieldValidator for RequiredKeys, counting invalid ones as failed.
+	ValidateResponse bool
+	RequiredKeys     []string
+
+	// Warmup sends requests for this long before Duration starts, recording
+	// them separately so cold connections don't skew the results.
+	Warmup time.Duration
+
+	// Headers are added to every HTTP request, including the Authorization
+	// or X-API-Key header from --auth-bearer and --auth-apikey.
+	Headers map[string]string
+
+	// Locations adds a ClusteredLocation to every message.
+	Locations bool
+
+	// FirmwareVersions, when set, are spread across devices by
+	// AssignFirmware and sent with a device type in every message.
+	FirmwareVersions []string
+
+	// Chaos, when set, sends HTTP requests through a ChaosTransport.
+	Chaos *ChaosConfig
+
+	// ReportFile is where the html output format writes its report.
+	ReportFile string
+
+	// E2ELatency adds a trace ID to every message and measures how long it
+	// takes to show up in an aggregate on E2ETopic, read from KafkaBrokers.
+	E2ELatency   bool
+	KafkaBrokers []string
+	E2ETopic     string
+
+	// ListenCommands logs the device commands published to CommandsTopic,
+	// read from KafkaBrokers.
+	ListenCommands bool
+	CommandsTopic  string
+
+	// DeviceProfile names the ProfileRegistry profile, and device type, of
+	// every device. Empty uses the default metric ranges.
+	DeviceProfile string
+
+	// DeviceFile lists the device IDs to simulate, one per line, assigned to
+	// the DeviceCount workers round-robin. Empty generates device IDs.
+	DeviceFile string
+
+	// KafkaReplay, when set, sends telemetry read from Kafka at its original
+	// pace instead of generating it. The rate limiter is not used.
+	KafkaReplay *KafkaReplayConfig
+
+	// Assertions are checked against the final statistics, failing the run
+	// when any of them doesn't hold.
+	Assertions []Assertion
 }
 
 type TelemetryData struct {
@@ -37,8 +118,17 @@ type TelemetryData struct {
 	Timestamp int64              `json:"ts"`
 	Metrics   map[string]float64 `json:"metrics"`
 	Raw       []byte             `json:"raw,omitempty"`
+	Location  *DeviceLocation    `json:"location,omitempty"`
+
+	FirmwareVersion string `json:"firmware_version,omitempty"`
+	DeviceType      string `json:"device_type,omitempty"`
+
+	// TraceID is passed through the pipeline to the aggregates, for
+	// end-to-end latency measurement.
+	TraceID string `json:"trace_id,omitempty"`
 }
 
+// Statistics is a snapshot of the load test results.
 type Statistics struct {
 	TotalRequests   int64
 	SuccessRequests int64
@@ -46,15 +136,46 @@ type Statistics struct {
 	TotalLatency    time.Duration
 	MinLatency      time.Duration
 	MaxLatency      time.Duration
+	P50Latency      time.Duration
+	P95Latency      time.Duration
+	P99Latency      time.Duration
 	StartTime       time.Time
 	EndTime         time.Time
 	BytesSent       int64
 	RequestsPerSec  float64
 	AvgLatency      time.Duration
-	mutex           sync.RWMutex
+
+	// ValidationFailures counts requests that got a success status but an
+	// invalid body. They are also counted in FailedRequests.
+	ValidationFailures int64
+
+	// ChaosFaults counts requests failed on purpose by a ChaosTransport.
+	// They are also counted in FailedRequests.
+	ChaosFaults int64
+
+	// E2ELatency is the average time from sending a traced message to its
+	// trace ID appearing in an aggregate, over E2EMessages messages.
+	E2ELatency  time.Duration
+	E2EMessages int64
+
+	// CommandsReceived counts the device commands read in ListenCommands
+	// mode.
+	CommandsReceived int64
+}
+
+// StatsRecorder accumulates Statistics from concurrent workers.
+type StatsRecorder struct {
+	Statistics
+	mutex sync.RWMutex
+
+	// latencies holds every recorded latency for the percentiles.
+	latencies []time.Duration
+
+	// totalE2ELatency sums the latencies counted in E2EMessages.
+	totalE2ELatency time.Duration
 }
 
-func (s *Statistics) RecordRequest(latency time.Duration, success bool, bytes int64) {
+func (s *StatsRecorder) RecordRequest(latency time.Duration, success bool, bytes int64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -68,6 +189,58 @@ func (s *Statistics) RecordRequest(latency time.Duration, success bool, bytes in
 	}
 
 	s.TotalLatency += latency
+	s.recordLatency(latency)
+}
+
+// RecordBatch records one request carrying count messages. Each message is
+// credited as a request with the batch's latency, and all succeed or fail
+// together.
+func (s *StatsRecorder) RecordBatch(latency time.Duration, success bool, bytes int64, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	atomic.AddInt64(&s.TotalRequests, int64(count))
+	atomic.AddInt64(&s.BytesSent, bytes)
+
+	if success {
+		atomic.AddInt64(&s.SuccessRequests, int64(count))
+	} else {
+		atomic.AddInt64(&s.FailedRequests, int64(count))
+	}
+
+	s.TotalLatency += latency * time.Duration(count)
+	s.recordLatency(latency)
+}
+
+// RecordValidationFailures counts count requests whose response failed
+// validation.
+func (s *StatsRecorder) RecordValidationFailures(count int) {
+	atomic.AddInt64(&s.ValidationFailures, int64(count))
+}
+
+// RecordChaosFaults counts count requests failed by a ChaosTransport.
+func (s *StatsRecorder) RecordChaosFaults(count int) {
+	atomic.AddInt64(&s.ChaosFaults, int64(count))
+}
+
+// RecordE2ELatency records the end-to-end latency of one traced message.
+func (s *StatsRecorder) RecordE2ELatency(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.E2EMessages++
+	s.totalE2ELatency += latency
+}
+
+// RecordCommand counts one device command read from Kafka.
+func (s *StatsRecorder) RecordCommand() {
+	atomic.AddInt64(&s.CommandsReceived, 1)
+}
+
+// recordLatency updates the latency extremes and samples. The caller holds
+// the mutex.
+func (s *StatsRecorder) recordLatency(latency time.Duration) {
+	s.latencies = append(s.latencies, latency)
 
 	if s.MinLatency == 0 || latency < s.MinLatency {
 		s.MinLatency = latency
@@ -78,27 +251,28 @@ func (s *Statistics) RecordRequest(latency time.Duration, success bool, bytes in
 	}
 }
 
-func (s *Statistics) GetStats() Statistics {
+func (s *StatsRecorder) GetStats() Statistics {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	// Create a new stats struct without copying the mutex
-	stats := Statistics{
-		TotalRequests:   atomic.LoadInt64(&s.TotalRequests),
-		SuccessRequests: atomic.LoadInt64(&s.SuccessRequests),
-		FailedRequests:  atomic.LoadInt64(&s.FailedRequests),
-		TotalLatency:    s.TotalLatency,
-		MinLatency:      s.MinLatency,
-		MaxLatency:      s.MaxLatency,
-		StartTime:       s.StartTime,
-		EndTime:         s.EndTime,
-		BytesSent:       atomic.LoadInt64(&s.BytesSent),
-	}
+	stats := s.Statistics
 
 	if stats.TotalRequests > 0 {
 		stats.AvgLatency = s.TotalLatency / time.Duration(stats.TotalRequests)
 	}
 
+	if stats.E2EMessages > 0 {
+		stats.E2ELatency = s.totalE2ELatency / time.Duration(stats.E2EMessages)
+	}
+
+	if len(s.latencies) > 0 {
+		sorted := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		stats.P50Latency = percentile(sorted, 50)
+		stats.P95Latency = percentile(sorted, 95)
+		stats.P99Latency = percentile(sorted, 99)
+	}
+
 	if !stats.EndTime.IsZero() && !stats.StartTime.IsZero() {
 		duration := stats.EndTime.Sub(stats.StartTime).Seconds()
 		if duration > 0 {
@@ -109,36 +283,203 @@ func (s *Statistics) GetStats() Statistics {
 	return stats
 }
 
+// percentile returns the nearest-rank percentile p of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+// successRate returns the percentage of successful requests.
+func successRate(stats Statistics) float64 {
+	if stats.TotalRequests == 0 {
+		return 0
+	}
+	return float64(stats.SuccessRequests) / float64(stats.TotalRequests) * 100
+}
+
+// Restart moves StartTime to now, for a recorder that starts recording
+// later than it was created.
+func (s *StatsRecorder) Restart() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.StartTime = time.Now()
+}
+
+// Finish records the end of the load test.
+func (s *StatsRecorder) Finish() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.EndTime = time.Now()
+}
+
 type LoadGenerator struct {
 	config     Config
 	httpClient *http.Client
-	stats      *Statistics
+	grpcConn   *grpc.ClientConn
+	grpcClient pb.TelemetryIngestionClient
+	validator  ResponseValidator
+	stats      *StatsRecorder
 	limiter    *rate.Limiter
 	ctx        context.Context
 	cancel     context.CancelFunc
+
+	// name labels the periodic stats when several generators run at once.
+	name string
+
+	// warmupStats records requests sent while warmingUp, instead of stats.
+	warmupStats *StatsRecorder
+	warmingUp   atomic.Bool
+
+	// samples holds the throughput of every stats interval after warm-up,
+	// for the HTML report.
+	samples      []TimedSample
+	lastSample   Statistics
+	samplesMutex sync.Mutex
+
+	// e2e tracks traced messages when E2ELatency is enabled.
+	e2e *E2ETracker
+
+	// deviceIDs holds the device ID of every worker.
+	deviceIDs []string
+
+	// replayer supplies the telemetry of every worker when KafkaReplay is set.
+	replayer *KafkaReplayer
 }
 
-func NewLoadGenerator(config Config) *LoadGenerator {
+func NewLoadGenerator(config Config) (*LoadGenerator, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &LoadGenerator{
-		config: config,
-		httpClient: &http.Client{
-			Timeout: config.HTTPTimeout,
-		},
-		stats:   &Statistics{StartTime: time.Now()},
-		limiter: rate.NewLimiter(rate.Limit(config.Rate), config.BatchSize),
-		ctx:     ctx,
-		cancel:  cancel,
+	lg := &LoadGenerator{
+		config:     config,
+		httpClient: buildHTTPClient(config),
+		stats:      &StatsRecorder{Statistics: Statistics{StartTime: time.Now()}},
+		limiter:    rate.NewLimiter(rate.Limit(config.Rate), config.BatchSize),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	var fileIDs []string
+	if config.DeviceFile != "" {
+		ids, err := ParseDeviceFile(config.DeviceFile)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		fileIDs = ids
+	}
+	lg.deviceIDs = assignDeviceIDs(fileIDs, config.DeviceCount)
+
+	if config.ValidateResponse {
+		lg.validator = JSONFieldValidator{RequiredKeys: config.RequiredKeys}
 	}
+
+	if config.E2ELatency {
+		lg.e2e = NewE2ETracker()
+	}
+
+	if config.KafkaReplay != nil {
+		lg.replayer = NewKafkaReplayer(newReplayReader(*config.KafkaReplay), config.KafkaReplay.SpeedMultiplier)
+	}
+
+	if config.Protocol == ProtocolGRPC {
+		conn, client, err := newGRPCClient(config.GRPCAddr)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		lg.grpcConn = conn
+		lg.grpcClient = client
+	}
+
+	return lg, nil
+}
+
+// buildHTTPClient returns the client HTTP requests are sent with. Idle
+// connections are kept for every device, so each worker reuses its own.
+func buildHTTPClient(config Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = newDialer(config).DialContext
+	transport.DisableKeepAlives = false
+	if config.DeviceCount > 0 {
+		transport.MaxIdleConnsPerHost = config.DeviceCount
+		transport.MaxIdleConns = max(transport.MaxIdleConns, config.DeviceCount)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if config.Chaos != nil {
+		roundTripper = NewChaosTransport(transport, *config.Chaos)
+	}
+	return &http.Client{
+		Timeout:   config.HTTPTimeout,
+		Transport: roundTripper,
+	}
+}
+
+// newDialer returns the dialer of HTTP connections.
+func newDialer(config Config) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: config.KeepAliveInterval,
+	}
+}
+
+// recorder returns the statistics requests are currently recorded in.
+func (lg *LoadGenerator) recorder() *StatsRecorder {
+	if lg.warmingUp.Load() {
+		return lg.warmupStats
+	}
+	return lg.stats
+}
+
+// startWarmup records requests in warmupStats until endWarmup is called.
+func (lg *LoadGenerator) startWarmup() {
+	lg.warmupStats = &StatsRecorder{Statistics: Statistics{StartTime: time.Now()}}
+	lg.warmingUp.Store(true)
+}
+
+// endWarmup switches recording to the main statistics, which start now.
+func (lg *LoadGenerator) endWarmup() {
+	lg.stats.Restart()
+	lg.warmingUp.Store(false)
+	lg.warmupStats.Finish()
+}
+
+// phase names the current phase for the periodic stats.
+func (lg *LoadGenerator) phase() string {
+	if lg.warmingUp.Load() {
+		return "warmup"
+	}
+	return "steady"
 }
 
 func (lg *LoadGenerator) generateTelemetry(deviceID string) TelemetryData {
 	generator := NewTelemetryGenerator(deviceID, lg.config.MetricTypes)
-	return generator.GenerateRealisticTelemetry()
+	if lg.config.Locations {
+		location := ClusteredLocation(deviceID)
+		generator.Location = &location
+	}
+	if len(lg.config.FirmwareVersions) > 0 {
+		generator.FirmwareVersion = AssignFirmware(deviceID, lg.config.FirmwareVersions)
+		generator.DeviceType = AssignDeviceType(deviceID)
+	}
+	if profile, ok := ProfileRegistry[lg.config.DeviceProfile]; ok {
+		generator.Profile = profile
+		generator.DeviceType = lg.config.DeviceProfile
+	}
+	telemetry := generator.GenerateRealisticTelemetry()
+
+	// Warm-up messages are left untraced, like their other statistics
+	if lg.e2e != nil && !lg.warmingUp.Load() {
+		lg.e2e.Track(&telemetry, time.Now())
+	}
+	return telemetry
 }
 
 func (lg *LoadGenerator) sendRequest(telemetry TelemetryData) error {
+	if err := ValidateTelemetry(&telemetry); err != nil {
+		return fmt.Errorf("invalid telemetry: %w", err)
+	}
+
 	jsonData, err := json.Marshal(telemetry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal telemetry: %w", err)
@@ -149,8 +490,84 @@ func (lg *LoadGenerator) sendRequest(telemetry TelemetryData) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
+	lg.setHeaders(req)
+
+	start := time.Now()
+	resp, err := lg.httpClient.Do(req)
+	latency := time.Since(start)
+
+	success := err == nil && resp != nil && resp.StatusCode < 400
+
+	var validationErr error
+	if success {
+		validationErr = lg.validateResponse(resp)
+		success = validationErr == nil
+	}
+
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	stats := lg.recorder()
+	stats.RecordRequest(latency, success, int64(len(jsonData)))
+
+	if validationErr != nil {
+		stats.RecordValidationFailures(1)
+		return validationErr
+	}
+
+	if errors.Is(err, ErrChaosFault) {
+		stats.RecordChaosFaults(1)
+	}
+
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("received error status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// setHeaders sets the standard and configured headers on req.
+func (lg *LoadGenerator) setHeaders(req *http.Request) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "IoT-LoadGen/1.0")
+	for key, value := range lg.config.Headers {
+		req.Header.Set(key, value)
+	}
+}
+
+// validateResponse runs the configured validator, if any, on resp's body.
+func (lg *LoadGenerator) validateResponse(resp *http.Response) error {
+	if lg.validator == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := lg.validator.Validate(body); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+func (lg *LoadGenerator) sendBatchRequest(batch []TelemetryData) error {
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telemetry batch: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(lg.ctx, "POST", lg.config.TargetURL+"/telemetry/batch", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	lg.setHeaders(req)
 
 	start := time.Now()
 	resp, err := lg.httpClient.Do(req)
@@ -158,11 +575,27 @@ func (lg *LoadGenerator) sendRequest(telemetry TelemetryData) error {
 
 	success := err == nil && resp != nil && resp.StatusCode < 400
 
+	var validationErr error
+	if success {
+		validationErr = lg.validateResponse(resp)
+		success = validationErr == nil
+	}
+
 	if resp != nil {
 		resp.Body.Close()
 	}
 
-	lg.stats.RecordRequest(latency, success, int64(len(jsonData)))
+	stats := lg.recorder()
+	stats.RecordBatch(latency, success, int64(len(jsonData)), len(batch))
+
+	if validationErr != nil {
+		stats.RecordValidationFailures(len(batch))
+		return validationErr
+	}
+
+	if errors.Is(err, ErrChaosFault) {
+		stats.RecordChaosFaults(len(batch))
+	}
 
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
@@ -175,16 +608,19 @@ func (lg *LoadGenerator) sendRequest(telemetry TelemetryData) error {
 	return nil
 }
 
-func (lg *LoadGenerator) worker(deviceID string, wg *sync.WaitGroup) {
+// batchWorker sends batches of BatchSize messages, taking devices in turn
+// from deviceIDs starting at offset.
+func (lg *LoadGenerator) batchWorker(deviceIDs []string, offset int, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	next := offset
 	for {
 		select {
 		case <-lg.ctx.Done():
 			return
 		default:
-			// Wait for rate limiter
-			if err := lg.limiter.Wait(lg.ctx); err != nil {
+			// Wait for one token per message in the batch
+			if err := lg.limiter.WaitN(lg.ctx, lg.config.BatchSize); err != nil {
 				if err == context.Canceled {
 					return
 				}
@@ -192,14 +628,71 @@ func (lg *LoadGenerator) worker(deviceID string, wg *sync.WaitGroup) {
 				continue
 			}
 
-			telemetry := lg.generateTelemetry(deviceID)
+			batch := make([]TelemetryData, lg.config.BatchSize)
+			for i := range batch {
+				batch[i] = lg.generateTelemetry(deviceIDs[next%len(deviceIDs)])
+				next++
+			}
 
-			if err := lg.sendRequest(telemetry); err != nil {
+			if err := lg.sendBatchRequest(batch); err != nil {
 				if lg.config.Verbose {
-					log.Printf("Request failed for device %s: %v", deviceID, err)
+					log.Printf("Batch request failed: %v", err)
 				}
 			} else if lg.config.Verbose {
-				log.Printf("✓ Sent telemetry for device %s", deviceID)
+				log.Printf("✓ Sent batch of %d messages", len(batch))
+			}
+		}
+	}
+}
+
+func (lg *LoadGenerator) worker(deviceID string, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	send := lg.sendRequest
+	if lg.config.Protocol == ProtocolGRPC {
+		sender := &grpcSender{client: lg.grpcClient}
+		defer sender.close()
+		send = func(telemetry TelemetryData) error {
+			return sender.send(lg.ctx, lg.recorder(), telemetry)
+		}
+	}
+
+	for {
+		select {
+		case <-lg.ctx.Done():
+			return
+		default:
+			var telemetry TelemetryData
+			if lg.replayer != nil {
+				// Replayed messages are paced by their original timing
+				var err error
+				telemetry, err = lg.replayTelemetry()
+				if err != nil {
+					if errors.Is(err, context.Canceled) {
+						return
+					}
+					log.Printf("Kafka replay error: %v", err)
+					continue
+				}
+			} else {
+				// Wait for rate limiter
+				if err := lg.limiter.Wait(lg.ctx); err != nil {
+					if err == context.Canceled {
+						return
+					}
+					log.Printf("Rate limiter error: %v", err)
+					continue
+				}
+
+				telemetry = lg.generateTelemetry(deviceID)
+			}
+
+			if err := send(telemetry); err != nil {
+				if lg.config.Verbose {
+					log.Printf("Request failed for device %s: %v", telemetry.DeviceID, err)
+				}
+			} else if lg.config.Verbose {
+				log.Printf("✓ Sent telemetry for device %s", telemetry.DeviceID)
 			}
 		}
 	}
@@ -207,19 +700,70 @@ func (lg *LoadGenerator) worker(deviceID string, wg *sync.WaitGroup) {
 
 func (lg *LoadGenerator) Run() error {
 	log.Printf("Starting load generator...")
-	log.Printf("Target: %s", lg.config.TargetURL)
+	if lg.config.Protocol == ProtocolGRPC {
+		log.Printf("Target: grpc://%s", lg.config.GRPCAddr)
+	} else {
+		log.Printf("Target: %s", lg.config.TargetURL)
+	}
 	log.Printf("Rate: %d requests/second", lg.config.Rate)
 	log.Printf("Duration: %v", lg.config.Duration)
 	log.Printf("Devices: %d", lg.config.DeviceCount)
-	log.Printf("Metrics: %v", lg.config.MetricTypes)
+	if lg.config.DeviceFile != "" {
+		log.Printf("Device IDs: %s", lg.config.DeviceFile)
+	}
+	if lg.config.DeviceProfile != "" {
+		log.Printf("Device profile: %s", lg.config.DeviceProfile)
+	}
+	if replay := lg.config.KafkaReplay; replay != nil {
+		log.Printf("Kafka replay: %s from %v at %gx speed", replay.Topic, replay.Brokers, replay.SpeedMultiplier)
+	} else {
+		log.Printf("Metrics: %v", lg.config.MetricTypes)
+	}
+
+	if lg.config.Warmup > 0 {
+		log.Printf("Warm-up: %v (excluded from statistics)", lg.config.Warmup)
+		lg.startWarmup()
+		go func() {
+			timer := time.NewTimer(lg.config.Warmup)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				lg.endWarmup()
+				log.Printf("Warm-up complete, recording statistics")
+			case <-lg.ctx.Done():
+			}
+		}()
+	}
+
+	if lg.e2e != nil {
+		log.Printf("E2E latency: reading %s from %v", lg.config.E2ETopic, lg.config.KafkaBrokers)
+		go lg.consumeAggregates(newE2EReader(lg.config.KafkaBrokers, lg.config.E2ETopic))
+	}
+
+	if lg.config.ListenCommands {
+		log.Printf("Listening for commands on %s from %v", lg.config.CommandsTopic, lg.config.KafkaBrokers)
+		go lg.listenCommands(newCommandReader(lg.config.KafkaBrokers, lg.config.CommandsTopic))
+	}
 
 	var wg sync.WaitGroup
 
-	// Start workers for each device
-	for i := 0; i < lg.config.DeviceCount; i++ {
-		deviceID := fmt.Sprintf("loadgen-device-%04d", i+1)
-		wg.Add(1)
-		go lg.worker(deviceID, &wg)
+	deviceIDs := lg.deviceIDs
+
+	if lg.config.BatchSubmit {
+		// One worker per BatchSize devices, each batch mixing devices
+		log.Printf("Batch submit: %d messages per request", lg.config.BatchSize)
+		workers := max(1, lg.config.DeviceCount/lg.config.BatchSize)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go lg.batchWorker(deviceIDs, i*lg.config.BatchSize, &wg)
+		}
+	} else {
+		// Start workers for each device
+		for _, deviceID := range deviceIDs {
+			wg.Add(1)
+			go lg.worker(deviceID, &wg)
+		}
 	}
 
 	// Start statistics reporter
@@ -233,13 +777,17 @@ func (lg *LoadGenerator) Run() error {
 				return
 			case <-statsTicker.C:
 				lg.printStats()
+				lg.recordSample()
+				if lg.e2e != nil {
+					lg.e2e.Expire(time.Now().Add(-e2ePendingTTL))
+				}
 			}
 		}
 	}()
 
-	// Wait for duration or cancellation
+	// Wait for duration or cancellation. The duration starts after warm-up.
 	if lg.config.Duration > 0 {
-		timer := time.NewTimer(lg.config.Duration)
+		timer := time.NewTimer(lg.config.Warmup + lg.config.Duration)
 		defer timer.Stop()
 
 		select {
@@ -270,16 +818,30 @@ func (lg *LoadGenerator) Run() error {
 		log.Printf("Timeout waiting for workers to stop")
 	}
 
-	lg.stats.EndTime = time.Now()
-	lg.printFinalStats()
+	lg.stats.Finish()
+
+	if lg.grpcConn != nil {
+		lg.grpcConn.Close()
+	}
+	if lg.replayer != nil {
+		lg.replayer.Close()
+	}
 
 	return nil
 }
 
 func (lg *LoadGenerator) printStats() {
-	stats := lg.stats.GetStats()
+	phase := lg.phase()
+	stats := lg.recorder().GetStats()
+
+	prefix := ""
+	if lg.name != "" {
+		prefix = "[" + lg.name + "] "
+	}
 
-	log.Printf("Stats: Total=%d, Success=%d, Failed=%d, Rate=%.2f req/s, Avg Latency=%v",
+	log.Printf("%sStats: Phase=%s, Total=%d, Success=%d, Failed=%d, Rate=%.2f req/s, Avg Latency=%v",
+		prefix,
+		phase,
 		stats.TotalRequests,
 		stats.SuccessRequests,
 		stats.FailedRequests,
@@ -288,6 +850,53 @@ func (lg *LoadGenerator) printStats() {
 	)
 }
 
+// recordSample appends the throughput and latency since the previous sample
+// to samples. Nothing is sampled during warm-up.
+func (lg *LoadGenerator) recordSample() {
+	if lg.warmingUp.Load() {
+		return
+	}
+
+	now := time.Now()
+	stats := lg.stats.GetStats()
+
+	lg.samplesMutex.Lock()
+	defer lg.samplesMutex.Unlock()
+
+	since := stats.StartTime
+	if len(lg.samples) > 0 {
+		since = lg.samples[len(lg.samples)-1].Timestamp
+	}
+
+	sample := TimedSample{Timestamp: now}
+	requests := stats.TotalRequests - lg.lastSample.TotalRequests
+	if elapsed := now.Sub(since).Seconds(); elapsed > 0 {
+		sample.RequestsPerSec = float64(requests) / elapsed
+	}
+	if requests > 0 {
+		sample.AvgLatency = (stats.TotalLatency - lg.lastSample.TotalLatency) / time.Duration(requests)
+	}
+
+	lg.samples = append(lg.samples, sample)
+	lg.lastSample = stats
+}
+
+// writeHTMLReport writes the HTML report of stats to the configured file.
+func (lg *LoadGenerator) writeHTMLReport(stats Statistics) error {
+	lg.samplesMutex.Lock()
+	samples := append([]TimedSample(nil), lg.samples...)
+	lg.samplesMutex.Unlock()
+
+	report, err := GenerateHTMLReport(stats, samples)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(lg.config.ReportFile, report, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
 func (lg *LoadGenerator) printFinalStats() {
 	stats := lg.stats.GetStats()
 
@@ -295,48 +904,114 @@ func (lg *LoadGenerator) printFinalStats() {
 	fmt.Printf("FINAL LOAD TEST RESULTS\n")
 	fmt.Printf(strings.Repeat("=", 60) + "\n")
 	fmt.Printf("Duration:              %v\n", stats.EndTime.Sub(stats.StartTime))
+	if lg.warmupStats != nil {
+		warmup := lg.warmupStats.GetStats()
+		fmt.Printf("Warm-up (excluded):    %v, %d requests\n", warmup.EndTime.Sub(warmup.StartTime), warmup.TotalRequests)
+	}
 	fmt.Printf("Total Requests:        %d\n", stats.TotalRequests)
 	fmt.Printf("Successful Requests:   %d\n", stats.SuccessRequests)
 	fmt.Printf("Failed Requests:       %d\n", stats.FailedRequests)
-	fmt.Printf("Success Rate:          %.2f%%\n", float64(stats.SuccessRequests)/float64(stats.TotalRequests)*100)
+	if lg.validator != nil {
+		fmt.Printf("Validation Failures:   %d\n", stats.ValidationFailures)
+	}
+	if lg.config.Chaos != nil {
+		fmt.Printf("Chaos Faults:          %d\n", stats.ChaosFaults)
+	}
+	if lg.e2e != nil {
+		fmt.Printf("E2E Latency:           %v (%d messages)\n", stats.E2ELatency, stats.E2EMessages)
+	}
+	if lg.config.ListenCommands {
+		fmt.Printf("Commands Received:     %d\n", stats.CommandsReceived)
+	}
+	fmt.Printf("Success Rate:          %.2f%%\n", successRate(stats))
 	fmt.Printf("Requests per Second:   %.2f\n", stats.RequestsPerSec)
 	fmt.Printf("Average Latency:       %v\n", stats.AvgLatency)
 	fmt.Printf("Min Latency:           %v\n", stats.MinLatency)
 	fmt.Printf("Max Latency:           %v\n", stats.MaxLatency)
+	fmt.Printf("P50/P95/P99 Latency:   %v / %v / %v\n", stats.P50Latency, stats.P95Latency, stats.P99Latency)
 	fmt.Printf("Total Bytes Sent:      %d (%.2f MB)\n", stats.BytesSent, float64(stats.BytesSent)/(1024*1024))
 	fmt.Printf(strings.Repeat("=", 60) + "\n")
 
 	// Output in JSON format if requested
 	if lg.config.OutputFormat == "json" {
-		jsonStats := map[string]interface{}{
-			"duration_seconds":     stats.EndTime.Sub(stats.StartTime).Seconds(),
-			"total_requests":       stats.TotalRequests,
-			"successful_requests":  stats.SuccessRequests,
-			"failed_requests":      stats.FailedRequests,
-			"success_rate_percent": float64(stats.SuccessRequests) / float64(stats.TotalRequests) * 100,
-			"requests_per_second":  stats.RequestsPerSec,
-			"average_latency_ms":   float64(stats.AvgLatency.Nanoseconds()) / 1e6,
-			"min_latency_ms":       float64(stats.MinLatency.Nanoseconds()) / 1e6,
-			"max_latency_ms":       float64(stats.MaxLatency.Nanoseconds()) / 1e6,
-			"total_bytes_sent":     stats.BytesSent,
-		}
-
-		if jsonData, err := json.MarshalIndent(jsonStats, "", "  "); err == nil {
+		output := statsJSON(stats)
+		if lg.warmupStats != nil {
+			warmup := lg.warmupStats.GetStats()
+			output["warmup_excluded_seconds"] = warmup.EndTime.Sub(warmup.StartTime).Seconds()
+			output["warmup_excluded_requests"] = warmup.TotalRequests
+		}
+		if jsonData, err := json.MarshalIndent(output, "", "  "); err == nil {
 			fmt.Printf("\nJSON Output:\n%s\n", string(jsonData))
 		}
 	}
+
+	if lg.config.OutputFormat == "html" {
+		if err := lg.writeHTMLReport(stats); err != nil {
+			log.Printf("Failed to write HTML report: %v", err)
+		} else {
+			fmt.Printf("\nHTML report written to %s\n", lg.config.ReportFile)
+		}
+	}
+}
+
+func statsJSON(stats Statistics) map[string]interface{} {
+	return map[string]interface{}{
+		"duration_seconds":     stats.EndTime.Sub(stats.StartTime).Seconds(),
+		"total_requests":       stats.TotalRequests,
+		"successful_requests":  stats.SuccessRequests,
+		"failed_requests":      stats.FailedRequests,
+		"validation_failures":  stats.ValidationFailures,
+		"chaos_faults":         stats.ChaosFaults,
+		"success_rate_percent": successRate(stats),
+		"requests_per_second":  stats.RequestsPerSec,
+		"average_latency_ms":   milliseconds(stats.AvgLatency),
+		"min_latency_ms":       milliseconds(stats.MinLatency),
+		"max_latency_ms":       milliseconds(stats.MaxLatency),
+		"p50_latency_ms":       milliseconds(stats.P50Latency),
+		"p95_latency_ms":       milliseconds(stats.P95Latency),
+		"p99_latency_ms":       milliseconds(stats.P99Latency),
+		"total_bytes_sent":     stats.BytesSent,
+		"e2e_latency_ms":       milliseconds(stats.E2ELatency),
+		"e2e_messages":         stats.E2EMessages,
+		"commands_received":    stats.CommandsReceived,
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
 }
 
 func parseEnvConfig() Config {
 	config := Config{
 		TargetURL:    getEnv("TARGET_URL", "http://localhost:8090"),
+		Protocol:     getEnv("PROTOCOL", ProtocolHTTP),
+		GRPCAddr:     getEnv("GRPC_ADDR", "localhost:50051"),
 		Rate:         getEnvInt("RATE", 100),
 		DeviceCount:  getEnvInt("DEVICE_COUNT", 10),
 		MetricTypes:  []string{"temperature", "humidity", "pressure"},
 		OutputFormat: getEnv("OUTPUT_FORMAT", "text"),
+		ReportFile:   getEnv("REPORT_FILE", "loadgen-report.html"),
 		Verbose:      getEnvBool("VERBOSE", false),
 		HTTPTimeout:  time.Duration(getEnvInt("HTTP_TIMEOUT", 30)) * time.Second,
 		BatchSize:    getEnvInt("BATCH_SIZE", 10),
+		BatchSubmit:  getEnvBool("BATCH_SUBMIT", false),
+		CompareURL:   getEnv("COMPARE_URL", ""),
+
+		ValidateResponse:  getEnvBool("VALIDATE_RESPONSE", false),
+		KeepAliveInterval: getEnvDuration("KEEPALIVE", 30*time.Second),
+		Locations:         getEnvBool("LOCATIONS", false),
+		E2ELatency:        getEnvBool("E2E_LATENCY", false),
+		E2ETopic:          getEnv("E2E_TOPIC", "aggregates.minute"),
+		ListenCommands:    getEnvBool("LISTEN_COMMANDS", false),
+		CommandsTopic:     getEnv("COMMANDS_TOPIC", "commands"),
+		DeviceFile:        getEnv("DEVICE_FILE", ""),
+		DeviceProfile:     getEnv("DEVICE_PROFILE", ""),
+	}
+
+	if warmupStr := getEnv("WARMUP", ""); warmupStr != "" {
+		if warmup, err := time.ParseDuration(warmupStr); err == nil {
+			config.Warmup = warmup
+		}
 	}
 
 	if durationStr := getEnv("DURATION", "60s"); durationStr != "" {
@@ -380,25 +1055,135 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
 func main() {
 	// Start with environment configuration
 	config := parseEnvConfig()
 
 	// Command line flags override environment variables
 	flag.StringVar(&config.TargetURL, "url", config.TargetURL, "Target URL for load testing")
+	flag.StringVar(&config.Protocol, "protocol", config.Protocol, "Ingestion protocol (http|grpc)")
+	flag.StringVar(&config.GRPCAddr, "grpc-addr", config.GRPCAddr, "gRPC ingestion address when using the grpc protocol")
 	flag.IntVar(&config.Rate, "rate", config.Rate, "Requests per second")
 	flag.DurationVar(&config.Duration, "duration", config.Duration, "Test duration (0 for infinite)")
 	flag.IntVar(&config.DeviceCount, "devices", config.DeviceCount, "Number of devices to simulate")
-	flag.StringVar(&config.OutputFormat, "output", config.OutputFormat, "Output format (text|json)")
+	flag.StringVar(&config.DeviceProfile, "device-profile", config.DeviceProfile, "Metric ranges and device type of every device (thermostat|industrial_sensor|wearable)")
+	flag.StringVar(&config.DeviceFile, "device-file", config.DeviceFile, "File of device IDs, one per line, reused round-robin when --devices exceeds them")
+	flag.StringVar(&config.OutputFormat, "output", config.OutputFormat, "Output format (text|json|html)")
+	flag.StringVar(&config.ReportFile, "report-file", config.ReportFile, "File the html output format writes its report to")
 	flag.BoolVar(&config.Verbose, "verbose", config.Verbose, "Verbose logging")
 	flag.DurationVar(&config.HTTPTimeout, "timeout", config.HTTPTimeout, "HTTP request timeout")
+	flag.DurationVar(&config.KeepAliveInterval, "keepalive", config.KeepAliveInterval, "TCP keepalive interval of HTTP connections (negative disables)")
 	flag.IntVar(&config.BatchSize, "batch", config.BatchSize, "Batch size for rate limiting")
+	flag.StringVar(&config.CompareURL, "compare-url", config.CompareURL, "Second target URL to load test in parallel and compare against --url (http only)")
+	flag.BoolVar(&config.BatchSubmit, "batch-submit", config.BatchSubmit, "Send --batch messages per request to /telemetry/batch (http only)")
+
+	flag.BoolVar(&config.Locations, "locations", config.Locations, "Include a device location, clustered around a few buildings, in every message")
+	flag.DurationVar(&config.Warmup, "warmup", config.Warmup, "Send requests for this long before --duration without recording statistics")
+	flag.BoolVar(&config.ValidateResponse, "validate-response", config.ValidateResponse, "Count successful responses missing --required-keys as failures (http only)")
+
+	headers := headerFlag{}
+	flag.Var(headers, "header", "Extra HTTP header in \"Key: Value\" format (repeatable)")
+
+	flag.Var(&assertionFlag{assertions: &config.Assertions}, "assert",
+		`SLO the final statistics must meet, e.g. '{"success_rate": 99, "p99_latency": "500ms", "throughput": 80}' (repeatable)`)
+
+	var authBearer, authAPIKey string
+	flag.StringVar(&authBearer, "auth-bearer", getEnv("AUTH_BEARER", ""), "Bearer token sent in the Authorization header")
+	flag.StringVar(&authAPIKey, "auth-apikey", getEnv("AUTH_APIKEY", ""), "API key sent in the X-API-Key header")
+
+	var requiredKeysFlag string
+	flag.StringVar(&requiredKeysFlag, "required-keys", getEnv("REQUIRED_KEYS", ""), "Comma-separated JSON keys every response must contain")
+
+	var firmwareVersionsFlag string
+	flag.StringVar(&firmwareVersionsFlag, "firmware-versions", getEnv("FIRMWARE_VERSIONS", ""), "Comma-separated firmware versions spread across devices, e.g. 1.0.0,1.1.0,2.0.0-beta")
+
+	var chaos bool
+	chaosConfig := ChaosConfig{
+		FailureRate:    getEnvFloat("CHAOS_FAILURE_RATE", 0.05),
+		MaxDelay:       getEnvDuration("CHAOS_MAX_DELAY", 2*time.Second),
+		CorruptPayload: getEnvBool("CHAOS_CORRUPT_PAYLOAD", false),
+	}
+	flag.BoolVar(&chaos, "chaos", getEnvBool("CHAOS", false), "Inject simulated network failures, delays and corrupted payloads (http only)")
+	flag.Float64Var(&chaosConfig.FailureRate, "chaos-failure-rate", chaosConfig.FailureRate, "Fraction of requests failed with a simulated network error in --chaos mode")
+	flag.DurationVar(&chaosConfig.MaxDelay, "chaos-max-delay", chaosConfig.MaxDelay, "Longest delay added to 10% of requests in --chaos mode")
+	flag.BoolVar(&chaosConfig.CorruptPayload, "chaos-corrupt-payload", chaosConfig.CorruptPayload, "Flip random bytes in request bodies in --chaos mode")
+
+	var kafkaBrokersFlag string
+	flag.BoolVar(&config.E2ELatency, "e2e-latency", config.E2ELatency, "Measure the latency from sending a message to its aggregate appearing in Kafka (http only)")
+	flag.StringVar(&kafkaBrokersFlag, "kafka-brokers", getEnv("KAFKA_BROKERS", "localhost:19092"), "Comma-separated Kafka brokers read in --e2e-latency, --listen-commands and --kafka-replay modes")
+	flag.StringVar(&config.E2ETopic, "e2e-topic", config.E2ETopic, "Aggregates topic read in --e2e-latency mode")
+	flag.BoolVar(&config.ListenCommands, "listen-commands", config.ListenCommands, "Log the device commands published to Kafka while the load runs")
+	flag.StringVar(&config.CommandsTopic, "commands-topic", config.CommandsTopic, "Commands topic read in --listen-commands mode")
+
+	var kafkaReplay bool
+	replayConfig := KafkaReplayConfig{
+		Topic:           getEnv("REPLAY_TOPIC", "raw.events"),
+		GroupID:         getEnv("REPLAY_GROUP_ID", "loadgen-replay"),
+		SpeedMultiplier: getEnvFloat("REPLAY_SPEED", 1.0),
+	}
+	flag.BoolVar(&kafkaReplay, "kafka-replay", getEnvBool("KAFKA_REPLAY", false), "Send the telemetry read from Kafka at its original pace instead of generating it")
+	flag.StringVar(&replayConfig.Topic, "replay-topic", replayConfig.Topic, "Raw telemetry topic read in --kafka-replay mode")
+	flag.StringVar(&replayConfig.GroupID, "replay-group", replayConfig.GroupID, "Consumer group of --kafka-replay mode, which resumes where the group last stopped")
+	flag.Float64Var(&replayConfig.SpeedMultiplier, "replay-speed", replayConfig.SpeedMultiplier, "Pace of --kafka-replay relative to the original messages, e.g. 2 for twice as fast")
 
 	var metricsFlag string
 	flag.StringVar(&metricsFlag, "metrics", "temperature,humidity,pressure", "Comma-separated list of metrics to generate")
 
 	flag.Parse()
 
+	if authBearer != "" {
+		headers["Authorization"] = "Bearer " + authBearer
+	}
+	if authAPIKey != "" {
+		headers["X-API-Key"] = authAPIKey
+	}
+	config.Headers = headers
+
+	if chaos {
+		config.Chaos = &chaosConfig
+	}
+
+	for _, key := range strings.Split(requiredKeysFlag, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.RequiredKeys = append(config.RequiredKeys, key)
+		}
+	}
+
+	for _, version := range strings.Split(firmwareVersionsFlag, ",") {
+		if version = strings.TrimSpace(version); version != "" {
+			config.FirmwareVersions = append(config.FirmwareVersions, version)
+		}
+	}
+
+	for _, broker := range strings.Split(kafkaBrokersFlag, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			config.KafkaBrokers = append(config.KafkaBrokers, broker)
+		}
+	}
+
+	if kafkaReplay {
+		replayConfig.Brokers = config.KafkaBrokers
+		config.KafkaReplay = &replayConfig
+	}
+
 	// Parse metrics
 	if metricsFlag != "" {
 		config.MetricTypes = []string{}
@@ -414,12 +1199,91 @@ func main() {
 	if config.DeviceCount <= 0 {
 		log.Fatal("Device count must be positive")
 	}
-	if config.TargetURL == "" {
-		log.Fatal("Target URL must be specified")
+	if _, ok := ProfileRegistry[config.DeviceProfile]; config.DeviceProfile != "" && !ok {
+		log.Fatalf("Unknown device profile %q, expected thermostat, industrial_sensor or wearable", config.DeviceProfile)
+	}
+	if config.CompareURL != "" && config.Protocol != ProtocolHTTP {
+		log.Fatal("Comparison is only supported with the http protocol")
+	}
+	if len(config.Headers) > 0 && config.Protocol != ProtocolHTTP {
+		log.Fatal("Custom headers are only supported with the http protocol")
+	}
+	if config.OutputFormat == "html" && config.CompareURL != "" {
+		log.Fatal("HTML reports are not supported with --compare-url")
+	}
+	if len(config.Assertions) > 0 && config.CompareURL != "" {
+		log.Fatal("Assertions are not supported with --compare-url")
+	}
+	if config.ValidateResponse && config.Protocol != ProtocolHTTP {
+		log.Fatal("Response validation is only supported with the http protocol")
+	}
+	if config.Chaos != nil {
+		if config.Protocol != ProtocolHTTP {
+			log.Fatal("Chaos mode is only supported with the http protocol")
+		}
+		if config.Chaos.FailureRate < 0 || config.Chaos.FailureRate > 1 {
+			log.Fatal("Chaos failure rate must be between 0 and 1")
+		}
+	}
+	if config.E2ELatency {
+		if config.Protocol != ProtocolHTTP {
+			log.Fatal("E2E latency is only supported with the http protocol")
+		}
+		if len(config.KafkaBrokers) == 0 {
+			log.Fatal("E2E latency requires --kafka-brokers")
+		}
+	}
+	if config.ListenCommands && len(config.KafkaBrokers) == 0 {
+		log.Fatal("Listening for commands requires --kafka-brokers")
+	}
+	if config.KafkaReplay != nil {
+		if len(config.KafkaReplay.Brokers) == 0 {
+			log.Fatal("Kafka replay requires --kafka-brokers")
+		}
+		if config.KafkaReplay.Topic == "" {
+			log.Fatal("Kafka replay requires --replay-topic")
+		}
+		if config.KafkaReplay.SpeedMultiplier <= 0 {
+			log.Fatal("Replay speed must be positive")
+		}
+		if config.BatchSubmit {
+			log.Fatal("Kafka replay is not supported with --batch-submit")
+		}
+		if config.CompareURL != "" {
+			log.Fatal("Kafka replay is not supported with --compare-url")
+		}
+	}
+	if config.BatchSubmit {
+		if config.Protocol != ProtocolHTTP {
+			log.Fatal("Batch submit is only supported with the http protocol")
+		}
+		if config.BatchSize <= 0 {
+			log.Fatal("Batch size must be positive")
+		}
+	}
+	switch config.Protocol {
+	case ProtocolHTTP:
+		if config.TargetURL == "" {
+			log.Fatal("Target URL must be specified")
+		}
+	case ProtocolGRPC:
+		if config.GRPCAddr == "" {
+			log.Fatal("gRPC address must be specified")
+		}
+	default:
+		log.Fatalf("Unknown protocol %q, expected http or grpc", config.Protocol)
 	}
 
 	// Create load generator
-	loadGen := NewLoadGenerator(config)
+	loadGen, err := NewLoadGenerator(config)
+	if err != nil {
+		log.Fatalf("Failed to create load generator: %v", err)
+	}
+
+	if config.CompareURL != "" {
+		runComparison(loadGen, config)
+		return
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -435,4 +1299,9 @@ func main() {
 	if err := loadGen.Run(); err != nil {
 		log.Fatalf("Load test failed: %v", err)
 	}
+	loadGen.printFinalStats()
+
+	if !checkAssertions(config.Assertions, loadGen.stats.GetStats()) {
+		os.Exit(1)
+	}
 }
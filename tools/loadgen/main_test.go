@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendBatchRequest(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var bodies [][]TelemetryData
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/telemetry/batch" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		data, _ := io.ReadAll(r.Body)
+
+		var batch []TelemetryData
+		if err := json.Unmarshal(data, &batch); err != nil {
+			t.Errorf("body is not a JSON array of telemetry: %v", err)
+		}
+
+		mu.Lock()
+		calls++
+		bodies = append(bodies, batch)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   server.URL,
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	batch := make([]TelemetryData, 5)
+	for i := range batch {
+		batch[i] = lg.generateTelemetry("device-1")
+	}
+	for i := 0; i < 2; i++ {
+		if err := lg.sendBatchRequest(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("got %d HTTP calls, want 2", calls)
+	}
+	for _, body := range bodies {
+		if len(body) != 5 || body[0].DeviceID != "device-1" {
+			t.Errorf("unexpected batch body %+v", body)
+		}
+	}
+
+	stats := lg.stats.GetStats()
+	if stats.TotalRequests != 10 || stats.SuccessRequests != 10 || stats.FailedRequests != 0 {
+		t.Errorf("got total=%d success=%d failed=%d, want 10 successful requests",
+			stats.TotalRequests, stats.SuccessRequests, stats.FailedRequests)
+	}
+	if stats.BytesSent == 0 {
+		t.Error("no bytes recorded")
+	}
+}
+
+func TestSendBatchRequest_FailureFailsWholeBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   server.URL,
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		HTTPTimeout: time.Second,
+		BatchSize:   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	if err := lg.sendBatchRequest(make([]TelemetryData, 3)); err == nil {
+		t.Fatal("expected an error for a 503 response")
+	}
+
+	stats := lg.stats.GetStats()
+	if stats.TotalRequests != 3 || stats.FailedRequests != 3 || stats.SuccessRequests != 0 {
+		t.Errorf("got total=%d success=%d failed=%d, want 3 failed requests",
+			stats.TotalRequests, stats.SuccessRequests, stats.FailedRequests)
+	}
+}
+
+func TestRecordBatch_AverageLatencyIsPerRequest(t *testing.T) {
+	stats := &StatsRecorder{}
+	stats.RecordBatch(100*time.Millisecond, true, 1000, 10)
+	stats.RecordRequest(100*time.Millisecond, true, 100)
+
+	got := stats.GetStats()
+	if got.TotalRequests != 11 {
+		t.Errorf("got %d requests, want 11", got.TotalRequests)
+	}
+	if got.AvgLatency != 100*time.Millisecond {
+		t.Errorf("got average latency %v, want 100ms", got.AvgLatency)
+	}
+}
+
+func TestWarmupRequestsAreExcluded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   server.URL,
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	lg.startWarmup()
+	for i := 0; i < 3; i++ {
+		if err := lg.sendRequest(lg.generateTelemetry("device-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if phase := lg.phase(); phase != "warmup" {
+		t.Errorf("expected warmup phase, got %s", phase)
+	}
+	if total := lg.stats.GetStats().TotalRequests; total != 0 {
+		t.Errorf("expected no requests in the main stats during warm-up, got %d", total)
+	}
+
+	lg.endWarmup()
+	if err := lg.sendRequest(lg.generateTelemetry("device-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if phase := lg.phase(); phase != "steady" {
+		t.Errorf("expected steady phase, got %s", phase)
+	}
+	if total := lg.stats.GetStats().TotalRequests; total != 1 {
+		t.Errorf("expected 1 request in the main stats, got %d", total)
+	}
+	if total := lg.warmupStats.GetStats().TotalRequests; total != 3 {
+		t.Errorf("expected 3 warm-up requests, got %d", total)
+	}
+}
+
+func TestSendRequest_SetsConfiguredHeaders(t *testing.T) {
+	received := make(chan http.Header, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	headers := headerFlag{}
+	for _, value := range []string{"X-Gateway-ID: gw-7", "X-Region:eu-west"} {
+		if err := headers.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	headers["Authorization"] = "Bearer secret-token"
+
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   server.URL,
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+		Headers:     headers,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	if err := lg.sendRequest(lg.generateTelemetry("device-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := lg.sendBatchRequest([]TelemetryData{lg.generateTelemetry("device-1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		header := <-received
+		for key, want := range map[string]string{
+			"X-Gateway-ID":  "gw-7",
+			"X-Region":      "eu-west",
+			"Authorization": "Bearer secret-token",
+			"Content-Type":  "application/json",
+		} {
+			if got := header.Get(key); got != want {
+				t.Errorf("expected %s header %q, got %q", key, want, got)
+			}
+		}
+	}
+}
+
+func TestSendRequest_RejectsInvalidTelemetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected invalid telemetry not to be sent")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   server.URL,
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	telemetry := lg.generateTelemetry("device-1")
+	telemetry.DeviceID = ""
+	if err := lg.sendRequest(telemetry); err == nil {
+		t.Fatal("expected telemetry without a device ID to be rejected")
+	}
+	if total := lg.stats.GetStats().TotalRequests; total != 0 {
+		t.Errorf("expected no requests to be sent, got %d", total)
+	}
+}
+
+func TestHeaderFlag_RejectsMalformedHeader(t *testing.T) {
+	headers := headerFlag{}
+	if err := headers.Set("no-colon"); err == nil {
+		t.Error("expected an error for a header without a colon")
+	}
+	if err := headers.Set(": value"); err == nil {
+		t.Error("expected an error for a header without a key")
+	}
+}
+
+func TestBuildHTTPClient_ConfiguresKeepAlive(t *testing.T) {
+	config := Config{HTTPTimeout: time.Second, DeviceCount: 250, KeepAliveInterval: 15 * time.Second}
+
+	client := buildHTTPClient(config)
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an *http.Transport, got %T", client.Transport)
+	}
+	if transport.DialContext == nil {
+		t.Fatal("expected a DialContext")
+	}
+	if transport.DisableKeepAlives {
+		t.Error("expected keepalives to be enabled")
+	}
+	if transport.MaxIdleConnsPerHost != 250 || transport.MaxIdleConns < 250 {
+		t.Errorf("expected 250 idle connections per host, got %d of %d", transport.MaxIdleConnsPerHost, transport.MaxIdleConns)
+	}
+	if keepAlive := newDialer(config).KeepAlive; keepAlive != 15*time.Second {
+		t.Errorf("expected a keepalive interval of 15s, got %v", keepAlive)
+	}
+
+	// Requests go through the configured dialer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestBuildHTTPClient_WrapsChaosTransport(t *testing.T) {
+	client := buildHTTPClient(Config{HTTPTimeout: time.Second, Chaos: &ChaosConfig{FailureRate: 1}})
+
+	chaos, ok := client.Transport.(*ChaosTransport)
+	if !ok {
+		t.Fatalf("expected a *ChaosTransport, got %T", client.Transport)
+	}
+	if transport, ok := chaos.Base.(*http.Transport); !ok || transport.DialContext == nil {
+		t.Errorf("expected chaos to wrap the keepalive transport, got %T", chaos.Base)
+	}
+}
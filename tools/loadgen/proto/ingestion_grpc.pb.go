@@ -0,0 +1,125 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: internal/proto/ingestion.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TelemetryIngestion_Ingest_FullMethodName = "/telemetry.TelemetryIngestion/Ingest"
+)
+
+// TelemetryIngestionClient is the client API for TelemetryIngestion service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TelemetryIngestion accepts telemetry from devices and gateways and
+// publishes it to the raw events topic.
+type TelemetryIngestionClient interface {
+	// Ingest streams telemetry to the processor, which answers each message
+	// with an IngestAck in the order received.
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Telemetry, IngestAck], error)
+}
+
+type telemetryIngestionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTelemetryIngestionClient(cc grpc.ClientConnInterface) TelemetryIngestionClient {
+	return &telemetryIngestionClient{cc}
+}
+
+func (c *telemetryIngestionClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Telemetry, IngestAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TelemetryIngestion_ServiceDesc.Streams[0], TelemetryIngestion_Ingest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Telemetry, IngestAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetryIngestion_IngestClient = grpc.BidiStreamingClient[Telemetry, IngestAck]
+
+// TelemetryIngestionServer is the server API for TelemetryIngestion service.
+// All implementations must embed UnimplementedTelemetryIngestionServer
+// for forward compatibility.
+//
+// TelemetryIngestion accepts telemetry from devices and gateways and
+// publishes it to the raw events topic.
+type TelemetryIngestionServer interface {
+	// Ingest streams telemetry to the processor, which answers each message
+	// with an IngestAck in the order received.
+	Ingest(grpc.BidiStreamingServer[Telemetry, IngestAck]) error
+	mustEmbedUnimplementedTelemetryIngestionServer()
+}
+
+// UnimplementedTelemetryIngestionServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTelemetryIngestionServer struct{}
+
+func (UnimplementedTelemetryIngestionServer) Ingest(grpc.BidiStreamingServer[Telemetry, IngestAck]) error {
+	return status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedTelemetryIngestionServer) mustEmbedUnimplementedTelemetryIngestionServer() {}
+func (UnimplementedTelemetryIngestionServer) testEmbeddedByValue()                            {}
+
+// UnsafeTelemetryIngestionServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TelemetryIngestionServer will
+// result in compilation errors.
+type UnsafeTelemetryIngestionServer interface {
+	mustEmbedUnimplementedTelemetryIngestionServer()
+}
+
+func RegisterTelemetryIngestionServer(s grpc.ServiceRegistrar, srv TelemetryIngestionServer) {
+	// If the following call pancis, it indicates UnimplementedTelemetryIngestionServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TelemetryIngestion_ServiceDesc, srv)
+}
+
+func _TelemetryIngestion_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TelemetryIngestionServer).Ingest(&grpc.GenericServerStream[Telemetry, IngestAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetryIngestion_IngestServer = grpc.BidiStreamingServer[Telemetry, IngestAck]
+
+// TelemetryIngestion_ServiceDesc is the grpc.ServiceDesc for TelemetryIngestion service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TelemetryIngestion_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "telemetry.TelemetryIngestion",
+	HandlerType: (*TelemetryIngestionServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Ingest",
+			Handler:       _TelemetryIngestion_Ingest_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "internal/proto/ingestion.proto",
+}
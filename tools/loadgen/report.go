@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// Chart dimensions of the HTML report, in SVG user units
+const (
+	chartWidth   = 800
+	chartHeight  = 300
+	chartPadding = 50
+)
+
+// TimedSample is the throughput and latency over one stats interval
+type TimedSample struct {
+	Timestamp      time.Time
+	RequestsPerSec float64
+	AvgLatency     time.Duration
+}
+
+// reportRow is one line of the summary table
+type reportRow struct {
+	Name  string
+	Value string
+}
+
+// reportData is what the HTML report template renders
+type reportData struct {
+	Generated  string
+	Rows       []reportRow
+	Samples    int
+	Points     string
+	MaxRate    string
+	Duration   string
+	ChartTop   int
+	ChartLeft  int
+	ChartRight int
+	ChartBase  int
+	Width      int
+	Height     int
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Load Test Report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.3em 1.5em 0.3em 0; border-bottom: 1px solid #ddd; }
+td { font-variant-numeric: tabular-nums; }
+.axis { stroke: #888; stroke-width: 1; }
+.line { fill: none; stroke: #2563eb; stroke-width: 2; }
+.label { font-size: 12px; fill: #555; }
+</style>
+</head>
+<body>
+<h1>Load Test Report</h1>
+<p>Generated {{.Generated}}</p>
+<table>
+<tr><th>Metric</th><th>Value</th></tr>
+{{- range .Rows}}
+<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+<h2>Throughput</h2>
+{{- if .Samples}}
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<line class="axis" x1="{{.ChartLeft}}" y1="{{.ChartTop}}" x2="{{.ChartLeft}}" y2="{{.ChartBase}}"/>
+<line class="axis" x1="{{.ChartLeft}}" y1="{{.ChartBase}}" x2="{{.ChartRight}}" y2="{{.ChartBase}}"/>
+<text class="label" x="{{.ChartLeft}}" y="{{.ChartTop}}" dx="-6" text-anchor="end">{{.MaxRate}}</text>
+<text class="label" x="{{.ChartLeft}}" y="{{.ChartBase}}" dx="-6" text-anchor="end">0</text>
+<text class="label" x="{{.ChartRight}}" y="{{.ChartBase}}" dy="18" text-anchor="end">{{.Duration}}</text>
+<text class="label" x="{{.ChartLeft}}" y="{{.ChartBase}}" dy="18">0s</text>
+<polyline class="line" points="{{.Points}}"/>
+</svg>
+<p>Requests per second, sampled every stats interval.</p>
+{{- else}}
+<p>No throughput samples were recorded.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// GenerateHTMLReport renders the final statistics and the throughput samples
+// as a self-contained HTML page
+func GenerateHTMLReport(stats Statistics, samples []TimedSample) ([]byte, error) {
+	data := reportData{
+		Generated:  time.Now().Format(time.RFC1123),
+		Samples:    len(samples),
+		ChartTop:   chartPadding / 2,
+		ChartLeft:  chartPadding,
+		ChartRight: chartWidth - chartPadding/2,
+		ChartBase:  chartHeight - chartPadding,
+		Width:      chartWidth,
+		Height:     chartHeight,
+		Rows: []reportRow{
+			{"Duration", stats.EndTime.Sub(stats.StartTime).String()},
+			{"Total Requests", fmt.Sprint(stats.TotalRequests)},
+			{"Successful Requests", fmt.Sprint(stats.SuccessRequests)},
+			{"Failed Requests", fmt.Sprint(stats.FailedRequests)},
+			{"Success Rate", fmt.Sprintf("%.2f%%", successRate(stats))},
+			{"Requests per Second", fmt.Sprintf("%.2f", stats.RequestsPerSec)},
+			{"Average Latency", stats.AvgLatency.String()},
+			{"Min Latency", stats.MinLatency.String()},
+			{"Max Latency", stats.MaxLatency.String()},
+			{"P50/P95/P99 Latency", fmt.Sprintf("%v / %v / %v", stats.P50Latency, stats.P95Latency, stats.P99Latency)},
+			{"Total Bytes Sent", fmt.Sprintf("%d (%.2f MB)", stats.BytesSent, float64(stats.BytesSent)/(1024*1024))},
+		},
+	}
+	if stats.E2EMessages > 0 {
+		data.Rows = append(data.Rows, reportRow{"E2E Latency", fmt.Sprintf("%v (%d messages)", stats.E2ELatency, stats.E2EMessages)})
+	}
+
+	if len(samples) > 0 {
+		maxRate := 0.0
+		for _, sample := range samples {
+			maxRate = max(maxRate, sample.RequestsPerSec)
+		}
+		if maxRate == 0 {
+			maxRate = 1
+		}
+
+		// Time runs from the first sample's interval start to the last sample
+		start := samples[0].Timestamp
+		if !stats.StartTime.IsZero() && stats.StartTime.Before(start) {
+			start = stats.StartTime
+		}
+		span := samples[len(samples)-1].Timestamp.Sub(start)
+		if span <= 0 {
+			span = time.Second
+		}
+
+		plotWidth := float64(data.ChartRight - data.ChartLeft)
+		plotHeight := float64(data.ChartBase - data.ChartTop)
+		points := make([]string, len(samples))
+		for i, sample := range samples {
+			x := float64(data.ChartLeft) + plotWidth*float64(sample.Timestamp.Sub(start))/float64(span)
+			y := float64(data.ChartBase) - plotHeight*sample.RequestsPerSec/maxRate
+			points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+		}
+
+		data.Points = strings.Join(points, " ")
+		data.MaxRate = fmt.Sprintf("%.0f req/s", maxRate)
+		data.Duration = span.Round(time.Second).String()
+	}
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
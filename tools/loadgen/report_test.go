@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateHTMLReport(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stats := Statistics{
+		TotalRequests:   300,
+		SuccessRequests: 297,
+		FailedRequests:  3,
+		StartTime:       start,
+		EndTime:         start.Add(15 * time.Second),
+		RequestsPerSec:  20,
+		AvgLatency:      12 * time.Millisecond,
+	}
+	samples := []TimedSample{
+		{Timestamp: start.Add(5 * time.Second), RequestsPerSec: 10, AvgLatency: 10 * time.Millisecond},
+		{Timestamp: start.Add(10 * time.Second), RequestsPerSec: 30, AvgLatency: 14 * time.Millisecond},
+		{Timestamp: start.Add(15 * time.Second), RequestsPerSec: 20, AvgLatency: 12 * time.Millisecond},
+	}
+
+	report, err := GenerateHTMLReport(stats, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(report)
+
+	for _, want := range []string{
+		"<td>Total Requests</td><td>300</td>",
+		"<td>Success Rate</td><td>99.00%</td>",
+		"<td>Average Latency</td><td>12ms</td>",
+		"30 req/s",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected report to contain %q", want)
+		}
+	}
+
+	// The busiest sample sits at the top of the chart, two thirds along
+	if !strings.Contains(html, `<polyline class="line" points="291.7,175.0 533.3,25.0 775.0,100.0"`) {
+		t.Errorf("unexpected throughput chart:\n%s", html)
+	}
+}
+
+func TestGenerateHTMLReport_NoSamples(t *testing.T) {
+	report, err := GenerateHTMLReport(Statistics{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(report)
+	if strings.Contains(html, "<svg") {
+		t.Error("expected no chart without samples")
+	}
+	if !strings.Contains(html, "No throughput samples were recorded.") {
+		t.Error("expected the report to say no samples were recorded")
+	}
+}
+
+func TestRecordSample_MeasuresEachInterval(t *testing.T) {
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:   "http://localhost",
+		Protocol:    ProtocolHTTP,
+		Rate:        100,
+		MetricTypes: []string{"temperature"},
+		HTTPTimeout: time.Second,
+		BatchSize:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	lg.startWarmup()
+	lg.warmupStats.RecordRequest(time.Millisecond, true, 10)
+	lg.recordSample()
+	if len(lg.samples) != 0 {
+		t.Fatalf("expected no samples during warm-up, got %d", len(lg.samples))
+	}
+	lg.endWarmup()
+
+	lg.stats.RecordRequest(10*time.Millisecond, true, 10)
+	lg.stats.RecordRequest(30*time.Millisecond, true, 10)
+	lg.recordSample()
+
+	lg.stats.RecordRequest(50*time.Millisecond, true, 10)
+	lg.recordSample()
+
+	if len(lg.samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(lg.samples))
+	}
+	if latency := lg.samples[0].AvgLatency; latency != 20*time.Millisecond {
+		t.Errorf("expected first interval latency 20ms, got %v", latency)
+	}
+	if latency := lg.samples[1].AvgLatency; latency != 50*time.Millisecond {
+		t.Errorf("expected second interval latency 50ms, got %v", latency)
+	}
+	for i, sample := range lg.samples {
+		if sample.RequestsPerSec <= 0 {
+			t.Errorf("expected positive throughput in sample %d, got %f", i, sample.RequestsPerSec)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ResponseValidator checks the body of a successful ingestion response.
+type ResponseValidator interface {
+	Validate(body []byte) error
+}
+
+// JSONFieldValidator accepts JSON object bodies that contain every one of
+// RequiredKeys at the top level.
+type JSONFieldValidator struct {
+	RequiredKeys []string
+}
+
+func (v JSONFieldValidator) Validate(body []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Errorf("response is not a JSON object: %w", err)
+	}
+
+	var missing []string
+	for _, key := range v.RequiredKeys {
+		if _, ok := fields[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("response is missing keys: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
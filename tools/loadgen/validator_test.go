@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJSONFieldValidator(t *testing.T) {
+	validator := JSONFieldValidator{RequiredKeys: []string{"temp", "device_id"}}
+
+	if err := validator.Validate([]byte(`{"temp": 21.5, "device_id": "device-1"}`)); err != nil {
+		t.Errorf("expected valid body, got %v", err)
+	}
+	if err := validator.Validate([]byte(`{"temp": 21.5}`)); err == nil {
+		t.Error("expected an error for a body missing device_id")
+	}
+	if err := validator.Validate([]byte(`[1, 2]`)); err == nil {
+		t.Error("expected an error for a body that is not an object")
+	}
+}
+
+func TestSendRequest_InvalidResponseCountsAsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"temp": 21.5}`))
+	}))
+	defer server.Close()
+
+	lg, err := NewLoadGenerator(Config{
+		TargetURL:        server.URL,
+		Protocol:         ProtocolHTTP,
+		Rate:             100,
+		MetricTypes:      []string{"temperature"},
+		HTTPTimeout:      time.Second,
+		BatchSize:        1,
+		ValidateResponse: true,
+		RequiredKeys:     []string{"temp", "device_id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.cancel()
+
+	if err := lg.sendRequest(lg.generateTelemetry("device-1")); err == nil {
+		t.Fatal("expected a validation error")
+	}
+
+	stats := lg.stats.GetStats()
+	if stats.FailedRequests != 1 || stats.SuccessRequests != 0 {
+		t.Errorf("expected 1 failed and 0 successful requests, got %d and %d", stats.FailedRequests, stats.SuccessRequests)
+	}
+	if stats.ValidationFailures != 1 {
+		t.Errorf("expected 1 validation failure, got %d", stats.ValidationFailures)
+	}
+}